@@ -0,0 +1,25 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+)
+
+// submit starts query through the Statement Execution API and prints its statement ID
+// on stdout, so the result can be collected later with "dbarrow fetch <id>".
+func submit(ctx context.Context, client *arrowfetch.Client, query string, opts *cliOptions) error {
+	if len(arrowfetch.SplitStatements(query)) > 1 {
+		return errors.New("submit runs a single statement; split the script or run it without submit")
+	}
+	id, err := client.Submit(ctx, query, opts.params.args()...)
+	if err != nil {
+		return err
+	}
+	fmt.Println(id)
+	slog.Info("statement submitted; collect the result with: dbarrow fetch <statement_id>", "statement_id", id)
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/dbauth"
+
+	"github.com/joho/godotenv"
+	"golang.org/x/term"
+)
+
+// runAuth implements the "auth login" and "auth logout" subcommands, which keep
+// access tokens in the OS keychain instead of a plaintext .env file.
+func runAuth(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: dbarrow auth login|logout [--host HOST]")
+	}
+	action, args := args[0], args[1:]
+
+	set := flag.NewFlagSet("dbarrow auth "+action, flag.ContinueOnError)
+	host := set.String("host", "", "workspace hostname (default $DATABRICKS_HOST)")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if set.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(set.Args(), " "))
+	}
+	if *host == "" {
+		*host = defaultHost()
+	}
+	if *host == "" {
+		return errors.New("missing workspace: pass --host or set DATABRICKS_HOST")
+	}
+
+	switch action {
+	case "login":
+		token, err := readToken(*host)
+		if err != nil {
+			return err
+		}
+		if err := dbauth.StoreToken(*host, token); err != nil {
+			return fmt.Errorf("unable to store the token in the keychain: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Token for %s stored in the keychain.\n", *host)
+	case "logout":
+		if err := dbauth.DeleteToken(*host); err != nil {
+			return fmt.Errorf("unable to remove the token for %s: %w", *host, err)
+		}
+		fmt.Fprintf(os.Stderr, "Token for %s removed from the keychain.\n", *host)
+	default:
+		return fmt.Errorf("unknown auth command %q, expected login or logout", action)
+	}
+	return nil
+}
+
+// defaultHost returns DATABRICKS_HOST from the environment or the .env file.
+func defaultHost() string {
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return ""
+	}
+	return os.Getenv("DATABRICKS_HOST")
+}
+
+// readToken reads the access token from the terminal without echoing it,
+// or as the first line of stdin when it is piped.
+func readToken(host string) (string, error) {
+	var token string
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		fmt.Fprintf(os.Stderr, "Access token for %s: ", host)
+		b, err := term.ReadPassword(int(os.Stdin.Fd()))
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		token = string(b)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			return "", fmt.Errorf("unable to read the token from stdin: %w", err)
+		}
+		token = line
+	}
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errors.New("empty access token")
+	}
+	return token, nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// batchJob is one job of a command running many side by side, such as a table of
+// export-all or a query of run-spec.
+type batchJob struct {
+	name string
+	out  string
+	run  func(ctx context.Context, stats *runStats) error
+}
+
+// batchResult is the outcome of one job, a line of the report at the end.
+type batchResult struct {
+	Name    string  `json:"name"`
+	Out     string  `json:"out"`
+	Rows    int64   `json:"rows"`
+	Bytes   int64   `json:"bytes"`
+	Seconds float64 `json:"seconds"`
+	Status  string  `json:"status"` // ok, error or interrupted
+	Error   string  `json:"error,omitempty"`
+}
+
+// runBatch runs the jobs, up to parallel at a time, adding the rows and bytes of each to
+// stats. A job that fails does not stop the others; once ctx is done the jobs not yet
+// started are marked interrupted. finished, if not nil, is called with the number of
+// jobs done after each one ends, never by two jobs at once.
+func runBatch(ctx context.Context, jobs []batchJob, parallel int, stats *runStats, finished func(done int)) []batchResult {
+	results := make([]batchResult, len(jobs))
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex // guards stats and done
+		done int
+		sem  = make(chan struct{}, parallel)
+	)
+	for i, job := range jobs {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+		if ctx.Err() != nil {
+			results[i] = batchResult{Name: job.name, Out: job.out, Status: "interrupted"}
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			var jobStats runStats
+			results[i] = runBatchJob(ctx, job, &jobStats)
+			mu.Lock()
+			defer mu.Unlock()
+			stats.rows += jobStats.rows
+			stats.bytes += jobStats.bytes
+			done++
+			if finished != nil {
+				finished(done)
+			}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// runBatchJob runs one job and times it.
+func runBatchJob(ctx context.Context, job batchJob, stats *runStats) batchResult {
+	r := batchResult{Name: job.name, Out: job.out, Status: "ok"}
+	start := time.Now()
+	err := job.run(ctx, stats)
+	r.Rows, r.Bytes, r.Seconds = stats.rows, stats.bytes, time.Since(start).Seconds()
+	switch {
+	case ctx.Err() != nil:
+		r.Status = "interrupted"
+	case err != nil:
+		r.Status, r.Error = "error", err.Error()
+		slog.Error("failed", "name", job.name, "err", err)
+	}
+	return r
+}
+
+// batchError returns an error listing the jobs that failed, if any. items names the
+// jobs in the message, e.g. "tables".
+func batchError(results []batchResult, items string) error {
+	var errs []error
+	for _, r := range results {
+		if r.Status == "error" {
+			errs = append(errs, fmt.Errorf("%s: %s", r.Name, r.Error))
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%d of %d %s failed: %w", len(errs), len(results), items, errors.Join(errs...))
+	}
+	return nil
+}
+
+// writeBatchReport writes the outcome of every job and the totals, as a table or, with
+// --summary json, as JSON. item and items name a job and the jobs, e.g. "table" and
+// "tables", in the header and the totals, and items is the key of the JSON list.
+func writeBatchReport(w io.Writer, results []batchResult, item, items, format string) error {
+	if format == "json" {
+		return json.NewEncoder(w).Encode(map[string]any{items: results})
+	}
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "%s\tSTATUS\tROWS\tBYTES\tSECONDS\tOUT\tERROR\n", strings.ToUpper(item))
+	var rows, bytes int64
+	ok := 0
+	for _, r := range results {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.1f\t%s\t%s\n", r.Name, r.Status, r.Rows, r.Bytes, r.Seconds, r.Out, r.Error)
+		rows += r.Rows
+		bytes += r.Bytes
+		if r.Status == "ok" {
+			ok++
+		}
+	}
+	fmt.Fprintf(tw, "%d/%d %s\t\t%d\t%d\t\t\t\n", ok, len(results), items, rows, bytes)
+	return tw.Flush()
+}
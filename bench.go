@@ -0,0 +1,153 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime"
+	"slices"
+	"text/tabwriter"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// benchRun is one measured read of the whole result.
+type benchRun struct {
+	rows       int64
+	elapsed    time.Duration
+	allocs     uint64 // heap objects allocated
+	allocBytes uint64
+}
+
+// benchPath is one way of reading a result.
+type benchPath struct {
+	name string
+	read func(ctx context.Context) (int64, error)
+	runs []benchRun
+}
+
+// runBench reads the result of query --bench-runs times as Arrow batches and as rows
+// scanned through database/sql, and prints the median time and allocations of each. The
+// paths take turns going first, so warm-up and caching favour neither of them.
+func runBench(ctx context.Context, client *arrowfetch.Client, query string, opts *cliOptions) error {
+	if len(arrowfetch.SplitStatements(query)) > 1 {
+		return errors.New("bench runs a single statement")
+	}
+	args := opts.params.args()
+	paths := []*benchPath{
+		{name: "arrow", read: func(ctx context.Context) (int64, error) {
+			var rows int64
+			err := client.Fetch(ctx, query, func(rec arrow.Record) error {
+				rows += rec.NumRows()
+				return nil
+			}, args...)
+			return rows, err
+		}},
+		{name: "rows.Scan", read: func(ctx context.Context) (int64, error) {
+			return scanRows(ctx, client, query, args)
+		}},
+	}
+
+	for run := 1; run <= opts.benchRuns; run++ {
+		order := slices.Clone(paths)
+		if run%2 == 0 {
+			slices.Reverse(order)
+		}
+		for _, p := range order {
+			r, err := measure(ctx, p.read)
+			if err != nil {
+				return fmt.Errorf("%s, run %d: %w", p.name, run, err)
+			}
+			slog.Info("bench run", "path", p.name, "run", run, "rows", r.rows, "elapsed", r.elapsed.Round(time.Millisecond))
+			p.runs = append(p.runs, r)
+		}
+	}
+	return writeBench(os.Stdout, paths)
+}
+
+// scanRows reads the result row by row, scanning every value into a Go value as a
+// typical database/sql program does.
+func scanRows(ctx context.Context, client *arrowfetch.Client, query string, args []any) (int64, error) {
+	rows, err := client.DB().QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.Columns()
+	if err != nil {
+		return 0, err
+	}
+	values := make([]any, len(cols))
+	dest := make([]any, len(cols))
+	for i := range values {
+		dest[i] = &values[i]
+	}
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(dest...); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, rows.Err()
+}
+
+// measure times read and counts the heap allocations of the whole process meanwhile,
+// which includes the driver's background fetching.
+func measure(ctx context.Context, read func(context.Context) (int64, error)) (benchRun, error) {
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	rows, err := read(ctx)
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return benchRun{
+		rows:       rows,
+		elapsed:    elapsed,
+		allocs:     after.Mallocs - before.Mallocs,
+		allocBytes: after.TotalAlloc - before.TotalAlloc,
+	}, err
+}
+
+// median returns the run with the median time.
+func (p *benchPath) median() benchRun {
+	runs := slices.Clone(p.runs)
+	slices.SortFunc(runs, func(a, b benchRun) int { return cmp.Compare(a.elapsed, b.elapsed) })
+	return runs[len(runs)/2]
+}
+
+// writeBench prints the median run of each path and how the Arrow path compares.
+func writeBench(w io.Writer, paths []*benchPath) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PATH\tROWS\tTIME\tROWS/S\tALLOCS\tALLOCATED\tALLOCS/ROW")
+	medians := make([]benchRun, len(paths))
+	for i, p := range paths {
+		m := p.median()
+		medians[i] = m
+		perRow := 0.0
+		if m.rows > 0 {
+			perRow = float64(m.allocs) / float64(m.rows)
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%.0f\t%d\t%s\t%.1f\n",
+			p.name, m.rows, m.elapsed.Round(time.Millisecond), float64(m.rows)/m.elapsed.Seconds(), m.allocs, formatBytes(int64(m.allocBytes)), perRow)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	arrowRun, scanRun := medians[0], medians[1]
+	if arrowRun.rows != scanRun.rows {
+		slog.Warn("the paths read different row counts; is the result changing?", "arrow", arrowRun.rows, "scan", scanRun.rows)
+	}
+	_, err := fmt.Fprintf(w, "\narrow is %.1fx as fast with %.1fx fewer allocations (median of %d runs)\n",
+		scanRun.elapsed.Seconds()/arrowRun.elapsed.Seconds(), float64(scanRun.allocs)/float64(max(arrowRun.allocs, 1)), len(paths[0].runs))
+	return err
+}
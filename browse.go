@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// browseQuery returns the query of the catalog browsing commands: the information_schema
+// query of "catalogs", "schemas <catalog>" or "tables <catalog.schema>", or the DESCRIBE
+// TABLE of "describe <table>" and the SHOW CREATE TABLE of "ddl <table>". The result
+// goes through the same pipeline as any query, so every --format, --filter and --sink
+// applies to it.
+func browseQuery(command, namespace string) (string, error) {
+	switch command {
+	case "catalogs":
+		return "SELECT catalog_name, catalog_owner, comment, created, last_altered\n" +
+			"FROM system.information_schema.catalogs\n" +
+			"ORDER BY catalog_name", nil
+	case "schemas":
+		return "SELECT schema_name, schema_owner, comment, created, last_altered\n" +
+			"FROM " + quoteIdent(namespace) + ".information_schema.schemata\n" +
+			"ORDER BY schema_name", nil
+	case "tables":
+		catalog, schema, _ := strings.Cut(namespace, ".")
+		return "SELECT table_name, table_type, table_owner, data_source_format, comment, created, last_altered\n" +
+			"FROM " + quoteIdent(catalog) + ".information_schema.tables\n" +
+			"WHERE table_schema = " + arrowfetch.QuoteString(schema) + "\n" +
+			"ORDER BY table_name", nil
+	case "describe":
+		return "DESCRIBE TABLE " + namespace, nil
+	case "ddl":
+		return "SHOW CREATE TABLE " + namespace, nil
+	}
+	return "", fmt.Errorf("unknown command %q", command)
+}
+
+// parseBrowse reads the argument of a catalog browsing command from args, returning
+// the remaining flags.
+func parseBrowse(opts *cliOptions, args []string) ([]string, error) {
+	opts.browse, args = args[0], args[1:]
+	if opts.browse == "catalogs" {
+		return args, nil
+	}
+	usage := map[string]string{
+		"schemas":  "usage: dbarrow schemas <catalog> [flags]",
+		"tables":   "usage: dbarrow tables <catalog.schema> [flags]",
+		"describe": "usage: dbarrow describe <table> [flags]",
+		"ddl":      "usage: dbarrow ddl <table> [--dialect postgres|duckdb|sqlite] [flags]",
+	}[opts.browse]
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return nil, errors.New(usage)
+	}
+	opts.namespace, args = args[0], args[1:]
+	if opts.browse == "describe" || opts.browse == "ddl" {
+		// The name is passed on as written, so it may be qualified and quoted.
+		return args, nil
+	}
+	catalog, schema, dotted := strings.Cut(opts.namespace, ".")
+	switch {
+	case catalog == "":
+		return nil, errors.New(usage)
+	case opts.browse == "schemas" && dotted:
+		return nil, fmt.Errorf("%s is not a catalog name; list its tables with: dbarrow tables %s", opts.namespace, opts.namespace)
+	case opts.browse == "tables" && (schema == "" || strings.Contains(schema, ".")):
+		return nil, errors.New(usage)
+	}
+	return args, nil
+}
+
+// quoteIdent returns name as a quoted SQL identifier.
+func quoteIdent(name string) string {
+	return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+}
+
+// describeRow is one row of DESCRIBE TABLE.
+type describeRow struct {
+	ColName  string
+	DataType string
+	Comment  *string
+}
+
+// describeTable runs the DESCRIBE TABLE query and writes one row per column of the
+// table: its name, Databricks type, the Arrow type the driver returns for it, its
+// position in the partitioning of the table and its comment.
+func describeTable(ctx context.Context, client *arrowfetch.Client, query string, opts *cliOptions, stats *runStats) error {
+	var rows []describeRow
+	err := client.Fetch(ctx, query, func(rec arrow.Record) error {
+		batch, err := arrowfetch.Scan[describeRow](rec)
+		rows = append(rows, batch...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// The columns come first, then sections headed by a "# ..." row, such as the
+	// partition columns under "# Partition Information" and their own "# col_name" header.
+	var columns []describeRow
+	partitions := map[string]int{}
+	section := ""
+	for _, r := range rows {
+		name := strings.TrimSpace(r.ColName)
+		switch {
+		case strings.HasPrefix(name, "#"):
+			if name != "# col_name" {
+				section = name
+			}
+		case name == "":
+			section = "end"
+		case section == "":
+			columns = append(columns, r)
+		case section == "# Partition Information":
+			partitions[strings.ToLower(name)] = len(partitions)
+		}
+	}
+
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "column", Type: arrow.BinaryTypes.String},
+		{Name: "sql_type", Type: arrow.BinaryTypes.String},
+		{Name: "arrow_type", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "partition", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		{Name: "comment", Type: arrow.BinaryTypes.String, Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	for _, c := range columns {
+		b.Field(0).(*array.StringBuilder).Append(c.ColName)
+		b.Field(1).(*array.StringBuilder).Append(c.DataType)
+		if dt, err := arrowfetch.ParseSQLType(c.DataType); err == nil {
+			b.Field(2).(*array.StringBuilder).Append(dt.String())
+		} else {
+			b.Field(2).AppendNull()
+		}
+		if i, ok := partitions[strings.ToLower(c.ColName)]; ok {
+			b.Field(3).(*array.Int32Builder).Append(int32(i))
+		} else {
+			b.Field(3).AppendNull()
+		}
+		if c.Comment != nil && *c.Comment != "" {
+			b.Field(4).(*array.StringBuilder).Append(*c.Comment)
+		} else {
+			b.Field(4).AppendNull()
+		}
+	}
+	rec := b.NewRecord()
+	defer rec.Release()
+	source := pipeline.SourceFunc(func(_ context.Context, fn func(arrow.Record) error) error {
+		return fn(rec)
+	})
+	return writeResult(ctx, client, opts, 0, source, stats)
+}
+
+// printDDL writes the CREATE TABLE statement of a table to --out: the one SHOW CREATE
+// TABLE returns, or with --dialect one for Postgres, DuckDB or SQLite with the columns
+// of the table and the types the sinks write them as.
+func printDDL(ctx context.Context, client *arrowfetch.Client, table, query string, opts *cliOptions) error {
+	var ddl string
+	if opts.dialect == "" {
+		var rows []struct{ CreatetabStmt string }
+		err := client.Fetch(ctx, query, func(rec arrow.Record) error {
+			batch, err := arrowfetch.Scan[struct{ CreatetabStmt string }](rec)
+			rows = append(rows, batch...)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return fmt.Errorf("SHOW CREATE TABLE returned nothing for %s", table)
+		}
+		ddl = strings.TrimSpace(rows[0].CreatetabStmt) + "\n"
+	} else {
+		schema, err := client.Schema(ctx, "SELECT * FROM "+table)
+		if err != nil {
+			return err
+		}
+		_, name := splitTableName(table)
+		if ddl, err = sink.CreateTableSQL(opts.dialect, name, schema); err != nil {
+			return err
+		}
+	}
+
+	out, err := openOutput(opts.out, 0, opts.uploadOptions())
+	if err != nil {
+		return err
+	}
+	_, err = io.WriteString(out, ddl)
+	return finish(out, err)
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+)
+
+// downloads counts the cloud fetch result files the process downloaded and their bytes.
+var downloads struct {
+	files, bytes atomic.Int64
+}
+
+// setupDownloadClient sets the transport of http.DefaultClient, which the driver downloads
+// cloud fetch result links with and which no option of arrowfetch.New reaches. It is
+// the only place the process changes it, and it is called once, so the downloads go
+// through a single trace transport: counted for the summary with --cloud-fetch, and
+// logged with every other round trip with --debug. host is the workspace, whose
+// requests are not downloads.
+func setupDownloadClient(host string, count, debug bool) {
+	if !count && !debug {
+		return
+	}
+	http.DefaultClient.Transport = arrowfetch.NewTraceTransport(http.DefaultTransport, host, func(rt arrowfetch.RoundTrip) {
+		if count && rt.Kind == "download" && rt.Err == nil {
+			downloads.files.Add(1)
+			downloads.bytes.Add(rt.Bytes)
+		}
+		if debug {
+			logRoundTrip(rt)
+		}
+	})
+}
+
+// downloadCount is a reading of the download counters.
+type downloadCount struct {
+	files, bytes int64
+}
+
+// countDownloads reads the download counters.
+func countDownloads() downloadCount {
+	return downloadCount{files: downloads.files.Load(), bytes: downloads.bytes.Load()}
+}
+
+// since returns the downloads made after the reading from.
+func (c downloadCount) since(from downloadCount) downloadCount {
+	return downloadCount{files: c.files - from.files, bytes: c.bytes - from.bytes}
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// compressExtensions are the file extensions of the --compress codecs.
+var compressExtensions = map[string]string{"gzip": ".gz", "zstd": ".zst"}
+
+// compressedOutput compresses the bytes written to it into out. Closing it writes the
+// end of the compressed stream before out is closed.
+type compressedOutput struct {
+	enc io.WriteCloser
+	out io.WriteCloser
+}
+
+// compressOutput wraps out so everything written is compressed with codec, gzip or
+// zstd. It works the same for files, stdout and uploads, as it only writes to out.
+func compressOutput(out io.WriteCloser, codec string) (io.WriteCloser, error) {
+	var enc io.WriteCloser
+	switch codec {
+	case "gzip":
+		enc = gzip.NewWriter(out)
+	case "zstd":
+		zw, err := zstd.NewWriter(out)
+		if err != nil {
+			return nil, err
+		}
+		enc = zw
+	default:
+		return nil, fmt.Errorf("unsupported --compress %q, expected gzip, zstd or none", codec)
+	}
+	return &compressedOutput{enc: enc, out: out}, nil
+}
+
+func (c *compressedOutput) Write(p []byte) (int, error) {
+	return c.enc.Write(p)
+}
+
+func (c *compressedOutput) Close() error {
+	return finish(c.out, c.enc.Close())
+}
+
+// Abort discards the output if it supports it, such as an upload, without finishing
+// the compressed stream.
+func (c *compressedOutput) Abort(err error) {
+	finish(c.out, err)
+}
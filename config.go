@@ -0,0 +1,314 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/dbauth"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of the dbarrow config file (~/.dbarrow/config.yaml).
+type fileConfig struct {
+	DefaultProfile string             `yaml:"default_profile"`
+	Profiles       map[string]profile `yaml:"profiles"`
+
+	// Queries are saved SQL templates run with "dbarrow run <name>".
+	Queries map[string]string `yaml:"queries"`
+
+	// Jobs are the exports "dbarrow schedule" runs on their cron schedules.
+	Jobs map[string]scheduleJob `yaml:"jobs"`
+}
+
+// profile holds the connection settings of one named warehouse.
+// Values may reference environment variables as $VAR or ${VAR}.
+type profile struct {
+	Host     string `yaml:"host"`
+	HTTPPath string `yaml:"http_path"`
+	Port     int    `yaml:"port"`
+	Auth     string `yaml:"auth"`
+	Token    string `yaml:"token"`
+
+	// TokenCommand prints a fresh token when run; it is re-run before the token expires.
+	TokenCommand string `yaml:"token_command"`
+
+	// Service principal credentials for m2m authentication.
+	ClientID     string `yaml:"client_id"`
+	ClientSecret string `yaml:"client_secret"`
+
+	// Azure AD identity for azure-client-secret and azure-msi authentication.
+	AzureTenantID     string `yaml:"azure_tenant_id"`
+	AzureClientID     string `yaml:"azure_client_id"`
+	AzureClientSecret string `yaml:"azure_client_secret"`
+
+	// Initial namespace for unqualified table names and Spark SQL session parameters.
+	Catalog       string            `yaml:"catalog"`
+	Schema        string            `yaml:"schema"`
+	SessionParams map[string]string `yaml:"session_params"`
+
+	// Connection pool limits for embedding the client in long-running services.
+	Pool poolConfig `yaml:"pool"`
+}
+
+// poolConfig is the pool section of a profile. Zero values keep the database/sql defaults.
+type poolConfig struct {
+	MaxOpenConns    int           `yaml:"max_open_conns"`
+	MaxIdleConns    int           `yaml:"max_idle_conns"`
+	ConnMaxLifetime time.Duration `yaml:"conn_max_lifetime"`
+	ConnMaxIdleTime time.Duration `yaml:"conn_max_idle_time"`
+}
+
+// defaultConfigPath returns the location of the config file in the user's home directory.
+func defaultConfigPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".dbarrow", "config.yaml")
+}
+
+// loadConfigFile reads and parses the config file at path.
+// A missing file yields an empty config so the .env fallback keeps working.
+func loadConfigFile(path string) (*fileConfig, error) {
+	cfg := &fileConfig{}
+	if path == "" {
+		return cfg, nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return cfg, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read config file: %w", err)
+	}
+	if err := yaml.Unmarshal(data, cfg); err != nil {
+		return nil, fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// resolveProfile picks the connection settings to use.
+// An explicit --profile wins, then the config file's default_profile, then
+// DATABRICKS_CONFIG_PROFILE, and finally the DATABRICKS_* variables from the
+// environment or .env file. Profile names are looked up in the dbarrow config
+// first and in the Databricks CLI's ~/.databrickscfg second.
+func resolveProfile(opts *cliOptions) (profile, error) {
+	// Load environment variables from .env file (containing Databricks credentials), if present.
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return profile{}, fmt.Errorf("unable to load .env file: %w", err)
+	}
+
+	cfg, err := loadConfigFile(opts.configPath)
+	if err != nil {
+		return profile{}, err
+	}
+
+	name := opts.profile
+	if name == "" {
+		name = cfg.DefaultProfile
+	}
+	if name == "" && os.Getenv("DATABRICKS_CONFIG_PROFILE") == "" {
+		return envProfile(opts.auth)
+	}
+
+	// Profiles from our own config file win over sections of ~/.databrickscfg with the same name.
+	p, ok := cfg.Profiles[name]
+	if ok {
+		p.Host = os.ExpandEnv(p.Host)
+		p.HTTPPath = os.ExpandEnv(p.HTTPPath)
+		p.Token = os.ExpandEnv(p.Token)
+		p.TokenCommand = os.ExpandEnv(p.TokenCommand)
+		p.ClientID = os.ExpandEnv(p.ClientID)
+		p.ClientSecret = os.ExpandEnv(p.ClientSecret)
+		p.AzureTenantID = os.ExpandEnv(p.AzureTenantID)
+		p.AzureClientID = os.ExpandEnv(p.AzureClientID)
+		p.AzureClientSecret = os.ExpandEnv(p.AzureClientSecret)
+		p.Catalog = os.ExpandEnv(p.Catalog)
+		p.Schema = os.ExpandEnv(p.Schema)
+	} else {
+		if name == "" {
+			name = os.Getenv("DATABRICKS_CONFIG_PROFILE")
+		}
+		cliPath := databricksCfgPath()
+		sections, err := loadDatabricksCfg(cliPath)
+		if err != nil {
+			return profile{}, err
+		}
+		section, ok := sections[name]
+		if !ok {
+			return profile{}, fmt.Errorf("profile %q not found in %s or %s", name, opts.configPath, cliPath)
+		}
+		p = databricksCfgProfile(section)
+	}
+	if opts.auth != "" {
+		p.Auth = opts.auth
+	}
+	p.useStoredToken()
+	return p, p.validate()
+}
+
+// envProfile builds the connection settings from the DATABRICKS_* environment variables.
+func envProfile(authMethod string) (profile, error) {
+	p := profile{
+		Host:     os.Getenv("DATABRICKS_HOST"),
+		HTTPPath: os.Getenv("DATABRICKS_HTTP_PATH"),
+		Auth:     authMethod,
+		Token:    os.Getenv("DATABRICKS_ACCESS_TOKEN"),
+
+		TokenCommand: os.Getenv("DATABRICKS_TOKEN_COMMAND"),
+
+		ClientID:     os.Getenv("DATABRICKS_CLIENT_ID"),
+		ClientSecret: os.Getenv("DATABRICKS_CLIENT_SECRET"),
+
+		AzureTenantID:     firstEnv("ARM_TENANT_ID", "AZURE_TENANT_ID"),
+		AzureClientID:     firstEnv("ARM_CLIENT_ID", "AZURE_CLIENT_ID"),
+		AzureClientSecret: firstEnv("ARM_CLIENT_SECRET", "AZURE_CLIENT_SECRET"),
+	}
+	p.useStoredToken()
+	return p, p.validate()
+}
+
+// firstEnv returns the value of the first environment variable that is set.
+func firstEnv(names ...string) string {
+	for _, name := range names {
+		if v := os.Getenv(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// useStoredToken fills in the token saved with "dbarrow auth login" when token
+// authentication is used and no token or token command was configured.
+func (p *profile) useStoredToken() {
+	if (p.Auth != "" && p.Auth != "pat") || p.Token != "" || p.TokenCommand != "" || p.Host == "" {
+		return
+	}
+	// A missing entry or an unavailable keychain just leaves the token empty.
+	if token, err := dbauth.StoredToken(p.Host); err == nil {
+		p.Token = token
+	}
+}
+
+// overrideSession applies the --catalog, --schema and --session-param flags on top of
+// the profile's session settings.
+func (p *profile) overrideSession(opts *cliOptions) {
+	if opts.catalog != "" {
+		p.Catalog = opts.catalog
+	}
+	if opts.schema != "" {
+		p.Schema = opts.schema
+	}
+	if len(opts.sessionParams) > 0 {
+		params := make(map[string]string, len(p.SessionParams)+len(opts.sessionParams))
+		for k, v := range p.SessionParams {
+			params[k] = v
+		}
+		for k, v := range opts.sessionParams {
+			params[k] = v
+		}
+		p.SessionParams = params
+	}
+}
+
+// validate checks that the profile carries enough settings to connect.
+func (p profile) validate() error {
+	if p.Host == "" || p.HTTPPath == "" {
+		return errors.New("missing connection settings: set DATABRICKS_HOST and DATABRICKS_HTTP_PATH or select a --profile")
+	}
+	if p.Pool.MaxOpenConns < 0 || p.Pool.MaxIdleConns < 0 || p.Pool.ConnMaxLifetime < 0 || p.Pool.ConnMaxIdleTime < 0 {
+		return errors.New("pool settings must not be negative")
+	}
+	switch p.Auth {
+	case "", "pat":
+		if p.Token == "" && p.TokenCommand == "" {
+			return errors.New("missing access token for pat authentication: set a token or token_command, or run dbarrow auth login")
+		}
+	case "u2m":
+		// The browser login needs no stored credentials.
+	case "m2m":
+		if p.ClientID == "" || p.ClientSecret == "" {
+			return errors.New("missing client_id or client_secret for m2m authentication")
+		}
+	case "azure-client-secret":
+		if p.AzureTenantID == "" || p.AzureClientID == "" || p.AzureClientSecret == "" {
+			return errors.New("missing azure_tenant_id, azure_client_id or azure_client_secret for azure-client-secret authentication")
+		}
+	case "azure-msi":
+		// The managed identity is provided by the Azure host; azure_client_id is optional.
+	default:
+		return fmt.Errorf("unsupported auth method %q", p.Auth)
+	}
+	return nil
+}
+
+// clientOptions converts the profile into arrowfetch options, running the
+// authentication flow selected by the profile.
+func (p profile) clientOptions() ([]arrowfetch.Option, error) {
+	port := p.Port
+	if port == 0 {
+		port = 443
+	}
+	opts := []arrowfetch.Option{
+		arrowfetch.WithHost(p.Host),
+		arrowfetch.WithPort(port),
+		arrowfetch.WithHTTPPath(p.HTTPPath),
+		arrowfetch.WithPool(arrowfetch.PoolOptions(p.Pool)),
+		arrowfetch.WithInitialNamespace(p.Catalog, p.Schema),
+		arrowfetch.WithSessionParams(p.SessionParams),
+	}
+
+	switch p.Auth {
+	case "u2m":
+		a, err := dbauth.NewU2M(context.Background(), p.Host, dbauth.NewFileCache(tokenCachePath()))
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, arrowfetch.WithAuthenticator(a))
+	case "m2m":
+		a, err := dbauth.NewM2M(context.Background(), p.Host, p.ClientID, p.ClientSecret)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, arrowfetch.WithAuthenticator(a))
+	case "azure-client-secret", "azure-msi":
+		creds := dbauth.AzureCredentials{TenantID: p.AzureTenantID, ClientID: p.AzureClientID}
+		if p.Auth == "azure-client-secret" {
+			creds.ClientSecret = p.AzureClientSecret
+		}
+		a, err := dbauth.NewAzureAD(context.Background(), creds)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, arrowfetch.WithAuthenticator(a))
+	default:
+		if p.TokenCommand != "" {
+			// Tokens from the command are renewed before they expire during long exports.
+			src := dbauth.NewRefresher(context.Background(), dbauth.NewCommandProvider(p.TokenCommand), dbauth.RefreshMargin)
+			if _, err := src.Token(); err != nil {
+				return nil, err
+			}
+			opts = append(opts, arrowfetch.WithAuthenticator(src))
+		} else {
+			opts = append(opts, arrowfetch.WithAccessToken(p.Token))
+		}
+	}
+	return opts, nil
+}
+
+// tokenCachePath returns the file where OAuth tokens are cached between runs.
+func tokenCachePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "dbarrow-token-cache.json")
+	}
+	return filepath.Join(home, ".dbarrow", "token-cache.json")
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+)
+
+// countQuery returns the query counting the rows of query's result.
+func countQuery(query string) string {
+	return fmt.Sprintf("SELECT COUNT(*) AS count FROM (\n%s\n) AS dbarrow_count", query)
+}
+
+// countRows runs the query for --count-only, rewritten to count the rows of its result,
+// and writes the count to --out. Only the count comes back from the warehouse, so it
+// tells the size of an export before committing to the full fetch. SHOW, DESCRIBE,
+// EXPLAIN and LIST cannot be nested in the count, so their rows are fetched and
+// counted here; their results are small.
+func countRows(ctx context.Context, client *arrowfetch.Client, statements []string, opts *cliOptions) error {
+	if len(statements) != 1 {
+		return errors.New("--count-only counts the rows of a single query")
+	}
+	if !arrowfetch.ReturnsRows(statements[0]) {
+		return errors.New("--count-only counts the rows of a query, such as SELECT, not of a statement changing data")
+	}
+	start := time.Now()
+	var (
+		count int64
+		err   error
+	)
+	if arrowfetch.IsSubquery(statements[0]) {
+		count, err = fetchCount(ctx, client, countQuery(statements[0]), opts.params.args()...)
+	} else {
+		err = client.Fetch(ctx, statements[0], func(rec arrow.Record) error {
+			count += rec.NumRows()
+			return nil
+		}, opts.params.args()...)
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("counted rows", "rows", count, "elapsed", time.Since(start).Round(time.Millisecond))
+
+	out, err := openOutput(opts.out, 0, opts.uploadOptions())
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(out, count)
+	return finish(out, err)
+}
+
+// fetchCount runs query, a SELECT COUNT(*), and returns the count.
+func fetchCount(ctx context.Context, client *arrowfetch.Client, query string, args ...any) (int64, error) {
+	var count int64
+	found := false
+	err := client.Fetch(ctx, query, func(rec arrow.Record) error {
+		if rec.NumRows() == 0 {
+			return nil
+		}
+		col, ok := rec.Column(0).(*array.Int64)
+		if !ok {
+			return fmt.Errorf("COUNT(*) returned a %s column, expected bigint", rec.Column(0).DataType())
+		}
+		count, found = col.Value(0), true
+		return nil
+	}, args...)
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, errors.New("COUNT(*) returned no row")
+	}
+	return count, nil
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Wednesday.
+	from := time.Date(2026, 10, 14, 10, 17, 30, 0, time.UTC)
+	for _, tc := range []struct {
+		expr string
+		want string
+	}{
+		{"* * * * *", "2026-10-14 10:18"},
+		{"*/15 * * * *", "2026-10-14 10:30"},
+		{"5 10 * * *", "2026-10-15 10:05"},
+		{"@daily", "2026-10-15 00:00"},
+		{"@hourly", "2026-10-14 11:00"},
+		{"0 6 * * mon-fri", "2026-10-15 06:00"},
+		{"0 6 * * sat,sun", "2026-10-17 06:00"},
+		{"0 0 * * 7", "2026-10-18 00:00"},
+		{"0 0 1 * *", "2026-11-01 00:00"},
+		{"30 2 1 jan *", "2027-01-01 02:30"},
+		{"0 12 29 2 *", "2028-02-29 12:00"},
+		// Both day fields restricted: either matches.
+		{"0 0 20 * fri", "2026-10-16 00:00"},
+		{"0 8-18/4 * * *", "2026-10-14 12:00"},
+	} {
+		c, err := parseCron(tc.expr)
+		if err != nil {
+			t.Errorf("%s: %v", tc.expr, err)
+			continue
+		}
+		if got := c.next(from).Format("2006-01-02 15:04"); got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.expr, got, tc.want)
+		}
+	}
+}
+
+func TestCronInvalid(t *testing.T) {
+	for _, expr := range []string{"", "* * * *", "60 * * * *", "* * * 13 *", "*/0 * * * *", "5-1 * * * *", "0 0 30 2 *", "@sometimes"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("%q parsed, want an error", expr)
+		}
+	}
+}
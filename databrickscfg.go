@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// databricksCfgPath returns the Databricks CLI config file, honouring DATABRICKS_CONFIG_FILE.
+func databricksCfgPath() string {
+	if path := os.Getenv("DATABRICKS_CONFIG_FILE"); path != "" {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".databrickscfg")
+}
+
+// loadDatabricksCfg parses the INI sections of a Databricks CLI config file.
+// A missing file yields no sections.
+func loadDatabricksCfg(path string) (map[string]map[string]string, error) {
+	sections := map[string]map[string]string{}
+	if path == "" {
+		return sections, nil
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return sections, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	defer f.Close()
+
+	// Keys before the first section header belong to DEFAULT, as in the Databricks CLI.
+	current := "DEFAULT"
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			current = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s:%d: expected key = value", path, n)
+		}
+		if sections[current] == nil {
+			sections[current] = map[string]string{}
+		}
+		sections[current][strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(value)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("unable to read %s: %w", path, err)
+	}
+	return sections, nil
+}
+
+// databricksCfgProfile converts a section of ~/.databrickscfg into connection settings.
+// The CLI file usually has no warehouse, so the HTTP path comes from http_path, from
+// warehouse_id, or from DATABRICKS_HTTP_PATH.
+func databricksCfgProfile(section map[string]string) profile {
+	p := profile{
+		Host:              strings.TrimSuffix(strings.TrimPrefix(section["host"], "https://"), "/"),
+		HTTPPath:          section["http_path"],
+		Token:             section["token"],
+		TokenCommand:      section["token_command"],
+		ClientID:          section["client_id"],
+		ClientSecret:      section["client_secret"],
+		AzureTenantID:     section["azure_tenant_id"],
+		AzureClientID:     section["azure_client_id"],
+		AzureClientSecret: section["azure_client_secret"],
+	}
+	if p.HTTPPath == "" && section["warehouse_id"] != "" {
+		p.HTTPPath = "/sql/1.0/warehouses/" + section["warehouse_id"]
+	}
+	if p.HTTPPath == "" {
+		p.HTTPPath = os.Getenv("DATABRICKS_HTTP_PATH")
+	}
+
+	// Map the CLI's auth_type names onto ours; without one, infer it from the credentials.
+	switch authType := section["auth_type"]; authType {
+	case "":
+		switch {
+		case p.Token != "" || p.TokenCommand != "":
+			p.Auth = "pat"
+		case p.ClientID != "" && p.ClientSecret != "":
+			p.Auth = "m2m"
+		case p.AzureClientSecret != "":
+			p.Auth = "azure-client-secret"
+		}
+	case "oauth-m2m":
+		p.Auth = "m2m"
+	case "databricks-cli", "external-browser", "oauth-u2m":
+		p.Auth = "u2m"
+	default:
+		p.Auth = authType
+	}
+	return p
+}
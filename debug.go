@@ -0,0 +1,43 @@
+package main
+
+import (
+	"log/slog"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/databricks/databricks-sql-go/logger"
+	"github.com/rs/zerolog"
+)
+
+// setupDebug turns on the dbsql driver's own logger at the debug level for --debug,
+// which reports the sessions, operations and cloud fetch links it handles. The driver
+// writes to logOutput as well, as console lines for --log-format text and as its JSON
+// records otherwise. The HTTP round trips are logged by logRoundTrip.
+func setupDebug(format string) {
+	if format == "json" {
+		logger.SetLogOutput(logOutput)
+	} else {
+		logger.SetLogOutput(zerolog.ConsoleWriter{Out: logOutput, NoColor: true, TimeFormat: time.RFC3339})
+	}
+	_ = logger.SetLogLevel("debug") // a level the driver knows
+}
+
+// logRoundTrip logs an HTTP request of the driver, the REST API or a cloud fetch
+// download at the debug level. Presigned links are logged without their signature.
+func logRoundTrip(rt arrowfetch.RoundTrip) {
+	attrs := []any{
+		"kind", rt.Kind,
+		"method", rt.Method,
+		"host", rt.Host,
+		"path", rt.Path,
+		"status", rt.Status,
+		"bytes", rt.Bytes,
+		"header", rt.Header.Round(time.Millisecond),
+		"elapsed", rt.Duration.Round(time.Millisecond),
+	}
+	if rt.Err != nil {
+		attrs = append(attrs, "err", rt.Err)
+	}
+	slog.Debug("http", attrs...)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"slices"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// errResultsDiffer fails a diff that found differences, as diff(1) exits with 1.
+var errResultsDiffer = errors.New("the results differ")
+
+// parseDiff reads the arguments of "diff [<table> <version> [<version>]]" from args,
+// returning the remaining flags.
+func parseDiff(opts *cliOptions, args []string) ([]string, error) {
+	opts.command, args = "diff", args[1:]
+	var positional []string
+	for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		positional, args = append(positional, args[0]), args[1:]
+	}
+	switch len(positional) {
+	case 0:
+	case 2, 3:
+		opts.diffTable, opts.diffVersions = positional[0], positional[1:]
+	default:
+		return nil, errors.New("usage: dbarrow diff --key <columns> --query <sql> --against <sql> [flags]\n" +
+			"       dbarrow diff <table> <version or timestamp> [<version or timestamp>] --key <columns> [flags]")
+	}
+	return args, nil
+}
+
+// versionQuery returns the query reading table as of version, a version number or a
+// timestamp, or as it is now for an empty version.
+func versionQuery(table, version string) string {
+	switch {
+	case version == "":
+		return "SELECT * FROM " + table
+	case strings.Trim(version, "0123456789") == "":
+		return fmt.Sprintf("SELECT * FROM %s VERSION AS OF %s", table, version)
+	}
+	return fmt.Sprintf("SELECT * FROM %s TIMESTAMP AS OF %s", table, arrowfetch.QuoteString(version))
+}
+
+// diffSide is one result of a diff, its batches concatenated so any row can be reached.
+type diffSide struct {
+	schema *arrow.Schema
+	cols   []arrow.Array
+	rows   int
+	keys   map[string]int // row of every key
+	order  []string       // keys in result order
+}
+
+// runDiff runs query and the query it is compared with, --against or the second table
+// version, and writes the differences compareResults finds between the results aligned
+// on --key. Both results are held in memory, within the table limit of FetchTable. The
+// run fails with errResultsDiffer once the differences are written, so scripts can
+// check it.
+func runDiff(ctx context.Context, client *arrowfetch.Client, query string, opts *cliOptions, stats *runStats) error {
+	against := opts.against
+	if opts.diffTable != "" {
+		// A single version is compared with the table as it is now.
+		against = versionQuery(opts.diffTable, "")
+		if len(opts.diffVersions) == 2 {
+			against = versionQuery(opts.diffTable, opts.diffVersions[1])
+		}
+	}
+	args := opts.params.args()
+	before, err := fetchDiffSide(ctx, client, query, opts.diffKey, args)
+	if err != nil {
+		return fmt.Errorf("first result: %w", err)
+	}
+	defer before.release()
+	after, err := fetchDiffSide(ctx, client, against, opts.diffKey, args)
+	if err != nil {
+		return fmt.Errorf("second result: %w", err)
+	}
+	defer after.release()
+
+	rec, counts := compareResults(before, after, opts.diffKey)
+	defer rec.Release()
+	slog.Info("diff", "added", counts.added, "removed", counts.removed, "changed", counts.changed, "unchanged", counts.unchanged)
+
+	source := pipeline.SourceFunc(func(_ context.Context, fn func(arrow.Record) error) error {
+		return fn(rec)
+	})
+	if err := writeResult(ctx, client, opts, 0, source, stats); err != nil {
+		return err
+	}
+	if counts.added+counts.removed+counts.changed > 0 {
+		return errResultsDiffer
+	}
+	return nil
+}
+
+// diffCounts are the rows of a diff by outcome.
+type diffCounts struct {
+	added, removed, changed, unchanged int
+}
+
+// compareResults returns one row for every difference between before and after:
+// "removed" for a key only in before, "added" for one only in after, and "changed" for
+// every column whose value differs, with the value before and after. Values of the same
+// type are compared as Arrow arrays, so e.g. 1.0 and 1.00 of a double are equal; a
+// decimal and a double are compared as numbers, and other types as written at full
+// precision. Columns found in one result only are logged and not compared.
+func compareResults(before, after *diffSide, key []string) (arrow.Record, diffCounts) {
+	// Compare the columns the results share, in the order of the first. An empty result
+	// without columns shares them all.
+	type columnPair struct {
+		name          string
+		before, after arrow.Array
+	}
+	var pairs []columnPair
+	if before.cols != nil && after.cols != nil {
+		var onlyBefore, onlyAfter []string
+		for i, f := range before.schema.Fields() {
+			switch j := after.schema.FieldIndices(f.Name); {
+			case len(j) == 0:
+				onlyBefore = append(onlyBefore, f.Name)
+			case !slices.Contains(key, f.Name):
+				pairs = append(pairs, columnPair{f.Name, before.cols[i], after.cols[j[0]]})
+			}
+		}
+		for _, f := range after.schema.Fields() {
+			if !before.schema.HasField(f.Name) {
+				onlyAfter = append(onlyAfter, f.Name)
+			}
+		}
+		if len(onlyBefore) > 0 || len(onlyAfter) > 0 {
+			slog.Warn("columns not compared", "only_first", strings.Join(onlyBefore, ","), "only_second", strings.Join(onlyAfter, ","))
+		}
+	}
+
+	fields := []arrow.Field{{Name: "change", Type: arrow.BinaryTypes.String}}
+	for _, k := range key {
+		fields = append(fields, arrow.Field{Name: k, Type: arrow.BinaryTypes.String, Nullable: true})
+	}
+	fields = append(fields,
+		arrow.Field{Name: "column", Type: arrow.BinaryTypes.String, Nullable: true},
+		arrow.Field{Name: "before", Type: arrow.BinaryTypes.String, Nullable: true},
+		arrow.Field{Name: "after", Type: arrow.BinaryTypes.String, Nullable: true},
+	)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema(fields, nil))
+	defer b.Release()
+	n := len(key)
+	appendChange := func(change string, side *diffSide, row int, column string, from, to *string) {
+		b.Field(0).(*array.StringBuilder).Append(change)
+		for i, k := range key {
+			appendValue(b.Field(1+i).(*array.StringBuilder), side.column(k), row)
+		}
+		if column == "" {
+			b.Field(n + 1).AppendNull()
+		} else {
+			b.Field(n + 1).(*array.StringBuilder).Append(column)
+		}
+		for i, v := range []*string{from, to} {
+			if v == nil {
+				b.Field(n + 2 + i).AppendNull()
+			} else {
+				b.Field(n + 2 + i).(*array.StringBuilder).Append(*v)
+			}
+		}
+	}
+
+	var counts diffCounts
+	for _, k := range before.order {
+		i := before.keys[k]
+		j, ok := after.keys[k]
+		if !ok {
+			appendChange("removed", before, i, "", nil, nil)
+			counts.removed++
+			continue
+		}
+		differs := false
+		for _, p := range pairs {
+			if valuesEqual(p.before, i, p.after, j) {
+				continue
+			}
+			appendChange("changed", before, i, p.name, textValue(p.before, i), textValue(p.after, j))
+			differs = true
+		}
+		if differs {
+			counts.changed++
+		} else {
+			counts.unchanged++
+		}
+	}
+	for _, k := range after.order {
+		if _, ok := before.keys[k]; !ok {
+			appendChange("added", after, after.keys[k], "", nil, nil)
+			counts.added++
+		}
+	}
+	return b.NewRecord(), counts
+}
+
+// fetchDiffSide runs query and indexes its rows by the key columns, which must be
+// unique. An empty result may come without columns, and then has no rows to index.
+func fetchDiffSide(ctx context.Context, client *arrowfetch.Client, query string, key []string, args []any) (*diffSide, error) {
+	table, err := client.FetchTable(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer table.Release()
+
+	s := &diffSide{schema: table.Schema(), rows: int(table.NumRows()), keys: map[string]int{}}
+	if table.NumCols() == 0 {
+		return s, nil
+	}
+	for i := 0; i < int(table.NumCols()); i++ {
+		col, err := concatenate(table.Column(i), table.Schema().Field(i).Type)
+		if err != nil {
+			s.release()
+			return nil, err
+		}
+		s.cols = append(s.cols, col)
+	}
+	keyCols := make([]arrow.Array, len(key))
+	for i, k := range key {
+		if keyCols[i] = s.column(k); keyCols[i] == nil {
+			s.release()
+			return nil, fmt.Errorf("the result has no key column %s", k)
+		}
+	}
+	var b strings.Builder
+	for row := 0; row < s.rows; row++ {
+		b.Reset()
+		for _, col := range keyCols {
+			// A separator no written value contains keeps ("a b", "c") apart from ("a", "b c").
+			if col.IsNull(row) {
+				b.WriteString("\x00")
+			} else {
+				b.WriteString(sink.TextValue(col, row))
+			}
+			b.WriteString("\x1f")
+		}
+		k := b.String()
+		if _, dup := s.keys[k]; dup {
+			s.release()
+			return nil, fmt.Errorf("key %s is not unique", strings.ReplaceAll(strings.TrimSuffix(k, "\x1f"), "\x1f", ", "))
+		}
+		s.keys[k] = row
+		s.order = append(s.order, k)
+	}
+	return s, nil
+}
+
+// concatenate joins the chunks of a table column into one array.
+func concatenate(col *arrow.Column, dt arrow.DataType) (arrow.Array, error) {
+	chunks := col.Data().Chunks()
+	if len(chunks) == 0 {
+		return array.MakeArrayOfNull(memory.DefaultAllocator, dt, 0), nil
+	}
+	return array.Concatenate(chunks, memory.DefaultAllocator)
+}
+
+// release releases the columns of the result.
+func (s *diffSide) release() {
+	for _, col := range s.cols {
+		col.Release()
+	}
+}
+
+// column returns the column named name, or nil.
+func (s *diffSide) column(name string) arrow.Array {
+	if i := s.schema.FieldIndices(name); len(i) > 0 {
+		return s.cols[i[0]]
+	}
+	return nil
+}
+
+// valuesEqual compares row i of a with row j of b: as Arrow values when the columns
+// have the same type, as numbers when both are numeric, and as written otherwise.
+func valuesEqual(a arrow.Array, i int, b arrow.Array, j int) bool {
+	if arrow.TypeEqual(a.DataType(), b.DataType()) {
+		return array.SliceEqual(a, int64(i), int64(i+1), b, int64(j), int64(j+1))
+	}
+	ta, tb := textValue(a, i), textValue(b, j)
+	if ta == nil || tb == nil {
+		return ta == nil && tb == nil
+	}
+	if arrow.IsFloating(a.DataType().ID()) || arrow.IsFloating(b.DataType().ID()) || arrow.IsDecimal(a.DataType().ID()) || arrow.IsDecimal(b.DataType().ID()) {
+		ra, oka := new(big.Rat).SetString(*ta)
+		rb, okb := new(big.Rat).SetString(*tb)
+		if oka && okb {
+			return ra.Cmp(rb) == 0
+		}
+	}
+	return *ta == *tb
+}
+
+// textValue returns the value at row i of col as the text formats write it, at full
+// precision, or nil for NULL.
+func textValue(col arrow.Array, i int) *string {
+	if col.IsNull(i) {
+		return nil
+	}
+	v := sink.TextValue(col, i)
+	return &v
+}
+
+// appendValue appends the value at row i of col to b as text.
+func appendValue(b *array.StringBuilder, col arrow.Array, i int) {
+	if v := textValue(col, i); v != nil {
+		b.Append(*v)
+	} else {
+		b.AppendNull()
+	}
+}
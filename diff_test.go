@@ -0,0 +1,160 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// diffRecord returns a batch with an id column and the given double columns.
+func diffRecord(ids []int64, cols map[string][]float64) arrow.Record {
+	fields := []arrow.Field{{Name: "id", Type: arrow.PrimitiveTypes.Int64}}
+	names := []string{"amount", "fee"}
+	for _, name := range names {
+		if _, ok := cols[name]; ok {
+			fields = append(fields, arrow.Field{Name: name, Type: arrow.PrimitiveTypes.Float64})
+		}
+	}
+	b := array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema(fields, nil))
+	defer b.Release()
+	b.Field(0).(*array.Int64Builder).AppendValues(ids, nil)
+	for i, f := range fields[1:] {
+		b.Field(1+i).(*array.Float64Builder).AppendValues(cols[f.Name], nil)
+	}
+	return b.NewRecord()
+}
+
+// diffClient returns a client answering each query with its batch in results.
+func diffClient(t *testing.T, results map[string]arrow.Record) *arrowfetch.Client {
+	t.Helper()
+	client, err := arrowfetchtest.NewClient(func(query string, _ []driver.NamedValue) ([]arrow.Record, error) {
+		rec, ok := results[query]
+		if !ok {
+			return nil, fmt.Errorf("unexpected query %q", query)
+		}
+		return []arrow.Record{rec}, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		client.Close()
+		for _, rec := range results {
+			rec.Release()
+		}
+	})
+	return client
+}
+
+// diffRows runs the diff of queries a and b on key and returns its rows as text.
+func diffRows(t *testing.T, client *arrowfetch.Client, a, b string, key []string) ([]string, diffCounts) {
+	t.Helper()
+	ctx := context.Background()
+	before, err := fetchDiffSide(ctx, client, a, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer before.release()
+	after, err := fetchDiffSide(ctx, client, b, key, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer after.release()
+	rec, counts := compareResults(before, after, key)
+	defer rec.Release()
+	var rows []string
+	for i := 0; i < int(rec.NumRows()); i++ {
+		var row []string
+		for _, col := range rec.Columns() {
+			row = append(row, col.ValueStr(i))
+		}
+		rows = append(rows, strings.Join(row, " "))
+	}
+	return rows, counts
+}
+
+func TestDiff(t *testing.T) {
+	client := diffClient(t, map[string]arrow.Record{
+		"a": diffRecord([]int64{1, 2, 3}, map[string][]float64{"amount": {1.001, 2, 3}, "fee": {0, 0, 0}}),
+		"b": diffRecord([]int64{4, 3, 1}, map[string][]float64{"amount": {4, 3, 1.004}, "fee": {0, 0, 0.5}}),
+	})
+	rows, counts := diffRows(t, client, "a", "b", []string{"id"})
+	want := []string{
+		"changed 1 amount 1.001 1.004",
+		"changed 1 fee 0 0.5",
+		"removed 2 (null) (null) (null)",
+		"added 4 (null) (null) (null)",
+	}
+	if strings.Join(rows, "\n") != strings.Join(want, "\n") {
+		t.Errorf("got rows\n%s\nwant\n%s", strings.Join(rows, "\n"), strings.Join(want, "\n"))
+	}
+	if counts != (diffCounts{added: 1, removed: 1, changed: 1, unchanged: 1}) {
+		t.Errorf("got counts %+v", counts)
+	}
+}
+
+func TestDiffFloatKeys(t *testing.T) {
+	// Keys that only differ past the second decimal are still distinct.
+	client := diffClient(t, map[string]arrow.Record{
+		"a": diffRecord([]int64{1, 2}, map[string][]float64{"amount": {1.001, 1.004}}),
+		"b": diffRecord([]int64{1, 2}, map[string][]float64{"amount": {1.001, 1.004}}),
+	})
+	rows, counts := diffRows(t, client, "a", "b", []string{"amount"})
+	if len(rows) != 0 || counts.unchanged != 2 {
+		t.Errorf("got rows %q and counts %+v, want 2 unchanged rows", rows, counts)
+	}
+}
+
+func TestDiffDuplicateKey(t *testing.T) {
+	client := diffClient(t, map[string]arrow.Record{
+		"a": diffRecord([]int64{1, 2, 1}, map[string][]float64{"amount": {1, 2, 3}}),
+	})
+	_, err := fetchDiffSide(context.Background(), client, "a", []string{"id"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "key 1 is not unique") {
+		t.Errorf("got error %v, want key 1 is not unique", err)
+	}
+}
+
+func TestDiffColumnsInOneResult(t *testing.T) {
+	// fee is only in the first result and amount only in the second, so neither is
+	// compared and the rows match on their key alone.
+	client := diffClient(t, map[string]arrow.Record{
+		"a": diffRecord([]int64{1, 2}, map[string][]float64{"fee": {1, 2}}),
+		"b": diffRecord([]int64{1, 2}, map[string][]float64{"amount": {3, 4}}),
+	})
+	rows, counts := diffRows(t, client, "a", "b", []string{"id"})
+	if len(rows) != 0 || counts.unchanged != 2 {
+		t.Errorf("got rows %q and counts %+v, want 2 unchanged rows", rows, counts)
+	}
+}
+
+func TestValuesEqualAcrossTypes(t *testing.T) {
+	db := array.NewFloat64Builder(memory.DefaultAllocator)
+	defer db.Release()
+	db.AppendValues([]float64{1.004, 1}, nil)
+	doubles := db.NewArray()
+	defer doubles.Release()
+
+	dt := &arrow.Decimal128Type{Precision: 10, Scale: 2}
+	decimals, _, err := array.FromJSON(memory.DefaultAllocator, dt, strings.NewReader(`["1.00"]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decimals.Release()
+
+	if valuesEqual(decimals, 0, doubles, 0) {
+		t.Error("decimal 1.00 equals double 1.004")
+	}
+	if !valuesEqual(decimals, 0, doubles, 1) {
+		t.Error("decimal 1.00 differs from double 1")
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+)
+
+// explainPlan writes the plan of the query to --out, as EXPLAIN FORMATTED, EXPLAIN COST
+// or EXPLAIN EXTENDED returns it for --explain, without running the query. The
+// warehouse returns the plan as one text value, whose lines are written with their
+// trailing blanks removed.
+func explainPlan(ctx context.Context, client *arrowfetch.Client, statements []string, opts *cliOptions) error {
+	if len(statements) != 1 {
+		return errors.New("--explain describes a single statement")
+	}
+	var plan strings.Builder
+	err := client.Fetch(ctx, "EXPLAIN "+strings.ToUpper(string(opts.explain))+" "+statements[0], func(rec arrow.Record) error {
+		if rec.NumCols() == 0 {
+			return nil
+		}
+		col, ok := rec.Column(0).(*array.String)
+		if !ok {
+			return fmt.Errorf("EXPLAIN returned a %s column, expected a string", rec.Column(0).DataType())
+		}
+		for i := 0; i < col.Len(); i++ {
+			plan.WriteString(col.Value(i))
+		}
+		return nil
+	}, opts.params.args()...)
+	if err != nil {
+		return err
+	}
+	if plan.Len() == 0 {
+		return errors.New("EXPLAIN returned no plan")
+	}
+
+	out, err := openOutput(opts.out, 0, opts.uploadOptions())
+	if err != nil {
+		return err
+	}
+	var text strings.Builder
+	for _, line := range strings.Split(strings.TrimSpace(plan.String()), "\n") {
+		text.WriteString(strings.TrimRight(line, " \t\r"))
+		text.WriteByte('\n')
+	}
+	_, err = out.Write([]byte(text.String()))
+	return finish(out, err)
+}
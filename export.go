@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// exportAll runs "export-all": every table named on the command line, or matched by a
+// pattern such as samples.nyctaxi.*, is read with SELECT * and written to its own
+// destination: the --out or --sink with {table} replaced by the name of the table and
+// {schema} by the name of its schema.
+// Up to --table-concurrency tables are exported at once. A table that fails does not
+// stop the others; the report at the end lists the outcome of each.
+func exportAll(ctx context.Context, client *arrowfetch.Client, opts *cliOptions, stats *runStats) error {
+	tables, err := expandTables(ctx, client, opts.exportTables)
+	if err != nil {
+		return err
+	}
+	if len(tables) == 0 {
+		return fmt.Errorf("no table matches %s", strings.Join(opts.exportTables, " "))
+	}
+	slog.Info("exporting tables", "tables", len(tables), "concurrency", opts.tableConcurrency)
+
+	jobs := make([]batchJob, len(tables))
+	for i, table := range tables {
+		jobs[i] = exportJob(client, opts, table)
+	}
+	results := runBatch(ctx, jobs, opts.tableConcurrency, stats, nil)
+	if err := writeBatchReport(os.Stderr, results, "table", "tables", opts.summary); err != nil {
+		slog.Warn("unable to write the export report", "err", err)
+	}
+	return batchError(results, "tables")
+}
+
+// exportJob returns the job writing the rows of one table to its destination.
+func exportJob(client *arrowfetch.Client, opts *cliOptions, table string) batchJob {
+	qualifier, name := splitTableName(table)
+	_, schema := splitTableName(qualifier)
+	o := *opts
+	names := strings.NewReplacer("{table}", name, "{schema}", schema)
+	o.out, o.sink, o.manifest = names.Replace(opts.out), names.Replace(opts.sink), names.Replace(opts.manifest)
+	if opts.tableConcurrency > 1 {
+		// Progress lines of tables exported side by side would overwrite each other.
+		o.progress = "never"
+	}
+	out := o.out
+	if o.sink != "" {
+		out = o.sink
+	}
+	return batchJob{name: table, out: out, run: func(ctx context.Context, stats *runStats) error {
+		slog.Info("exporting", "table", table, "out", out)
+		return writeResult(ctx, client, &o, 0, pipeline.Query(client, "SELECT * FROM "+table), stats)
+	}}
+}
+
+// expandTables resolves the table arguments of export-all. A name whose last part holds
+// * or ? is a pattern over the tables of its schema, listed with SHOW TABLES; other
+// names are taken as they are. Temporary views are left out, and a table matched twice
+// is exported once.
+func expandTables(ctx context.Context, client *arrowfetch.Client, args []string) ([]string, error) {
+	var tables []string
+	seen := map[string]bool{}
+	add := func(t string) {
+		if !seen[strings.ToLower(t)] {
+			seen[strings.ToLower(t)] = true
+			tables = append(tables, t)
+		}
+	}
+	for _, arg := range args {
+		schema, pattern := splitTableName(arg)
+		if !strings.ContainsAny(pattern, "*?[") {
+			add(arg)
+			continue
+		}
+		if schema == "" {
+			return nil, fmt.Errorf("%s: a pattern must name its schema, e.g. samples.nyctaxi.*", arg)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid table pattern %s: %w", arg, err)
+		}
+		type shownTable struct {
+			TableName   string
+			IsTemporary bool
+		}
+		var names []string
+		err := client.Fetch(ctx, "SHOW TABLES IN "+schema, func(rec arrow.Record) error {
+			rows, err := arrowfetch.Scan[shownTable](rec)
+			for _, t := range rows {
+				if ok, _ := path.Match(strings.ToLower(pattern), strings.ToLower(t.TableName)); ok && !t.IsTemporary {
+					names = append(names, t.TableName)
+				}
+			}
+			return err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the tables of %s: %w", schema, err)
+		}
+		slog.Info("tables matched", "pattern", arg, "tables", len(names))
+		for _, name := range names {
+			add(schema + "." + quoteIdent(name))
+		}
+	}
+	return tables, nil
+}
+
+// splitTableName splits a table name into its qualifying catalog and schema, if any,
+// and its last part without quotes.
+func splitTableName(table string) (schema, name string) {
+	if i := strings.LastIndex(table, "."); i >= 0 {
+		schema, table = table[:i], table[i+1:]
+	}
+	return schema, strings.Trim(table, "`")
+}
@@ -0,0 +1,1100 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/remote"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"golang.org/x/term"
+)
+
+// defaultQuery is run when neither --query nor --query-file is given.
+const defaultQuery = `SELECT * FROM samples.nyctaxi.trips`
+
+// cliOptions holds the settings parsed from the command line.
+type cliOptions struct {
+	// command is "submit" or "fetch" for the asynchronous commands, "repl", "tui",
+	// "bench", "serve", "schedule", "run-spec", "export-all" or "diff", empty to run the
+	// query.
+	command     string
+	statementID string
+
+	// serve is the protocol of "serve <protocol>" ("flight", "flight-sql", "grpc" or
+	// "http"), listening on listen. The limits apply to every HTTP request; allowOrigins
+	// are the browser origins besides the server's own that may open its WebSocket.
+	serve          string
+	listen         string
+	requestTimeout time.Duration
+	requestMaxRows int64
+	maxConcurrent  int
+	allowOrigins   []string
+
+	// benchRuns is the number of times bench reads the result by each path.
+	benchRuns int
+
+	// diff compares the query with against, or diffTable as of the first of diffVersions
+	// with the second or its current version, aligning rows on the diffKey columns.
+	against      string
+	diffTable    string
+	diffVersions []string
+	diffKey      []string
+
+	// specFile is the run spec of "run-spec", whose queries run parallel at a time.
+	specFile string
+	parallel int
+
+	// rerun is the history entry re-run by "history run <n>", 0 otherwise.
+	rerun     int
+	noHistory bool
+
+	// exportTables are the tables, or patterns such as samples.nyctaxi.*, exported by
+	// "export-all", tableConcurrency of them at a time.
+	exportTables     []string
+	tableConcurrency int
+
+	// ingestFiles are the local files "ingest" uploads to the volume directory
+	// ingestVolume, and loads into the table ingestTable with COPY INTO when it is set.
+	ingestFiles   []string
+	ingestVolume  string
+	ingestTable   string
+	fileFormat    string
+	formatOptions keyValues
+	copyOptions   keyValues
+	removeStaged  bool
+
+	// stagingDir is the local directory PUT and GET statements may read and write in.
+	stagingDir string
+
+	// browse is the catalog browsing command, "catalogs", "schemas", "tables", "describe"
+	// or "ddl", whose query lists the contents of namespace (a catalog, catalog.schema or
+	// table). dialect is the database "ddl" translates the table's schema for.
+	browse    string
+	namespace string
+	dialect   string
+
+	// savedQuery is the config file query run by "run <name>", filled from vars.
+	savedQuery string
+	vars       keyValues
+
+	query      string
+	queryFile  string
+	params     queryParams
+	results    string
+	profile    string
+	auth       string
+	configPath string
+	format     string
+	columns    []string
+	filter     string
+
+	// head stops after this many rows and sample keeps this fraction of them (0 for all).
+	head   int64
+	sample float64
+
+	// incremental fetches only the rows whose watermarkColumn is above the value recorded
+	// in stateFile, or every row with fullRefresh, and records the new highest value.
+	incremental     bool
+	watermarkColumn string
+	stateFile       string
+	fullRefresh     bool
+
+	// keysetColumn splits the query into pages of pageSize rows ordered by this column,
+	// each starting after the last key of the page before.
+	keysetColumn string
+	pageSize     int64
+
+	// postSQL is a DuckDB query over the fetched rows, read from the table "result".
+	postSQL string
+
+	// aggregations and groupBy are parsed from --aggregate.
+	aggregations []sink.Aggregation
+	groupBy      []string
+	out          string
+	sink         string
+	proxy        string
+
+	// Session settings overriding the profile's.
+	catalog       string
+	schema        string
+	sessionParams keyValues
+
+	// TLS settings for the connection to the warehouse.
+	caCert     string
+	clientCert string
+	clientKey  string
+
+	// Time limits for running the statement and for reading its result (0 for none).
+	queryTimeout time.Duration
+	fetchTimeout time.Duration
+
+	// workers encodes batches on this many goroutines, keeping their order unless
+	// workerOrder is "unordered".
+	workers     int
+	workerOrder string
+
+	// prefetch is the number of batches fetched ahead of the writer.
+	prefetch int
+
+	// fetchBatchSize is the most rows fetched per round trip, which bounds the rows of a
+	// batch.
+	fetchBatchSize int
+
+	// cloudFetch lets the warehouse return large results as cloud storage files, which
+	// are downloaded on downloadThreads goroutines.
+	cloudFetch      bool
+	downloadThreads int
+
+	// mode is how results are read: "arrow" batches, or "rows" through database/sql.
+	mode string
+
+	// memoryLimit caps the MiB held in result batches (0 for no limit).
+	memoryLimit int64
+
+	// summary prints the end-of-run performance summary as "text" log lines or "json",
+	// with the warehouse's own timings when warehouseMetrics is set.
+	summary          string
+	warehouseMetrics bool
+
+	// Diagnostics on stderr: the minimum slog level and "text" or "json" records.
+	logLevel  string
+	logFormat string
+
+	// debug logs the driver's activity and every HTTP round trip, at the debug level.
+	debug bool
+
+	// otlpEndpoint receives the OpenTelemetry spans of the run (empty for the
+	// OTEL_EXPORTER_OTLP_* environment, or none).
+	otlpEndpoint string
+
+	// metricsAddr serves Prometheus metrics at /metrics on this address (empty for none).
+	metricsAddr string
+
+	// pprof is the address serving the runtime profiles, e.g. :6060 (empty for none).
+	pprof string
+
+	// progress draws a live progress line on stderr: "auto" when it is a terminal,
+	// "always" or "never".
+	progress string
+
+	// Retry settings for transient query and fetch failures.
+	retryAttempts int
+	retryBackoff  time.Duration
+
+	// schemaOnly prints the result schema as "text" or "json" instead of fetching rows.
+	schemaOnly schemaMode
+
+	// countOnly prints the number of rows of the result instead of fetching them.
+	countOnly bool
+
+	// explain prints the plan of the query, "formatted", "cost" or "extended", instead
+	// of running it.
+	explain explainMode
+
+	// watch re-runs the query at this interval until interrupted, 0 to run it once.
+	// highlight is set by each run on a terminal to mark the table values that changed
+	// since the previous one.
+	watch     time.Duration
+	highlight func(row int64, column, value string) bool
+
+	// stats reports column statistics on stderr: "summary" at the end, or "batch" for
+	// every batch as well.
+	stats statsMode
+
+	// Display settings for the human-readable formats.
+	maxColWidth    int
+	maxRowsDisplay int64
+
+	// binaryEncoding is how the text formats write BINARY values: hex, base64 or raw.
+	binaryEncoding string
+
+	// casts convert columns to other types before they are written, from --cast.
+	casts []sink.CastRule
+
+	// nullString is how the text formats write NULL values, or nil for the default of
+	// each format: NULL in tables, an empty field in CSV and null in JSON.
+	nullString *string
+
+	// partitionBy are the columns whose values split the output into the directories
+	// of --out, from --partition-by.
+	partitionBy []string
+
+	// maxOpenPartitions is the most partition files open at once (0 for no limit).
+	maxOpenPartitions int
+
+	// maxRowsPerFile and maxFileSize (MiB) roll the output over numbered files (0 for
+	// no limit).
+	maxRowsPerFile int64
+	maxFileSize    int64
+
+	// compress is the codec compressing the csv and ndjson output, gzip or zstd, or
+	// empty for none.
+	compress string
+
+	// manifest is the path of the JSON manifest listing the files written, from
+	// --manifest.
+	manifest string
+
+	// timezone is the zone timestamps are rendered in, or "" for the zone of each column.
+	timezone string
+
+	// Upload settings for object store destinations.
+	uploadPartSize    int64
+	uploadConcurrency int
+
+	// Parquet output settings.
+	compression      string
+	rowGroupSize     int64
+	dataPageSize     int64 // KiB
+	dictionary       *bool
+	columnDictionary map[string]bool
+	parquetVersion   string
+	dataPageVersion  int
+}
+
+// keyValues collects repeated KEY=VALUE flags.
+type keyValues map[string]string
+
+func (kv *keyValues) String() string {
+	pairs := make([]string, 0, len(*kv))
+	for k, v := range *kv {
+		pairs = append(pairs, k+"="+v)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (kv *keyValues) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(k) == "" {
+		return fmt.Errorf("expected KEY=VALUE, got %q", s)
+	}
+	if *kv == nil {
+		*kv = keyValues{}
+	}
+	(*kv)[strings.TrimSpace(k)] = v
+	return nil
+}
+
+// schemaMode is the --schema-only flag: given alone it selects the text output, and
+// --schema-only=json selects JSON.
+type schemaMode string
+
+func (m *schemaMode) String() string { return string(*m) }
+
+func (m *schemaMode) Set(s string) error {
+	switch s {
+	case "true", "text":
+		*m = "text"
+	case "json":
+		*m = "json"
+	case "false":
+		*m = ""
+	default:
+		return fmt.Errorf("expected text or json, got %q", s)
+	}
+	return nil
+}
+
+// IsBoolFlag lets --schema-only be given without a value.
+func (m *schemaMode) IsBoolFlag() bool { return true }
+
+// explainMode is the --explain flag: given alone it selects EXPLAIN FORMATTED, and
+// --explain=cost or --explain=extended the other plans.
+type explainMode string
+
+func (m *explainMode) String() string { return string(*m) }
+
+func (m *explainMode) Set(s string) error {
+	switch s {
+	case "true", "formatted":
+		*m = "formatted"
+	case "cost", "extended":
+		*m = explainMode(s)
+	case "false":
+		*m = ""
+	default:
+		return fmt.Errorf("expected formatted, cost or extended, got %q", s)
+	}
+	return nil
+}
+
+// IsBoolFlag lets --explain be given without a value.
+func (m *explainMode) IsBoolFlag() bool { return true }
+
+// statsMode is the --stats flag: given alone it selects the end-of-run summary, and
+// --stats=batch adds a table for every batch.
+type statsMode string
+
+func (m *statsMode) String() string { return string(*m) }
+
+func (m *statsMode) Set(s string) error {
+	switch s {
+	case "true", "summary":
+		*m = "summary"
+	case "batch":
+		*m = "batch"
+	case "false":
+		*m = ""
+	default:
+		return fmt.Errorf("expected summary or batch, got %q", s)
+	}
+	return nil
+}
+
+// IsBoolFlag lets --stats be given without a value.
+func (m *statsMode) IsBoolFlag() bool { return true }
+
+// parseFlags parses the command line arguments into cliOptions. A leading command word
+// selects another mode: "submit", "fetch <statement-id>", "repl", "tui", "bench",
+// "export-all <table>...", "ingest <file>...", "serve flight|flight-sql|grpc|http", "schedule",
+// "run-spec <file>", "run <saved-query>", "history run <n>", "diff [<table> <version> [<version>]]", "catalogs",
+// "schemas <catalog>", "tables <catalog.schema>", "describe <table>" or "ddl <table>".
+func parseFlags(args []string) (*cliOptions, error) {
+	opts := &cliOptions{}
+
+	switch {
+	case len(args) > 0 && args[0] == "submit":
+		opts.command, args = "submit", args[1:]
+	case len(args) > 0 && args[0] == "fetch":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return nil, errors.New("usage: dbarrow fetch <statement-id> [flags]")
+		}
+		opts.command, opts.statementID, args = "fetch", args[1], args[2:]
+	case len(args) > 0 && args[0] == "repl":
+		opts.command, args = "repl", args[1:]
+	case len(args) > 0 && args[0] == "tui":
+		opts.command, args = "tui", args[1:]
+	case len(args) > 0 && args[0] == "export-all":
+		opts.command, args = "export-all", args[1:]
+		for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			opts.exportTables, args = append(opts.exportTables, args[0]), args[1:]
+		}
+		if len(opts.exportTables) == 0 {
+			return nil, errors.New("usage: dbarrow export-all <table or catalog.schema.pattern>... --out 'dir/{table}.parquet' [flags]")
+		}
+	case len(args) > 0 && args[0] == "ingest":
+		opts.command, args = "ingest", args[1:]
+		for len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+			opts.ingestFiles, args = append(opts.ingestFiles, args[0]), args[1:]
+		}
+		if len(opts.ingestFiles) == 0 {
+			return nil, errors.New("usage: dbarrow ingest <file>... --volume /Volumes/<catalog>/<schema>/<volume>[/dir] [--into <table>] [flags]")
+		}
+	case len(args) > 0 && args[0] == "bench":
+		opts.command, args = "bench", args[1:]
+	case len(args) > 0 && args[0] == "diff":
+		var err error
+		if args, err = parseDiff(opts, args); err != nil {
+			return nil, err
+		}
+	case len(args) > 0 && args[0] == "run-spec":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return nil, errors.New("usage: dbarrow run-spec <spec.yaml> [--parallel n] [flags]")
+		}
+		opts.command, opts.specFile, args = "run-spec", args[1], args[2:]
+	case len(args) > 0 && args[0] == "schedule":
+		opts.command, args = "schedule", args[1:]
+	case len(args) > 0 && args[0] == "serve":
+		if len(args) < 2 || (args[1] != "flight" && args[1] != "flight-sql" && args[1] != "grpc" && args[1] != "http") {
+			return nil, errors.New("usage: dbarrow serve flight|flight-sql|grpc|http [--listen addr] [flags]")
+		}
+		opts.command, opts.serve, args = "serve", args[1], args[2:]
+	case len(args) > 0 && args[0] == "run":
+		if len(args) < 2 || strings.HasPrefix(args[1], "-") {
+			return nil, errors.New("usage: dbarrow run <saved-query> [--var key=value ...] [flags]")
+		}
+		opts.savedQuery, args = args[1], args[2:]
+	case len(args) > 0 && (args[0] == "catalogs" || args[0] == "schemas" || args[0] == "tables" || args[0] == "describe" || args[0] == "ddl"):
+		var err error
+		if args, err = parseBrowse(opts, args); err != nil {
+			return nil, err
+		}
+	case len(args) > 1 && args[0] == "history" && args[1] == "run":
+		if len(args) < 3 {
+			return nil, errors.New("usage: dbarrow history run <n> [flags]")
+		}
+		n, err := strconv.Atoi(args[2])
+		if err != nil || n < 1 {
+			return nil, fmt.Errorf("invalid history entry %q", args[2])
+		}
+		opts.rerun, args = n, args[3:]
+	}
+
+	fs := flag.NewFlagSet("dbarrow", flag.ContinueOnError)
+	fs.StringVar(&opts.query, "query", "", "SQL query to run (default "+fmt.Sprintf("%q", defaultQuery)+")")
+	fs.StringVar(&opts.queryFile, "query-file", "", "path to a file containing the SQL query to run, - for stdin")
+	fs.StringVar(&opts.queryFile, "f", "", "shorthand for --query-file")
+	fs.Var(&opts.params, "param", "query parameter as NAME=VALUE for :NAME, or VALUE for the next ?; NAME:TYPE=VALUE sets the SQL type (repeatable)")
+	fs.StringVar(&opts.results, "results", "last", "results written for a multi-statement script: last, or each query's result using {n} in --out")
+	fs.Var(&opts.vars, "var", "value for a {{.key}} placeholder of a saved query as key=value (repeatable)")
+	fs.StringVar(&opts.ingestVolume, "volume", "", "with ingest, the Unity Catalog volume directory the files are uploaded to, e.g. /Volumes/main/raw/landing")
+	fs.StringVar(&opts.ingestTable, "into", "", "with ingest, the table the uploaded files are loaded into with COPY INTO")
+	fs.StringVar(&opts.fileFormat, "file-format", "", "with ingest --into, the format of the files: csv, json, parquet, avro, orc, text or binaryfile (default from the file extension)")
+	fs.Var(&opts.formatOptions, "format-option", "with ingest --into, a FORMAT_OPTIONS entry of COPY INTO as KEY=VALUE, e.g. header=true (repeatable)")
+	fs.Var(&opts.copyOptions, "copy-option", "with ingest --into, a COPY_OPTIONS entry of COPY INTO as KEY=VALUE, e.g. mergeSchema=true (repeatable)")
+	fs.BoolVar(&opts.removeStaged, "remove-staged", false, "with ingest --into, remove the uploaded files from the volume once they are loaded")
+	fs.StringVar(&opts.stagingDir, "staging-dir", ".", "local directory the files of PUT and GET statements must be in")
+	fs.IntVar(&opts.parallel, "parallel", 4, "queries of run-spec running at the same time")
+	fs.IntVar(&opts.benchRuns, "bench-runs", 3, "times bench reads the result by each path; the median is reported")
+	fs.StringVar(&opts.against, "against", "", "with diff, SQL query whose result is compared with the result of --query")
+	fs.Func("key", "with diff, comma-separated columns identifying a row in both results, e.g. order_id", func(v string) (err error) {
+		opts.diffKey, err = parseColumnList(v)
+		return err
+	})
+	fs.StringVar(&opts.listen, "listen", "", "address serve listens on (default localhost:8815 for Flight, localhost:50051 for gRPC, localhost:8080 for HTTP); e.g. :8815 accepts connections from other hosts")
+	fs.DurationVar(&opts.requestTimeout, "request-timeout", 5*time.Minute, "with serve http, maximum time for a request to run its query and send the result (0 for no timeout)")
+	fs.Int64Var(&opts.requestMaxRows, "request-max-rows", 0, "with serve http, maximum rows returned per request (0 for no limit)")
+	fs.IntVar(&opts.maxConcurrent, "max-concurrent", 8, "with serve http, queries run at once; further requests get 503 (0 for no limit)")
+	fs.Func("allow-origin", "with serve http, comma-separated browser origins allowed to open the WebSocket endpoint besides the server's own, e.g. https://dash.example.com, or * for any", func(v string) error {
+		for _, o := range strings.Split(v, ",") {
+			o = strings.TrimRight(strings.TrimSpace(o), "/")
+			if o == "" {
+				continue
+			}
+			if o != "*" && !strings.Contains(o, "://") {
+				return fmt.Errorf("origin %q must include the scheme, e.g. https://%s", o, o)
+			}
+			opts.allowOrigins = append(opts.allowOrigins, o)
+		}
+		return nil
+	})
+	fs.BoolVar(&opts.noHistory, "no-history", false, "do not record this run in the query history")
+	fs.StringVar(&opts.profile, "profile", "", "named connection profile from the config file")
+	fs.StringVar(&opts.auth, "auth", "", "authentication method overriding the profile: pat, u2m, m2m, azure-client-secret or azure-msi")
+	fs.StringVar(&opts.configPath, "config", defaultConfigPath(), "path to the config file")
+	fs.StringVar(&opts.catalog, "catalog", "", "initial catalog for unqualified table names")
+	fs.StringVar(&opts.schema, "schema", "", "initial schema for unqualified table names")
+	fs.Var(&opts.sessionParams, "session-param", "session parameter as KEY=VALUE, e.g. ANSI_MODE=true or TIMEZONE=UTC (repeatable)")
+	fs.StringVar(&opts.proxy, "proxy", "", "HTTP(S) proxy for all connections, e.g. http://proxy.corp:3128 (default $HTTPS_PROXY)")
+	fs.StringVar(&opts.caCert, "ca-cert", "", "PEM bundle of extra CA certificates to trust, e.g. for a TLS-intercepting proxy")
+	fs.StringVar(&opts.clientCert, "client-cert", "", "PEM client certificate for mutual TLS (requires --client-key)")
+	fs.StringVar(&opts.clientKey, "client-key", "", "PEM private key of --client-cert")
+	fs.DurationVar(&opts.queryTimeout, "query-timeout", 10*time.Minute, "maximum time for the statement to run, e.g. 30s or 2h (0 for no timeout)")
+	fs.DurationVar(&opts.fetchTimeout, "fetch-timeout", 0, "maximum time for reading all result batches (0 for no timeout)")
+	fs.IntVar(&opts.retryAttempts, "retry-attempts", arrowfetch.DefaultRetryPolicy.MaxAttempts, "attempts to run a query failing with 429, 503 or a reset connection; statements changing data run once (1 disables retries)")
+	fs.DurationVar(&opts.retryBackoff, "retry-backoff", arrowfetch.DefaultRetryPolicy.InitialBackoff, "wait before the first retry, doubled on every further retry")
+	fs.IntVar(&opts.workers, "workers", 1, "goroutines encoding batches: csv and ndjson are written in parallel to one output, parquet, avro, orc and arrow formats to one --out file per worker ({n})")
+	fs.StringVar(&opts.workerOrder, "worker-order", "ordered", "with --workers, write csv and ndjson batches in fetch order (ordered) or as soon as they are encoded (unordered)")
+	fs.StringVar(&opts.mode, "mode", "arrow", "how results are read: arrow batches, or rows through database/sql for results or servers without Arrow support (slower)")
+	fs.IntVar(&opts.prefetch, "prefetch", 1, "batches to fetch in the background while the current one is written (0 to fetch one at a time)")
+	fs.IntVar(&opts.fetchBatchSize, "fetch-batch-size", 100000, "most rows fetched per round trip to the warehouse, and so per batch: larger batches take fewer round trips and more memory")
+	fs.BoolVar(&opts.cloudFetch, "cloud-fetch", false, "let the warehouse return large results as files on cloud storage, downloaded in parallel (--cloud-fetch=false to keep them inline)")
+	fs.IntVar(&opts.downloadThreads, "download-threads", 0, "with --cloud-fetch, result files downloaded at the same time (0 for the driver's default of 10); the driver has no separate prefetch depth for downloads, so this is also how many files are downloaded ahead of the reader, and --prefetch only applies to the decoded batches")
+	fs.Int64Var(&opts.memoryLimit, "memory-limit", 0, "MiB of result batches held in memory before fetching waits for them to be written (0 for no limit)")
+	fs.StringVar(&opts.logLevel, "log-level", "info", "minimum level of the diagnostics on stderr: debug (adds every batch), info, warn or error")
+	fs.StringVar(&opts.logFormat, "log-format", "text", "format of the diagnostics on stderr: text or json")
+	fs.BoolVar(&opts.debug, "debug", false, "log the dbsql driver's activity, every Thrift, API and cloud fetch HTTP request with its timing, and the retries (implies --log-level debug)")
+	fs.StringVar(&opts.otlpEndpoint, "otlp-endpoint", "", "export OpenTelemetry spans over OTLP/HTTP, e.g. http://localhost:4318 (default $OTEL_EXPORTER_OTLP_ENDPOINT)")
+	fs.StringVar(&opts.metricsAddr, "metrics", "", "serve Prometheus metrics (queries, rows, latencies, errors) at /metrics on this address, e.g. :9090")
+	fs.StringVar(&opts.pprof, "pprof", "", "serve net/http/pprof profiles and runtime traces on this address during the run, e.g. :6060 or localhost:6060")
+	fs.StringVar(&opts.summary, "summary", "text", "end-of-run performance summary on stderr: text or json")
+	fs.BoolVar(&opts.warehouseMetrics, "warehouse-metrics", false, "add the warehouse's queue, compilation and execution times from the query history to the summary")
+	fs.StringVar(&opts.progress, "progress", "auto", "live progress line on stderr while fetching: auto (when stderr is a terminal), always or never")
+	fs.StringVar(&opts.format, "format", "table", "output format: table, markdown, csv, ndjson, parquet, arrow-stream, feather, avro, orc or xlsx")
+	fs.Func("columns", "comma-separated columns to keep from the result, in this order", func(v string) (err error) {
+		opts.columns, err = parseColumnList(v)
+		return err
+	})
+	fs.Func("partition-by", "comma-separated columns to partition the output by: each batch is split into Hive-style directories under --out, e.g. pickup_zip=10001/part-0.parquet", func(v string) (err error) {
+		opts.partitionBy, err = parseColumnList(v)
+		return err
+	})
+	fs.IntVar(&opts.maxOpenPartitions, "max-open-partitions", 64, "with --partition-by, the most partition files open at once: writing one more closes the one written least recently, and a partition seen again continues in a new file part-1, part-2, ... (0 for no limit)")
+	fs.StringVar(&opts.filter, "filter", "", "keep only rows matching this expression, e.g. \"fare_amount > 20 && trip_distance < 2\"")
+	fs.Int64Var(&opts.head, "head", 0, "stop fetching after this many rows, to preview a large result (0 for all)")
+	fs.Float64Var(&opts.sample, "sample", 0, "keep each row with this probability, e.g. 0.01 for about 1% of the rows")
+	fs.BoolVar(&opts.incremental, "incremental", false, "fetch only the rows whose --watermark-column is above the value recorded in --state-file, and record the new highest value once they are written")
+	fs.StringVar(&opts.watermarkColumn, "watermark-column", "", "with --incremental, the result column that increases with new rows, e.g. tpep_pickup_datetime")
+	fs.StringVar(&opts.stateFile, "state-file", "", "with --incremental, JSON file holding the watermark between runs, e.g. state.json; with --keyset-column, the last key written, to resume from")
+	fs.BoolVar(&opts.fullRefresh, "full-refresh", false, "ignore the watermark or key recorded in --state-file, fetch from the start, then record a new one")
+	fs.StringVar(&opts.keysetColumn, "keyset-column", "", "fetch the result in pages of --page-size rows, each a query ordered by this unique key column and starting after the last key of the page before, e.g. id")
+	fs.Int64Var(&opts.pageSize, "page-size", 1000000, "with --keyset-column, rows per page")
+	fs.StringVar(&opts.postSQL, "post-sql", "", "run this DuckDB query locally over the fetched rows, available as the table result, and output its result instead, e.g. \"SELECT zip, avg(fare) FROM result GROUP BY zip\" (requires -tags duckdb)")
+	fs.Func("aggregate", "aggregate the result locally, e.g. \"sum(fare_amount), count(*) group by pickup_zip\"", func(v string) (err error) {
+		opts.aggregations, opts.groupBy, err = sink.ParseAggregate(v)
+		return err
+	})
+	fs.Func("cast", "convert columns before they are written, by type or name, e.g. \"decimal=double, timestamp=string:rfc3339, zip=int\"; may be repeated", func(v string) error {
+		rules, err := sink.ParseCasts(v)
+		opts.casts = append(opts.casts, rules...)
+		return err
+	})
+	fs.StringVar(&opts.manifest, "manifest", "", "after the export, write a JSON manifest of the files written with their rows and bytes, the schema, the query and its snapshot time to this path, e.g. trips/_manifest.json")
+	fs.StringVar(&opts.compress, "compress", "none", "compress the csv or ndjson output, to a file, stdout or object store: gzip, zstd or none")
+	fs.Int64Var(&opts.maxRowsPerFile, "max-rows-per-file", 0, "start a new output file after this many rows: part-00000, part-00001, ... in the --out directory, or {n} in --out (0 for no limit)")
+	fs.Int64Var(&opts.maxFileSize, "max-file-size", 0, "start a new output file once one reaches this many MiB, named as with --max-rows-per-file (0 for no limit)")
+	fs.Var(&opts.stats, "stats", "print null counts, min/max and distinct estimates per column to stderr; --stats=batch for every batch too")
+	fs.Var(&opts.schemaOnly, "schema-only", "print the columns and types of the result without running the query; --schema-only=json for JSON")
+	fs.BoolVar(&opts.countOnly, "count-only", false, "print the number of rows of the result, counted by the warehouse with SELECT COUNT(*) FROM (query), without fetching them")
+	fs.DurationVar(&opts.watch, "watch", 0, "re-run the query at this interval, e.g. 30s, until interrupted; a terminal is redrawn with the changed values highlighted, and --out (with {n} for the run) or --sink receive every run")
+	fs.Var(&opts.explain, "explain", "print the plan of the query (EXPLAIN FORMATTED) without running it; --explain=cost adds the size estimates, --explain=extended the logical plans")
+	fs.StringVar(&opts.out, "out", "-", "output file path, - for stdout")
+	fs.IntVar(&opts.tableConcurrency, "table-concurrency", 4, "with export-all, tables exported at the same time")
+	fs.StringVar(&opts.dialect, "dialect", "", "with ddl, write the CREATE TABLE statement for postgres, duckdb or sqlite instead of Databricks")
+	fs.StringVar(&opts.sink, "sink", "", "write into a database table instead of --out, e.g. duckdb://results.db?table=trips, sqlite://cache.db?table=trips or delta://path/to/table")
+	fs.IntVar(&opts.maxColWidth, "max-col-width", 40, "truncate table values longer than this many characters (0 for no limit)")
+	fs.Int64Var(&opts.maxRowsDisplay, "max-rows-display", 0, "maximum rows to render in table and markdown output (0 for all)")
+	fs.StringVar(&opts.timezone, "timezone", "", "render timestamps in this time zone, e.g. Europe/Paris, UTC or +05:30 (default: the zone the warehouse sends, normally the session time zone)")
+	fs.Func("null-string", "how table, markdown, csv and ndjson output write NULL values, e.g. NULL, \\N or an empty string; null keeps JSON null in ndjson (default: NULL in tables, empty in csv, null in ndjson)", func(v string) error {
+		opts.nullString = &v
+		return nil
+	})
+	fs.StringVar(&opts.binaryEncoding, "binary-encoding", "base64", "how table, markdown, csv, ndjson and xlsx output write BINARY values: hex, base64 or raw")
+	fs.Int64Var(&opts.uploadPartSize, "upload-part-size", 0, "size in MiB of each part uploaded to an object store (0 for the store default)")
+	fs.IntVar(&opts.uploadConcurrency, "upload-concurrency", 0, "number of parts uploaded in parallel to S3 or Azure (0 for the default)")
+	fs.StringVar(&opts.compression, "compression", "", "compression codec: snappy, zstd, gzip, brotli or none for parquet; snappy, deflate or none for avro; zlib or none for orc (default snappy, zlib for orc)")
+	fs.Int64Var(&opts.rowGroupSize, "row-group-size", 0, "maximum rows per parquet row group (0 for the library default)")
+	fs.Int64Var(&opts.dataPageSize, "data-page-size", 0, "size in KiB at which a parquet data page is closed (0 for the library default of 1024)")
+	fs.Func("dictionary", "parquet dictionary encoding: on or off for every column, and <column>=on|off for single columns, e.g. \"off,payment_type=on\"", func(v string) (err error) {
+		opts.dictionary, opts.columnDictionary, err = sink.ParseDictionary(v)
+		return err
+	})
+	fs.StringVar(&opts.parquetVersion, "parquet-version", "2.6", "parquet format version the file declares: 1.0, 2.4 or 2.6")
+	fs.IntVar(&opts.dataPageVersion, "data-page-version", 1, "parquet data page version: 1, or 2 for engines that support it")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+	if opts.query != "" && opts.queryFile != "" {
+		return nil, errors.New("--query and --query-file are mutually exclusive")
+	}
+	if opts.savedQuery != "" && (opts.query != "" || opts.queryFile != "") {
+		return nil, errors.New("run executes a saved query and cannot be combined with --query or --query-file")
+	}
+	if opts.browse != "" && (opts.query != "" || opts.queryFile != "") {
+		return nil, fmt.Errorf("%s browses the catalog and cannot be combined with --query or --query-file", opts.browse)
+	}
+	if opts.command == "export-all" {
+		if opts.query != "" || opts.queryFile != "" {
+			return nil, errors.New("export-all reads whole tables and cannot be combined with --query or --query-file")
+		}
+		if !strings.Contains(opts.out, "{table}") && !strings.Contains(opts.sink, "{table}") {
+			return nil, errors.New("export-all writes every table to its own destination: put {table} in --out, e.g. --out 'exports/{table}.parquet', or in the table of --sink")
+		}
+		if opts.tableConcurrency < 1 {
+			return nil, errors.New("--table-concurrency must be at least 1")
+		}
+	}
+	if opts.command == "ingest" {
+		if err := checkIngest(opts); err != nil {
+			return nil, err
+		}
+	} else if opts.ingestVolume != "" || opts.ingestTable != "" || opts.fileFormat != "" || len(opts.formatOptions) > 0 || len(opts.copyOptions) > 0 || opts.removeStaged {
+		return nil, errors.New("--volume, --into, --file-format, --format-option, --copy-option and --remove-staged apply to ingest")
+	}
+	if opts.command == "schedule" && (opts.query != "" || opts.queryFile != "" || opts.sink != "" || opts.out != "-") {
+		return nil, errors.New("schedule runs the jobs of the config file, which set their own query, out and sink")
+	}
+	if opts.command == "run-spec" && (opts.query != "" || opts.queryFile != "" || opts.sink != "" || opts.out != "-") {
+		return nil, errors.New("run-spec runs the queries of the spec, which set their own query, out and sink")
+	}
+	if opts.parallel < 1 {
+		return nil, errors.New("--parallel must be at least 1")
+	}
+	if opts.command == "diff" {
+		switch {
+		case len(opts.diffKey) == 0:
+			return nil, errors.New("diff aligns the rows of the results on --key, e.g. --key order_id")
+		case opts.diffTable != "" && (opts.query != "" || opts.queryFile != "" || opts.against != ""):
+			return nil, errors.New("diff <table> compares versions of the table and cannot be combined with --query, --query-file or --against")
+		case opts.diffTable == "" && opts.against == "":
+			return nil, errors.New("diff needs the query to compare with in --against, or a table and its versions: dbarrow diff <table> <version> [<version>]")
+		case opts.diffTable == "" && opts.query == "" && opts.queryFile == "" && !stdinPiped():
+			return nil, errors.New("diff compares the result of --query, --query-file or the query on stdin with --against")
+		}
+	} else if opts.against != "" || len(opts.diffKey) > 0 {
+		return nil, errors.New("--against and --key apply to the diff command")
+	}
+	if opts.dialect != "" {
+		if opts.browse != "ddl" {
+			return nil, errors.New("--dialect applies to the ddl command")
+		}
+		if !slices.Contains(sink.Dialects, opts.dialect) {
+			return nil, fmt.Errorf("unsupported --dialect %q, expected %s", opts.dialect, strings.Join(sink.Dialects, ", "))
+		}
+	}
+	if opts.savedQuery == "" && len(opts.vars) > 0 {
+		return nil, errors.New("--var fills the placeholders of a saved query: use it with run <name>")
+	}
+	if opts.rerun > 0 && (opts.query != "" || opts.queryFile != "") {
+		return nil, errors.New("history run re-runs a stored query and cannot be combined with --query or --query-file")
+	}
+	if opts.results != "last" && opts.results != "each" {
+		return nil, fmt.Errorf("unsupported --results %q, expected last or each", opts.results)
+	}
+	if opts.results == "each" {
+		// Every result needs a destination of its own, unless all go to stdout.
+		if opts.sink != "" {
+			return nil, errors.New("--results each cannot be used with --sink")
+		}
+		if opts.out != "-" && opts.out != "" && !strings.Contains(opts.out, "{n}") {
+			return nil, errors.New("--results each writes one file per result and needs {n} in --out")
+		}
+	}
+	if opts.maxColWidth < 0 {
+		return nil, errors.New("--max-col-width must not be negative")
+	}
+	if opts.maxRowsDisplay < 0 {
+		return nil, errors.New("--max-rows-display must not be negative")
+	}
+	if opts.timezone != "" {
+		if _, err := sink.LoadTimeZone(opts.timezone); err != nil {
+			return nil, fmt.Errorf("--timezone: %w", err)
+		}
+	}
+	if _, err := sink.BinaryEncoder(opts.binaryEncoding); err != nil {
+		return nil, fmt.Errorf("--binary-encoding: %w", err)
+	}
+	if opts.proxy != "" {
+		if u, err := url.Parse(opts.proxy); err != nil || u.Scheme == "" || u.Host == "" {
+			return nil, fmt.Errorf("invalid --proxy %q, expected a URL such as http://proxy.corp:3128", opts.proxy)
+		}
+	}
+	if (opts.clientCert == "") != (opts.clientKey == "") {
+		return nil, errors.New("--client-cert and --client-key must be given together")
+	}
+	if opts.queryTimeout < 0 || opts.fetchTimeout < 0 {
+		return nil, errors.New("--query-timeout and --fetch-timeout must not be negative")
+	}
+	if opts.benchRuns < 1 {
+		return nil, errors.New("--bench-runs must be at least 1")
+	}
+	if opts.retryAttempts < 1 {
+		return nil, errors.New("--retry-attempts must be at least 1")
+	}
+	if opts.head < 0 {
+		return nil, errors.New("--head must not be negative")
+	}
+	if opts.sample < 0 || opts.sample > 1 {
+		return nil, errors.New("--sample must be a fraction between 0 and 1")
+	}
+	if opts.workers < 1 {
+		return nil, errors.New("--workers must be at least 1")
+	}
+	if opts.workerOrder != "ordered" && opts.workerOrder != "unordered" {
+		return nil, fmt.Errorf("unsupported --worker-order %q, expected ordered or unordered", opts.workerOrder)
+	}
+	if opts.workers > 1 {
+		switch {
+		case opts.sink != "":
+			return nil, errors.New("--workers cannot be used with --sink")
+		case partFormat(opts.format):
+			// Every worker writes a file of its own.
+			if !strings.Contains(opts.out, "{n}") {
+				return nil, fmt.Errorf("--workers with --format %s writes one file per worker and needs {n} in --out", opts.format)
+			}
+			if opts.results == "each" {
+				return nil, fmt.Errorf("--workers with --format %s cannot be combined with --results each", opts.format)
+			}
+		case opts.format != "csv" && opts.format != "ndjson":
+			return nil, fmt.Errorf("--workers is not supported with --format %s", opts.format)
+		}
+	}
+	if opts.requestTimeout < 0 || opts.requestMaxRows < 0 || opts.maxConcurrent < 0 {
+		return nil, errors.New("--request-timeout, --request-max-rows and --max-concurrent must not be negative")
+	}
+	if opts.postSQL != "" && !sink.DuckDBSupported {
+		return nil, errors.New("--post-sql runs the query in DuckDB, which this binary was built without; rebuild with: go build -tags duckdb")
+	}
+	if opts.incremental {
+		if opts.watermarkColumn == "" || opts.stateFile == "" {
+			return nil, errors.New("--incremental requires --watermark-column and --state-file")
+		}
+		if opts.command != "" || opts.schemaOnly != "" {
+			return nil, errors.New("--incremental only applies when running a query")
+		}
+		if opts.head > 0 {
+			return nil, errors.New("--incremental cannot be used with --head: the watermark must cover every row below it")
+		}
+		if opts.keysetColumn != "" {
+			return nil, errors.New("--incremental and --keyset-column cannot be combined")
+		}
+	} else if opts.watermarkColumn != "" {
+		return nil, errors.New("--watermark-column applies to --incremental")
+	}
+	if opts.keysetColumn != "" {
+		if opts.pageSize < 1 {
+			return nil, errors.New("--page-size must be at least 1")
+		}
+		if opts.command != "" || opts.schemaOnly != "" {
+			return nil, errors.New("--keyset-column only applies when running a query")
+		}
+		if opts.head > 0 {
+			return nil, errors.New("--keyset-column cannot be used with --head")
+		}
+		if opts.workers > 1 && partFormat(opts.format) {
+			return nil, fmt.Errorf("--keyset-column cannot be used with --workers for --format %s, which numbers the worker files with {n}", opts.format)
+		}
+		// A resumed extract must not overwrite the pages written before.
+		if opts.stateFile != "" && opts.sink == "" && !strings.Contains(opts.out, "{n}") {
+			return nil, errors.New("--state-file with --keyset-column needs {n} in --out, for a file per page, or an appending --sink, so a resumed extract keeps the pages already written")
+		}
+	}
+	if !opts.incremental && opts.keysetColumn == "" && (opts.stateFile != "" || opts.fullRefresh) {
+		return nil, errors.New("--state-file and --full-refresh apply to --incremental or --keyset-column")
+	}
+	if opts.mode != "arrow" && opts.mode != "rows" {
+		return nil, fmt.Errorf("unsupported --mode %q, expected arrow or rows", opts.mode)
+	}
+	if opts.prefetch < 0 {
+		return nil, errors.New("--prefetch must not be negative")
+	}
+	if opts.fetchBatchSize < 1 {
+		return nil, errors.New("--fetch-batch-size must be at least 1")
+	}
+	if opts.downloadThreads < 0 {
+		return nil, errors.New("--download-threads must not be negative")
+	}
+	if opts.downloadThreads > 0 && !opts.cloudFetch {
+		return nil, errors.New("--download-threads applies to --cloud-fetch")
+	}
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(opts.logLevel)); err != nil {
+		return nil, fmt.Errorf("unsupported --log-level %q, expected debug, info, warn or error", opts.logLevel)
+	}
+	if opts.logFormat != "text" && opts.logFormat != "json" {
+		return nil, fmt.Errorf("unsupported --log-format %q, expected text or json", opts.logFormat)
+	}
+	if opts.debug {
+		opts.logLevel = "debug"
+	}
+	if opts.summary != "text" && opts.summary != "json" {
+		return nil, fmt.Errorf("unsupported --summary %q, expected text or json", opts.summary)
+	}
+	if opts.progress != "auto" && opts.progress != "always" && opts.progress != "never" {
+		return nil, fmt.Errorf("unsupported --progress %q, expected auto, always or never", opts.progress)
+	}
+	if opts.memoryLimit < 0 {
+		return nil, errors.New("--memory-limit must not be negative")
+	}
+	if opts.retryBackoff < 0 {
+		return nil, errors.New("--retry-backoff must not be negative")
+	}
+	if opts.uploadPartSize < 0 || opts.uploadConcurrency < 0 {
+		return nil, errors.New("--upload-part-size and --upload-concurrency must not be negative")
+	}
+	if len(opts.partitionBy) > 0 {
+		switch {
+		case opts.sink != "":
+			return nil, errors.New("--partition-by writes files under --out and cannot be used with --sink")
+		case opts.out == "" || opts.out == "-":
+			return nil, errors.New("--partition-by requires --out with the directory to write the partitions to")
+		case opts.format == "table" || opts.format == "markdown":
+			return nil, fmt.Errorf("--partition-by is not supported with --format %s", opts.format)
+		case opts.workers > 1:
+			return nil, errors.New("--partition-by cannot be combined with --workers")
+		}
+	}
+	if opts.maxOpenPartitions < 0 {
+		return nil, errors.New("--max-open-partitions must not be negative")
+	}
+	if opts.dataPageSize < 0 {
+		return nil, errors.New("--data-page-size must not be negative")
+	}
+	if opts.parquetVersion != "1.0" && opts.parquetVersion != "2.4" && opts.parquetVersion != "2.6" {
+		return nil, fmt.Errorf("unsupported --parquet-version %q, expected 1.0, 2.4 or 2.6", opts.parquetVersion)
+	}
+	if opts.dataPageVersion != 1 && opts.dataPageVersion != 2 {
+		return nil, fmt.Errorf("unsupported --data-page-version %d, expected 1 or 2", opts.dataPageVersion)
+	}
+	if opts.compress == "none" {
+		opts.compress = ""
+	}
+	if opts.compress != "" {
+		switch {
+		case compressExtensions[opts.compress] == "":
+			return nil, fmt.Errorf("unsupported --compress %q, expected gzip, zstd or none", opts.compress)
+		case opts.sink != "":
+			return nil, errors.New("--compress applies to --out and cannot be used with --sink")
+		case opts.format != "csv" && opts.format != "ndjson":
+			return nil, fmt.Errorf("--compress applies to the csv and ndjson formats, not %s; --compression sets the codec of parquet, avro and orc", opts.format)
+		case (opts.out == "" || opts.out == "-") && term.IsTerminal(int(os.Stdout.Fd())):
+			return nil, errors.New("--compress writes binary data; pipe stdout into a reader such as zcat, or use --out with a file path")
+		}
+	}
+	if opts.manifest != "" {
+		switch {
+		case opts.sink != "":
+			return nil, errors.New("--manifest lists the files written to --out and cannot be used with --sink")
+		case opts.out == "" || opts.out == "-" || opts.manifest == "-":
+			return nil, errors.New("--manifest requires --out with a file path, and a path of its own")
+		case opts.command == "export-all" && !strings.Contains(opts.manifest, "{table}"):
+			return nil, errors.New("export-all writes a manifest per table and needs {table} in --manifest")
+		case (opts.results == "each" || opts.keysetColumn != "" && opts.stateFile != "") && !strings.Contains(opts.manifest, "{n}"):
+			return nil, errors.New("a manifest is written for each result file and needs {n} in --manifest")
+		}
+	}
+	if opts.maxRowsPerFile < 0 || opts.maxFileSize < 0 {
+		return nil, errors.New("--max-rows-per-file and --max-file-size must not be negative")
+	}
+	if opts.rolling() {
+		// The part number takes the place of {n}, which these number their own files with.
+		switch {
+		case opts.sink != "":
+			return nil, errors.New("--max-rows-per-file and --max-file-size split files and cannot be used with --sink")
+		case opts.out == "" || opts.out == "-":
+			return nil, errors.New("--max-rows-per-file and --max-file-size require --out with a directory, or a file path with {n}")
+		case opts.format == "table" || opts.format == "markdown":
+			return nil, fmt.Errorf("--max-rows-per-file and --max-file-size are not supported with --format %s", opts.format)
+		case opts.workers > 1 && partFormat(opts.format):
+			return nil, fmt.Errorf("--max-rows-per-file and --max-file-size cannot be combined with --workers for --format %s", opts.format)
+		case opts.results == "each":
+			return nil, errors.New("--max-rows-per-file and --max-file-size cannot be combined with --results each")
+		case opts.keysetColumn != "" && opts.stateFile != "":
+			return nil, errors.New("--max-rows-per-file and --max-file-size cannot be combined with a resumable --keyset-column, which writes a file per page")
+		}
+	}
+	if opts.command == "tui" {
+		// The browser owns the terminal, so the result goes nowhere else.
+		switch {
+		case opts.sink != "" || opts.out != "-":
+			return nil, errors.New("tui shows the result in the terminal and cannot be used with --out or --sink")
+		case opts.stats != "":
+			return nil, errors.New("tui cannot be combined with --stats")
+		case !term.IsTerminal(int(os.Stdout.Fd())):
+			return nil, errors.New("tui needs a terminal on stdout")
+		}
+	}
+	if opts.watch != 0 {
+		switch {
+		case opts.watch < time.Second:
+			return nil, errors.New("--watch must be at least 1s")
+		case opts.command != "" || opts.browse != "":
+			return nil, fmt.Errorf("--watch cannot be used with %s", cmp.Or(opts.command, opts.browse))
+		case opts.schemaOnly != "" || opts.explain != "" || opts.countOnly:
+			return nil, errors.New("--watch cannot be combined with --schema-only, --explain or --count-only")
+		case opts.incremental || opts.keysetColumn != "":
+			return nil, errors.New("--watch cannot be used with --incremental or --keyset-column")
+		case opts.results == "each" || opts.rolling() || opts.workers > 1 && partFormat(opts.format):
+			return nil, errors.New("--watch numbers its runs with {n} and cannot be combined with --results each, --max-rows-per-file, --max-file-size or --workers writing a file per worker")
+		case opts.sink == "" && opts.out != "-" && !strings.Contains(opts.out, "{n}"):
+			return nil, errors.New("--watch writes a file per run and needs {n} in --out, which is replaced by the run number")
+		}
+	}
+	if opts.countOnly {
+		switch {
+		case opts.command != "" || opts.browse != "":
+			return nil, fmt.Errorf("--count-only cannot be used with %s", cmp.Or(opts.command, opts.browse))
+		case opts.schemaOnly != "" || opts.explain != "":
+			return nil, errors.New("--count-only cannot be combined with --schema-only or --explain")
+		case opts.incremental || opts.keysetColumn != "":
+			return nil, errors.New("--count-only cannot be used with --incremental or --keyset-column")
+		case opts.sink != "":
+			return nil, errors.New("--count-only prints the count and cannot be used with --sink")
+		}
+		return opts, nil
+	}
+	if opts.explain != "" {
+		switch {
+		case opts.command != "" || opts.browse != "":
+			return nil, fmt.Errorf("--explain cannot be used with %s", cmp.Or(opts.command, opts.browse))
+		case opts.schemaOnly != "":
+			return nil, errors.New("--explain and --schema-only cannot be combined")
+		case opts.incremental || opts.keysetColumn != "":
+			return nil, errors.New("--explain cannot be used with --incremental or --keyset-column")
+		case opts.sink != "":
+			return nil, errors.New("--explain prints the plan and cannot be used with --sink")
+		}
+		return opts, nil
+	}
+	if opts.schemaOnly != "" {
+		if opts.command != "" {
+			return nil, fmt.Errorf("--schema-only cannot be used with %s", opts.command)
+		}
+		if opts.sink != "" {
+			return nil, errors.New("--schema-only prints the schema and cannot be used with --sink")
+		}
+		return opts, nil
+	}
+	if opts.sink != "" {
+		// A database sink replaces the encoded output, so --format and --out do not apply.
+		if opts.out != "-" {
+			return nil, errors.New("--sink and --out are mutually exclusive")
+		}
+		return opts, nil
+	}
+	switch opts.format {
+	case "parquet", "feather", "avro", "orc", "xlsx":
+		if opts.out == "" || opts.out == "-" {
+			return nil, fmt.Errorf("--format %s requires --out with a file path", opts.format)
+		}
+	case "arrow-stream":
+		// The stream can go to stdout for a reader on a pipe, but not to a terminal.
+		if (opts.out == "" || opts.out == "-") && term.IsTerminal(int(os.Stdout.Fd())) {
+			return nil, errors.New("--format arrow-stream writes binary data; pipe stdout into a reader such as polars.read_ipc_stream, or use --out with a file path")
+		}
+	}
+	return opts, nil
+}
+
+// parseColumnList parses a comma-separated list of column names, such as the value of
+// --columns, rejecting a name listed twice.
+func parseColumnList(v string) ([]string, error) {
+	var columns []string
+	seen := map[string]bool{}
+	for _, c := range strings.Split(v, ",") {
+		c = strings.TrimSpace(c)
+		if c == "" {
+			continue
+		}
+		if seen[strings.ToLower(c)] {
+			return nil, fmt.Errorf("column %q is listed twice", c)
+		}
+		seen[strings.ToLower(c)] = true
+		columns = append(columns, c)
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("no column names given")
+	}
+	return columns, nil
+}
+
+// uploadOptions returns the settings for uploads to object store destinations.
+func (o *cliOptions) uploadOptions() remote.Options {
+	return remote.Options{
+		PartSize:    o.uploadPartSize << 20,
+		Concurrency: o.uploadConcurrency,
+	}
+}
+
+// parquetOptions returns the settings of the Parquet files written for --format
+// parquet and delta:// sinks.
+func (o *cliOptions) parquetOptions() sink.ParquetOptions {
+	return sink.ParquetOptions{
+		Compression:      o.compression,
+		RowGroupSize:     o.rowGroupSize,
+		DataPageSize:     o.dataPageSize << 10,
+		Dictionary:       o.dictionary,
+		ColumnDictionary: o.columnDictionary,
+		Version:          o.parquetVersion,
+		DataPageVersion:  o.dataPageVersion,
+	}
+}
+
+// rolling reports whether the output is split into files by --max-rows-per-file or
+// --max-file-size.
+func (o *cliOptions) rolling() bool {
+	return o.maxRowsPerFile > 0 || o.maxFileSize > 0
+}
+
+// rollingOptions returns the limits of each output file.
+func (o *cliOptions) rollingOptions() sink.RollingOptions {
+	return sink.RollingOptions{MaxRows: o.maxRowsPerFile, MaxBytes: o.maxFileSize << 20}
+}
+
+// retryPolicy returns the retry settings for the client, logging every retry.
+func (o *cliOptions) retryPolicy() arrowfetch.RetryPolicy {
+	p := arrowfetch.DefaultRetryPolicy
+	p.MaxAttempts = o.retryAttempts
+	p.InitialBackoff = o.retryBackoff
+	p.OnRetry = func(attempt int, err error, wait time.Duration) {
+		slog.Warn("retrying", "attempt", attempt, "err", err, "wait", wait.Round(time.Millisecond))
+	}
+	return p
+}
+
+// resolveQuery returns the SQL text to run, reading it from --query-file when set, or
+// from stdin for "-f -" or when stdin is piped without --query. For "run <name>" it is
+// the saved query filled with --var, and for "history run <n>" the stored query, whose
+// profile is also used unless --profile is given. The catalog browsing commands query
+// information_schema, and "diff <table>" reads the first version of the table.
+func (o *cliOptions) resolveQuery() (string, error) {
+	if o.browse != "" {
+		return browseQuery(o.browse, o.namespace)
+	}
+	if o.diffTable != "" {
+		return versionQuery(o.diffTable, o.diffVersions[0]), nil
+	}
+	if o.savedQuery != "" {
+		return savedQuery(o.configPath, o.savedQuery, o.vars)
+	}
+	if o.rerun > 0 {
+		e, err := historyQuery(o.rerun)
+		if err != nil {
+			return "", err
+		}
+		if o.profile == "" {
+			o.profile = e.Profile
+		}
+		return e.Query, nil
+	}
+	if o.queryFile == "-" {
+		query, err := readStdin()
+		if err != nil {
+			return "", err
+		}
+		if query == "" {
+			return "", errors.New("no query on stdin")
+		}
+		return query, nil
+	}
+	if o.queryFile != "" {
+		data, err := os.ReadFile(o.queryFile)
+		if err != nil {
+			return "", fmt.Errorf("unable to read query file: %w", err)
+		}
+		query := strings.TrimSpace(string(data))
+		if query == "" {
+			return "", fmt.Errorf("query file %s is empty", o.queryFile)
+		}
+		return query, nil
+	}
+	if o.query != "" {
+		return o.query, nil
+	}
+	// fetch, repl, serve, schedule, run-spec, export-all and ingest run no query of their
+	// own, so they leave stdin alone.
+	switch o.command {
+	case "fetch", "repl", "serve", "schedule", "run-spec", "export-all", "ingest":
+		return defaultQuery, nil
+	}
+	if stdinPiped() {
+		query, err := readStdin()
+		if err != nil {
+			return "", err
+		}
+		if query != "" {
+			return query, nil
+		}
+	}
+	// Comparing with the sample table is never what a diff means.
+	if o.command == "diff" {
+		return "", errors.New("no query on stdin to compare with --against")
+	}
+	return defaultQuery, nil
+}
+
+// stdinPiped reports whether stdin is a pipe or a redirected file rather than a terminal.
+func stdinPiped() bool {
+	fi, err := os.Stdin.Stat()
+	if err != nil {
+		return false
+	}
+	return fi.Mode()&os.ModeNamedPipe != 0 || fi.Mode().IsRegular()
+}
+
+// readStdin reads the whole query from stdin.
+func readStdin() (string, error) {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", fmt.Errorf("unable to read the query from stdin: %w", err)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// historyEntry is one line of the query history file.
+type historyEntry struct {
+	Time     time.Time `json:"time"`
+	Profile  string    `json:"profile,omitempty"`
+	Host     string    `json:"host,omitempty"`
+	Query    string    `json:"query"`
+	Duration float64   `json:"duration_seconds"`
+	Rows     int64     `json:"rows"`
+	Bytes    int64     `json:"bytes"`
+	Status   string    `json:"status"` // ok, error or interrupted
+	Error    string    `json:"error,omitempty"`
+}
+
+// historyPath returns the JSON Lines file every run is appended to.
+func historyPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "dbarrow-history.jsonl")
+	}
+	return filepath.Join(home, ".dbarrow", "history.jsonl")
+}
+
+// recordHistory appends the outcome of a run to the history. A failure to write the
+// history is only logged, so it never hides the result of the query itself.
+func recordHistory(opts *cliOptions, prof profile, query string, start time.Time, stats runStats, err error, interrupted bool) {
+	e := historyEntry{
+		Time:     start.UTC(),
+		Profile:  opts.profile,
+		Host:     prof.Host,
+		Query:    query,
+		Duration: time.Since(start).Seconds(),
+		Rows:     stats.rows,
+		Bytes:    stats.bytes,
+		Status:   "ok",
+	}
+	switch opts.command {
+	case "submit":
+		e.Query = "submit: " + query
+	case "fetch":
+		e.Query = "fetch " + opts.statementID
+	case "bench":
+		e.Query = "bench: " + query
+	case "export-all":
+		e.Query = "export-all " + strings.Join(opts.exportTables, " ")
+	}
+	switch {
+	case interrupted:
+		e.Status = "interrupted"
+	case err != nil:
+		e.Status, e.Error = "error", err.Error()
+	}
+	if err := appendHistory(historyPath(), e); err != nil {
+		slog.Warn("unable to record the query history", "err", err)
+	}
+}
+
+// appendHistory adds e as one JSON line to the file at path, creating it if needed.
+// The file is private to the user since queries may contain sensitive values.
+func appendHistory(path string, e historyEntry) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// loadHistory reads all entries of the history file, oldest first.
+// A missing file is an empty history.
+func loadHistory(path string) ([]historyEntry, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []historyEntry
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16<<20) // queries can be long
+	for scanner.Scan() {
+		var e historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("corrupt history line %d: %w", len(entries)+1, err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, scanner.Err()
+}
+
+// historyQuery returns the entry number n (1 for the oldest) for "history run".
+func historyQuery(n int) (historyEntry, error) {
+	entries, err := loadHistory(historyPath())
+	if err != nil {
+		return historyEntry{}, err
+	}
+	if n < 1 || n > len(entries) {
+		return historyEntry{}, fmt.Errorf("no history entry %d (the history has %d entries)", n, len(entries))
+	}
+	e := entries[n-1]
+	if strings.HasPrefix(e.Query, "fetch ") || strings.HasPrefix(e.Query, "submit: ") {
+		return historyEntry{}, fmt.Errorf("history entry %d is a %s command and cannot be re-run", n, strings.Fields(e.Query)[0])
+	}
+	return e, nil
+}
+
+// runHistory implements the "history" subcommand, which lists past runs numbered from
+// the oldest, so "dbarrow history run <n>" can re-run one of them.
+func runHistory(args []string) error {
+	set := flag.NewFlagSet("dbarrow history", flag.ContinueOnError)
+	limit := set.Int("limit", 20, "number of most recent entries to list (0 for all)")
+	grep := set.String("grep", "", "only list queries containing this text (case-insensitive)")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if set.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(set.Args(), " "))
+	}
+
+	entries, err := loadHistory(historyPath())
+	if err != nil {
+		return err
+	}
+
+	// Keep the entry numbers of the full history so they stay valid for "history run".
+	var shown []int
+	for i, e := range entries {
+		if *grep == "" || strings.Contains(strings.ToLower(e.Query), strings.ToLower(*grep)) {
+			shown = append(shown, i)
+		}
+	}
+	if *limit > 0 && len(shown) > *limit {
+		shown = shown[len(shown)-*limit:]
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "#\tTIME\tSTATUS\tROWS\tDURATION\tQUERY")
+	for _, i := range shown {
+		e := entries[i]
+		query := []rune(strings.Join(strings.Fields(e.Query), " "))
+		if len(query) > 80 {
+			query = append(query[:77], []rune("...")...)
+		}
+		duration := time.Duration(e.Duration * float64(time.Second)).Round(time.Millisecond)
+		fmt.Fprintf(w, "%d\t%s\t%s\t%d\t%s\t%s\n", i+1, e.Time.Local().Format("2006-01-02 15:04:05"), e.Status, e.Rows, duration, string(query))
+	}
+	return w.Flush()
+}
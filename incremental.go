@@ -0,0 +1,278 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/decimal128"
+)
+
+// watermarkState is the --state-file of an incremental extraction: the highest value of
+// the watermark column written so far. Type is the kind of SQL literal Value is given
+// as: timestamp, timestamp_ntz, date, bigint, decimal, double or string. A
+// keyset-paginated extract records the last key written the same way, with the number
+// of the next page.
+type watermarkState struct {
+	Column  string    `json:"column"`
+	Type    string    `json:"type"`
+	Value   string    `json:"value"`
+	Page    int       `json:"page,omitempty"`
+	Updated time.Time `json:"updated"`
+}
+
+// runIncremental runs the query for --incremental. Only the rows whose watermark column
+// is above the value in the state file are fetched, and once they have been written the
+// highest value among them becomes the new watermark. Without a state file, or with
+// --full-refresh, the whole result is fetched. The state is left alone when the run
+// fails or is interrupted, so the next run fetches the same rows again.
+func runIncremental(ctx context.Context, client *arrowfetch.Client, query string, opts *cliOptions, stats *runStats) error {
+	if len(arrowfetch.SplitStatements(query)) > 1 {
+		return errors.New("--incremental runs a single query, not a script")
+	}
+	state, err := loadWatermark(opts.stateFile)
+	if err != nil {
+		return err
+	}
+	switch {
+	case opts.fullRefresh:
+		slog.Info("full refresh: fetching every row", "watermark_column", opts.watermarkColumn)
+	case state == nil:
+		slog.Info("no watermark recorded yet: fetching every row", "state_file", opts.stateFile)
+	case !strings.EqualFold(state.Column, opts.watermarkColumn):
+		return fmt.Errorf("%s records a watermark for column %s, not %s; use --full-refresh to start over with the new column", opts.stateFile, state.Column, opts.watermarkColumn)
+	default:
+		predicate, err := watermarkPredicate(state)
+		if err != nil {
+			return fmt.Errorf("%s: %w", opts.stateFile, err)
+		}
+		query = fmt.Sprintf("SELECT * FROM (\n%s\n) AS dbarrow_incremental WHERE %s", query, predicate)
+		slog.Info("fetching rows above the watermark", "watermark_column", state.Column, "watermark", state.Value)
+	}
+
+	// The highest value is taken over every row fetched, before --filter or --sample
+	// drop any: those rows were seen and are not meant to be fetched again.
+	high := &watermarkTracker{column: opts.watermarkColumn}
+	fetch := pipeline.Query(client, query, opts.params.args()...)
+	source := pipeline.SourceFunc(func(ctx context.Context, fn func(arrow.Record) error) error {
+		return fetch.Records(ctx, func(rec arrow.Record) error {
+			if err := high.observe(rec); err != nil {
+				return err
+			}
+			return fn(rec)
+		})
+	})
+	if err := writeResult(ctx, client, opts, 0, source, stats); err != nil {
+		return err
+	}
+	if ctx.Err() != nil {
+		slog.Warn("interrupted: the watermark was not advanced", "state_file", opts.stateFile)
+		return nil
+	}
+	if high.state == nil {
+		slog.Info("no new rows: the watermark is unchanged", "state_file", opts.stateFile)
+		return nil
+	}
+	high.state.Updated = time.Now().UTC()
+	if err := saveWatermark(opts.stateFile, high.state); err != nil {
+		return fmt.Errorf("the result was written but the watermark could not be saved: %w", err)
+	}
+	slog.Info("watermark advanced", "watermark_column", high.state.Column, "watermark", high.state.Value)
+	return nil
+}
+
+// watermarkPredicate returns the WHERE condition selecting the rows above the state's
+// watermark.
+func watermarkPredicate(s *watermarkState) (string, error) {
+	column := quoteIdent(s.Column)
+	var literal string
+	switch s.Type {
+	case "timestamp":
+		// The value carries its offset, so the session time zone does not shift it.
+		literal = "TIMESTAMP " + arrowfetch.QuoteString(s.Value)
+	case "timestamp_ntz":
+		// A wall-clock time, compared as such whatever the session time zone.
+		literal = "TIMESTAMP_NTZ " + arrowfetch.QuoteString(s.Value)
+	case "date":
+		literal = "DATE " + arrowfetch.QuoteString(s.Value)
+	case "bigint", "decimal", "double":
+		if _, err := strconv.ParseFloat(s.Value, 64); err != nil {
+			return "", fmt.Errorf("invalid %s watermark %q", s.Type, s.Value)
+		}
+		literal = s.Value
+	case "string":
+		literal = arrowfetch.QuoteString(s.Value)
+	default:
+		return "", fmt.Errorf("unsupported watermark type %q", s.Type)
+	}
+	return column + " > " + literal, nil
+}
+
+// loadWatermark reads the state file, returning nil when it does not exist yet.
+func loadWatermark(path string) (*watermarkState, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the state file: %w", err)
+	}
+	var s watermarkState
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("corrupt state file %s: %w", path, err)
+	}
+	if s.Column == "" || s.Value == "" {
+		return nil, fmt.Errorf("state file %s has no column or value", path)
+	}
+	return &s, nil
+}
+
+// saveWatermark replaces the state file with s. It is written next to the old file and
+// renamed over it, so a crash leaves either the old or the new watermark.
+func saveWatermark(path string, s *watermarkState) error {
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// watermarkTracker keeps the highest non-null value of the watermark column among the
+// batches it observes.
+type watermarkTracker struct {
+	column string
+	index  int // of the column in the batches, once found
+	found  bool
+	state  *watermarkState
+
+	// The highest value so far, in the field matching the column type.
+	i   int64
+	f   float64
+	d   decimal128.Num
+	s   string
+	set bool
+}
+
+// observe updates the highest value with the rows of rec.
+func (t *watermarkTracker) observe(rec arrow.Record) error {
+	if !t.found {
+		idx := -1
+		for i, f := range rec.Schema().Fields() {
+			if strings.EqualFold(f.Name, t.column) {
+				idx = i
+				break
+			}
+		}
+		if idx < 0 {
+			return fmt.Errorf("--watermark-column %s is not a column of the result", t.column)
+		}
+		t.index, t.found = idx, true
+	}
+	col := rec.Column(t.index)
+	for r := 0; r < col.Len(); r++ {
+		if col.IsNull(r) {
+			continue
+		}
+		switch c := col.(type) {
+		case *array.Int8:
+			t.integer(int64(c.Value(r)))
+		case *array.Int16:
+			t.integer(int64(c.Value(r)))
+		case *array.Int32:
+			t.integer(int64(c.Value(r)))
+		case *array.Int64:
+			t.integer(c.Value(r))
+		case *array.Float32:
+			t.float(float64(c.Value(r)))
+		case *array.Float64:
+			t.float(c.Value(r))
+		case *array.Date32:
+			t.integer(int64(c.Value(r)))
+		case *array.Timestamp:
+			// Compared in microseconds, the precision of Databricks timestamps.
+			unit := c.DataType().(*arrow.TimestampType).Unit
+			t.integer(c.Value(r).ToTime(unit).UnixMicro())
+		case *array.Decimal128:
+			if v := c.Value(r); !t.set || v.Greater(t.d) {
+				t.d, t.set = v, true
+			}
+		case *array.String:
+			if v := c.Value(r); !t.set || v > t.s {
+				t.s, t.set = v, true
+			}
+		default:
+			return fmt.Errorf("--watermark-column %s has type %s, expected an integer, decimal, floating-point, date, timestamp or string column", t.column, col.DataType())
+		}
+	}
+	if t.set {
+		t.state = t.record(col.DataType())
+	}
+	return nil
+}
+
+func (t *watermarkTracker) integer(v int64) {
+	if !t.set || v > t.i {
+		t.i, t.set = v, true
+	}
+}
+
+func (t *watermarkTracker) float(v float64) {
+	if !t.set || v > t.f {
+		t.f, t.set = v, true
+	}
+}
+
+// record returns the state recording the highest value of a column of type dt.
+func (t *watermarkTracker) record(dt arrow.DataType) *watermarkState {
+	s := &watermarkState{Column: t.column}
+	switch dt.ID() {
+	case arrow.DATE32:
+		s.Type, s.Value = "date", arrow.Date32(t.i).ToTime().Format("2006-01-02")
+	case arrow.TIMESTAMP:
+		// TIMESTAMP_NTZ columns come without a time zone and hold wall-clock times, which
+		// are recorded without an offset.
+		s.Type, s.Value = "timestamp", time.UnixMicro(t.i).UTC().Format("2006-01-02 15:04:05.999999Z07:00")
+		if dt.(*arrow.TimestampType).TimeZone == "" {
+			s.Type, s.Value = "timestamp_ntz", time.UnixMicro(t.i).UTC().Format("2006-01-02 15:04:05.999999")
+		}
+	case arrow.DECIMAL128:
+		s.Type, s.Value = "decimal", t.d.ToString(dt.(*arrow.Decimal128Type).Scale)
+	case arrow.FLOAT32, arrow.FLOAT64:
+		s.Type, s.Value = "double", strconv.FormatFloat(t.f, 'g', -1, 64)
+	case arrow.STRING:
+		s.Type, s.Value = "string", t.s
+	default:
+		s.Type, s.Value = "bigint", strconv.FormatInt(t.i, 10)
+	}
+	return s
+}
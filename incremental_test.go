@@ -0,0 +1,44 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+func TestWatermarkTimestamps(t *testing.T) {
+	for _, tc := range []struct {
+		dt   *arrow.TimestampType
+		want string
+	}{
+		{arrow.FixedWidthTypes.Timestamp_us.(*arrow.TimestampType), "`ts` > TIMESTAMP '2026-10-05 12:30:00.5Z'"},
+		{&arrow.TimestampType{Unit: arrow.Microsecond}, "`ts` > TIMESTAMP_NTZ '2026-10-05 12:30:00.5'"},
+	} {
+		b := array.NewRecordBuilder(memory.DefaultAllocator, arrow.NewSchema([]arrow.Field{{Name: "ts", Type: tc.dt}}, nil))
+		b.Field(0).(*array.TimestampBuilder).AppendValues([]arrow.Timestamp{1791203400500000, 1791203000000000}, nil)
+		rec := b.NewRecord()
+		b.Release()
+
+		tracker := &watermarkTracker{column: "ts"}
+		if err := tracker.observe(rec); err != nil {
+			t.Fatal(err)
+		}
+		rec.Release()
+		got, err := watermarkPredicate(tracker.state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("%s: got %s, want %s", tc.dt, got, tc.want)
+		}
+	}
+}
+
+func TestWatermarkString(t *testing.T) {
+	got, err := watermarkPredicate(&watermarkState{Column: "name", Type: "string", Value: `O'Brien\`})
+	if want := "`name` > 'O\\'Brien\\\\'"; err != nil || got != want {
+		t.Errorf("got %s, %v, want %s", got, err, want)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+)
+
+// fileFormats maps file extensions to the FILEFORMAT of COPY INTO.
+var fileFormats = map[string]string{
+	".csv":     "csv",
+	".tsv":     "csv",
+	".json":    "json",
+	".ndjson":  "json",
+	".jsonl":   "json",
+	".parquet": "parquet",
+	".avro":    "avro",
+	".orc":     "orc",
+	".txt":     "text",
+}
+
+// checkIngest validates the flags of "ingest" and settles the format of the files.
+func checkIngest(opts *cliOptions) error {
+	if opts.query != "" || opts.queryFile != "" {
+		return errors.New("ingest loads files and cannot be combined with --query or --query-file")
+	}
+	if !strings.HasPrefix(opts.ingestVolume, "/Volumes/") {
+		return errors.New("ingest uploads the files to a Unity Catalog volume: set --volume, e.g. --volume /Volumes/main/raw/landing")
+	}
+	seen := map[string]string{}
+	for _, f := range opts.ingestFiles {
+		name := filepath.Base(f)
+		if other, ok := seen[name]; ok {
+			return fmt.Errorf("%s and %s would be uploaded to the same file %s", other, f, name)
+		}
+		seen[name] = f
+	}
+	if opts.ingestTable == "" {
+		if opts.fileFormat != "" || len(opts.formatOptions) > 0 || len(opts.copyOptions) > 0 || opts.removeStaged {
+			return errors.New("--file-format, --format-option, --copy-option and --remove-staged apply to ingest --into")
+		}
+		return nil
+	}
+	switch opts.fileFormat {
+	case "csv", "json", "parquet", "avro", "orc", "text", "binaryfile":
+	case "":
+		// Every file must then have the same known extension.
+		for _, f := range opts.ingestFiles {
+			format, ok := fileFormats[strings.ToLower(filepath.Ext(f))]
+			switch {
+			case !ok:
+				return fmt.Errorf("unknown format of %s: set --file-format", f)
+			case opts.fileFormat != "" && format != opts.fileFormat:
+				return fmt.Errorf("%s is %s and not %s like the other files: COPY INTO loads files of one format", f, format, opts.fileFormat)
+			}
+			opts.fileFormat = format
+		}
+	default:
+		return fmt.Errorf("unsupported --file-format %q, expected csv, json, parquet, avro, orc, text or binaryfile", opts.fileFormat)
+	}
+	return nil
+}
+
+// runIngest runs "ingest": the files are uploaded to the volume directory with PUT,
+// replacing files of the same name, and with --into loaded into the table with one
+// COPY INTO, whose result (the rows inserted) is written like the result of a query.
+// With --remove-staged the uploaded files are removed once they are loaded.
+func runIngest(ctx context.Context, client *arrowfetch.Client, opts *cliOptions, stats *runStats) error {
+	dir := strings.TrimSuffix(opts.ingestVolume, "/")
+	var staged []string
+	for i, f := range opts.ingestFiles {
+		target := dir + "/" + filepath.Base(f)
+		slog.Info("uploading", "file", f, "to", target, "n", i+1, "of", len(opts.ingestFiles))
+		if err := client.Put(ctx, f, target, true); err != nil {
+			return err
+		}
+		staged = append(staged, target)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	if opts.ingestTable == "" {
+		slog.Info("uploaded", "files", len(staged), "volume", dir)
+		return nil
+	}
+
+	query := copyIntoQuery(opts.ingestTable, dir, opts.ingestFiles, opts.fileFormat, opts.formatOptions, opts.copyOptions)
+	slog.Info("loading", "table", opts.ingestTable, "files", len(staged))
+	if err := writeResult(ctx, client, opts, 0, pipeline.Query(client, query), stats); err != nil {
+		return fmt.Errorf("unable to load the files into %s: %w", opts.ingestTable, err)
+	}
+	if !opts.removeStaged || ctx.Err() != nil {
+		return nil
+	}
+	for _, target := range staged {
+		if err := client.Remove(ctx, target); err != nil {
+			return err
+		}
+	}
+	slog.Info("removed the uploaded files", "files", len(staged))
+	return nil
+}
+
+// copyIntoQuery returns the COPY INTO statement loading the named files of dir into
+// table.
+func copyIntoQuery(table, dir string, files []string, format string, formatOptions, copyOptions keyValues) string {
+	names := make([]string, len(files))
+	for i, f := range files {
+		names[i] = arrowfetch.QuoteString(filepath.Base(f))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "COPY INTO %s\nFROM %s\nFILEFORMAT = %s\nFILES = (%s)", table, arrowfetch.QuoteString(dir), strings.ToUpper(format), strings.Join(names, ", "))
+	if len(formatOptions) > 0 {
+		fmt.Fprintf(&b, "\nFORMAT_OPTIONS (%s)", sqlOptions(formatOptions))
+	}
+	if len(copyOptions) > 0 {
+		fmt.Fprintf(&b, "\nCOPY_OPTIONS (%s)", sqlOptions(copyOptions))
+	}
+	return b.String()
+}
+
+// sqlOptions returns the options as 'key' = 'value' pairs in key order.
+func sqlOptions(options keyValues) string {
+	keys := make([]string, 0, len(options))
+	for k := range options {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = arrowfetch.QuoteString(k) + " = " + arrowfetch.QuoteString(options[k])
+	}
+	return strings.Join(pairs, ", ")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+func TestIngest(t *testing.T) {
+	dir := t.TempDir()
+	var files []string
+	for _, name := range []string{"a.csv", "b.csv"} {
+		f := filepath.Join(dir, name)
+		if err := os.WriteFile(f, []byte("id\n1\n"), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, f)
+	}
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+	client, err := arrowfetchtest.NewClient(func(query string, _ []driver.NamedValue) ([]arrow.Record, error) {
+		mu.Lock()
+		queries = append(queries, query)
+		mu.Unlock()
+		return arrowfetchtest.Batches(1, 1), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	args := append([]string{"ingest"}, files...)
+	args = append(args, "--volume", "/Volumes/main/raw/landing/", "--into", "main.raw.events",
+		"--format-option", "header=true", "--remove-staged", "--format", "csv", "--out", filepath.Join(dir, "result.csv"), "--progress", "never")
+	opts, err := parseFlags(args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats runStats
+	if err := runIngest(context.Background(), client, opts, &stats); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"PUT '" + files[0] + "' INTO '/Volumes/main/raw/landing/a.csv' OVERWRITE",
+		"PUT '" + files[1] + "' INTO '/Volumes/main/raw/landing/b.csv' OVERWRITE",
+		"COPY INTO main.raw.events\nFROM '/Volumes/main/raw/landing'\nFILEFORMAT = CSV\nFILES = ('a.csv', 'b.csv')\nFORMAT_OPTIONS ('header' = 'true')",
+		"REMOVE '/Volumes/main/raw/landing/a.csv'",
+		"REMOVE '/Volumes/main/raw/landing/b.csv'",
+	}
+	if strings.Join(queries, "\n;\n") != strings.Join(want, "\n;\n") {
+		t.Errorf("got statements\n%s\nwant\n%s", strings.Join(queries, "\n;\n"), strings.Join(want, "\n;\n"))
+	}
+}
+
+func TestIngestMixedFormats(t *testing.T) {
+	_, err := parseFlags([]string{"ingest", "a.csv", "b.parquet", "--volume", "/Volumes/main/raw/landing", "--into", "main.raw.events"})
+	if err == nil || !strings.Contains(err.Error(), "COPY INTO loads files of one format") {
+		t.Errorf("got error %v", err)
+	}
+}
@@ -0,0 +1,8 @@
+// Package integration holds the end-to-end tests that run real queries on a Databricks
+// SQL warehouse. They are skipped unless DATABRICKS_HOST, DATABRICKS_HTTP_PATH and
+// DATABRICKS_ACCESS_TOKEN are set:
+//
+//	DATABRICKS_HOST=... DATABRICKS_HTTP_PATH=... DATABRICKS_ACCESS_TOKEN=... go test ./integration -v
+//
+// The tests only read the samples catalog, which every workspace has.
+package integration
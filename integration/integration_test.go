@@ -0,0 +1,173 @@
+package integration
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+const trips = "samples.nyctaxi.trips"
+
+// newClient connects to the warehouse of the environment, or skips the test when it is
+// not configured. Sessions run in UTC so that timestamps render the same everywhere.
+func newClient(t *testing.T, opts ...arrowfetch.Option) *arrowfetch.Client {
+	t.Helper()
+	host, path, token := os.Getenv("DATABRICKS_HOST"), os.Getenv("DATABRICKS_HTTP_PATH"), os.Getenv("DATABRICKS_ACCESS_TOKEN")
+	if host == "" || path == "" || token == "" {
+		t.Skip("set DATABRICKS_HOST, DATABRICKS_HTTP_PATH and DATABRICKS_ACCESS_TOKEN to run the integration tests")
+	}
+	host = strings.TrimSuffix(strings.TrimPrefix(host, "https://"), "/")
+	client, err := arrowfetch.New(append([]arrowfetch.Option{
+		arrowfetch.WithHost(host),
+		arrowfetch.WithHTTPPath(path),
+		arrowfetch.WithAccessToken(token),
+		arrowfetch.WithTimeout(5 * time.Minute),
+		arrowfetch.WithSessionParams(map[string]string{"TIMEZONE": "UTC"}),
+	}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	return client
+}
+
+func TestTripsSchema(t *testing.T) {
+	client := newClient(t)
+	schema, err := client.Schema(context.Background(), "SELECT * FROM "+trips)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		name string
+		typ  arrow.DataType
+	}{
+		{"tpep_pickup_datetime", arrow.FixedWidthTypes.Timestamp_us},
+		{"tpep_dropoff_datetime", arrow.FixedWidthTypes.Timestamp_us},
+		{"trip_distance", arrow.PrimitiveTypes.Float64},
+		{"fare_amount", arrow.PrimitiveTypes.Float64},
+		{"pickup_zip", arrow.PrimitiveTypes.Int32},
+		{"dropoff_zip", arrow.PrimitiveTypes.Int32},
+	}
+	if len(schema.Fields()) != len(want) {
+		t.Fatalf("schema has %d columns, want %d:\n%s", len(schema.Fields()), len(want), schema)
+	}
+	for i, w := range want {
+		f := schema.Field(i)
+		if f.Name != w.name || !arrow.TypeEqual(f.Type, w.typ) {
+			t.Errorf("column %d is %s %s, want %s %s", i, f.Name, f.Type, w.name, w.typ)
+		}
+	}
+}
+
+func TestTripsBatches(t *testing.T) {
+	const rows, perBatch = 10000, 1000
+	client := newClient(t, arrowfetch.WithMaxRows(perBatch))
+	query := "SELECT * FROM " + trips + " LIMIT 10000"
+	ctx := context.Background()
+	schema, err := client.Schema(ctx, query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var batches int
+	var total int64
+	err = client.Fetch(ctx, query, func(rec arrow.Record) error {
+		batches++
+		total += rec.NumRows()
+		if rec.NumRows() > perBatch {
+			t.Errorf("batch %d has %d rows, more than the %d per fetch", batches, rec.NumRows(), perBatch)
+		}
+		// The batches have the types Schema describes.
+		for i, f := range rec.Schema().Fields() {
+			if want := schema.Field(i); f.Name != want.Name || !arrow.TypeEqual(f.Type, want.Type) {
+				t.Errorf("batch %d: column %d is %s %s, Schema said %s %s", batches, i, f.Name, f.Type, want.Name, want.Type)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != rows {
+		t.Errorf("fetched %d rows, want %d", total, rows)
+	}
+	if batches < rows/perBatch {
+		t.Errorf("fetched %d batches, want at least %d", batches, rows/perBatch)
+	}
+}
+
+// typesQuery selects one value of each common type, and a NULL.
+const typesQuery = `SELECT
+	CAST(7 AS TINYINT) AS tiny,
+	CAST(-300 AS SMALLINT) AS small,
+	42 AS i,
+	CAST(9007199254740991 AS BIGINT) AS big,
+	CAST(0.5 AS FLOAT) AS f,
+	1.25D AS d,
+	true AS b,
+	'héllo, "world"' AS s,
+	CAST(12.50 AS DECIMAL(10,2)) AS dec,
+	DATE'2024-01-31' AS dt,
+	TIMESTAMP'2024-01-31 12:34:56.789' AS ts,
+	X'CAFE' AS bin,
+	ARRAY(1, 2, 3) AS arr,
+	CAST(NULL AS STRING) AS nothing`
+
+// typesJSON is the NDJSON rendering of typesQuery.
+const typesJSON = `{"tiny":7,"small":-300,"i":42,"big":9007199254740991,"f":0.5,"d":1.25,"b":true,` +
+	`"s":"héllo, \"world\"","dec":"12.50","dt":"2024-01-31","ts":"2024-01-31T12:34:56.789Z",` +
+	`"bin":"yv4=","arr":[1,2,3],"nothing":null}`
+
+func TestTypeRendering(t *testing.T) {
+	for _, mode := range []string{"arrow", "rows"} {
+		t.Run(mode, func(t *testing.T) {
+			var opts []arrowfetch.Option
+			if mode == "rows" {
+				opts = append(opts, arrowfetch.WithRowMode())
+			}
+			client := newClient(t, opts...)
+			ctx := context.Background()
+
+			var out strings.Builder
+			w := sink.NewNDJSONWriter(&out, sink.NDJSONOptions{})
+			if err := client.Fetch(ctx, typesQuery, w.Write); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.TrimSpace(out.String())
+			want := typesJSON
+			if mode == "rows" {
+				// Row mode reads nested values as their JSON text.
+				want = strings.Replace(want, `"arr":[1,2,3]`, `"arr":"[1,2,3]"`, 1)
+			}
+			if !sameJSON(t, got, want) {
+				t.Errorf("rendered\n%s\nwant\n%s", got, want)
+			}
+		})
+	}
+}
+
+// sameJSON compares two JSON objects regardless of number formatting.
+func sameJSON(t *testing.T, a, b string) bool {
+	t.Helper()
+	var x, y map[string]any
+	if err := json.Unmarshal([]byte(a), &x); err != nil {
+		t.Fatalf("invalid JSON %s: %v", a, err)
+	}
+	if err := json.Unmarshal([]byte(b), &y); err != nil {
+		t.Fatalf("invalid JSON %s: %v", b, err)
+	}
+	xs, _ := json.Marshal(x)
+	ys, _ := json.Marshal(y)
+	return string(xs) == string(ys)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// runKeyset runs the query for --keyset-column as a series of pages of up to
+// --page-size rows, each fetched by a query of its own ordered by the key column and
+// starting after the highest key of the page before:
+//
+//	SELECT * FROM (<query>) WHERE key > <last key> ORDER BY key LIMIT <page size>
+//
+// No single statement has to produce the whole result. The pages go to one destination,
+// or with {n} in --out or a --sink each page is written as its own result. The key of
+// the last page written is then recorded in --state-file, so an interrupted extract
+// resumes with the page after it.
+func runKeyset(ctx context.Context, client *arrowfetch.Client, query string, opts *cliOptions, stats *runStats) error {
+	if len(arrowfetch.SplitStatements(query)) > 1 {
+		return errors.New("--keyset-column pages a single query, not a script")
+	}
+	var last *watermarkState
+	if opts.stateFile != "" && !opts.fullRefresh {
+		state, err := loadWatermark(opts.stateFile)
+		if err != nil {
+			return err
+		}
+		if state != nil && !strings.EqualFold(state.Column, opts.keysetColumn) {
+			return fmt.Errorf("%s records a key for column %s, not %s; use --full-refresh to start over with the new column", opts.stateFile, state.Column, opts.keysetColumn)
+		}
+		if state != nil {
+			slog.Info("resuming after the recorded key", "key_column", state.Column, "key", state.Value, "page", state.Page)
+		}
+		last = state
+	}
+
+	page := 0
+	if last != nil {
+		page = last.Page
+	}
+	perPage := opts.sink != "" || strings.Contains(opts.out, "{n}")
+	pages := pipeline.SourceFunc(func(ctx context.Context, fn func(arrow.Record) error) error {
+		for {
+			pageQuery, err := keysetQuery(query, opts.keysetColumn, opts.pageSize, last)
+			if err != nil {
+				return err
+			}
+			slog.Info("page", "n", page, "after", keyValue(last))
+
+			// The last key of the page is its highest, as the rows come ordered by it.
+			high := &watermarkTracker{column: opts.keysetColumn}
+			var rows int64
+			source := pipeline.Query(client, pageQuery, opts.params.args()...)
+			observe := func(ctx context.Context, fn func(arrow.Record) error) error {
+				return source.Records(ctx, func(rec arrow.Record) error {
+					if err := high.observe(rec); err != nil {
+						return err
+					}
+					rows += rec.NumRows()
+					return fn(rec)
+				})
+			}
+			if perPage {
+				err = writeResult(ctx, client, opts, page, pipeline.SourceFunc(observe), stats)
+			} else {
+				err = observe(ctx, fn)
+			}
+			if err != nil {
+				return fmt.Errorf("page %d: %w", page, err)
+			}
+			if ctx.Err() != nil {
+				return nil
+			}
+			if high.state != nil {
+				last = high.state
+			}
+			page++
+
+			// A page written as its own result is complete, so the extract can resume
+			// after it. A page short of the page size was the last.
+			if opts.stateFile != "" && high.state != nil {
+				last.Page, last.Updated = page, time.Now().UTC()
+				if err := saveWatermark(opts.stateFile, last); err != nil {
+					return fmt.Errorf("page %d was written but its key could not be saved: %w", page-1, err)
+				}
+			}
+			if rows < opts.pageSize {
+				slog.Info("last page", "pages", page, "last_key", keyValue(last))
+				return nil
+			}
+		}
+	})
+	if perPage {
+		return pages(ctx, nil)
+	}
+	return writeResult(ctx, client, opts, 0, pages, stats)
+}
+
+// keysetQuery returns the query of the page after the key last, or of the first page
+// when last is nil.
+func keysetQuery(query, column string, size int64, last *watermarkState) (string, error) {
+	quoted := quoteIdent(column)
+	where := ""
+	if last != nil {
+		predicate, err := watermarkPredicate(last)
+		if err != nil {
+			return "", err
+		}
+		where = " WHERE " + predicate
+	}
+	return fmt.Sprintf("SELECT * FROM (\n%s\n) AS dbarrow_page%s ORDER BY %s LIMIT %d", query, where, quoted, size), nil
+}
+
+// keyValue returns the key for the log, or "start" before the first page.
+func keyValue(s *watermarkState) string {
+	if s == nil {
+		return "start"
+	}
+	return s.Value
+}
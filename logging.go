@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Diagnostics go to stderr through log/slog, so stdout carries nothing but the result.
+// The handler writes to logOutput, which the REPL points at readline's stderr while the
+// prompt is shown.
+var logOutput = &switchWriter{w: os.Stderr}
+
+// switchWriter is an io.Writer whose destination can be replaced while in use.
+type switchWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (s *switchWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.w.Write(p)
+}
+
+// set sends the output to w and returns a function restoring the previous destination.
+func (s *switchWriter) set(w io.Writer) (restore func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.w
+	s.w = w
+	return func() { s.set(prev) }
+}
+
+// setupLogging installs the default slog logger for --log-level and --log-format. The
+// standard log package is routed through it as well, at the info level.
+func setupLogging(level, format string) error {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return fmt.Errorf("unsupported --log-level %q, expected debug, info, warn or error", level)
+	}
+	opts := &slog.HandlerOptions{
+		Level: l,
+		// Durations read as 1.5s rather than nanoseconds, in JSON as well.
+		ReplaceAttr: func(_ []string, a slog.Attr) slog.Attr {
+			if a.Value.Kind() == slog.KindDuration {
+				a.Value = slog.StringValue(a.Value.Duration().String())
+			}
+			return a
+		},
+	}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "text":
+		h = slog.NewTextHandler(logOutput, opts)
+	case "json":
+		h = slog.NewJSONHandler(logOutput, opts)
+	default:
+		return fmt.Errorf("unsupported --log-format %q, expected text or json", format)
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
+
+// fatal logs err and exits with status 1.
+func fatal(err error) {
+	slog.Error(err.Error())
+	os.Exit(1)
+}
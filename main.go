@@ -2,194 +2,381 @@ package main
 
 import (
 	"context"
-	"database/sql"
-	"database/sql/driver"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/metrics"
+	"dbx_arrow_dbsql/pkg/pipeline"
+	"dbx_arrow_dbsql/pkg/sink"
+
 	"github.com/apache/arrow/go/v12/arrow"
-	"github.com/apache/arrow/go/v12/arrow/array"
-	dbsql "github.com/databricks/databricks-sql-go"
-	dbsqlrows "github.com/databricks/databricks-sql-go/rows"
-	"github.com/joho/godotenv"
 )
 
 func main() {
-	// Load environment variables from .env file (containing Databricks credentials).
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal(err.Error())
+	// Run the auth subcommands, which manage stored credentials instead of querying.
+	if len(os.Args) > 1 && os.Args[1] == "auth" {
+		if err := runAuth(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fatal(err)
+		}
+		return
 	}
 
-	// Port configuration for the Databricks SQL connector.
-	port := 443
-	if err != nil {
-		log.Fatal(err.Error())
+	// List the query history; "history run <n>" is handled by the regular flags below.
+	if len(os.Args) > 1 && os.Args[1] == "history" && (len(os.Args) < 3 || os.Args[2] != "run") {
+		if err := runHistory(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fatal(err)
+		}
+		return
 	}
 
-	// Create a new Databricks SQL connector using the credentials from environment variables.
-	connector, err := dbsql.NewConnector(
-		dbsql.WithServerHostname(os.Getenv("DATABRICKS_HOST")),
-		dbsql.WithPort(port),
-		dbsql.WithHTTPPath(os.Getenv("DATABRICKS_HTTP_PATH")),
-		dbsql.WithAccessToken(os.Getenv("DATABRICKS_ACCESS_TOKEN")),
-		dbsql.WithMaxRows(100000), // Set a maximum number of rows to fetch.
-	)
+	// Check the files of an export against its manifest, without a warehouse.
+	if len(os.Args) > 1 && os.Args[1] == "verify" {
+		if err := runVerify(os.Args[2:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fatal(err)
+		}
+		return
+	}
+
+	// Show the state of the scheduled jobs, without a warehouse.
+	if len(os.Args) > 2 && os.Args[1] == "schedule" && os.Args[2] == "status" {
+		if err := runScheduleStatus(os.Args[3:]); err != nil && !errors.Is(err, flag.ErrHelp) {
+			fatal(err)
+		}
+		return
+	}
 
-	// Handle any error while creating the connector.
+	// Parse the command line flags.
+	opts, err := parseFlags(os.Args[1:])
 	if err != nil {
-		log.Fatal(err)
+		if errors.Is(err, flag.ErrHelp) {
+			os.Exit(0)
+		}
+		fatal(err)
+	}
+	if err := setupLogging(opts.logLevel, opts.logFormat); err != nil {
+		fatal(err)
 	}
 
-	// Open the SQL connection using the connector.
-	db := sql.OpenDB(connector)
-	defer db.Close() // Ensure the connection is closed after operations are complete.
+	// Export OpenTelemetry spans of the run when an OTLP endpoint is configured.
+	shutdownTracing, err := setupTracing(context.Background(), opts.otlpEndpoint)
+	if err != nil {
+		fatal(fmt.Errorf("--otlp-endpoint: %w", err))
+	}
+	defer shutdownTracing()
 
-	// Call the function to retrieve and process the data.
-	getData(db)
-}
+	// Route the OAuth token endpoints and object store uploads through the explicit proxy,
+	// which they read from the environment. The connector gets it through WithProxy below.
+	if opts.proxy != "" {
+		os.Setenv("HTTPS_PROXY", opts.proxy)
+		os.Setenv("HTTP_PROXY", opts.proxy)
+	}
 
-// getData retrieves data from the database, processes it in Arrow batches, and prints the result.
-func getData(db *sql.DB) {
-	// Start the timer
-	start := time.Now()
+	// Resolve the SQL query to run.
+	query, err := opts.resolveQuery()
+	if err != nil {
+		fatal(err)
+	}
 
-	// Create a context with a 60-second timeout for the query execution.
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel()
+	// Resolve the connection settings from the selected profile or the environment.
+	prof, err := resolveProfile(opts)
+	if err != nil {
+		fatal(err)
+	}
 
-	// Establish a connection to the database.
-	conn, _ := db.Conn(ctx)
-	defer conn.Close()
+	prof.overrideSession(opts)
 
-	// SQL query to fetch data from the "nyctaxi.trips" table.
-	query := `SELECT * FROM samples.nyctaxi.trips`
+	// Authenticate with the method selected by the profile.
+	clientOpts, err := prof.clientOptions()
+	if err != nil {
+		fatal(err)
+	}
 
-	var rows driver.Rows
-	var err error
+	if opts.proxy != "" {
+		clientOpts = append(clientOpts, arrowfetch.WithProxy(opts.proxy))
+	}
+	if opts.caCert != "" {
+		clientOpts = append(clientOpts, arrowfetch.WithCACert(opts.caCert))
+	}
+	if opts.clientCert != "" {
+		clientOpts = append(clientOpts, arrowfetch.WithClientCert(opts.clientCert, opts.clientKey))
+	}
+	if opts.memoryLimit > 0 {
+		clientOpts = append(clientOpts, arrowfetch.WithMemoryLimit(opts.memoryLimit<<20))
+	}
+	// Log the driver's activity and every HTTP round trip for --debug.
+	if opts.debug {
+		setupDebug(opts.logFormat)
+		clientOpts = append(clientOpts, arrowfetch.WithRoundTripLog(logRoundTrip))
+	}
+	// Count the cloud fetch downloads for the summary, and log them for --debug.
+	setupDownloadClient(prof.Host, opts.cloudFetch, opts.debug)
+	// Download large results from cloud storage.
+	if opts.cloudFetch {
+		clientOpts = append(clientOpts, arrowfetch.WithCloudFetch(true), arrowfetch.WithDownloadThreads(opts.downloadThreads))
+	}
+	// Read results row by row where Arrow fetching is not available.
+	if opts.mode == "rows" {
+		clientOpts = append(clientOpts, arrowfetch.WithRowMode())
+	}
+	// Count queries, rows, latencies and errors for Prometheus.
+	if opts.metricsAddr != "" {
+		reg := metrics.NewRegistry()
+		clientOpts = append(clientOpts, arrowfetch.WithObserver(metrics.New(reg)))
+		if err := startMetrics(opts.metricsAddr, reg); err != nil {
+			fatal(fmt.Errorf("--metrics: %w", err))
+		}
+	}
 
-	// Execute the query using the underlying database driver.
-	err = conn.Raw(func(d interface{}) error {
-		rows, err = d.(driver.QueryerContext).QueryContext(ctx, query, nil)
-		return err
-	})
+	// Create a new client using the resolved credentials.
+	client, err := arrowfetch.New(append(clientOpts,
+		arrowfetch.WithMaxRows(opts.fetchBatchSize),
+		arrowfetch.WithUserAgent("dbarrow"),
+		arrowfetch.WithQueryTimeout(opts.queryTimeout),
+		arrowfetch.WithFetchTimeout(opts.fetchTimeout),
+		arrowfetch.WithRetry(opts.retryPolicy()),
+		arrowfetch.WithPrefetch(opts.prefetch),
+	)...)
 
-	// Handle any error while executing the query.
+	// Handle any error while creating the client.
 	if err != nil {
-		log.Fatalf("unable to run the query. err: %v", err)
+		fatal(err)
 	}
-	defer rows.Close() // Ensure the rows are closed after processing.
+	defer client.Close() // Ensure the connection is closed after operations are complete.
 
-	// Create a new context for fetching Arrow batches from the result.
-	ctx2, cancel2 := context.WithTimeout(context.Background(), 60*time.Second)
-	defer cancel2()
+	// Expose the runtime profiles while the run lasts, e.g. to watch a long export.
+	if opts.pprof != "" {
+		if err := startPprof(opts.pprof, client.Allocator()); err != nil {
+			fatal(fmt.Errorf("--pprof: %w", err))
+		}
+	}
 
-	// Retrieve Arrow batches from the query result.
-	batches, err := rows.(dbsqlrows.Rows).GetArrowBatches(ctx2)
-	if err != nil {
-		log.Fatalf("unable to get arrow batches. err: %v", err)
+	// The interactive shell handles Ctrl-C per statement itself.
+	if opts.command == "repl" {
+		if err := runREPL(client, prof, opts); err != nil {
+			fatal(err)
+		}
+		return
 	}
 
-	var iBatch, nRows int
+	// Cancel the query on Ctrl-C or SIGTERM. The driver then cancels the statement on the
+	// warehouse instead of leaving it running; a second Ctrl-C exits immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
+	ctx, endRun := startRunSpan(ctx, opts)
 
-	// Loop through the Arrow batches and process each batch.
-	for batches.HasNext() {
-		b, err := batches.Next()
-		if err != nil {
-			log.Fatalf("Failure retrieving batch. err: %v", err)
-		}
+	start := time.Now()
+	var stats runStats
+	// A single statement is sent without its trailing semicolon, e.g. from piped input.
+	statements := arrowfetch.SplitStatements(query)
+	if len(statements) == 1 {
+		query = statements[0]
+	}
+	switch {
+	case opts.command == "submit":
+		// Start the query on the warehouse and print its ID without waiting for it.
+		err = submit(ctx, client, query, opts)
+	case opts.command == "serve":
+		// Answer Flight requests with query results until interrupted.
+		err = serve(ctx, client, opts)
+	case opts.command == "schedule":
+		// Run the jobs of the config file on their schedules until interrupted.
+		err = runSchedule(ctx, client, opts)
+	case opts.command == "run-spec":
+		// Run the queries of the spec side by side, each to its own output.
+		err = runSpecFile(ctx, client, opts, &stats)
+	case opts.command == "export-all":
+		// Export every listed table to its own destination.
+		err = exportAll(ctx, client, opts, &stats)
+	case opts.command == "ingest":
+		// Upload the files to the volume and load them into the table.
+		err = runIngest(ctx, client, opts, &stats)
+	case opts.command == "tui":
+		// Browse the result interactively, loading batches as the user scrolls.
+		err = runTUI(ctx, client, statements, opts, &stats)
+	case opts.command == "bench":
+		// Compare reading the result as Arrow batches with scanning it row by row.
+		err = runBench(ctx, client, query, opts)
+	case opts.command == "diff":
+		// Compare two results row by row, aligned on the key columns.
+		err = runDiff(ctx, client, query, opts, &stats)
+	case opts.command == "fetch":
+		// Collect the result of a query started earlier with submit.
+		err = writeResult(ctx, client, opts, 0, pipeline.Statement(client, opts.statementID), &stats)
+	case opts.browse == "describe":
+		// List the columns of a table with their types and partitioning.
+		err = describeTable(ctx, client, query, opts, &stats)
+	case opts.browse == "ddl":
+		// Print the statement creating the table, translated with --dialect.
+		err = printDDL(ctx, client, opts.namespace, query, opts)
+	case opts.countOnly:
+		// Count the rows of the result on the warehouse instead of fetching them.
+		err = countRows(ctx, client, statements, opts)
+	case opts.explain != "":
+		// Print the plan of the query without running it.
+		err = explainPlan(ctx, client, statements, opts)
+	case opts.schemaOnly != "":
+		// Describe the result without running the query.
+		err = printSchema(ctx, client, statements, opts)
+	case opts.watch > 0:
+		// Run the query again at every interval until interrupted.
+		err = runWatch(ctx, client, statements, opts, &stats)
+	case opts.incremental:
+		// Fetch the rows added since the last run and advance the watermark.
+		err = runIncremental(ctx, client, query, opts, &stats)
+	case opts.keysetColumn != "":
+		// Fetch the result page by page, ordered by the key column.
+		err = runKeyset(ctx, client, query, opts, &stats)
+	case len(statements) == 1 && arrowfetch.IsStaging(query):
+		// Upload, download or remove a volume file with PUT, GET or REMOVE.
+		err = client.Stage(ctx, query, opts.stagingDir)
+	case len(statements) > 1:
+		// Run a script statement by statement.
+		err = runScript(ctx, client, statements, opts, &stats)
+	default:
+		err = writeResult(ctx, client, opts, 0, pipeline.Query(client, query, opts.params.args()...), &stats)
+	}
 
-		// Log the number of records in each batch.
-		log.Printf("batch %v: nRecords=%v\n", iBatch, b.NumRows())
+	// Report how close the run came to the memory limit.
+	if mem := client.Allocator(); mem != nil {
+		slog.Info("peak memory held in batches", "peak_mib", float64(mem.Peak())/(1<<20), "limit_mib", opts.memoryLimit)
+	}
 
-		// Print the content of the batch.
-		printBatch(b)
-		iBatch += 1
-		nRows += int(b.NumRows())
-		b.Release() // Release the batch to free memory.
+	// Record the run in the local query history; describing or explaining a query does
+	// not run it, the queries of a server belong to its clients, the scheduler keeps
+	// the state of its jobs itself and an ingest runs no query that could be rerun.
+	if !opts.noHistory && opts.schemaOnly == "" && opts.explain == "" && opts.command != "serve" && opts.command != "schedule" && opts.command != "ingest" {
+		recordHistory(opts, prof, query, start, stats, err, ctx.Err() != nil)
 	}
 
-	// Log the total number of rows processed.
-	log.Printf("NRows: %v\n", nRows)
+	// The deferred calls are skipped by the exits below, so send the spans first.
+	endRun(err)
+	shutdownTracing()
 
-	// Calculate the elapsed time.
-	elapsed := time.Since(start)
-	log.Printf("Data processing took %s", elapsed)
+	// Exit with the conventional status for SIGINT once the partial output is safe. A
+	// server or the scheduler stops on Ctrl-C as a matter of course.
+	if ctx.Err() != nil && opts.command != "serve" && opts.command != "schedule" {
+		slog.Warn("interrupted: kept the rows fetched so far")
+		client.Close()
+		os.Exit(130)
+	}
+	if err != nil {
+		fatal(err)
+	}
 }
 
-// printBatch prints all the rows and columns of an Arrow Record (batch) in a table format.
-func printBatch(record arrow.Record) {
-	// Get the schema of the record to print column names.
-	schema := record.Schema()
+// writeResult opens the destination of result n and streams the batches of source into
+// it through the transformations selected on the command line. The rows and bytes
+// fetched are added to stats, and the performance summary is logged even when the fetch
+// is interrupted part way.
+func writeResult(ctx context.Context, client *arrowfetch.Client, opts *cliOptions, n int, source pipeline.Source, stats *runStats) error {
+	// Open the output destination and the writer for the selected format or sink.
+	m := newManifest(opts)
+	out, writer, err := openDestination(opts, n, m)
+	if err != nil {
+		return err
+	}
+	sinkWriter := m.writer(writer)
+
+	p := pipeline.Pipeline{
+		Source:     source,
+		Transforms: transforms(opts),
+		Sink:       sinkWriter,
+		OnBatch: func(i int, b arrow.Record) {
+			// Log the number of records in each batch.
+			slog.Debug("batch", "n", i, "rows", b.NumRows())
+		},
+	}
+	var bar *progress
+	if showProgress(opts.progress) {
+		// The progress line replaces the per-batch log. Only --head bounds the rows
+		// read in advance (when no filter or sample precedes it), which gives an ETA.
+		var total int64
+		if opts.filter == "" && opts.sample == 0 {
+			total = opts.head
+		}
+		bar = newProgress(os.Stderr, total)
+		p.OnBatch = func(_ int, b arrow.Record) {
+			bar.add(b.NumRows(), arrowfetch.RecordSize(b))
+		}
+	}
+	var times arrowfetch.Timings
+	before := countDownloads()
+	result, err := p.Run(arrowfetch.WithTimings(ctx, &times))
+	if bar != nil {
+		bar.done()
+	}
+	stats.rows += result.Rows
+	stats.bytes += result.Bytes
 
-	// Get the list of fields (columns) from the schema.
-	fields := schema.Fields()
+	summary := newPerfSummary(result, &times)
+	summary.addDownloads(countDownloads().since(before))
+	if opts.warehouseMetrics && ctx.Err() == nil {
+		summary.addWarehouseMetrics(ctx, client)
+	}
+	if serr := summary.write(os.Stderr, opts.summary); serr != nil {
+		slog.Warn("unable to write the summary", "err", serr)
+	}
 
-	// Print the table headers (column names).
-	for _, field := range fields {
-		fmt.Printf("%s\t", field.Name) // Print column names separated by tabs.
+	// Keep the rows fetched before an interruption: the output is closed as if complete.
+	if ctx.Err() != nil {
+		err = nil
+	}
+	// --head stops the fetch once it has its rows; the result is complete for it.
+	if result.Stopped {
+		slog.Info("stopped after the first rows", "head", opts.head)
 	}
-	fmt.Println() // Newline after the column headers.
 
-	// Print a separator line for readability.
-	for range fields {
-		fmt.Print("--------\t") // Separator line with dashes.
+	// Flush the writer and close the output even when the fetch failed part way.
+	err = finish(sinkWriter, err)
+	err = finish(out, err)
+	if err != nil {
+		return err
 	}
-	fmt.Println()
 
-	// Loop through each row in the batch.
-	for rowIndex := 0; rowIndex < int(record.NumRows()); rowIndex++ {
-		// Loop through each column in the row and print the value.
-		for _, col := range record.Columns() {
-			// Print the value of the column at the current row.
-			printValue(col, rowIndex)
-			fmt.Print("\t") // Separate columns with tabs.
+	// The manifest vouches for a complete export, so an interrupted one has none.
+	if m != nil {
+		if ctx.Err() != nil {
+			slog.Warn("no manifest written: the export was interrupted")
+		} else if err := m.write(opts.manifest, n, &times, opts.uploadOptions()); err != nil {
+			return fmt.Errorf("unable to write the manifest: %w", err)
 		}
-		fmt.Println() // Newline after each row.
 	}
-	fmt.Println() // Extra newline for readability between batches.
+
+	// Warn when the output format could not hold every row (e.g. Excel's row limit).
+	if d, ok := writer.(interface{ Dropped() int64 }); ok && d.Dropped() > 0 {
+		slog.Warn(fmt.Sprintf("%s output is limited to %d rows; some rows were not written", opts.format, sink.XLSXMaxRows), "dropped", d.Dropped())
+	}
+	return nil
 }
 
-// printValue prints the value of a column for a specific row.
-func printValue(col arrow.Array, index int) {
-	// Use type assertion to determine the column's data type and print the value.
-	switch col := col.(type) {
-	case *array.Int32:
-		if col.IsNull(index) {
-			fmt.Print("NULL")
-		} else {
-			fmt.Print(col.Value(index))
-		}
-	case *array.Int64:
-		if col.IsNull(index) {
-			fmt.Print("NULL")
-		} else {
-			fmt.Print(col.Value(index))
-		}
-	case *array.Float64:
-		if col.IsNull(index) {
-			fmt.Print("NULL")
-		} else {
-			fmt.Printf("%.2f", col.Value(index))
-		}
-	case *array.String:
-		if col.IsNull(index) {
-			fmt.Print("NULL")
-		} else {
-			fmt.Printf("%s", col.Value(index))
-		}
-	case *array.Timestamp:
-		if col.IsNull(index) {
-			fmt.Print("NULL")
-		} else {
-			// Convert the timestamp to time.Time for better readability
-			ts := col.Value(index).ToTime(arrow.Microsecond)
-			fmt.Print(ts.Format(time.RFC3339)) // Format the timestamp as needed
-		}
-	default:
-		// Print a message for unsupported column types.
-		fmt.Printf("Unsupported type: %T", col)
+// finish closes c once the result has been written. When err reports that the result is
+// incomplete, outputs that can discard their work (uploads, Delta commits) are aborted instead,
+// so no truncated file is left behind.
+func finish(c io.Closer, err error) error {
+	if a, ok := c.(interface{ Abort(error) }); ok && err != nil {
+		a.Abort(err)
+		return err
+	}
+	if cerr := c.Close(); err == nil {
+		err = cerr
 	}
+	return err
+}
+
+// runStats accumulates the size of the results fetched during a run.
+type runStats struct {
+	rows  int64
+	bytes int64
 }
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/remote"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// manifest describes what an export wrote, for --manifest: every file with its rows,
+// bytes and SHA-256 checksum, the schema, and the query with the time it ran, so a
+// loader can check that it has the whole result before reading it, and "verify" that
+// the files are intact. It is written once the last file is complete; an interrupted
+// or failed export leaves none.
+type manifest struct {
+	Query       string          `json:"query,omitempty"`
+	QueryID     string          `json:"query_id,omitempty"`
+	Snapshot    time.Time       `json:"snapshot"` // when the query was sent
+	Format      string          `json:"format"`
+	Compress    string          `json:"compress,omitempty"`
+	PartitionBy []string        `json:"partition_by,omitempty"`
+	Rows        int64           `json:"rows"`
+	Bytes       int64           `json:"bytes"`
+	Files       []*manifestFile `json:"files"`
+	Schema      []schemaField   `json:"schema"`
+
+	mu     sync.Mutex
+	schema *arrow.Schema // of the records written, partition columns included
+}
+
+// manifestFile is one file written by the export. The path of a local file is relative
+// to the directory of the manifest, when the manifest is local too, so the export can
+// be moved or read from elsewhere.
+type manifestFile struct {
+	Path   string `json:"path"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+
+	// Local files are measured and hashed when the manifest is written, uploads as
+	// they are written.
+	local   bool
+	written int64
+	hash    hash.Hash
+}
+
+// newManifest returns the manifest of an export with the options of opts, or nil
+// without --manifest.
+func newManifest(opts *cliOptions) *manifest {
+	if opts.manifest == "" {
+		return nil
+	}
+	return &manifest{Format: opts.format, Compress: opts.compress, PartitionBy: opts.partitionBy, Files: []*manifestFile{}}
+}
+
+// track records a file opened at path and returns its output, which counts the bytes
+// of uploads. The rows are counted by the writer returned by manifestFile.count.
+func (m *manifest) track(path string, out io.WriteCloser) (io.WriteCloser, *manifestFile) {
+	if m == nil {
+		return out, nil
+	}
+	f := &manifestFile{Path: path}
+	if _, ok := out.(*os.File); ok {
+		f.local = true
+	} else {
+		f.hash = sha256.New()
+		out = &countedOutput{WriteCloser: out, n: &f.written, hash: f.hash}
+	}
+	m.mu.Lock()
+	m.Files = append(m.Files, f)
+	m.mu.Unlock()
+	return out, f
+}
+
+// count returns w counting the rows written to the file.
+func (f *manifestFile) count(w sink.Writer) sink.Writer {
+	if f == nil {
+		return w
+	}
+	return &rowCounter{Writer: w, rows: &f.Rows}
+}
+
+// writer returns w recording the rows and schema of the whole result.
+func (m *manifest) writer(w sink.Writer) sink.Writer {
+	if m == nil {
+		return w
+	}
+	return &rowCounter{Writer: w, rows: &m.Rows, schema: &m.schema}
+}
+
+// write completes the manifest with the query of times and writes it to path, with {n}
+// replaced by the result number n.
+func (m *manifest) write(path string, n int, times *arrowfetch.Timings, opts remote.Options) error {
+	m.Query, m.QueryID, m.Snapshot = times.Query, times.QueryID, times.Start.UTC()
+	m.Schema = []schemaField{}
+	if m.schema != nil {
+		for _, f := range m.schema.Fields() {
+			m.Schema = append(m.Schema, schemaField{Name: f.Name, SQLType: sqlType(f), ArrowType: f.Type.String(), Nullable: f.Nullable})
+		}
+	}
+	path = strings.ReplaceAll(path, "{n}", strconv.Itoa(n))
+	dir, err := filepath.Abs(filepath.Dir(path))
+	if err != nil || remote.IsRemote(path) {
+		dir = ""
+	}
+	for _, f := range m.Files {
+		if f.local {
+			var err error
+			if f.Bytes, f.SHA256, err = hashFile(f.Path); err != nil {
+				return err
+			}
+			if abs, err := filepath.Abs(f.Path); err == nil && dir != "" {
+				if rel, err := filepath.Rel(dir, abs); err == nil {
+					f.Path = filepath.ToSlash(rel)
+				}
+			}
+		} else {
+			f.Bytes, f.SHA256 = f.written, hex.EncodeToString(f.hash.Sum(nil))
+		}
+		m.Bytes += f.Bytes
+	}
+
+	out, err := openOutput(path, n, opts)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return finish(out, enc.Encode(m))
+}
+
+// hashFile returns the size and the hex SHA-256 checksum of the file at path.
+func hashFile(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	n, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return n, hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// rowCounter counts the rows written through it, and records their schema when schema
+// is set.
+type rowCounter struct {
+	sink.Writer
+	rows   *int64
+	schema **arrow.Schema
+}
+
+func (c *rowCounter) Write(rec arrow.Record) error {
+	if c.schema != nil && *c.schema == nil {
+		*c.schema = rec.Schema()
+	}
+	if err := c.Writer.Write(rec); err != nil {
+		return err
+	}
+	*c.rows += rec.NumRows()
+	return nil
+}
+
+func (c *rowCounter) Flush() error {
+	return sink.Flush(c.Writer)
+}
+
+// Abort aborts the wrapped Writer if it supports it, and closes it otherwise.
+func (c *rowCounter) Abort(err error) {
+	finish(c.Writer, err)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"net/http"
+
+	"dbx_arrow_dbsql/pkg/metrics"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// startMetrics serves the Prometheus metrics of reg on addr at /metrics for the rest of
+// the run, for scraping while a long export, a server or a schedule runs.
+func startMetrics(addr string, reg *prometheus.Registry) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler(reg))
+
+	// Listen before returning so a busy port fails the run instead of going unnoticed.
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("metrics on http://" + ln.Addr().String() + "/metrics")
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			slog.Error("metrics server", "err", err)
+		}
+	}()
+	return nil
+}
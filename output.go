@@ -0,0 +1,396 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/pipeline"
+	"dbx_arrow_dbsql/pkg/remote"
+	"dbx_arrow_dbsql/pkg/sink"
+)
+
+// nopCloser wraps stdout so closing the output does not close the process' stdout.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// openDestination opens the writer for result n: a database table when --sink is set,
+// otherwise the --format encoder writing to --out. The files opened are recorded in m,
+// if set.
+func openDestination(opts *cliOptions, n int, m *manifest) (io.WriteCloser, sink.Writer, error) {
+	if opts.sink != "" {
+		writer, err := newDatabaseWriter(opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		return nopCloser{io.Discard}, writer, nil
+	}
+
+	if len(opts.partitionBy) > 0 {
+		return nopCloser{io.Discard}, openPartitions(opts, n, m), nil
+	}
+	if opts.rolling() {
+		return nopCloser{io.Discard}, openRolling(opts, m), nil
+	}
+	if opts.workers > 1 && partFormat(opts.format) {
+		return openParts(opts, m)
+	}
+
+	out, err := openOutput(opts.out, n, opts.uploadOptions())
+	if err != nil {
+		return nil, nil, err
+	}
+	out, file := m.track(strings.ReplaceAll(opts.out, "{n}", strconv.Itoa(n)), out)
+	if opts.compress != "" {
+		if out, err = compressOutput(out, opts.compress); err != nil {
+			return nil, nil, err
+		}
+	}
+	writer, err := newWriter(opts, out)
+	if err != nil {
+		out.Close()
+		return nil, nil, err
+	}
+	return out, file.count(writer), nil
+}
+
+// partFormat reports whether --workers writes the format as one file per worker,
+// because its encoder cannot be split across goroutines.
+func partFormat(format string) bool {
+	switch format {
+	case "parquet", "avro", "orc", "arrow-stream", "feather":
+		return true
+	}
+	return false
+}
+
+// openParts opens one output file and writer per --workers, numbered from 0 in the {n}
+// of --out, and spreads the batches over them.
+func openParts(opts *cliOptions, m *manifest) (io.WriteCloser, sink.Writer, error) {
+	var (
+		outs    multiOutput
+		writers []sink.Writer
+	)
+	for i := 0; i < opts.workers; i++ {
+		out, err := openOutput(opts.out, i, opts.uploadOptions())
+		if err != nil {
+			outs.Abort(err)
+			return nil, nil, err
+		}
+		out, file := m.track(strings.ReplaceAll(opts.out, "{n}", strconv.Itoa(i)), out)
+		outs = append(outs, out)
+		writer, err := newWriter(opts, out)
+		if err != nil {
+			outs.Abort(err)
+			return nil, nil, err
+		}
+		writers = append(writers, file.count(writer))
+	}
+	return outs, sink.NewPoolWriter(writers), nil
+}
+
+// multiOutput closes the part files of openParts together.
+type multiOutput []io.WriteCloser
+
+// Write is not used: every part is written by its own writer.
+func (m multiOutput) Write(p []byte) (int, error) {
+	return 0, fmt.Errorf("write to a multi-part output")
+}
+
+func (m multiOutput) Close() error {
+	var first error
+	for _, out := range m {
+		if err := out.Close(); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Abort discards the parts that support it, such as uploads, and closes the others.
+func (m multiOutput) Abort(err error) {
+	for _, out := range m {
+		if a, ok := out.(interface{ Abort(error) }); ok {
+			a.Abort(err)
+		} else {
+			out.Close()
+		}
+	}
+}
+
+// openPartitions returns the writer of --partition-by: a file for each partition,
+// part-0 with the extension of --format in the Hive-style directory of its values under
+// the --out directory, created as the partition is first seen. A partition whose file
+// was closed to keep within --max-open-partitions continues in part-1, part-2 and so
+// on. With --max-rows-per-file or --max-file-size, every partition rolls over
+// part-00000, part-00001 and so on, numbered on across reopened files.
+func openPartitions(opts *cliOptions, n int, m *manifest) sink.Writer {
+	dir := strings.TrimSuffix(strings.ReplaceAll(opts.out, "{n}", strconv.Itoa(n)), "/")
+	ext := opts.fileExtension()
+	next := map[string]int{} // the number of the next file of each partition
+	return sink.NewPartitionWriter(opts.partitionBy, opts.maxOpenPartitions, func(partition string) (sink.Writer, error) {
+		if opts.rolling() {
+			return sink.NewRollingWriter(opts.rollingOptions(), func(int) (sink.Writer, error) {
+				part := next[partition]
+				next[partition]++
+				return openFile(opts, fmt.Sprintf("%s/%s/part-%05d.%s", dir, partition, part, ext), m)
+			}), nil
+		}
+		part := next[partition]
+		next[partition]++
+		return openFile(opts, fmt.Sprintf("%s/%s/part-%d.%s", dir, partition, part, ext), m)
+	})
+}
+
+// openRolling returns the writer of --max-rows-per-file and --max-file-size, which
+// rolls the result over numbered files: {n} in --out is replaced by the part number
+// padded to five digits, and an --out without {n} is a directory of part-00000,
+// part-00001 and so on with the extension of --format.
+func openRolling(opts *cliOptions, m *manifest) sink.Writer {
+	return sink.NewRollingWriter(opts.rollingOptions(), func(part int) (sink.Writer, error) {
+		num := fmt.Sprintf("%05d", part)
+		if strings.Contains(opts.out, "{n}") {
+			return openFile(opts, strings.ReplaceAll(opts.out, "{n}", num), m)
+		}
+		return openFile(opts, strings.TrimSuffix(opts.out, "/")+"/part-"+num+"."+opts.fileExtension(), m)
+	})
+}
+
+// openFile opens one of the files a result is split into, creating its directory when
+// it is local, and the writer for --format into it. The file is recorded in m, if set.
+func openFile(opts *cliOptions, path string, m *manifest) (*outputFile, error) {
+	if !remote.IsRemote(path) {
+		path = filepath.FromSlash(path)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return nil, fmt.Errorf("unable to create the output directory: %w", err)
+		}
+	}
+	out, err := openOutput(path, 0, opts.uploadOptions())
+	if err != nil {
+		return nil, err
+	}
+	out, file := m.track(path, out)
+	f := &outputFile{}
+	if file, ok := out.(*os.File); ok {
+		// A local file knows its size; uploads are counted as they are written.
+		f.file = file
+	} else {
+		out = &countedOutput{WriteCloser: out, n: &f.written}
+	}
+	if opts.compress != "" {
+		if out, err = compressOutput(out, opts.compress); err != nil {
+			return nil, err
+		}
+	}
+	f.out = out
+	writer, err := newWriter(opts, out)
+	if err != nil {
+		out.Close()
+		return nil, err
+	}
+	f.Writer = file.count(writer)
+	return f, nil
+}
+
+// fileExtension returns the file extension of the files written in --format, with the
+// extension of the --compress codec.
+func (o *cliOptions) fileExtension() string {
+	ext := o.format
+	switch o.format {
+	case "arrow-stream":
+		ext = "arrows"
+	case "feather":
+		ext = "arrow"
+	}
+	return ext + compressExtensions[o.compress]
+}
+
+// outputFile is the writer of one of the files of a split result, which closes its
+// file with it.
+type outputFile struct {
+	sink.Writer
+	out io.WriteCloser
+
+	// The size of the file, compressed if --compress is set.
+	file    *os.File
+	written int64
+}
+
+func (f *outputFile) Flush() error {
+	return sink.Flush(f.Writer)
+}
+
+func (f *outputFile) Close() error {
+	return finish(f.out, f.Writer.Close())
+}
+
+// Abort discards the file if its output supports it, such as an upload.
+func (f *outputFile) Abort(err error) {
+	f.Writer.Close()
+	finish(f.out, err)
+}
+
+// Size returns the bytes written to the file so far.
+func (f *outputFile) Size() int64 {
+	if f.file != nil {
+		if info, err := f.file.Stat(); err == nil {
+			return info.Size()
+		}
+	}
+	return f.written
+}
+
+// countedOutput adds the bytes written to it to n, and hashes them when hash is set.
+type countedOutput struct {
+	io.WriteCloser
+	n    *int64
+	hash hash.Hash
+}
+
+func (c *countedOutput) Write(p []byte) (int, error) {
+	n, err := c.WriteCloser.Write(p)
+	*c.n += int64(n)
+	if c.hash != nil {
+		c.hash.Write(p[:n])
+	}
+	return n, err
+}
+
+// Abort discards the output if it supports it, such as an upload.
+func (c *countedOutput) Abort(err error) {
+	finish(c.WriteCloser, err)
+}
+
+// openOutput opens the destination given by --out; "-" or an empty path means stdout.
+// Object store URLs such as s3://bucket/key are uploaded while the result is written.
+// A {n} placeholder in the path is replaced by n, the part or result number, which is 0
+// for a single file.
+func openOutput(path string, n int, opts remote.Options) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return nopCloser{os.Stdout}, nil
+	}
+	path = strings.ReplaceAll(path, "{n}", strconv.Itoa(n))
+	if remote.IsRemote(path) {
+		u, err := remote.Create(context.Background(), path, opts)
+		if err != nil {
+			return nil, err
+		}
+		return u, nil
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create output file: %w", err)
+	}
+	return f, nil
+}
+
+// transforms returns the post-fetch transformations selected on the command line, in
+// the order the batches go through them: --filter first, so it can use columns that
+// --columns drops, then --sample and --head, then --post-sql queries the rows left,
+// --aggregate reduces them to one per group and --columns picks from its output.
+// --cast then converts the columns left, and --stats describes what is finally written.
+func transforms(opts *cliOptions) []pipeline.Transform {
+	var t []pipeline.Transform
+	if opts.timezone != "" {
+		// First, so a --filter on a timestamp's hour or day sees it in the same zone.
+		t = append(t, pipeline.TimeZone(opts.timezone))
+	}
+	if opts.filter != "" {
+		t = append(t, pipeline.Filter(opts.filter))
+	}
+	if opts.sample > 0 {
+		t = append(t, pipeline.Sample(opts.sample))
+	}
+	if opts.head > 0 {
+		t = append(t, pipeline.Head(opts.head))
+	}
+	if opts.postSQL != "" {
+		t = append(t, pipeline.PostSQL(opts.postSQL))
+	}
+	if len(opts.aggregations) > 0 {
+		t = append(t, pipeline.Aggregate(opts.aggregations, opts.groupBy))
+	}
+	if len(opts.columns) > 0 {
+		t = append(t, pipeline.Project(opts.columns))
+	}
+	if len(opts.casts) > 0 {
+		t = append(t, pipeline.Cast(opts.casts))
+	}
+	if opts.stats != "" {
+		t = append(t, pipeline.ColumnStats(os.Stderr, opts.stats == "batch"))
+	}
+	if opts.sink == "" && (textFormat(opts.format) || opts.format == "xlsx") {
+		// The other formats keep BINARY columns as bytes.
+		t = append(t, pipeline.EncodeBinary(opts.binaryEncoding))
+	}
+	return t
+}
+
+// newWriter returns the sink for the format selected with --format.
+func newWriter(opts *cliOptions, w io.Writer) (sink.Writer, error) {
+	switch opts.format {
+	case "table":
+		return sink.NewTableWriter(w, sink.TableOptions{MaxColWidth: opts.maxColWidth, MaxRows: opts.maxRowsDisplay, NullString: opts.nullString, Highlight: opts.highlight}), nil
+	case "csv":
+		csvOpts := sink.CSVOptions{NullString: opts.nullString}
+		if opts.workers > 1 {
+			return sink.NewParallelWriter(w, opts.workers, opts.workerOrder == "ordered", sink.CSVEncoder(csvOpts)), nil
+		}
+		return sink.NewCSVWriter(w, csvOpts), nil
+	case "ndjson":
+		ndjsonOpts := sink.NDJSONOptions{NullString: opts.nullString}
+		if opts.workers > 1 {
+			return sink.NewParallelWriter(w, opts.workers, opts.workerOrder == "ordered", sink.NDJSONEncoder(ndjsonOpts)), nil
+		}
+		return sink.NewNDJSONWriter(w, ndjsonOpts), nil
+	case "parquet":
+		return sink.NewParquetWriter(w, opts.parquetOptions())
+	case "avro":
+		return sink.NewAvroWriter(w, sink.AvroOptions{Compression: opts.compression})
+	case "orc":
+		return sink.NewORCWriter(w, sink.ORCOptions{Compression: opts.compression})
+	case "markdown":
+		return sink.NewMarkdownWriter(w, sink.MarkdownOptions{MaxRows: opts.maxRowsDisplay, NullString: opts.nullString}), nil
+	case "xlsx":
+		return sink.NewXLSXWriter(w)
+	case "arrow-stream":
+		return sink.NewIPCStreamWriter(w), nil
+	case "feather":
+		ws, ok := w.(io.WriteSeeker)
+		if !ok {
+			return nil, fmt.Errorf("--format feather requires a seekable output file")
+		}
+		return sink.NewFeatherWriter(ws), nil
+	default:
+		return nil, fmt.Errorf("unsupported output format %q", opts.format)
+	}
+}
+
+// newDatabaseWriter returns the sink for a table URL given with --sink.
+func newDatabaseWriter(opts *cliOptions) (sink.Writer, error) {
+	// A Delta table is a directory, so its URL has no table parameter.
+	if dir, ok := strings.CutPrefix(opts.sink, "delta://"); ok {
+		return sink.NewDeltaWriter(dir, opts.parquetOptions())
+	}
+
+	scheme, path, table, err := sink.ParseDatabaseURL(opts.sink)
+	if err != nil {
+		return nil, err
+	}
+	switch scheme {
+	case "duckdb":
+		return sink.NewDuckDBWriter(path, table)
+	case "sqlite":
+		return sink.NewSQLiteWriter(path, table)
+	default:
+		return nil, fmt.Errorf("unsupported sink %q", scheme)
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	dbsql "github.com/databricks/databricks-sql-go"
+)
+
+// queryParams collects repeated --param flags in order. Each one is either named,
+// NAME=VALUE for a :NAME marker, or positional, VALUE (or =VALUE when the value holds
+// an =) for the next ? marker. NAME:TYPE=VALUE binds the value as that SQL type
+// instead of a string, e.g. days:INT=7.
+type queryParams []dbsql.Parameter
+
+func (p *queryParams) String() string {
+	parts := make([]string, len(*p))
+	for i, param := range *p {
+		parts[i] = fmt.Sprintf("%s=%v", param.Name, param.Value)
+	}
+	return strings.Join(parts, ",")
+}
+
+func (p *queryParams) Set(s string) error {
+	name, value, named := strings.Cut(s, "=")
+	if !named {
+		name, value = "", s
+	}
+	param := dbsql.Parameter{Value: value}
+
+	// An optional :TYPE suffix on the name sets the SQL type.
+	name, typeName, typed := strings.Cut(strings.TrimSpace(name), ":")
+	if typed {
+		t, ok := arrowfetch.ParameterType(typeName)
+		if !ok {
+			return fmt.Errorf("unsupported parameter type %q", typeName)
+		}
+		param.Type = t
+	}
+	param.Name = name
+
+	// Spark does not allow mixing named and positional markers in one statement.
+	if len(*p) > 0 && ((*p)[0].Name == "") != (name == "") {
+		return errors.New("named and positional parameters cannot be mixed")
+	}
+	*p = append(*p, param)
+	return nil
+}
+
+// args returns the parameters in the form accepted by arrowfetch.Client.Fetch.
+func (p queryParams) args() []any {
+	args := make([]any, len(p))
+	for i, param := range p {
+		args[i] = param
+	}
+	return args
+}
@@ -0,0 +1,63 @@
+package arrowfetchtest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// Schema is the schema of the synthetic batches of Batches, with a column of each of
+// the common Databricks types.
+var Schema = arrow.NewSchema([]arrow.Field{
+	{Name: "id", Type: arrow.PrimitiveTypes.Int64, Nullable: true},
+	{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+	{Name: "amount", Type: arrow.PrimitiveTypes.Float64, Nullable: true},
+	{Name: "active", Type: arrow.FixedWidthTypes.Boolean, Nullable: true},
+	{Name: "day", Type: arrow.FixedWidthTypes.Date32, Nullable: true},
+	{Name: "created", Type: arrow.FixedWidthTypes.Timestamp_us, Nullable: true},
+}, nil)
+
+// Epoch is the created value of row 0 of Batches; row i was created i minutes later.
+var Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// Batches returns n synthetic batches of rows rows each, with Schema. Row i of the
+// result, counting across batches, holds:
+//
+//	id      i
+//	name    "name-<i>", NULL when i is a multiple of 7
+//	amount  i * 1.5
+//	active  whether i is even
+//	day     the day of Epoch plus i days
+//	created Epoch plus i minutes
+//
+// The batches belong to the caller, who releases them once the queries using them are
+// done.
+func Batches(n, rows int) []arrow.Record {
+	recs := make([]arrow.Record, n)
+	for k := range recs {
+		recs[k] = batch(k*rows, rows)
+	}
+	return recs
+}
+
+// batch builds the rows from first to first+rows-1.
+func batch(first, rows int) arrow.Record {
+	b := array.NewRecordBuilder(memory.DefaultAllocator, Schema)
+	defer b.Release()
+	for i := first; i < first+rows; i++ {
+		b.Field(0).(*array.Int64Builder).Append(int64(i))
+		if i%7 == 0 {
+			b.Field(1).AppendNull()
+		} else {
+			b.Field(1).(*array.StringBuilder).Append(fmt.Sprintf("name-%d", i))
+		}
+		b.Field(2).(*array.Float64Builder).Append(float64(i) * 1.5)
+		b.Field(3).(*array.BooleanBuilder).Append(i%2 == 0)
+		b.Field(4).(*array.Date32Builder).Append(arrow.Date32FromTime(Epoch.AddDate(0, 0, i)))
+		b.Field(5).(*array.TimestampBuilder).Append(arrow.Timestamp(Epoch.Add(time.Duration(i) * time.Minute).UnixMicro()))
+	}
+	return b.NewRecord()
+}
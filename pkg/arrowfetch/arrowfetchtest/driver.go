@@ -0,0 +1,124 @@
+// Package arrowfetchtest provides a fake database/sql driver whose query results are
+// Arrow batches, for testing code built on arrowfetch, such as pipelines, sinks and
+// servers, without a Databricks warehouse or credentials.
+//
+//	client, err := arrowfetchtest.NewClient(arrowfetchtest.Static(arrowfetchtest.Batches(3, 100)...))
+//	err = client.Fetch(ctx, "select * from anything", func(rec arrow.Record) error { ... })
+//
+// The fake supports both ways a Client reads results: Arrow batches, and rows scanned
+// through database/sql with arrowfetch.WithRowMode.
+//
+// NewServer serves the same Handlers over a local emulation of a warehouse's Thrift
+// endpoint, for tests that also cover the Databricks driver.
+package arrowfetchtest
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// Handler answers a query sent to the fake driver with the batches of its result. The
+// batches are retained for every query they are returned to, so a Handler may return
+// the same batches again.
+type Handler func(query string, args []driver.NamedValue) ([]arrow.Record, error)
+
+// Static returns a Handler answering every query with recs.
+func Static(recs ...arrow.Record) Handler {
+	return func(string, []driver.NamedValue) ([]arrow.Record, error) {
+		return recs, nil
+	}
+}
+
+// Fail returns a Handler failing every query with err.
+func Fail(err error) Handler {
+	return func(string, []driver.NamedValue) ([]arrow.Record, error) {
+		return nil, err
+	}
+}
+
+// NewDB returns a database handle whose queries are answered by h.
+func NewDB(h Handler) *sql.DB {
+	return sql.OpenDB(connector{h})
+}
+
+// NewClient returns a Client whose queries are answered by h. The options apply as
+// with arrowfetch.New; the connection settings among them are ignored.
+func NewClient(h Handler, opts ...arrowfetch.Option) (*arrowfetch.Client, error) {
+	return arrowfetch.New(append(opts, arrowfetch.WithDB(NewDB(h)))...)
+}
+
+type connector struct {
+	h Handler
+}
+
+func (c connector) Connect(context.Context) (driver.Conn, error) {
+	return &conn{h: c.h}, nil
+}
+
+func (c connector) Driver() driver.Driver {
+	return fakeDriver{}
+}
+
+// fakeDriver only exists for Connector.Driver: handles are opened with NewDB.
+type fakeDriver struct{}
+
+func (fakeDriver) Open(string) (driver.Conn, error) {
+	return nil, errors.New("arrowfetchtest: open the fake driver with NewDB")
+}
+
+// conn runs queries with its Handler. Statements cannot be prepared.
+type conn struct {
+	h Handler
+}
+
+var (
+	_ driver.QueryerContext    = (*conn)(nil)
+	_ driver.ExecerContext     = (*conn)(nil)
+	_ driver.NamedValueChecker = (*conn)(nil)
+)
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	recs, err := c.h(query, args)
+	if err != nil {
+		return nil, err
+	}
+	return newRows(recs), nil
+}
+
+// ExecContext runs the statement with the Handler and discards its result.
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if _, err := c.h(query, args); err != nil {
+		return nil, err
+	}
+	return driver.RowsAffected(0), nil
+}
+
+// CheckNamedValue accepts any argument, e.g. a dbsql.Parameter, as the Databricks
+// driver does; the Handler gets it unchanged.
+func (c *conn) CheckNamedValue(*driver.NamedValue) error {
+	return nil
+}
+
+func (c *conn) Prepare(string) (driver.Stmt, error) {
+	return nil, errors.New("arrowfetchtest: prepared statements are not supported")
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return nil, errors.New("arrowfetchtest: transactions are not supported")
+}
+
+func (c *conn) Close() error {
+	return nil
+}
@@ -0,0 +1,168 @@
+package arrowfetchtest
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"io"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	dbsqlrows "github.com/databricks/databricks-sql-go/rows"
+)
+
+// rows is the result of a query. It hands out its batches through GetArrowBatches, or
+// their rows one at a time through Next.
+type rows struct {
+	recs   []arrow.Record
+	schema *arrow.Schema
+	rec    int // batch and row read next by Next
+	row    int
+}
+
+var _ arrowfetch.ArrowRows = (*rows)(nil)
+
+func newRows(recs []arrow.Record) *rows {
+	r := &rows{recs: recs}
+	if len(recs) > 0 {
+		r.schema = recs[0].Schema()
+	} else {
+		r.schema = arrow.NewSchema(nil, nil)
+	}
+	return r
+}
+
+func (r *rows) GetArrowBatches(context.Context) (dbsqlrows.ArrowBatchIterator, error) {
+	return &batches{recs: r.recs}, nil
+}
+
+func (r *rows) Columns() []string {
+	names := make([]string, len(r.schema.Fields()))
+	for i, f := range r.schema.Fields() {
+		names[i] = f.Name
+	}
+	return names
+}
+
+// ColumnTypeDatabaseTypeName reports the Databricks type of a column, as the driver does.
+func (r *rows) ColumnTypeDatabaseTypeName(i int) string {
+	switch r.schema.Field(i).Type.ID() {
+	case arrow.BOOL:
+		return "BOOLEAN"
+	case arrow.INT8:
+		return "TINYINT"
+	case arrow.INT16:
+		return "SMALLINT"
+	case arrow.INT32:
+		return "INT"
+	case arrow.INT64:
+		return "BIGINT"
+	case arrow.FLOAT32:
+		return "FLOAT"
+	case arrow.FLOAT64:
+		return "DOUBLE"
+	case arrow.DATE32:
+		return "DATE"
+	case arrow.TIMESTAMP:
+		return "TIMESTAMP"
+	case arrow.BINARY:
+		return "BINARY"
+	case arrow.DECIMAL128:
+		return "DECIMAL"
+	case arrow.LIST:
+		return "ARRAY"
+	case arrow.MAP:
+		return "MAP"
+	case arrow.STRUCT:
+		return "STRUCT"
+	}
+	return "STRING"
+}
+
+// Next copies the values of the next row into dest, converting them to the types the
+// Databricks driver scans.
+func (r *rows) Next(dest []driver.Value) error {
+	for r.rec < len(r.recs) && r.row >= int(r.recs[r.rec].NumRows()) {
+		r.rec, r.row = r.rec+1, 0
+	}
+	if r.rec == len(r.recs) {
+		return io.EOF
+	}
+	for i, col := range r.recs[r.rec].Columns() {
+		dest[i] = value(col, r.row)
+	}
+	r.row++
+	return nil
+}
+
+func (r *rows) Close() error {
+	return nil
+}
+
+// value returns the driver value of row i of col: nil for NULL, and otherwise an int64,
+// float64, bool, string, []byte or time.Time. Nested values are given as JSON text.
+func value(col arrow.Array, i int) driver.Value {
+	if col.IsNull(i) {
+		return nil
+	}
+	switch col := col.(type) {
+	case *array.Boolean:
+		return col.Value(i)
+	case *array.Int8:
+		return int64(col.Value(i))
+	case *array.Int16:
+		return int64(col.Value(i))
+	case *array.Int32:
+		return int64(col.Value(i))
+	case *array.Int64:
+		return col.Value(i)
+	case *array.Float32:
+		return float64(col.Value(i))
+	case *array.Float64:
+		return col.Value(i)
+	case *array.String:
+		return col.Value(i)
+	case *array.Binary:
+		return append([]byte(nil), col.Value(i)...)
+	case *array.Decimal128:
+		// The driver scans decimals as their text.
+		return col.Value(i).ToString(col.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Date32:
+		return col.Value(i).ToTime().UTC()
+	case *array.Timestamp:
+		unit := col.DataType().(*arrow.TimestampType).Unit
+		return col.Value(i).ToTime(unit).UTC()
+	case *array.List, *array.Map, *array.Struct:
+		text, err := json.Marshal(col.GetOneForMarshal(i))
+		if err != nil {
+			return col.ValueStr(i)
+		}
+		return string(text)
+	}
+	return col.ValueStr(i)
+}
+
+// batches is the ArrowBatchIterator of a result.
+type batches struct {
+	recs []arrow.Record
+	next int
+}
+
+func (b *batches) HasNext() bool {
+	return b.next < len(b.recs)
+}
+
+// Next returns the next batch, retained for the caller to release.
+func (b *batches) Next() (arrow.Record, error) {
+	if !b.HasNext() {
+		return nil, io.EOF
+	}
+	rec := b.recs[b.next]
+	b.next++
+	rec.Retain()
+	return rec, nil
+}
+
+func (b *batches) Close() {}
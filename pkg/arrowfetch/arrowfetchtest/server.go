@@ -0,0 +1,449 @@
+package arrowfetchtest
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// HTTPPath is the HTTP path of the warehouse emulated by a Server.
+const HTTPPath = "/sql/1.0/warehouses/arrowfetchtest"
+
+// Server is a local HTTP server emulating the Thrift endpoint of a Databricks SQL
+// warehouse, so the connect, query and fetch paths of the real Databricks driver can
+// be tested without a workspace. A Handler answers the queries, as with NewDB.
+//
+// The server speaks the subset of the protocol the driver uses for a query: it opens
+// and closes sessions, runs each statement with the Handler, and returns the result as
+// inline Arrow batches, one batch per page of FetchResults. Query parameters reach the
+// Handler as strings, the form the driver sends them in, and Decimal128 columns are
+// sent as text, as the warehouse sends them to the driver. Cloud fetch, LZ4 compression,
+// the metadata calls such as GetTables, and asynchronous execution are not emulated:
+// a statement has finished by the time ExecuteStatement returns.
+type Server struct {
+	h   Handler
+	srv *httptest.Server
+
+	mu      sync.Mutex
+	ops     map[string]*operation
+	queries []string
+	next    uint64
+}
+
+// operation is a statement whose result is being fetched.
+type operation struct {
+	meta  tstruct   // TGetResultSetMetadataResp
+	pages []tstruct // TSparkArrowBatch per batch of the result
+	rows  []int64   // offset of the first row of each page
+	next  int       // page returned by the next FetchResults
+}
+
+// NewServer starts a Server whose queries are answered by h. Close it when done.
+func NewServer(h Handler) *Server {
+	s := &Server{h: h, ops: map[string]*operation{}}
+	s.srv = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Options returns the options connecting a Client to the server. Append them to the
+// caller's options, as later options win.
+func (s *Server) Options() []arrowfetch.Option {
+	host, port, _ := net.SplitHostPort(s.srv.Listener.Addr().String())
+	n, _ := strconv.Atoi(port)
+	return []arrowfetch.Option{
+		arrowfetch.WithHost("http://" + host),
+		arrowfetch.WithPort(n),
+		arrowfetch.WithHTTPPath(HTTPPath),
+		arrowfetch.WithAccessToken("arrowfetchtest"),
+	}
+}
+
+// NewClient returns a Client connected to the server through the Databricks driver.
+func (s *Server) NewClient(opts ...arrowfetch.Option) (*arrowfetch.Client, error) {
+	return arrowfetch.New(append(opts, s.Options()...)...)
+}
+
+// Queries returns the statements the server has run, in order.
+func (s *Server) Queries() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.queries...)
+}
+
+// Close shuts the server down.
+func (s *Server) Close() {
+	s.srv.Close()
+}
+
+// serve answers one Thrift call, which the driver sends as the body of a POST.
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.URL.Path != HTTPPath {
+		http.NotFound(w, r)
+		return
+	}
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx := r.Context()
+	in := thrift.NewTBinaryProtocolConf(thrift.NewStreamTransportR(bytes.NewReader(body)), nil)
+	name, _, seq, err := in.ReadMessageBegin(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	args, err := readStruct(ctx, in)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req, _ := args.get(1).(rstruct)
+
+	out := thrift.NewTMemoryBuffer()
+	oprot := thrift.NewTBinaryProtocolConf(out, nil)
+	if resp, ok := s.call(name, req); ok {
+		err = writeReply(ctx, oprot, name, seq, resp)
+	} else {
+		err = writeException(ctx, oprot, name, seq)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/x-thrift")
+	w.Write(out.Bytes())
+}
+
+func writeReply(ctx context.Context, p thrift.TProtocol, name string, seq int32, resp tstruct) error {
+	if err := p.WriteMessageBegin(ctx, name, thrift.REPLY, seq); err != nil {
+		return err
+	}
+	// The result struct holds the response as its field 0, "success".
+	if err := writeStruct(ctx, p, tstruct{{0, resp}}); err != nil {
+		return err
+	}
+	if err := p.WriteMessageEnd(ctx); err != nil {
+		return err
+	}
+	return p.Flush(ctx)
+}
+
+func writeException(ctx context.Context, p thrift.TProtocol, name string, seq int32) error {
+	if err := p.WriteMessageBegin(ctx, name, thrift.EXCEPTION, seq); err != nil {
+		return err
+	}
+	exc := thrift.NewTApplicationException(thrift.UNKNOWN_METHOD, "arrowfetchtest: "+name+" is not emulated")
+	if err := exc.Write(ctx, p); err != nil {
+		return err
+	}
+	if err := p.WriteMessageEnd(ctx); err != nil {
+		return err
+	}
+	return p.Flush(ctx)
+}
+
+// Values of the TCLIService enums the server sends.
+const (
+	statusSuccess       int32 = 0
+	statusInvalidHandle int32 = 4
+	stateFinished       int32 = 2
+	stateError          int32 = 5
+	protocolV8          int32 = 42248
+	arrowBasedSet       int32 = 0
+)
+
+// call answers the request of the named TCLIService method, reporting false for a
+// method the server does not emulate.
+func (s *Server) call(name string, req rstruct) (tstruct, bool) {
+	switch name {
+	case "OpenSession":
+		return tstruct{
+			{1, status(statusSuccess)},
+			{2, protocolV8},
+			{3, tstruct{{1, s.handle()}}},
+		}, true
+	case "CloseSession":
+		return tstruct{{1, status(statusSuccess)}}, true
+	case "ExecuteStatement":
+		return s.execute(req), true
+	case "GetOperationStatus":
+		if s.operation(req) == nil {
+			return tstruct{{1, status(statusInvalidHandle)}}, true
+		}
+		return tstruct{{1, status(statusSuccess)}, {2, stateFinished}}, true
+	case "GetResultSetMetadata":
+		op := s.operation(req)
+		if op == nil {
+			return tstruct{{1, status(statusInvalidHandle)}}, true
+		}
+		return op.meta, true
+	case "FetchResults":
+		return s.fetch(req), true
+	case "CloseOperation", "CancelOperation":
+		// Closing an operation that already ended, e.g. with an error, succeeds too.
+		s.mu.Lock()
+		delete(s.ops, req.str(1, 1, 1))
+		s.mu.Unlock()
+		return tstruct{{1, status(statusSuccess)}}, true
+	}
+	return nil, false
+}
+
+// execute runs a statement with the Handler. The result is returned inline: the
+// response holds the final status and the result metadata, and its batches are left
+// for FetchResults.
+func (s *Server) execute(req rstruct) tstruct {
+	query := req.str(2)
+	s.mu.Lock()
+	s.queries = append(s.queries, query)
+	s.mu.Unlock()
+
+	id := s.handle()
+	handle := tstruct{{1, id}, {2, int32(0)}, {3, true}} // EXECUTE_STATEMENT with a result set
+	recs, err := s.h(query, parameters(req.get(1288)))
+	var op *operation
+	if err == nil {
+		op, err = newOperation(recs)
+	}
+	if err != nil {
+		// The driver reports the display message of a failed statement.
+		failed := tstruct{
+			{1, status(statusSuccess)},
+			{2, stateError},
+			{5, err.Error()},
+			{1281, err.Error()},
+		}
+		return tstruct{
+			{1, status(statusSuccess)},
+			{2, handle},
+			{1281, tstruct{{1, failed}, {4, tstruct{{1, status(statusSuccess)}}}}},
+		}
+	}
+
+	s.mu.Lock()
+	s.ops[string(id[0].v.([]byte))] = op
+	s.mu.Unlock()
+	finished := tstruct{{1, status(statusSuccess)}, {2, stateFinished}}
+	return tstruct{
+		{1, status(statusSuccess)},
+		{2, handle},
+		{1281, tstruct{{1, finished}, {2, op.meta}}},
+	}
+}
+
+// fetch returns the next page of a result: one batch, with the result metadata.
+func (s *Server) fetch(req rstruct) tstruct {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	op := s.ops[req.str(1, 1, 1)]
+	if op == nil {
+		return tstruct{{1, status(statusInvalidHandle)}}
+	}
+	var (
+		batches []tstruct
+		start   int64
+	)
+	if op.next < len(op.pages) {
+		batches = []tstruct{op.pages[op.next]}
+		start = op.rows[op.next]
+		op.next++
+	}
+	return tstruct{
+		{1, status(statusSuccess)},
+		{2, op.next < len(op.pages)},
+		{3, tstruct{{1, start}, {2, []tstruct{}}, {1281, batches}}},
+		{1281, op.meta},
+	}
+}
+
+// operation returns the operation of the handle in field 1 of req, or nil when it is
+// unknown or closed.
+func (s *Server) operation(req rstruct) *operation {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.ops[req.str(1, 1, 1)]
+}
+
+// handle returns a new THandleIdentifier, whose guid is also its secret.
+func (s *Server) handle() tstruct {
+	s.mu.Lock()
+	s.next++
+	guid := make([]byte, 16)
+	binary.BigEndian.PutUint64(guid[8:], s.next)
+	s.mu.Unlock()
+	return tstruct{{1, guid}, {2, guid}}
+}
+
+func status(code int32) tstruct {
+	return tstruct{{1, code}}
+}
+
+// parameters converts the TSparkParameter list of a statement to the arguments of a
+// Handler. Values are strings, or nil for NULL.
+func parameters(list any) []driver.NamedValue {
+	params, _ := list.([]any)
+	args := make([]driver.NamedValue, len(params))
+	for i, p := range params {
+		p, _ := p.(rstruct)
+		args[i] = driver.NamedValue{Ordinal: i + 1, Name: p.str(2)}
+		if v, ok := p.get(4, 1).([]byte); ok {
+			args[i].Value = string(v)
+		}
+	}
+	return args
+}
+
+// newOperation encodes the batches of a result as the driver reads them: the IPC
+// stream schema message once, in the metadata, and the messages of each batch after
+// it in a TSparkArrowBatch.
+func newOperation(recs []arrow.Record) (*operation, error) {
+	schema := arrow.NewSchema(nil, nil)
+	if len(recs) > 0 {
+		schema = recs[0].Schema()
+	}
+	wire := wireSchema(schema)
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(wire))
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	// Drop the end-of-stream marker after the schema.
+	schemaBytes := bytes.Clone(buf.Bytes()[:buf.Len()-8])
+
+	op := &operation{meta: metadata(schema, schemaBytes)}
+	var offset int64
+	for _, rec := range recs {
+		buf.Reset()
+		w := ipc.NewWriter(&buf, ipc.WithSchema(wire))
+		wired := wireRecord(wire, rec)
+		err := w.Write(wired)
+		wired.Release()
+		if err == nil {
+			err = w.Close()
+		}
+		if err != nil {
+			return nil, err
+		}
+		batch := bytes.Clone(buf.Bytes()[len(schemaBytes):])
+		op.pages = append(op.pages, tstruct{{1, batch}, {2, rec.NumRows()}})
+		op.rows = append(op.rows, offset)
+		offset += rec.NumRows()
+	}
+	return op, nil
+}
+
+// wireSchema returns the Arrow schema the warehouse sends for a result of the given
+// schema. Without native Arrow decimals, which the driver does not ask for, decimal
+// columns are sent as strings and their SQL type is named in the field metadata.
+func wireSchema(schema *arrow.Schema) *arrow.Schema {
+	fields := append([]arrow.Field(nil), schema.Fields()...)
+	for i, f := range fields {
+		if dt, ok := f.Type.(*arrow.Decimal128Type); ok {
+			fields[i].Type = arrow.BinaryTypes.String
+			fields[i].Metadata = arrow.NewMetadata([]string{"Spark:DataType:SqlName"}, []string{fmt.Sprintf("DECIMAL(%d,%d)", dt.Precision, dt.Scale)})
+		}
+	}
+	md := schema.Metadata()
+	return arrow.NewSchema(fields, &md)
+}
+
+// wireRecord returns rec with the schema wire, its decimal columns turned into text.
+// The caller releases the new record.
+func wireRecord(wire *arrow.Schema, rec arrow.Record) arrow.Record {
+	cols := make([]arrow.Array, rec.NumCols())
+	for i, col := range rec.Columns() {
+		dec, ok := col.(*array.Decimal128)
+		if !ok {
+			cols[i] = col
+			continue
+		}
+		scale := dec.DataType().(*arrow.Decimal128Type).Scale
+		b := array.NewStringBuilder(memory.DefaultAllocator)
+		for r := 0; r < dec.Len(); r++ {
+			if dec.IsNull(r) {
+				b.AppendNull()
+			} else {
+				b.Append(dec.Value(r).ToString(scale))
+			}
+		}
+		cols[i] = b.NewArray()
+		defer cols[i].Release()
+		b.Release()
+	}
+	return array.NewRecord(wire, cols, rec.NumRows())
+}
+
+// metadata returns the TGetResultSetMetadataResp of a result: its columns as a
+// TTableSchema, and its Arrow schema.
+func metadata(schema *arrow.Schema, schemaBytes []byte) tstruct {
+	columns := make([]tstruct, len(schema.Fields()))
+	for i, f := range schema.Fields() {
+		entry := tstruct{{1, tstruct{{1, typeID(f.Type)}}}} // TTypeEntry with a primitiveEntry
+		columns[i] = tstruct{
+			{1, f.Name},
+			{2, tstruct{{1, []tstruct{entry}}}},
+			{3, int32(i + 1)},
+		}
+	}
+	return tstruct{
+		{1, status(statusSuccess)},
+		{2, tstruct{{1, columns}}},
+		{1281, arrowBasedSet},
+		{1282, false},
+		{1283, schemaBytes},
+	}
+}
+
+// typeID returns the TTypeId of the Databricks type delivered as an Arrow type.
+func typeID(dt arrow.DataType) int32 {
+	switch dt.ID() {
+	case arrow.BOOL:
+		return 0
+	case arrow.INT8:
+		return 1
+	case arrow.INT16:
+		return 2
+	case arrow.INT32:
+		return 3
+	case arrow.INT64:
+		return 4
+	case arrow.FLOAT32:
+		return 5
+	case arrow.FLOAT64:
+		return 6
+	case arrow.TIMESTAMP:
+		return 8
+	case arrow.BINARY:
+		return 9
+	case arrow.LIST:
+		return 10
+	case arrow.MAP:
+		return 11
+	case arrow.STRUCT:
+		return 12
+	case arrow.DECIMAL128:
+		return 15
+	case arrow.NULL:
+		return 16
+	case arrow.DATE32:
+		return 17
+	}
+	return 7 // STRING
+}
@@ -0,0 +1,198 @@
+package arrowfetchtest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/apache/thrift/lib/go/thrift"
+)
+
+// The Server speaks the Thrift binary protocol of the warehouse's TCLIService without
+// the generated types, which are internal to the Databricks driver. Requests are read
+// into generic structs keyed by field id, and responses are written from tstructs
+// listing the fields the driver reads, by their ids in TCLIService.thrift.
+
+// tstruct is a Thrift struct to write: its fields, in order.
+type tstruct []tfield
+
+// tfield is a field of a tstruct. The value is a bool, int16, int32 (also for enums),
+// int64, string, []byte, tstruct, []tstruct or []string.
+type tfield struct {
+	id int16
+	v  any
+}
+
+// ttype returns the Thrift type of a field value.
+func ttype(v any) thrift.TType {
+	switch v.(type) {
+	case bool:
+		return thrift.BOOL
+	case int16:
+		return thrift.I16
+	case int32:
+		return thrift.I32
+	case int64:
+		return thrift.I64
+	case string, []byte:
+		return thrift.STRING
+	case tstruct:
+		return thrift.STRUCT
+	case []tstruct, []string:
+		return thrift.LIST
+	}
+	panic(fmt.Sprintf("arrowfetchtest: no Thrift type for %T", v))
+}
+
+func writeValue(ctx context.Context, p thrift.TProtocol, v any) error {
+	switch v := v.(type) {
+	case bool:
+		return p.WriteBool(ctx, v)
+	case int16:
+		return p.WriteI16(ctx, v)
+	case int32:
+		return p.WriteI32(ctx, v)
+	case int64:
+		return p.WriteI64(ctx, v)
+	case string:
+		return p.WriteString(ctx, v)
+	case []byte:
+		return p.WriteBinary(ctx, v)
+	case tstruct:
+		return writeStruct(ctx, p, v)
+	case []tstruct:
+		if err := p.WriteListBegin(ctx, thrift.STRUCT, len(v)); err != nil {
+			return err
+		}
+		for _, s := range v {
+			if err := writeStruct(ctx, p, s); err != nil {
+				return err
+			}
+		}
+		return p.WriteListEnd(ctx)
+	case []string:
+		if err := p.WriteListBegin(ctx, thrift.STRING, len(v)); err != nil {
+			return err
+		}
+		for _, s := range v {
+			if err := p.WriteString(ctx, s); err != nil {
+				return err
+			}
+		}
+		return p.WriteListEnd(ctx)
+	}
+	return fmt.Errorf("arrowfetchtest: cannot write a %T", v)
+}
+
+func writeStruct(ctx context.Context, p thrift.TProtocol, s tstruct) error {
+	if err := p.WriteStructBegin(ctx, ""); err != nil {
+		return err
+	}
+	for _, f := range s {
+		if err := p.WriteFieldBegin(ctx, "", ttype(f.v), f.id); err != nil {
+			return err
+		}
+		if err := writeValue(ctx, p, f.v); err != nil {
+			return err
+		}
+		if err := p.WriteFieldEnd(ctx); err != nil {
+			return err
+		}
+	}
+	if err := p.WriteFieldStop(ctx); err != nil {
+		return err
+	}
+	return p.WriteStructEnd(ctx)
+}
+
+// rstruct is a Thrift struct that was read: its field values by id. Nested structs are
+// rstructs, lists are []any, strings and binaries are []byte, and maps are skipped.
+type rstruct map[int16]any
+
+func readStruct(ctx context.Context, p thrift.TProtocol) (rstruct, error) {
+	if _, err := p.ReadStructBegin(ctx); err != nil {
+		return nil, err
+	}
+	s := rstruct{}
+	for {
+		_, t, id, err := p.ReadFieldBegin(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if t == thrift.STOP {
+			break
+		}
+		if s[id], err = readValue(ctx, p, t); err != nil {
+			return nil, err
+		}
+		if err := p.ReadFieldEnd(ctx); err != nil {
+			return nil, err
+		}
+	}
+	return s, p.ReadStructEnd(ctx)
+}
+
+func readValue(ctx context.Context, p thrift.TProtocol, t thrift.TType) (any, error) {
+	switch t {
+	case thrift.BOOL:
+		return p.ReadBool(ctx)
+	case thrift.BYTE:
+		return p.ReadByte(ctx)
+	case thrift.I16:
+		return p.ReadI16(ctx)
+	case thrift.I32:
+		return p.ReadI32(ctx)
+	case thrift.I64:
+		return p.ReadI64(ctx)
+	case thrift.DOUBLE:
+		return p.ReadDouble(ctx)
+	case thrift.STRING:
+		return p.ReadBinary(ctx)
+	case thrift.STRUCT:
+		return readStruct(ctx, p)
+	case thrift.LIST, thrift.SET:
+		var (
+			elem thrift.TType
+			n    int
+			err  error
+		)
+		if t == thrift.LIST {
+			elem, n, err = p.ReadListBegin(ctx)
+		} else {
+			elem, n, err = p.ReadSetBegin(ctx)
+		}
+		if err != nil {
+			return nil, err
+		}
+		list := make([]any, n)
+		for i := range list {
+			if list[i], err = readValue(ctx, p, elem); err != nil {
+				return nil, err
+			}
+		}
+		if t == thrift.LIST {
+			return list, p.ReadListEnd(ctx)
+		}
+		return list, p.ReadSetEnd(ctx)
+	}
+	return nil, p.Skip(ctx, t)
+}
+
+// get follows the field ids of path through nested structs, returning nil when a field
+// is missing.
+func (s rstruct) get(path ...int16) any {
+	var v any = s
+	for _, id := range path {
+		st, ok := v.(rstruct)
+		if !ok {
+			return nil
+		}
+		v = st[id]
+	}
+	return v
+}
+
+// str returns the string or binary field at path, or "" when it is missing.
+func (s rstruct) str(path ...int16) string {
+	b, _ := s.get(path...).([]byte)
+	return string(b)
+}
@@ -0,0 +1,119 @@
+package arrowfetch
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	dbsql "github.com/databricks/databricks-sql-go"
+)
+
+// Client executes queries on a Databricks SQL warehouse and returns Arrow batches.
+type Client struct {
+	db     *sql.DB
+	ownsDB bool
+	cfg    config
+	http   *http.Client // client for the REST API, sharing the connector's proxy and TLS settings
+}
+
+// New creates a Client from the given options.
+func New(opts ...Option) (*Client, error) {
+	cfg := defaultConfig()
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
+	httpClient := &http.Client{Transport: cfg.transport}
+	if cfg.proxy != "" || cfg.caCert != "" || cfg.certFile != "" {
+		transport, err := newTransport(cfg)
+		if err != nil {
+			return nil, err
+		}
+		httpClient.Transport = transport
+	}
+	if cfg.roundTrip != nil {
+		httpClient.Transport = NewTraceTransport(httpClient.Transport, cfg.host, cfg.roundTrip)
+	}
+
+	// Reuse the caller's database handle when one was provided.
+	if cfg.db != nil {
+		return &Client{db: cfg.db, cfg: cfg, http: httpClient}, nil
+	}
+
+	// Create a new Databricks SQL connector using the configured credentials.
+	connOpts := []dbsql.ConnOption{
+		dbsql.WithServerHostname(cfg.host),
+		dbsql.WithPort(cfg.port),
+		dbsql.WithHTTPPath(cfg.httpPath),
+		dbsql.WithMaxRows(cfg.maxRows),
+		dbsql.WithCloudFetch(cfg.cloudFetch),
+	}
+	if cfg.downloads > 0 {
+		connOpts = append(connOpts, dbsql.WithMaxDownloadThreads(cfg.downloads))
+	}
+	if cfg.userAgent != "" {
+		connOpts = append(connOpts, dbsql.WithUserAgentEntry(cfg.userAgent))
+	}
+	if cfg.catalog != "" || cfg.schema != "" {
+		connOpts = append(connOpts, dbsql.WithInitialNamespace(cfg.catalog, cfg.schema))
+	}
+	if len(cfg.session) > 0 {
+		connOpts = append(connOpts, dbsql.WithSessionParams(cfg.session))
+	}
+	if cfg.auth != nil {
+		connOpts = append(connOpts, dbsql.WithAuthenticator(cfg.auth))
+	} else {
+		connOpts = append(connOpts, dbsql.WithAccessToken(cfg.token))
+	}
+	if httpClient.Transport != nil {
+		connOpts = append(connOpts, dbsql.WithTransport(httpClient.Transport))
+	}
+	connector, err := dbsql.NewConnector(connOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create connector: %w", err)
+	}
+
+	// Open the SQL connection using the connector.
+	db := sql.OpenDB(connector)
+	cfg.pool.apply(db)
+	return &Client{db: db, ownsDB: true, cfg: cfg, http: httpClient}, nil
+}
+
+// apply sets the pool limits that differ from the database/sql defaults.
+func (p PoolOptions) apply(db *sql.DB) {
+	if p.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(p.MaxOpenConns)
+	}
+	if p.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(p.MaxIdleConns)
+	}
+	if p.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(p.ConnMaxLifetime)
+	}
+	if p.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(p.ConnMaxIdleTime)
+	}
+}
+
+// DB returns the underlying database handle.
+func (c *Client) DB() *sql.DB {
+	return c.db
+}
+
+// Allocator returns the allocator accounting for the memory held in batches, or nil
+// when no memory limit was set.
+func (c *Client) Allocator() *LimitedAllocator {
+	return c.cfg.mem
+}
+
+// Close releases the database handle if it was opened by New.
+func (c *Client) Close() error {
+	if !c.ownsDB {
+		return nil
+	}
+	return c.db.Close()
+}
@@ -0,0 +1,175 @@
+package arrowfetch
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/decimal128"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	dbsqlrows "github.com/databricks/databricks-sql-go/rows"
+)
+
+// sparkTypeKey is the field metadata key under which the warehouse describes the SQL
+// type of each column of its Arrow schemas, e.g. DECIMAL(10,2).
+const sparkTypeKey = "Spark:DataType:SqlName"
+
+// decimalBatches turns the DECIMAL columns the driver delivers as strings back into
+// Decimal128 columns of the precision and scale the warehouse reports for them, so
+// sinks write numbers rather than text and no digit is lost on the way. The columns
+// are picked from the schema of the first batch; batches without such columns pass
+// through untouched.
+type decimalBatches struct {
+	it      dbsqlrows.ArrowBatchIterator
+	checked bool
+	schema  *arrow.Schema                 // converted schema, or nil when nothing is converted
+	types   map[int]*arrow.Decimal128Type // columns to convert, by index
+}
+
+func newDecimalBatches(it dbsqlrows.ArrowBatchIterator) *decimalBatches {
+	return &decimalBatches{it: it}
+}
+
+func (d *decimalBatches) HasNext() bool { return d.it.HasNext() }
+
+func (d *decimalBatches) Close() { d.it.Close() }
+
+func (d *decimalBatches) Next() (arrow.Record, error) {
+	rec, err := d.it.Next()
+	if err != nil {
+		return nil, err
+	}
+	if !d.checked {
+		d.checked = true
+		d.schema, d.types = decimalSchema(rec.Schema())
+	}
+	if d.schema == nil {
+		return rec, nil
+	}
+	defer rec.Release()
+	cols := make([]arrow.Array, rec.NumCols())
+	defer func() {
+		for _, c := range cols {
+			if c != nil {
+				c.Release()
+			}
+		}
+	}()
+	for i, col := range rec.Columns() {
+		dt, ok := d.types[i]
+		if !ok {
+			col.Retain()
+			cols[i] = col
+			continue
+		}
+		if cols[i], err = toDecimal(col, dt); err != nil {
+			return nil, fmt.Errorf("column %s: %w", rec.ColumnName(i), err)
+		}
+	}
+	return array.NewRecord(d.schema, cols, rec.NumRows()), nil
+}
+
+// decimalSchema returns schema with its string-typed DECIMAL columns retyped, and the
+// new types by column index. The schema is nil when there is no such column.
+func decimalSchema(schema *arrow.Schema) (*arrow.Schema, map[int]*arrow.Decimal128Type) {
+	var types map[int]*arrow.Decimal128Type
+	fields := append([]arrow.Field(nil), schema.Fields()...)
+	for i, f := range fields {
+		if f.Type.ID() != arrow.STRING {
+			continue
+		}
+		dt := fieldDecimal(f)
+		if dt == nil {
+			continue
+		}
+		if types == nil {
+			types = map[int]*arrow.Decimal128Type{}
+		}
+		types[i] = dt
+		fields[i].Type = dt
+	}
+	if types == nil {
+		return nil, nil
+	}
+	md := schema.Metadata()
+	return arrow.NewSchema(fields, &md), types
+}
+
+// fieldDecimal returns the decimal type recorded in the metadata of f, or nil.
+func fieldDecimal(f arrow.Field) *arrow.Decimal128Type {
+	for _, key := range []string{sparkTypeKey, SQLTypeKey} {
+		i := f.Metadata.FindKey(key)
+		if i < 0 {
+			continue
+		}
+		text := strings.ToLower(f.Metadata.Values()[i])
+		if !strings.Contains(text, "(") {
+			// Without its precision and scale the type cannot be rebuilt exactly.
+			continue
+		}
+		if dt, err := ParseSQLType(text); err == nil {
+			if dec, ok := dt.(*arrow.Decimal128Type); ok {
+				return dec
+			}
+		}
+	}
+	return nil
+}
+
+// toDecimal parses the values of a string column into a Decimal128 column of type dt.
+func toDecimal(col arrow.Array, dt *arrow.Decimal128Type) (arrow.Array, error) {
+	strs := col.(*array.String)
+	b := array.NewDecimal128Builder(memory.DefaultAllocator, dt)
+	defer b.Release()
+	b.Reserve(strs.Len())
+	for i := 0; i < strs.Len(); i++ {
+		if strs.IsNull(i) {
+			b.AppendNull()
+			continue
+		}
+		n, err := parseDecimal(strs.Value(i), dt)
+		if err != nil {
+			return nil, err
+		}
+		b.Append(n)
+	}
+	return b.NewArray(), nil
+}
+
+// parseDecimal converts the text of a decimal value, e.g. 12.50 or 1.2E+3, to a
+// Decimal128 of type dt. The conversion is exact: a value with more fractional digits
+// than the scale, or more digits than the precision, is an error rather than rounded.
+func parseDecimal(s string, dt *arrow.Decimal128Type) (decimal128.Num, error) {
+	r, ok := new(big.Rat).SetString(strings.TrimSpace(s))
+	if !ok {
+		return decimal128.Num{}, fmt.Errorf("invalid decimal %q", s)
+	}
+	r.Mul(r, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(dt.Scale)), nil)))
+	if !r.IsInt() {
+		return decimal128.Num{}, fmt.Errorf("decimal %q has more than %d fractional digits", s, dt.Scale)
+	}
+	n := decimal128.FromBigInt(r.Num())
+	if r.Num().BitLen() > 127 || !n.FitsInPrecision(dt.Precision) {
+		return decimal128.Num{}, fmt.Errorf("decimal %q does not fit in %s", s, dt)
+	}
+	return n, nil
+}
+
+// decimalRat returns the value of a decimal column at row i as an exact fraction.
+func decimalRat(col arrow.Array, i int) *big.Rat {
+	var (
+		n     *big.Int
+		scale int32
+	)
+	switch col := col.(type) {
+	case *array.Decimal128:
+		n, scale = col.Value(i).BigInt(), col.DataType().(*arrow.Decimal128Type).Scale
+	case *array.Decimal256:
+		n, scale = col.Value(i).BigInt(), col.DataType().(*arrow.Decimal256Type).Scale
+	default:
+		return nil
+	}
+	return new(big.Rat).SetFrac(n, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil))
+}
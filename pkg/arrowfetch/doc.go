@@ -0,0 +1,28 @@
+// Package arrowfetch runs queries against a Databricks SQL warehouse and
+// streams the results back as Arrow record batches.
+//
+// A Client is created with New and configured only through the functional options
+// passed to it. The options fall into a few groups:
+//
+//   - Connection: WithHost, WithPort, WithHTTPPath, WithInitialNamespace,
+//     WithSessionParams and WithUserAgent, which mirror the options of the dbsql
+//     connector, and WithPool and WithDB for the database handle.
+//   - Authentication: WithAccessToken, or WithAuthenticator with an authenticator of
+//     package dbauth.
+//   - Network: WithProxy, WithCACert, WithClientCert or WithTransport.
+//   - Execution: WithQueryTimeout, WithFetchTimeout, WithTimeout and WithRetry.
+//   - Fetching: WithMaxRows, WithCloudFetch, WithDownloadThreads, WithPrefetch,
+//     WithMemoryLimit, WithTableLimit and WithRowMode.
+//   - Observability: WithObserver and WithRoundTripLog, and WithTimings on the context
+//     of a query.
+//
+// The driver's own ConnOption is not part of the API, so the driver can be upgraded
+// without changing the code of callers. Every option has a default that keeps the
+// behavior of a Client created without it, so options added later do not change
+// existing callers, and New rejects settings that cannot work instead of failing on
+// the first query.
+//
+// Batches are written to an output by the package pipeline, which runs a query of a
+// Client through transformations into any sink.Writer of the package sink, such as
+// the CSV, Parquet or database writers with their own options structs.
+package arrowfetch
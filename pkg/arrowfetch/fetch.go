@@ -0,0 +1,329 @@
+package arrowfetch
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	dbsql "github.com/databricks/databricks-sql-go"
+	"github.com/databricks/databricks-sql-go/driverctx"
+	dbsqlrows "github.com/databricks/databricks-sql-go/rows"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// ErrQueryTimeout and ErrFetchTimeout report which phase of a query ran out of time.
+var (
+	ErrQueryTimeout = errors.New("query timeout exceeded")
+	ErrFetchTimeout = errors.New("fetch timeout exceeded")
+)
+
+// ArrowRows is the part of a driver result that Query reads Arrow batches from. The rows
+// of the Databricks driver implement it, and so do those of the fake driver of package
+// arrowfetchtest, which runs a Client without a warehouse in tests.
+type ArrowRows interface {
+	GetArrowBatches(ctx context.Context) (dbsqlrows.ArrowBatchIterator, error)
+}
+
+var _ ArrowRows = dbsqlrows.Rows(nil)
+
+// Batches iterates over the Arrow record batches of a query result.
+// Records returned by Next must be released by the caller.
+type Batches struct {
+	conn    *sql.Conn // connection opened for this query, closed with the batches
+	rows    driver.Rows
+	sqlRows *sql.Rows // result read row by row instead, with WithRowMode
+	it      dbsqlrows.ArrowBatchIterator
+	mem     *LimitedAllocator // accounts for the batches handed out, when a limit is set
+	ahead   *prefetcher       // fetches batches in the background, when prefetching
+	ctx     context.Context
+	cancel  context.CancelCauseFunc
+	timer   *time.Timer
+	times   *Timings // phases recorded for WithTimings, or nil
+	obs     Observer
+	span    trace.Span
+	count   int // batches fetched so far
+}
+
+// Query executes query and returns an iterator over its Arrow batches.
+// The returned Batches must be closed once the caller is done with it.
+//
+// args bind the query's parameter markers: sql.Named or dbsql.Parameter values for
+// :name markers, plain values for positional ? markers.
+//
+// The query and all its fetches share one context derived from ctx, since the driver
+// keeps using the execution context to page through the result. The query and fetch
+// timeouts are enforced as successive deadlines on that context.
+func (c *Client) Query(ctx context.Context, query string, args ...any) (*Batches, error) {
+	return c.query(ctx, nil, query, args)
+}
+
+// query runs query on conn, or on a connection of its own when conn is nil.
+func (c *Client) query(ctx context.Context, conn *sql.Conn, query string, args []any) (*Batches, error) {
+	b := &Batches{mem: c.cfg.mem, times: timingsFrom(ctx), obs: c.cfg.observer}
+	start := time.Now()
+	ctx, b.span = tracer.Start(ctx, "query", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("db.system", "databricks"), attribute.String("db.statement", query)))
+	b.ctx, b.cancel = context.WithCancelCause(ctx)
+	b.limit(c.cfg.queryTimeout, ErrQueryTimeout)
+	if b.times != nil {
+		*b.times = Timings{Query: query, Start: start}
+	}
+	// The driver reports the statement's ID as soon as the warehouse accepts it.
+	b.ctx = driverctx.NewContextWithQueryIdCallback(b.ctx, func(id string) {
+		b.span.SetAttributes(attribute.String("databricks.query_id", id))
+		if b.times != nil {
+			b.times.QueryID = id
+		}
+	})
+
+	// Execute the query, retrying transient failures on a fresh connection
+	// (or on the session's connection, whose settings must be kept). A statement that
+	// changes data is run once, as a failed attempt may still have run on the warehouse.
+	retry := c.cfg.retry
+	if !Idempotent(query) {
+		retry.MaxAttempts = 1
+	}
+	err := retry.do(b.ctx, func() error {
+		return b.execute(b.ctx, c.db, conn, query, args, c.cfg.rowMode)
+	})
+	if err != nil {
+		err = b.explain(err)
+	}
+	if b.obs != nil {
+		b.obs.QueryExecuted(time.Since(start), err)
+	}
+	if err != nil {
+		return nil, b.fail(err)
+	}
+
+	// The statement has run; from now on the fetch timeout applies.
+	b.limit(c.cfg.fetchTimeout, ErrFetchTimeout)
+	if b.times != nil {
+		b.times.Executed = time.Now()
+	}
+
+	// Retrieve Arrow batches from the query result, or assemble them from its rows.
+	if b.sqlRows != nil {
+		b.it, err = newRowBatches(b.sqlRows, c.cfg.maxRows)
+	} else if rows, ok := b.rows.(ArrowRows); !ok {
+		err = fmt.Errorf("the driver does not return Arrow batches (%T); use row mode", b.rows)
+	} else if b.it, err = rows.GetArrowBatches(b.ctx); err != nil {
+		err = fmt.Errorf("unable to get arrow batches: %w", err)
+	} else {
+		b.it = newDecimalBatches(b.it)
+	}
+	if err != nil {
+		return nil, b.fail(err)
+	}
+	if c.cfg.prefetch > 0 {
+		b.prefetch(c.cfg.prefetch)
+	}
+	return b, nil
+}
+
+// limit replaces the running deadline with one that cancels the context with cause
+// after d. A zero d leaves the phase unlimited.
+func (b *Batches) limit(d time.Duration, cause error) {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	if d > 0 {
+		b.timer = time.AfterFunc(d, func() { b.cancel(fmt.Errorf("%w (%s)", cause, d)) })
+	}
+}
+
+// fail closes the batches and returns err, naming the timeout when one fired.
+func (b *Batches) fail(err error) error {
+	err = b.explain(err)
+	spanError(b.span, err)
+	b.Close()
+	return err
+}
+
+// explain adds the reason the context was cancelled, e.g. ErrFetchTimeout, to err.
+func (b *Batches) explain(err error) error {
+	if cause := context.Cause(b.ctx); cause != nil && !errors.Is(err, cause) {
+		return fmt.Errorf("%w: %w", cause, err)
+	}
+	return err
+}
+
+// execute runs query on conn, or opens a connection when conn is nil. On failure the
+// opened connection is closed so a retry starts from a clean one. With rowMode the
+// result is read through database/sql, as sql.Rows, rather than from the driver.
+func (b *Batches) execute(ctx context.Context, db *sql.DB, conn *sql.Conn, query string, args []any, rowMode bool) error {
+	owned := conn == nil
+	if owned {
+		// Establish a connection to the database.
+		_, span := tracer.Start(ctx, "connect")
+		var err error
+		conn, err = db.Conn(ctx)
+		endSpan(span, err)
+		if err != nil {
+			return fmt.Errorf("unable to open connection: %w", err)
+		}
+	}
+
+	// Execute the query using the underlying database driver.
+	ctx, span := tracer.Start(ctx, "execute")
+	var err error
+	if rowMode {
+		b.sqlRows, err = conn.QueryContext(ctx, query, args...)
+	} else {
+		err = conn.Raw(func(d interface{}) error {
+			var qerr error
+			b.rows, qerr = d.(driver.QueryerContext).QueryContext(ctx, query, namedValues(args))
+			return qerr
+		})
+	}
+	endSpan(span, err)
+	if err != nil {
+		if owned {
+			conn.Close()
+		}
+		return fmt.Errorf("unable to run the query: %w", err)
+	}
+	if owned {
+		b.conn = conn
+	}
+	return nil
+}
+
+// namedValues converts query arguments to the driver's form. Named arguments keep their
+// name so the driver binds them to :name markers.
+func namedValues(args []any) []driver.NamedValue {
+	if len(args) == 0 {
+		return nil
+	}
+	values := make([]driver.NamedValue, len(args))
+	for i, arg := range args {
+		v := driver.NamedValue{Ordinal: i + 1, Value: arg}
+		switch a := arg.(type) {
+		case sql.NamedArg:
+			v.Name, v.Value = a.Name, a.Value
+		case dbsql.Parameter:
+			v.Name = a.Name
+		}
+		values[i] = v
+	}
+	return values
+}
+
+// HasNext reports whether another batch is available.
+func (b *Batches) HasNext() bool {
+	if b.ahead != nil {
+		return b.ahead.hasNext()
+	}
+	return b.it.HasNext()
+}
+
+// Next returns the next record batch. A failed fetch is not retried: the driver drops
+// the rest of the page that failed and reports the end of the result to any further
+// call, so the result is incomplete and the query has to be run again. With a memory
+// limit, Next first waits until enough of the earlier batches have been released.
+func (b *Batches) Next() (arrow.Record, error) {
+	if b.ahead != nil {
+		return b.ahead.next()
+	}
+	return b.next()
+}
+
+// next fetches the next batch from the driver.
+func (b *Batches) next() (arrow.Record, error) {
+	if b.mem != nil {
+		if err := b.mem.wait(b.ctx); err != nil {
+			return nil, b.explain(err)
+		}
+	}
+	_, span := tracer.Start(b.ctx, "fetch batch", trace.WithAttributes(attribute.Int("batch", b.count)))
+	b.count++
+	start := time.Now()
+	rec, err := b.it.Next()
+	if err != nil {
+		err = b.explain(err)
+		if b.obs != nil {
+			b.obs.BatchFetched(0, 0, time.Since(start), err)
+		}
+		endSpan(span, err)
+		return nil, err
+	}
+	rows, size := rec.NumRows(), RecordSize(rec)
+	if b.obs != nil {
+		b.obs.BatchFetched(rows, size, time.Since(start), nil)
+	}
+	span.SetAttributes(attribute.Int64("rows", rows), attribute.Int64("bytes", size))
+	span.End()
+	if b.times != nil && b.times.FirstBatch.IsZero() {
+		b.times.FirstBatch = time.Now()
+	}
+	if b.mem != nil {
+		rec = b.mem.track(rec)
+	}
+	return rec, nil
+}
+
+// Close releases the iterator, the result set and the connection.
+func (b *Batches) Close() error {
+	if b.ahead != nil {
+		b.ahead.stop(b.cancel)
+		b.ahead = nil
+	}
+	if b.it != nil {
+		b.it.Close()
+	}
+	if b.rows != nil {
+		b.rows.Close()
+	}
+	if b.sqlRows != nil {
+		b.sqlRows.Close()
+	}
+	var err error
+	if b.conn != nil {
+		err = b.conn.Close()
+	}
+	if b.timer != nil {
+		b.timer.Stop()
+	}
+	if b.times != nil && b.times.End.IsZero() {
+		b.times.End = time.Now()
+	}
+	b.span.End()
+	b.cancel(nil)
+	return err
+}
+
+// Fetch executes query and calls fn for every record batch of the result.
+// Each record is released after fn returns, so fn must retain it to keep it longer.
+// args bind the query's parameters as in Query.
+func (c *Client) Fetch(ctx context.Context, query string, fn func(arrow.Record) error, args ...any) error {
+	batches, err := c.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return batches.each(fn)
+}
+
+// each calls fn for every remaining record batch and closes the batches.
+func (b *Batches) each(fn func(arrow.Record) error) error {
+	defer b.Close()
+
+	// Loop through the Arrow batches and process each batch.
+	for b.HasNext() {
+		rec, err := b.Next()
+		if err != nil {
+			return fmt.Errorf("failure retrieving batch: %w", err)
+		}
+		err = fn(rec)
+		rec.Release() // Release the batch to free memory.
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
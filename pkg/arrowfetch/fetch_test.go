@@ -0,0 +1,217 @@
+package arrowfetch_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+func release(recs []arrow.Record) {
+	for _, rec := range recs {
+		rec.Release()
+	}
+}
+
+// collect fetches query with client and returns the values of every row as text.
+func collect(t *testing.T, client *arrowfetch.Client, query string) (rows [][]string, batches int) {
+	t.Helper()
+	err := client.Fetch(context.Background(), query, func(rec arrow.Record) error {
+		batches++
+		for i := 0; i < int(rec.NumRows()); i++ {
+			row := make([]string, rec.NumCols())
+			for j, col := range rec.Columns() {
+				row[j] = col.ValueStr(i)
+			}
+			rows = append(rows, row)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Fetch: %v", err)
+	}
+	return rows, batches
+}
+
+func TestFetch(t *testing.T) {
+	recs := arrowfetchtest.Batches(3, 4)
+	defer release(recs)
+	var queries []string
+	client, err := arrowfetchtest.NewClient(func(query string, _ []driver.NamedValue) ([]arrow.Record, error) {
+		queries = append(queries, query)
+		return recs, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	rows, batches := collect(t, client, "select * from t")
+	if batches != 3 || len(rows) != 12 {
+		t.Fatalf("got %d batches and %d rows, want 3 and 12", batches, len(rows))
+	}
+	for i, row := range rows {
+		if want := fmt.Sprint(i); row[0] != want {
+			t.Errorf("row %d: id %s, want %s", i, row[0], want)
+		}
+	}
+	if len(queries) != 1 || queries[0] != "select * from t" {
+		t.Errorf("queries = %q", queries)
+	}
+
+	// The batches are retained per query, so they can be returned again.
+	if rows, _ := collect(t, client, "select * from t"); len(rows) != 12 {
+		t.Errorf("second fetch: %d rows, want 12", len(rows))
+	}
+}
+
+func TestFetchError(t *testing.T) {
+	fail := errors.New("table not found")
+	client, err := arrowfetchtest.NewClient(arrowfetchtest.Fail(fail), arrowfetch.WithRetry(arrowfetch.RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	err = client.Fetch(context.Background(), "select 1", func(arrow.Record) error { return nil })
+	if !errors.Is(err, fail) {
+		t.Fatalf("Fetch error = %v, want %v", err, fail)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	throttled := errors.New("unexpected HTTP status 503 Service Unavailable")
+	for _, tc := range []struct {
+		query string
+		calls int
+	}{
+		{"select * from t", 3},
+		{"-- daily\nSHOW TABLES", 3},
+		{"insert into t values (1)", 1},
+		{"with s as (select 1) insert into t select * from s", 1},
+		{"merge into t using s on t.id = s.id when matched then delete", 1},
+	} {
+		calls := 0
+		client, err := arrowfetchtest.NewClient(func(string, []driver.NamedValue) ([]arrow.Record, error) {
+			calls++
+			return nil, throttled
+		}, arrowfetch.WithRetry(arrowfetch.RetryPolicy{MaxAttempts: 3}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.Fetch(context.Background(), tc.query, func(arrow.Record) error { return nil })
+		client.Close()
+		if !errors.Is(err, throttled) || calls != tc.calls {
+			t.Errorf("%q: %v after %d attempts, want %d attempts", tc.query, err, calls, tc.calls)
+		}
+	}
+}
+
+func TestIsTransient(t *testing.T) {
+	for msg, want := range map[string]bool{
+		"unexpected HTTP status 429 Too Many Requests": true,
+		"HTTP Response code: 503":                      true,
+		"connection reset by peer":                     true,
+		"Table or view not found: sales_2503":          false,
+		"query 01ef-429a failed: division by zero":     false,
+	} {
+		if got := arrowfetch.IsTransient(errors.New(msg)); got != want {
+			t.Errorf("IsTransient(%q) = %v, want %v", msg, got, want)
+		}
+	}
+}
+
+func TestIsSubquery(t *testing.T) {
+	for stmt, want := range map[string]bool{
+		"SELECT 1": true,
+		"-- daily\nWITH t AS (SELECT 1) SELECT * FROM t": true,
+		"(VALUES (1), (2))":                true,
+		"SHOW TABLES IN main.sales":        false,
+		"DESCRIBE TABLE main.sales.orders": false,
+		"EXPLAIN SELECT 1":                 false,
+		"LIST '/Volumes/main/raw/landing'": false,
+	} {
+		if got := arrowfetch.IsSubquery(stmt); got != want {
+			t.Errorf("IsSubquery(%q) = %v, want %v", stmt, got, want)
+		}
+	}
+}
+
+func TestFetchCallbackError(t *testing.T) {
+	recs := arrowfetchtest.Batches(3, 2)
+	defer release(recs)
+	client, err := arrowfetchtest.NewClient(arrowfetchtest.Static(recs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	stop := errors.New("stop")
+	calls := 0
+	err = client.Fetch(context.Background(), "select 1", func(arrow.Record) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("Fetch = %v after %d calls, want %v after 1", err, calls, stop)
+	}
+}
+
+func TestRowMode(t *testing.T) {
+	recs := arrowfetchtest.Batches(2, 6)
+	defer release(recs)
+	arrowClient, err := arrowfetchtest.NewClient(arrowfetchtest.Static(recs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer arrowClient.Close()
+	rowClient, err := arrowfetchtest.NewClient(arrowfetchtest.Static(recs...), arrowfetch.WithRowMode(), arrowfetch.WithMaxRows(5))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rowClient.Close()
+
+	want, _ := collect(t, arrowClient, "select 1")
+	got, batches := collect(t, rowClient, "select 1")
+	if batches != 3 {
+		t.Errorf("row mode: %d batches of 12 rows, want 3 of at most 5", batches)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("row mode: %d rows, want %d", len(got), len(want))
+	}
+	for i := range want {
+		for j := range want[i] {
+			if got[i][j] != want[i][j] {
+				t.Errorf("row %d, column %s: %q in row mode, %q with Arrow batches", i, arrowfetchtest.Schema.Field(j).Name, got[i][j], want[i][j])
+			}
+		}
+	}
+}
+
+func TestNewRejectsInvalidOptions(t *testing.T) {
+	for name, opt := range map[string]arrowfetch.Option{
+		"key only":  arrowfetch.WithClientCert("", "client.key"),
+		"cert only": arrowfetch.WithClientCert("client.pem", ""),
+		"max rows":  arrowfetch.WithMaxRows(0),
+		"prefetch":  arrowfetch.WithPrefetch(-1),
+		"threads":   arrowfetch.WithDownloadThreads(-1),
+		"timeout":   arrowfetch.WithTimeout(-time.Second),
+		"transport": arrowfetch.WithTransport(http.DefaultTransport),
+	} {
+		opts := []arrowfetch.Option{opt, arrowfetch.WithDB(arrowfetchtest.NewDB(arrowfetchtest.Static()))}
+		if name == "transport" {
+			opts = append(opts, arrowfetch.WithProxy("http://proxy.corp:3128"))
+		}
+		if _, err := arrowfetch.New(opts...); err == nil {
+			t.Errorf("%s: New succeeded, want an error", name)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package arrowfetch
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// LimitedAllocator is a memory.Allocator that accounts for the bytes in use and makes
+// allocations wait while the total is over a limit, until enough memory is released.
+// The Client also charges the record batches it hands out to the same account, so a
+// caller that keeps batches (to process them later or in parallel) is throttled instead
+// of running out of memory on a huge result.
+//
+// Waiting only helps when some other goroutine releases memory; a single allocation or
+// batch larger than the limit is let through when nothing else is in use.
+type LimitedAllocator struct {
+	mem   memory.Allocator
+	limit int64
+
+	mu      sync.Mutex
+	inUse   int64
+	peak    int64
+	changed chan struct{} // closed and replaced whenever memory is released
+}
+
+// NewLimitedAllocator returns an allocator drawing from mem that keeps the bytes in use
+// at or under limit. A nil mem uses memory.DefaultAllocator.
+func NewLimitedAllocator(mem memory.Allocator, limit int64) *LimitedAllocator {
+	if mem == nil {
+		mem = memory.DefaultAllocator
+	}
+	return &LimitedAllocator{mem: mem, limit: limit, changed: make(chan struct{})}
+}
+
+// Allocate waits until size bytes fit under the limit and allocates them.
+func (a *LimitedAllocator) Allocate(size int) []byte {
+	a.acquire(context.Background(), int64(size))
+	return a.mem.Allocate(size)
+}
+
+// Reallocate resizes b, waiting first when it grows.
+func (a *LimitedAllocator) Reallocate(size int, b []byte) []byte {
+	if grow := int64(size - len(b)); grow > 0 {
+		a.acquire(context.Background(), grow)
+	} else {
+		a.release(-grow)
+	}
+	return a.mem.Reallocate(size, b)
+}
+
+// Free releases b.
+func (a *LimitedAllocator) Free(b []byte) {
+	a.mem.Free(b)
+	a.release(int64(len(b)))
+}
+
+// InUse returns the bytes currently accounted for.
+func (a *LimitedAllocator) InUse() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.inUse
+}
+
+// Peak returns the highest number of bytes in use so far.
+func (a *LimitedAllocator) Peak() int64 {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.peak
+}
+
+// acquire waits until n more bytes fit under the limit, or nothing is in use, and
+// accounts for them. It gives up with the context's error.
+func (a *LimitedAllocator) acquire(ctx context.Context, n int64) error {
+	for {
+		a.mu.Lock()
+		if a.inUse == 0 || a.inUse+n <= a.limit {
+			a.reserve(n)
+			a.mu.Unlock()
+			return nil
+		}
+		changed := a.changed
+		a.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return context.Cause(ctx)
+		}
+	}
+}
+
+// wait blocks until the bytes in use are under the limit, before fetching a batch whose
+// size is not known yet.
+func (a *LimitedAllocator) wait(ctx context.Context) error {
+	if err := a.acquire(ctx, 1); err != nil {
+		return err
+	}
+	a.release(1)
+	return nil
+}
+
+// reserve accounts for n bytes; the caller holds a.mu.
+func (a *LimitedAllocator) reserve(n int64) {
+	a.inUse += n
+	if a.inUse > a.peak {
+		a.peak = a.inUse
+	}
+}
+
+// release gives back n bytes and wakes the waiting allocations.
+func (a *LimitedAllocator) release(n int64) {
+	if n == 0 {
+		return
+	}
+	a.mu.Lock()
+	a.inUse -= n
+	close(a.changed)
+	a.changed = make(chan struct{})
+	a.mu.Unlock()
+}
+
+// track charges rec to the account until its last reference is released. Slices of its
+// columns kept after that are not counted.
+func (a *LimitedAllocator) track(rec arrow.Record) arrow.Record {
+	size := RecordSize(rec)
+	a.mu.Lock()
+	a.reserve(size)
+	a.mu.Unlock()
+	r := &trackedRecord{Record: rec, alloc: a, size: size}
+	r.refs.Store(1)
+	return r
+}
+
+// trackedRecord releases its account charge along with the record.
+type trackedRecord struct {
+	arrow.Record
+	alloc *LimitedAllocator
+	size  int64
+	refs  atomic.Int64
+}
+
+func (r *trackedRecord) Retain() {
+	r.refs.Add(1)
+	r.Record.Retain()
+}
+
+func (r *trackedRecord) Release() {
+	r.Record.Release()
+	if r.refs.Add(-1) == 0 {
+		r.alloc.release(r.size)
+	}
+}
+
+// RecordSize returns the bytes held by the buffers of rec, including nested columns.
+func RecordSize(rec arrow.Record) int64 {
+	var n int64
+	for _, col := range rec.Columns() {
+		n += dataSize(col.Data())
+	}
+	return n
+}
+
+// dataSize sums the buffers of an array and of its children.
+func dataSize(d arrow.ArrayData) int64 {
+	var n int64
+	for _, buf := range d.Buffers() {
+		if buf != nil {
+			n += int64(buf.Len())
+		}
+	}
+	for _, child := range d.Children() {
+		n += dataSize(child)
+	}
+	return n
+}
@@ -0,0 +1,23 @@
+package arrowfetch
+
+import "time"
+
+// Observer receives measurements of the queries a Client runs, for instance to export
+// them as metrics. With prefetching its methods are called from a background goroutine,
+// so they must be safe for concurrent use.
+type Observer interface {
+	// QueryExecuted is called once the statement has run, or failed to, with the time
+	// since the query was sent. Retried attempts count as one query.
+	QueryExecuted(d time.Duration, err error)
+
+	// BatchFetched is called for every batch fetched, or failed to fetch, with the time
+	// the fetch took including retries.
+	BatchFetched(rows, bytes int64, d time.Duration, err error)
+}
+
+// WithObserver reports the execution and fetch measurements of every query to o.
+func WithObserver(o Observer) Option {
+	return func(c *config) {
+		c.observer = o
+	}
+}
@@ -0,0 +1,312 @@
+package arrowfetch
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/databricks/databricks-sql-go/auth"
+)
+
+// config holds the settings collected from the functional options passed to New.
+type config struct {
+	host         string
+	port         int
+	httpPath     string
+	token        string
+	auth         auth.Authenticator
+	maxRows      int
+	queryTimeout time.Duration
+	fetchTimeout time.Duration
+	proxy        string
+	transport    http.RoundTripper
+	userAgent    string
+	caCert       string
+	certFile     string
+	keyFile      string
+	retry        RetryPolicy
+	pool         PoolOptions
+	catalog      string
+	schema       string
+	session      map[string]string
+	mem          *LimitedAllocator
+	tableLimit   int64
+	prefetch     int
+	cloudFetch   bool
+	downloads    int
+	rowMode      bool
+	observer     Observer
+	roundTrip    func(RoundTrip)
+	db           *sql.DB
+}
+
+// defaultConfig returns the settings used when no option overrides them.
+func defaultConfig() config {
+	return config{
+		port:         443,
+		maxRows:      100000,
+		queryTimeout: 10 * time.Minute,
+		retry:        DefaultRetryPolicy,
+		tableLimit:   1 << 30,
+	}
+}
+
+// validate reports the settings that cannot work, so New fails instead of the first
+// query.
+func (c config) validate() error {
+	switch {
+	case c.maxRows < 1:
+		return fmt.Errorf("WithMaxRows needs at least 1 row, got %d", c.maxRows)
+	case c.queryTimeout < 0 || c.fetchTimeout < 0:
+		return errors.New("timeouts must not be negative")
+	case c.prefetch < 0:
+		return fmt.Errorf("WithPrefetch needs a depth of 0 or more, got %d", c.prefetch)
+	case c.downloads < 0:
+		return fmt.Errorf("WithDownloadThreads needs 0 or more threads, got %d", c.downloads)
+	case c.tableLimit < 0:
+		return fmt.Errorf("WithTableLimit needs a limit of 0 or more, got %d", c.tableLimit)
+	case (c.certFile == "") != (c.keyFile == ""):
+		return errors.New("WithClientCert needs both the certificate and the key file")
+	case c.transport != nil && (c.proxy != "" || c.caCert != "" || c.certFile != ""):
+		return errors.New("WithTransport cannot be combined with WithProxy, WithCACert or WithClientCert, which build a transport of their own")
+	}
+	return nil
+}
+
+// Option configures a Client.
+type Option func(*config)
+
+// WithHost sets the Databricks workspace hostname (DATABRICKS_HOST).
+func WithHost(host string) Option {
+	return func(c *config) {
+		c.host = host
+	}
+}
+
+// WithPort sets the port of the SQL warehouse endpoint. Defaults to 443.
+func WithPort(port int) Option {
+	return func(c *config) {
+		c.port = port
+	}
+}
+
+// WithHTTPPath sets the HTTP path of the SQL warehouse (DATABRICKS_HTTP_PATH).
+func WithHTTPPath(path string) Option {
+	return func(c *config) {
+		c.httpPath = path
+	}
+}
+
+// WithAccessToken sets the personal access token used to authenticate.
+func WithAccessToken(token string) Option {
+	return func(c *config) {
+		c.token = token
+	}
+}
+
+// WithAuthenticator sets the authenticator used instead of a personal access token,
+// for example an OAuth flow from the dbauth package.
+func WithAuthenticator(a auth.Authenticator) Option {
+	return func(c *config) {
+		c.auth = a
+	}
+}
+
+// WithMaxRows sets the maximum number of rows fetched per round trip. Defaults to 100000.
+// The warehouse returns the rows of a round trip as one or more Arrow batches, so n also
+// bounds the rows of a batch, and in row mode it is the number of rows of every batch.
+// It does not limit the rows of the result, and has no effect on the size of the files
+// of a cloud fetch result.
+func WithMaxRows(n int) Option {
+	return func(c *config) {
+		c.maxRows = n
+	}
+}
+
+// WithQueryTimeout limits how long the statement may run before its first results are
+// ready. 0 disables the limit. Defaults to 10 minutes.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.queryTimeout = d
+	}
+}
+
+// WithFetchTimeout limits how long reading all batches of a result may take once the
+// statement has run. 0, the default, disables the limit.
+func WithFetchTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.fetchTimeout = d
+	}
+}
+
+// WithTimeout applies the same limit to query execution and to batch fetching.
+func WithTimeout(d time.Duration) Option {
+	return func(c *config) {
+		c.queryTimeout = d
+		c.fetchTimeout = d
+	}
+}
+
+// WithProxy routes the connection to the warehouse through the given HTTP(S) proxy,
+// e.g. http://proxy.corp:3128. Hosts listed in NO_PROXY still bypass it.
+// Without this option the HTTPS_PROXY and NO_PROXY environment variables apply.
+func WithProxy(proxyURL string) Option {
+	return func(c *config) {
+		c.proxy = proxyURL
+	}
+}
+
+// WithTransport sends the requests of the connector and the REST API through rt, for
+// callers with their own instrumentation or network setup. It replaces the transport
+// that WithProxy, WithCACert and WithClientCert would build, so it cannot be combined
+// with them. Cloud fetch and staging transfers do not use it.
+func WithTransport(rt http.RoundTripper) Option {
+	return func(c *config) {
+		c.transport = rt
+	}
+}
+
+// WithCACert trusts the PEM certificates in the given bundle in addition to the system
+// roots, for TLS-intercepting proxies or warehouses behind a private PKI.
+func WithCACert(path string) Option {
+	return func(c *config) {
+		c.caCert = path
+	}
+}
+
+// WithClientCert presents the PEM client certificate and key to the server (mutual TLS).
+func WithClientCert(certFile, keyFile string) Option {
+	return func(c *config) {
+		c.certFile = certFile
+		c.keyFile = keyFile
+	}
+}
+
+// WithUserAgent adds entry, e.g. "myapp/1.2", to the user agent of the connector and
+// the REST API requests, so the queries of an application can be told apart in the
+// query history of the warehouse. Both keep their default agent and append the entry
+// in parentheses, e.g. "godatabrickssqlconnector/1.6.1 (myapp/1.2)".
+func WithUserAgent(entry string) Option {
+	return func(c *config) {
+		c.userAgent = entry
+	}
+}
+
+// WithInitialNamespace sets the catalog and schema that unqualified table names resolve
+// against. An empty value keeps the warehouse default.
+func WithInitialNamespace(catalog, schema string) Option {
+	return func(c *config) {
+		c.catalog = catalog
+		c.schema = schema
+	}
+}
+
+// WithSessionParams sets Spark SQL session parameters such as ANSI_MODE or TIMEZONE
+// on every connection. Repeated calls merge the parameters.
+func WithSessionParams(params map[string]string) Option {
+	return func(c *config) {
+		if c.session == nil {
+			c.session = make(map[string]string, len(params))
+		}
+		for k, v := range params {
+			c.session[k] = v
+		}
+	}
+}
+
+// WithRetry sets the policy used to retry query execution on transient errors. Defaults
+// to DefaultRetryPolicy. Only Idempotent statements are re-submitted on retry, and
+// batch fetches are never retried.
+func WithRetry(p RetryPolicy) Option {
+	return func(c *config) {
+		c.retry = p
+	}
+}
+
+// PoolOptions tunes the connection pool of the database handle opened by New.
+// Zero values keep the database/sql defaults.
+type PoolOptions struct {
+	MaxOpenConns    int           // maximum open connections (default unlimited)
+	MaxIdleConns    int           // maximum idle connections kept for reuse (default 2)
+	ConnMaxLifetime time.Duration // close connections after this age (default never)
+	ConnMaxIdleTime time.Duration // close connections idle for this long (default never)
+}
+
+// WithPool sets the connection pool limits, for services that run many queries concurrently.
+// It has no effect together with WithDB, whose handle the caller tunes.
+func WithPool(p PoolOptions) Option {
+	return func(c *config) {
+		c.pool = p
+	}
+}
+
+// WithDB makes the Client use an existing database handle instead of opening its own.
+// The handle must be backed by the Databricks SQL driver, or another driver whose rows
+// implement ArrowRows such as the fake of package arrowfetchtest, and is not closed by
+// Client.Close.
+func WithDB(db *sql.DB) Option {
+	return func(c *config) {
+		c.db = db
+	}
+}
+
+// WithMemoryLimit caps the memory held in record batches at about limit bytes: once the
+// batches handed out and not yet released reach the limit, fetching the next one waits
+// for the caller to release some. Batches are still processed one at a time by Fetch,
+// so the limit matters to callers that keep batches, e.g. to process them in parallel.
+func WithMemoryLimit(limit int64) Option {
+	return func(c *config) {
+		c.mem = NewLimitedAllocator(nil, limit)
+	}
+}
+
+// WithTableLimit sets the most bytes of batches FetchTable assembles before failing with
+// ErrTableTooLarge. Defaults to 1 GiB; 0 removes the limit.
+func WithTableLimit(limit int64) Option {
+	return func(c *config) {
+		c.tableLimit = limit
+	}
+}
+
+// WithPrefetch fetches up to depth batches ahead in a background goroutine, so the
+// network transfer of the next batches overlaps with the processing of the current one.
+// Each prefetched batch is held in memory until it is used. Defaults to 0, fetching
+// every batch only when Next asks for it.
+func WithPrefetch(depth int) Option {
+	return func(c *config) {
+		c.prefetch = depth
+	}
+}
+
+// WithCloudFetch lets the warehouse return large results as files on the cloud storage
+// of the workspace, which the driver downloads in parallel, instead of inline in the
+// responses of the statement protocol. Whether a given result uses it is up to the
+// warehouse. The downloads go to cloud storage directly with http.DefaultClient, so
+// WithProxy, WithCACert and WithClientCert do not apply to them. Defaults to false.
+func WithCloudFetch(enabled bool) Option {
+	return func(c *config) {
+		c.cloudFetch = enabled
+	}
+}
+
+// WithDownloadThreads sets how many cloud fetch result files are downloaded at the same
+// time, which is also how many the driver downloads ahead of the one being read. It has
+// no effect without WithCloudFetch. 0, the default, keeps the driver's default of 10.
+func WithDownloadThreads(n int) Option {
+	return func(c *config) {
+		c.downloads = n
+	}
+}
+
+// WithRowMode reads results row by row with sql.Rows and Scan, and assembles the rows
+// into record batches of WithMaxRows rows, instead of fetching them as Arrow batches.
+// It is slower, but works with result types and server versions for which the driver
+// cannot return Arrow batches. Nested types arrive as their JSON text, and decimals as
+// strings unless the driver reports their precision and scale.
+func WithRowMode() Option {
+	return func(c *config) {
+		c.rowMode = true
+	}
+}
@@ -0,0 +1,30 @@
+package arrowfetch
+
+import (
+	"strings"
+
+	dbsql "github.com/databricks/databricks-sql-go"
+)
+
+// parameterTypes maps SQL type names to the driver's parameter types.
+var parameterTypes = map[string]dbsql.SqlType{
+	"STRING":    dbsql.SqlString,
+	"DATE":      dbsql.SqlDate,
+	"TIMESTAMP": dbsql.SqlTimestamp,
+	"FLOAT":     dbsql.SqlFloat,
+	"DOUBLE":    dbsql.SqlDouble,
+	"DECIMAL":   dbsql.SqlDecimal,
+	"INT":       dbsql.SqlInteger,
+	"INTEGER":   dbsql.SqlInteger,
+	"BIGINT":    dbsql.SqlBigInt,
+	"SMALLINT":  dbsql.SqlSmallInt,
+	"TINYINT":   dbsql.SqlTinyInt,
+	"BOOLEAN":   dbsql.SqlBoolean,
+}
+
+// ParameterType returns the driver's type for a query parameter declared with a SQL
+// type name such as INT or timestamp, for the Type of a dbsql.Parameter.
+func ParameterType(name string) (dbsql.SqlType, bool) {
+	t, ok := parameterTypes[strings.ToUpper(name)]
+	return t, ok
+}
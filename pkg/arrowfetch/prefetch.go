@@ -0,0 +1,99 @@
+package arrowfetch
+
+import (
+	"context"
+	"io"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// prefetcher runs the fetch loop of a Batches in a goroutine, keeping up to its
+// channel's capacity of batches ready for Next.
+type prefetcher struct {
+	ch      chan fetched
+	done    chan struct{} // closed by stop to end the goroutine
+	stopped chan struct{} // closed when the goroutine has returned
+	pending *fetched      // batch received by hasNext and not yet returned by next
+}
+
+// fetched is the outcome of fetching one batch.
+type fetched struct {
+	rec arrow.Record
+	err error
+}
+
+// prefetch starts fetching up to depth batches ahead.
+func (b *Batches) prefetch(depth int) {
+	p := &prefetcher{
+		ch:      make(chan fetched, depth),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	b.ahead = p
+	go func() {
+		defer close(p.stopped)
+		defer close(p.ch)
+		for b.it.HasNext() {
+			select {
+			case <-p.done:
+				return
+			default:
+			}
+			rec, err := b.next()
+			select {
+			case p.ch <- fetched{rec, err}:
+			case <-p.done:
+				if rec != nil {
+					rec.Release()
+				}
+				return
+			}
+			// Stop at the first error; the caller sees it from Next.
+			if err != nil {
+				return
+			}
+		}
+	}()
+}
+
+// hasNext waits for the next batch, or for the end of the result.
+func (p *prefetcher) hasNext() bool {
+	if p.pending == nil {
+		f, ok := <-p.ch
+		if !ok {
+			return false
+		}
+		p.pending = &f
+	}
+	return true
+}
+
+// next returns the batch, or error, fetched next by the goroutine.
+func (p *prefetcher) next() (arrow.Record, error) {
+	if !p.hasNext() {
+		return nil, io.EOF
+	}
+	f := p.pending
+	p.pending = nil
+	return f.rec, f.err
+}
+
+// stop ends the goroutine and releases the batches fetched but not used. A fetch still
+// in flight is interrupted with cancel.
+func (p *prefetcher) stop(cancel context.CancelCauseFunc) {
+	close(p.done)
+	select {
+	case <-p.stopped:
+	default:
+		cancel(nil)
+		<-p.stopped
+	}
+	if p.pending != nil && p.pending.rec != nil {
+		p.pending.rec.Release()
+	}
+	for f := range p.ch {
+		if f.rec != nil {
+			f.rec.Release()
+		}
+	}
+}
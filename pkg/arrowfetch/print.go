@@ -0,0 +1,223 @@
+package arrowfetch
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+)
+
+// PrintBatch prints all the rows and columns of an Arrow Record (batch) in a table format.
+func PrintBatch(w io.Writer, record arrow.Record) {
+	// Get the list of fields (columns) from the schema.
+	fields := record.Schema().Fields()
+
+	// Print the table headers (column names).
+	for _, field := range fields {
+		fmt.Fprintf(w, "%s\t", field.Name) // Print column names separated by tabs.
+	}
+	fmt.Fprintln(w) // Newline after the column headers.
+
+	// Print a separator line for readability.
+	for range fields {
+		fmt.Fprint(w, "--------\t") // Separator line with dashes.
+	}
+	fmt.Fprintln(w)
+
+	// Loop through each row in the batch.
+	for rowIndex := 0; rowIndex < int(record.NumRows()); rowIndex++ {
+		// Loop through each column in the row and print the value.
+		for _, col := range record.Columns() {
+			PrintValue(w, col, rowIndex)
+			fmt.Fprint(w, "\t") // Separate columns with tabs.
+		}
+		fmt.Fprintln(w) // Newline after each row.
+	}
+	fmt.Fprintln(w) // Extra newline for readability between batches.
+}
+
+// PrintValue prints the value of a column for a specific row.
+func PrintValue(w io.Writer, col arrow.Array, index int) {
+	if col.IsNull(index) {
+		fmt.Fprint(w, "NULL")
+		return
+	}
+	text, ok := formatValue(col, index)
+	if !ok {
+		// Print a message for unsupported column types.
+		fmt.Fprintf(w, "Unsupported type: %T", col)
+		return
+	}
+	io.WriteString(w, text)
+}
+
+// formatValue returns the printed form of the non-NULL value at row i of col, or false
+// for a column type it does not know.
+func formatValue(col arrow.Array, i int) (string, bool) {
+	switch col := col.(type) {
+	case *array.Boolean:
+		return strconv.FormatBool(col.Value(i)), true
+	case *array.Int8:
+		return formatInt(int64(col.Value(i))), true
+	case *array.Int16:
+		return formatInt(int64(col.Value(i))), true
+	case *array.Int32:
+		return formatInt(int64(col.Value(i))), true
+	case *array.Int64:
+		return formatInt(col.Value(i)), true
+	case *array.Uint8:
+		return formatUint(uint64(col.Value(i))), true
+	case *array.Uint16:
+		return formatUint(uint64(col.Value(i))), true
+	case *array.Uint32:
+		return formatUint(uint64(col.Value(i))), true
+	case *array.Uint64:
+		return formatUint(col.Value(i)), true
+	case *array.Float32:
+		return formatFloat(float64(col.Value(i))), true
+	case *array.Float64:
+		return formatFloat(col.Value(i)), true
+	case *array.Decimal128:
+		// Print every digit of the scale, e.g. 12.50 for a decimal(10,2).
+		return col.Value(i).ToString(col.DataType().(*arrow.Decimal128Type).Scale), true
+	case *array.Decimal256:
+		return col.Value(i).ToString(col.DataType().(*arrow.Decimal256Type).Scale), true
+	case *array.String:
+		return col.Value(i), true
+	case *array.LargeString:
+		return col.Value(i), true
+	case *array.Binary:
+		// Bytes are printed as base64, as Databricks shows BINARY values.
+		return base64.StdEncoding.EncodeToString(col.Value(i)), true
+	case *array.LargeBinary:
+		return base64.StdEncoding.EncodeToString(col.Value(i)), true
+	case *array.Date32:
+		return formatDate(col.Value(i).ToTime()), true
+	case *array.Date64:
+		return formatDate(col.Value(i).ToTime()), true
+	case *array.Timestamp:
+		// In the time zone of the column, which is UTC for TIMESTAMP_NTZ.
+		return formatTimestamp(timeValue(col, i)), true
+	case *array.List, *array.LargeList, *array.Map, *array.Struct:
+		// ARRAY, MAP and STRUCT values are printed as JSON, like Databricks shows them.
+		text, err := json.Marshal(JSONValue(col, i))
+		if err != nil {
+			return fmt.Sprintf("Unprintable value: %v", err), true
+		}
+		return string(text), true
+	}
+	return "", false
+}
+
+func formatInt(v int64) string { return strconv.FormatInt(v, 10) }
+
+func formatUint(v uint64) string { return strconv.FormatUint(v, 10) }
+
+// formatFloat prints floating-point values with two decimals.
+func formatFloat(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+func formatDate(t time.Time) string { return t.Format("2006-01-02") }
+
+// formatTimestamp prints a timestamp in RFC 3339, with fractional seconds only when it
+// has them.
+func formatTimestamp(t time.Time) string { return t.Format(time.RFC3339Nano) }
+
+// JSONValue converts the value at row i of col to a value encoding/json renders
+// faithfully, for the JSON outputs and the printed form of nested values. Timestamps
+// become RFC 3339 strings in the time zone of their column, decimals keep their exact
+// digits as strings, non-finite floats become null and nulls stay null. Arrays become
+// JSON arrays, and structs and maps JSON objects with their fields or entries in order;
+// the elements are converted the same way.
+func JSONValue(col arrow.Array, i int) any {
+	if col.IsNull(i) {
+		return nil
+	}
+	switch col := col.(type) {
+	case *array.Map:
+		// Checked before lists, of which maps are a kind.
+		start, end := col.ValueOffsets(i)
+		obj := make(jsonObject, 0, end-start)
+		for j := int(start); j < int(end); j++ {
+			// JSON object keys are strings, so keys of other types are given as text.
+			key := JSONValue(col.Keys(), j)
+			name, ok := key.(string)
+			if !ok {
+				b, _ := json.Marshal(key)
+				name = string(b)
+			}
+			obj = append(obj, jsonMember{name, JSONValue(col.Items(), j)})
+		}
+		return obj
+	case *array.FixedSizeList:
+		n := int(col.DataType().(*arrow.FixedSizeListType).Len())
+		return jsonArray(col.ListValues(), (col.Offset()+i)*n, (col.Offset()+i+1)*n)
+	case array.ListLike:
+		start, end := col.ValueOffsets(i)
+		return jsonArray(col.ListValues(), int(start), int(end))
+	case *array.Struct:
+		fields := col.DataType().(*arrow.StructType).Fields()
+		obj := make(jsonObject, len(fields))
+		for k, f := range fields {
+			obj[k] = jsonMember{f.Name, JSONValue(col.Field(k), i)}
+		}
+		return obj
+	case *array.Decimal128, *array.Decimal256, *array.Date32, *array.Date64, *array.Timestamp:
+		text, _ := formatValue(col, i)
+		return text
+	case *array.Float32:
+		return finiteOrNil(float64(col.Value(i)))
+	case *array.Float64:
+		return finiteOrNil(col.Value(i))
+	}
+	return col.GetOneForMarshal(i)
+}
+
+// jsonArray converts the elements start to end of a list's values.
+func jsonArray(values arrow.Array, start, end int) []any {
+	list := make([]any, 0, end-start)
+	for j := start; j < end; j++ {
+		list = append(list, JSONValue(values, j))
+	}
+	return list
+}
+
+// finiteOrNil maps NaN and infinities, which JSON cannot represent, to null.
+func finiteOrNil(f float64) any {
+	if math.IsNaN(f) || math.IsInf(f, 0) {
+		return nil
+	}
+	return f
+}
+
+// jsonObject is a JSON object whose members keep their order, unlike a Go map's.
+type jsonObject []jsonMember
+
+type jsonMember struct {
+	key   string
+	value any
+}
+
+func (o jsonObject) MarshalJSON() ([]byte, error) {
+	buf := []byte{'{'}
+	for k, m := range o {
+		if k > 0 {
+			buf = append(buf, ',')
+		}
+		key, err := json.Marshal(m.key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(m.value)
+		if err != nil {
+			return nil, err
+		}
+		buf = append(append(append(buf, key...), ':'), value...)
+	}
+	return append(buf, '}'), nil
+}
@@ -0,0 +1,107 @@
+package arrowfetch_test
+
+import (
+	"bytes"
+	"math"
+	"testing"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+func TestPrintBatch(t *testing.T) {
+	recs := arrowfetchtest.Batches(1, 3)
+	defer release(recs)
+
+	// PrintBatch knows the numeric, string and timestamp columns.
+	rec := recs[0]
+	keep := []int{0, 1, 2, 5}
+	fields := make([]arrow.Field, len(keep))
+	cols := make([]arrow.Array, len(keep))
+	for i, c := range keep {
+		fields[i], cols[i] = rec.Schema().Field(c), rec.Column(c)
+	}
+	sub := array.NewRecord(arrow.NewSchema(fields, nil), cols, rec.NumRows())
+	defer sub.Release()
+
+	var buf bytes.Buffer
+	arrowfetch.PrintBatch(&buf, sub)
+	want := "id\tname\tamount\tcreated\t\n" +
+		"--------\t--------\t--------\t--------\t\n" +
+		"0\tNULL\t0.00\t2024-01-01T00:00:00Z\t\n" +
+		"1\tname-1\t1.50\t2024-01-01T00:01:00Z\t\n" +
+		"2\tname-2\t3.00\t2024-01-01T00:02:00Z\t\n" +
+		"\n"
+	if got := buf.String(); got != want {
+		t.Errorf("PrintBatch printed\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestPrintValue(t *testing.T) {
+	mem := memory.DefaultAllocator
+	jan1 := time.Date(2024, 1, 1, 0, 0, 0, 123456789, time.UTC)
+	timestamps := func(unit arrow.TimeUnit) array.Builder {
+		b := array.NewTimestampBuilder(mem, &arrow.TimestampType{Unit: unit, TimeZone: "UTC"})
+		b.Append(arrow.Timestamp(jan1.UnixNano() / int64(unit.Multiplier())))
+		return b
+	}
+	for _, tc := range []struct {
+		name  string
+		build func() array.Builder
+		want  string
+	}{
+		{"bool", func() array.Builder { b := array.NewBooleanBuilder(mem); b.Append(true); return b }, "true"},
+		{"int8", func() array.Builder { b := array.NewInt8Builder(mem); b.Append(-8); return b }, "-8"},
+		{"int16", func() array.Builder { b := array.NewInt16Builder(mem); b.Append(-16); return b }, "-16"},
+		{"uint64", func() array.Builder { b := array.NewUint64Builder(mem); b.Append(math.MaxUint64); return b }, "18446744073709551615"},
+		{"float32", func() array.Builder { b := array.NewFloat32Builder(mem); b.Append(0.25); return b }, "0.25"},
+		{"date32", func() array.Builder {
+			b := array.NewDate32Builder(mem)
+			b.Append(arrow.Date32FromTime(time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC)))
+			return b
+		}, "2024-02-29"},
+		{"timestamp[s]", func() array.Builder { return timestamps(arrow.Second) }, "2024-01-01T00:00:00Z"},
+		{"timestamp[ms]", func() array.Builder { return timestamps(arrow.Millisecond) }, "2024-01-01T00:00:00.123Z"},
+		{"timestamp[ns]", func() array.Builder { return timestamps(arrow.Nanosecond) }, "2024-01-01T00:00:00.123456789Z"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			b := tc.build()
+			b.AppendNull()
+			col := b.NewArray()
+			b.Release()
+			defer col.Release()
+
+			var buf bytes.Buffer
+			arrowfetch.PrintValue(&buf, col, 0)
+			if got := buf.String(); got != tc.want {
+				t.Errorf("PrintValue = %q, want %q", got, tc.want)
+			}
+			buf.Reset()
+			arrowfetch.PrintValue(&buf, col, 1)
+			if got := buf.String(); got != "NULL" {
+				t.Errorf("PrintValue of NULL = %q, want NULL", got)
+			}
+		})
+	}
+}
+
+func TestPrintNestedNonFinite(t *testing.T) {
+	// JSON has no NaN or infinity, so they print as null inside an ARRAY.
+	b := array.NewListBuilder(memory.DefaultAllocator, arrow.PrimitiveTypes.Float64)
+	defer b.Release()
+	b.Append(true)
+	b.ValueBuilder().(*array.Float64Builder).AppendValues([]float64{1.25, math.NaN(), math.Inf(-1)}, nil)
+	col := b.NewArray()
+	defer col.Release()
+
+	var buf bytes.Buffer
+	arrowfetch.PrintValue(&buf, col, 0)
+	if got, want := buf.String(), "[1.25,null,null]"; got != want {
+		t.Errorf("PrintValue = %s, want %s", got, want)
+	}
+}
@@ -0,0 +1,121 @@
+package arrowfetch
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+	"unicode"
+
+	dbsqlerr "github.com/databricks/databricks-sql-go/errors"
+)
+
+// RetryPolicy controls how the execution of a query is retried on transient failures
+// such as throttling (429), an unavailable warehouse (503) or a reset connection. Only
+// Idempotent statements are retried, and a batch fetch that fails is not: the driver
+// cannot resume a result part way, so the caller has to run the query again.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, including the first one. 1 disables retries.
+	MaxAttempts int
+	// InitialBackoff is the wait before the first retry; it doubles on every further retry.
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts.
+	MaxBackoff time.Duration
+	// Jitter randomizes each wait by up to this fraction (0 to 1) so clients do not retry in lockstep.
+	Jitter float64
+	// OnRetry, when set, is called before waiting for the next attempt.
+	OnRetry func(attempt int, err error, wait time.Duration)
+}
+
+// DefaultRetryPolicy is used when no WithRetry option is given.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxAttempts:    4,
+	InitialBackoff: 500 * time.Millisecond,
+	MaxBackoff:     30 * time.Second,
+	Jitter:         0.2,
+}
+
+// transientStatus matches the HTTP statuses worth retrying as the driver and its
+// Thrift transport report them, e.g. "unexpected HTTP status 503 Service Unavailable"
+// or "HTTP Response code: 429". Bare numbers are not matched, since a table name, row
+// count or query ID may contain them.
+var transientStatus = regexp.MustCompile(`(?i)(unexpected HTTP status|HTTP Response code:|HTTP error) (429|503)\b|\b(too many requests|service unavailable)\b`)
+
+// IsTransient reports whether err is worth retrying: throttling, an unavailable service
+// or a connection dropped by the server or a proxy.
+func IsTransient(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	// The driver marks the failures its own retries gave up on.
+	var dbErr dbsqlerr.DBError
+	if errors.As(err, &dbErr) && dbErr.IsRetryable() {
+		return true
+	}
+	return transientStatus.MatchString(err.Error()) || strings.Contains(strings.ToLower(err.Error()), "connection reset by peer")
+}
+
+// Idempotent reports whether stmt can be executed again after a failure without
+// changing its outcome: a query reading rows, such as SELECT or SHOW. DDL, DML and SET
+// are not, nor a WITH clause that feeds an INSERT, MERGE, UPDATE or DELETE, since the
+// first attempt may have run on the warehouse before its response was lost.
+func Idempotent(stmt string) bool {
+	if !ReturnsRows(stmt) {
+		return false
+	}
+	if leadingKeyword(stmt) == "WITH" {
+		words := strings.FieldsFunc(strings.ToUpper(stmt), func(r rune) bool { return !unicode.IsLetter(r) })
+		for _, w := range words {
+			switch w {
+			case "INSERT", "MERGE", "UPDATE", "DELETE":
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// backoff returns the wait before the given retry (1 for the first retry).
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	wait := p.InitialBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if p.Jitter > 0 {
+		wait += time.Duration((rand.Float64()*2 - 1) * p.Jitter * float64(wait))
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	return wait
+}
+
+// do calls fn until it succeeds, fails with a non-transient error, runs out of attempts
+// or ctx is done.
+func (p RetryPolicy) do(ctx context.Context, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.MaxAttempts || !IsTransient(err) {
+			return err
+		}
+
+		wait := p.backoff(attempt)
+		if p.OnRetry != nil {
+			p.OnRetry(attempt, err, wait)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package arrowfetch
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RoundTrip describes one HTTP request made while running a query.
+type RoundTrip struct {
+	// Kind is "thrift" for the statement protocol of the warehouse, "api" for the REST
+	// API of the workspace and "download" for any other host, which for the driver means
+	// a cloud fetch result link on the cloud storage of the workspace.
+	Kind   string
+	Method string
+	Host   string
+	Path   string // without the query string, which holds the signature of presigned links
+	Status int    // 0 when no response was received
+	Bytes  int64  // response body bytes read
+	// Header is the time until the response headers arrived and Duration the time until
+	// the body was closed, so a slow download shows as Duration well above Header.
+	Header   time.Duration
+	Duration time.Duration
+	Err      error
+}
+
+// WithRoundTripLog calls fn for every HTTP request of the connector and the REST API,
+// once its response body is closed. Used for debugging slow fetches.
+func WithRoundTripLog(fn func(RoundTrip)) Option {
+	return func(c *config) {
+		c.roundTrip = fn
+	}
+}
+
+// NewTraceTransport wraps next so that fn is called for every request it sends, with
+// requests to host reported as "thrift" or "api" and all others as "download". The
+// driver downloads cloud fetch result links with http.DefaultClient, whose transport
+// can be replaced by this one to see them.
+func NewTraceTransport(next http.RoundTripper, host string, fn func(RoundTrip)) http.RoundTripper {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	// Accept the host as given to WithHost, with or without a scheme and port.
+	host = strings.TrimPrefix(strings.TrimPrefix(strings.ToLower(host), "https://"), "http://")
+	host = strings.TrimSuffix(host, "/")
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return &traceTransport{next: next, host: host, fn: fn}
+}
+
+type traceTransport struct {
+	next http.RoundTripper
+	host string
+	fn   func(RoundTrip)
+}
+
+func (t *traceTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	rt := RoundTrip{
+		Kind:   t.kind(req),
+		Method: req.Method,
+		Host:   req.URL.Host,
+		Path:   req.URL.Path,
+	}
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	rt.Header = time.Since(start)
+	if err != nil {
+		rt.Duration, rt.Err = rt.Header, err
+		t.fn(rt)
+		return nil, err
+	}
+	rt.Status = resp.StatusCode
+	resp.Body = &traceBody{ReadCloser: resp.Body, rt: rt, start: start, fn: t.fn}
+	return resp, nil
+}
+
+// kind classifies req by its host and path.
+func (t *traceTransport) kind(req *http.Request) string {
+	switch {
+	case strings.ToLower(req.URL.Hostname()) != t.host:
+		return "download"
+	case strings.HasPrefix(req.URL.Path, "/api/"):
+		return "api"
+	}
+	return "thrift"
+}
+
+// traceBody counts the bytes read from a response body and reports the round trip
+// when the body is closed.
+type traceBody struct {
+	io.ReadCloser
+	rt    RoundTrip
+	start time.Time
+	fn    func(RoundTrip)
+	once  sync.Once
+}
+
+func (b *traceBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.rt.Bytes += int64(n)
+	return n, err
+}
+
+func (b *traceBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.once.Do(func() {
+		b.rt.Duration = time.Since(b.start)
+		b.fn(b.rt)
+	})
+	return err
+}
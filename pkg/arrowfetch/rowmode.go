@@ -0,0 +1,243 @@
+package arrowfetch
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// rowBatches is the batch iterator of WithRowMode. It reads the result row by row with
+// sql.Rows and Scan and assembles the rows into record batches of up to size rows, so
+// the rest of the client sees the same batches as with Arrow fetching. Each column gets
+// the Arrow type Fetch delivers for it, except nested types, which arrive as their JSON
+// text.
+type rowBatches struct {
+	rows   *sql.Rows
+	size   int
+	schema *arrow.Schema
+	values []any
+	ptrs   []any
+
+	more    bool // a row was read ahead by rows.Next and awaits Scan
+	started bool
+	err     error // first error, returned by every later Next
+}
+
+func newRowBatches(rows *sql.Rows, size int) (*rowBatches, error) {
+	types, err := rows.ColumnTypes()
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the result columns: %w", err)
+	}
+	fields := make([]arrow.Field, len(types))
+	for i, t := range types {
+		fields[i] = arrow.Field{Name: t.Name(), Type: rowType(t), Nullable: true}
+	}
+	r := &rowBatches{rows: rows, size: max(size, 1), schema: arrow.NewSchema(fields, nil)}
+	r.values = make([]any, len(fields))
+	r.ptrs = make([]any, len(fields))
+	for i := range r.values {
+		r.ptrs[i] = &r.values[i]
+	}
+	return r, nil
+}
+
+// rowType maps the type name reported by the driver, e.g. BIGINT or DECIMAL, to the
+// Arrow type of the column.
+func rowType(t *sql.ColumnType) arrow.DataType {
+	dt, err := ParseSQLType(strings.ToLower(t.DatabaseTypeName()))
+	if err != nil || dt.ID() == arrow.NULL || arrow.IsNested(dt.ID()) {
+		// ARRAY, MAP, STRUCT and INTERVAL_* values are scanned as strings.
+		return arrow.BinaryTypes.String
+	}
+	if dt.ID() == arrow.DECIMAL128 {
+		// The type name carries no precision and scale; without them from the driver,
+		// the values are kept as the strings they are scanned as.
+		precision, scale, ok := t.DecimalSize()
+		if !ok || precision < 1 || precision > 38 || scale < 0 || scale > precision {
+			return arrow.BinaryTypes.String
+		}
+		return &arrow.Decimal128Type{Precision: int32(precision), Scale: int32(scale)}
+	}
+	return dt
+}
+
+// HasNext reports whether a row, or an error, is left.
+func (r *rowBatches) HasNext() bool {
+	if !r.started {
+		r.started = true
+		r.advance()
+	}
+	return r.more || r.err != nil
+}
+
+// advance reads the next row ahead, keeping the error that ended the rows.
+func (r *rowBatches) advance() {
+	r.more = r.rows.Next()
+	if !r.more && r.err == nil {
+		r.err = r.rows.Err()
+	}
+}
+
+// Next assembles the next batch from up to size rows.
+func (r *rowBatches) Next() (arrow.Record, error) {
+	if !r.HasNext() {
+		return nil, io.EOF
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	b := array.NewRecordBuilder(memory.DefaultAllocator, r.schema)
+	defer b.Release()
+	for n := 0; r.more && n < r.size; n++ {
+		if err := r.rows.Scan(r.ptrs...); err != nil {
+			r.err = err
+			return nil, err
+		}
+		for i, v := range r.values {
+			if err := appendValue(b.Field(i), v); err != nil {
+				r.err = fmt.Errorf("column %s: %w", r.schema.Field(i).Name, err)
+				return nil, r.err
+			}
+		}
+		r.advance()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return b.NewRecord(), nil
+}
+
+func (r *rowBatches) Close() {
+	r.rows.Close()
+}
+
+// appendValue appends a scanned value to the builder of its column.
+func appendValue(b array.Builder, v any) error {
+	if v == nil {
+		b.AppendNull()
+		return nil
+	}
+	ok := true
+	switch b := b.(type) {
+	case *array.BooleanBuilder:
+		var x bool
+		if x, ok = v.(bool); ok {
+			b.Append(x)
+		}
+	case *array.Int8Builder:
+		var x int64
+		if x, ok = integer(v); ok {
+			b.Append(int8(x))
+		}
+	case *array.Int16Builder:
+		var x int64
+		if x, ok = integer(v); ok {
+			b.Append(int16(x))
+		}
+	case *array.Int32Builder:
+		var x int64
+		if x, ok = integer(v); ok {
+			b.Append(int32(x))
+		}
+	case *array.Int64Builder:
+		var x int64
+		if x, ok = integer(v); ok {
+			b.Append(x)
+		}
+	case *array.Float32Builder:
+		switch x := v.(type) {
+		case float32:
+			b.Append(x)
+		case float64:
+			b.Append(float32(x))
+		default:
+			ok = false
+		}
+	case *array.Float64Builder:
+		switch x := v.(type) {
+		case float32:
+			b.Append(float64(x))
+		case float64:
+			b.Append(x)
+		default:
+			ok = false
+		}
+	case *array.Date32Builder:
+		var t time.Time
+		if t, ok = v.(time.Time); ok {
+			b.Append(arrow.Date32FromTime(t))
+		}
+	case *array.TimestampBuilder:
+		var t time.Time
+		if t, ok = v.(time.Time); ok {
+			b.Append(arrow.Timestamp(t.UnixMicro()))
+		}
+	case *array.BinaryBuilder:
+		switch x := v.(type) {
+		case []byte:
+			b.Append(x)
+		case string:
+			b.AppendString(x)
+		default:
+			ok = false
+		}
+	case *array.Decimal128Builder:
+		var text string
+		switch x := v.(type) {
+		case string:
+			text = x
+		case []byte:
+			text = string(x)
+		case float64:
+			text = strconv.FormatFloat(x, 'f', -1, 64)
+		default:
+			ok = false
+		}
+		if ok {
+			n, err := parseDecimal(text, b.Type().(*arrow.Decimal128Type))
+			if err != nil {
+				return err
+			}
+			b.Append(n)
+		}
+	case *array.StringBuilder:
+		switch x := v.(type) {
+		case string:
+			b.Append(x)
+		case []byte:
+			b.Append(string(x))
+		default:
+			b.Append(fmt.Sprint(x))
+		}
+	default:
+		return fmt.Errorf("unsupported column type %s", b.Type())
+	}
+	if !ok {
+		return fmt.Errorf("unexpected %T value for a %s column", v, b.Type())
+	}
+	return nil
+}
+
+// integer returns the value of any of the integer types the driver scans.
+func integer(v any) (int64, bool) {
+	switch x := v.(type) {
+	case int8:
+		return int64(x), true
+	case int16:
+		return int64(x), true
+	case int32:
+		return int64(x), true
+	case int64:
+		return x, true
+	case int:
+		return int64(x), true
+	}
+	return 0, false
+}
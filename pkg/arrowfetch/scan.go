@@ -0,0 +1,368 @@
+package arrowfetch
+
+import (
+	"fmt"
+	"iter"
+	"math/big"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+)
+
+// Scan copies the rows of rec into a slice of structs. Columns are matched to the
+// exported fields of T by the `arrow:"name"` tag, or else by the field name, ignoring
+// case and underscores (FareAmount matches fare_amount). A tag of "-" skips the field.
+// Columns without a matching field are ignored and fields without a column are left
+// zero.
+//
+// Integer, float, bool, string, []byte and time.Time fields are supported, as well as
+// pointers to them. A NULL leaves a pointer nil and any other field zero. Decimal
+// columns scan exactly into big.Rat or string fields, or approximately into floats.
+//
+//	type Trip struct {
+//		PickupZip  string
+//		FareAmount float64
+//		Pickup     time.Time `arrow:"tpep_pickup_datetime"`
+//	}
+//	err := client.Fetch(ctx, query, func(b arrow.Record) error {
+//		trips, err := arrowfetch.Scan[Trip](b)
+//		...
+//	})
+func Scan[T any](rec arrow.Record) ([]T, error) {
+	s, err := NewScanner[T](rec.Schema())
+	if err != nil {
+		return nil, err
+	}
+	rows := make([]T, rec.NumRows())
+	for i := range rows {
+		if err := s.ScanRow(rec, i, &rows[i]); err != nil {
+			return nil, err
+		}
+	}
+	return rows, nil
+}
+
+// Rows returns an iterator over the rows of rec as structs, mapped as in Scan. It stops
+// after yielding the first error.
+//
+//	for trip, err := range arrowfetch.Rows[Trip](b) { ... }
+func Rows[T any](rec arrow.Record) iter.Seq2[T, error] {
+	return func(yield func(T, error) bool) {
+		var zero T
+		s, err := NewScanner[T](rec.Schema())
+		if err != nil {
+			yield(zero, err)
+			return
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			var row T
+			if err := s.ScanRow(rec, i, &row); err != nil {
+				yield(row, err)
+				return
+			}
+			if !yield(row, nil) {
+				return
+			}
+		}
+	}
+}
+
+// Scanner maps the rows of records with one schema to structs of type T. Building it
+// once per schema avoids matching the columns again for every record.
+type Scanner[T any] struct {
+	fields []scanField
+}
+
+// scanField sets the struct field at index from a column.
+type scanField struct {
+	column int
+	index  []int
+	set    setter
+}
+
+// setter stores the value at row i of col in v, which is not NULL.
+type setter func(col arrow.Array, i int, v reflect.Value) error
+
+// NewScanner matches the columns of schema to the fields of T, which must be a struct.
+func NewScanner[T any](schema *arrow.Schema) (*Scanner[T], error) {
+	t := reflect.TypeFor[T]()
+	if t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("scan: %s is not a struct", t)
+	}
+
+	s := &Scanner[T]{}
+	for _, f := range reflect.VisibleFields(t) {
+		if !f.IsExported() || f.Anonymous {
+			continue
+		}
+		name, tagged := f.Tag.Lookup("arrow")
+		if name == "-" {
+			continue
+		}
+		column := -1
+		for c, field := range schema.Fields() {
+			if tagged && field.Name == name || !tagged && normalizeName(field.Name) == normalizeName(f.Name) {
+				column = c
+				break
+			}
+		}
+		if column < 0 {
+			continue
+		}
+		set, err := newSetter(schema.Field(column).Type, f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("scan: column %s into field %s: %w", schema.Field(column).Name, f.Name, err)
+		}
+		s.fields = append(s.fields, scanField{column: column, index: f.Index, set: set})
+	}
+	return s, nil
+}
+
+// ScanRow copies row i of rec into dst. rec must have the schema the Scanner was built for.
+func (s *Scanner[T]) ScanRow(rec arrow.Record, i int, dst *T) error {
+	v := reflect.ValueOf(dst).Elem()
+	for _, f := range s.fields {
+		col := rec.Column(f.column)
+		field := v.FieldByIndex(f.index)
+		if col.IsNull(i) {
+			field.SetZero()
+			continue
+		}
+		if err := f.set(col, i, field); err != nil {
+			return fmt.Errorf("scan: row %d, column %s: %w", i, rec.ColumnName(f.column), err)
+		}
+	}
+	return nil
+}
+
+// normalizeName folds case and drops underscores so Go and SQL naming styles match.
+func normalizeName(name string) string {
+	return strings.ToLower(strings.ReplaceAll(name, "_", ""))
+}
+
+var (
+	timeType = reflect.TypeFor[time.Time]()
+	ratType  = reflect.TypeFor[big.Rat]()
+)
+
+// newSetter returns the conversion from columns of type dt to fields of type t, or an
+// error when the types are incompatible.
+func newSetter(dt arrow.DataType, t reflect.Type) (setter, error) {
+	// Pointers are allocated for non-NULL values and filled by the pointed-to type's setter.
+	if t.Kind() == reflect.Pointer {
+		elem, err := newSetter(dt, t.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return func(col arrow.Array, i int, v reflect.Value) error {
+			p := reflect.New(t.Elem())
+			if err := elem(col, i, p.Elem()); err != nil {
+				return err
+			}
+			v.Set(p)
+			return nil
+		}, nil
+	}
+
+	switch {
+	case t == timeType:
+		switch dt.ID() {
+		case arrow.TIMESTAMP, arrow.DATE32, arrow.DATE64:
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				v.Set(reflect.ValueOf(timeValue(col, i)))
+				return nil
+			}, nil
+		}
+	case t == ratType:
+		switch dt.ID() {
+		case arrow.DECIMAL128, arrow.DECIMAL256:
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				v.Set(reflect.ValueOf(decimalRat(col, i)).Elem())
+				return nil
+			}, nil
+		case arrow.STRING:
+			// A decimal column read as text, e.g. in row mode.
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				r, ok := new(big.Rat).SetString(stringValue(col, i))
+				if !ok {
+					return fmt.Errorf("invalid decimal %q", stringValue(col, i))
+				}
+				v.Set(reflect.ValueOf(r).Elem())
+				return nil
+			}, nil
+		}
+	case t.Kind() == reflect.Bool:
+		if dt.ID() == arrow.BOOL {
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				v.SetBool(col.(*array.Boolean).Value(i))
+				return nil
+			}, nil
+		}
+	case t.Kind() == reflect.String:
+		switch dt.ID() {
+		case arrow.STRING, arrow.LARGE_STRING, arrow.DECIMAL128, arrow.DECIMAL256:
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				v.SetString(stringValue(col, i))
+				return nil
+			}, nil
+		}
+	case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+		switch dt.ID() {
+		case arrow.BINARY, arrow.LARGE_BINARY, arrow.FIXED_SIZE_BINARY:
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				// Copy the bytes: the record's buffers are released after the callback.
+				v.SetBytes(append([]byte(nil), binaryValue(col, i)...))
+				return nil
+			}, nil
+		}
+	case t.Kind() >= reflect.Int && t.Kind() <= reflect.Int64:
+		if isIntegerType(dt) {
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				n, ok := intValue(col, i)
+				if !ok || v.OverflowInt(n) {
+					return fmt.Errorf("value does not fit in %s", v.Type())
+				}
+				v.SetInt(n)
+				return nil
+			}, nil
+		}
+	case t.Kind() >= reflect.Uint && t.Kind() <= reflect.Uint64:
+		if isIntegerType(dt) {
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				n, ok := uintValue(col, i)
+				if !ok || v.OverflowUint(n) {
+					return fmt.Errorf("value does not fit in %s", v.Type())
+				}
+				v.SetUint(n)
+				return nil
+			}, nil
+		}
+	case t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64:
+		switch {
+		case isIntegerType(dt):
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				if u, isUint := col.(*array.Uint64); isUint {
+					v.SetFloat(float64(u.Value(i)))
+					return nil
+				}
+				n, _ := intValue(col, i)
+				v.SetFloat(float64(n))
+				return nil
+			}, nil
+		case dt.ID() == arrow.FLOAT32 || dt.ID() == arrow.FLOAT64 || dt.ID() == arrow.DECIMAL128 || dt.ID() == arrow.DECIMAL256:
+			return func(col arrow.Array, i int, v reflect.Value) error {
+				v.SetFloat(floatValue(col, i))
+				return nil
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("cannot convert %s to %s", dt, t)
+}
+
+// isIntegerType reports whether dt is a signed or unsigned integer type.
+func isIntegerType(dt arrow.DataType) bool {
+	switch dt.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return true
+	}
+	return false
+}
+
+// intValue returns an integer column value as int64; ok is false for a uint64 above the
+// int64 range.
+func intValue(col arrow.Array, i int) (n int64, ok bool) {
+	switch col := col.(type) {
+	case *array.Int8:
+		return int64(col.Value(i)), true
+	case *array.Int16:
+		return int64(col.Value(i)), true
+	case *array.Int32:
+		return int64(col.Value(i)), true
+	case *array.Int64:
+		return col.Value(i), true
+	case *array.Uint8:
+		return int64(col.Value(i)), true
+	case *array.Uint16:
+		return int64(col.Value(i)), true
+	case *array.Uint32:
+		return int64(col.Value(i)), true
+	case *array.Uint64:
+		u := col.Value(i)
+		return int64(u), u <= 1<<63-1
+	}
+	return 0, false
+}
+
+// uintValue returns an integer column value as uint64; ok is false for a negative value.
+func uintValue(col arrow.Array, i int) (uint64, bool) {
+	if u, isUint := col.(*array.Uint64); isUint {
+		return u.Value(i), true
+	}
+	n, _ := intValue(col, i)
+	return uint64(n), n >= 0
+}
+
+// floatValue returns a floating point or decimal column value as float64.
+func floatValue(col arrow.Array, i int) float64 {
+	switch col := col.(type) {
+	case *array.Float32:
+		return float64(col.Value(i))
+	case *array.Float64:
+		return col.Value(i)
+	case *array.Decimal128:
+		return col.Value(i).ToFloat64(col.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		return col.Value(i).ToFloat64(col.DataType().(*arrow.Decimal256Type).Scale)
+	}
+	return 0
+}
+
+// stringValue returns a string or decimal column value as text.
+func stringValue(col arrow.Array, i int) string {
+	switch col := col.(type) {
+	case *array.String:
+		return col.Value(i)
+	case *array.LargeString:
+		return col.Value(i)
+	case *array.Decimal128:
+		return col.Value(i).ToString(col.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		return col.Value(i).ToString(col.DataType().(*arrow.Decimal256Type).Scale)
+	}
+	return ""
+}
+
+// binaryValue returns a binary column value; the bytes belong to the record.
+func binaryValue(col arrow.Array, i int) []byte {
+	switch col := col.(type) {
+	case *array.Binary:
+		return col.Value(i)
+	case *array.LargeBinary:
+		return col.Value(i)
+	case *array.FixedSizeBinary:
+		return col.Value(i)
+	}
+	return nil
+}
+
+// timeValue returns a timestamp or date column value as a time.Time, in the column's
+// time zone for timestamps and UTC otherwise.
+func timeValue(col arrow.Array, i int) time.Time {
+	switch col := col.(type) {
+	case *array.Timestamp:
+		typ := col.DataType().(*arrow.TimestampType)
+		t := col.Value(i).ToTime(typ.Unit)
+		if loc, err := typ.GetZone(); err == nil && loc != nil {
+			return t.In(loc)
+		}
+		return t
+	case *array.Date32:
+		return col.Value(i).ToTime()
+	case *array.Date64:
+		return col.Value(i).ToTime()
+	}
+	return time.Time{}
+}
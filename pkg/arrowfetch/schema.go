@@ -0,0 +1,317 @@
+package arrowfetch
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+)
+
+// SQLTypeKey is the field metadata key holding the Databricks SQL type of a column,
+// e.g. decimal(10,2), in the schemas returned by Schema.
+const SQLTypeKey = "databricks.sql_type"
+
+// Schema returns the schema of the result of query without running it: the warehouse
+// only compiles the query (DESCRIBE QUERY), so no rows are read or transferred.
+//
+// The Arrow types are the ones Fetch delivers for those columns; decimals, for
+// instance, are Decimal128 columns of their precision and scale. The SQL type of each
+// column is kept in the field metadata under SQLTypeKey. Top-level columns are always
+// reported as nullable, since Databricks does not describe their nullability.
+func (c *Client) Schema(ctx context.Context, query string, args ...any) (*arrow.Schema, error) {
+	var fields []arrow.Field
+	err := c.Fetch(ctx, "DESCRIBE QUERY "+query, func(rec arrow.Record) error {
+		if rec.NumCols() < 2 {
+			return fmt.Errorf("unexpected DESCRIBE QUERY result: %s", rec.Schema())
+		}
+		names, ok1 := rec.Column(0).(*array.String)
+		types, ok2 := rec.Column(1).(*array.String)
+		if !ok1 || !ok2 {
+			return fmt.Errorf("unexpected DESCRIBE QUERY result: %s", rec.Schema())
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			dt, err := ParseSQLType(types.Value(i))
+			if err != nil {
+				return fmt.Errorf("column %s: %w", names.Value(i), err)
+			}
+			fields = append(fields, arrow.Field{
+				Name:     names.Value(i),
+				Type:     dt,
+				Nullable: true,
+				Metadata: arrow.NewMetadata([]string{SQLTypeKey}, []string{types.Value(i)}),
+			})
+		}
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+	return arrow.NewSchema(fields, nil), nil
+}
+
+// ParseSQLType maps a Databricks SQL type such as array<struct<id:bigint,price:decimal(10,2)>>
+// to the Arrow type its values are fetched as.
+func ParseSQLType(text string) (arrow.DataType, error) {
+	p := &typeParser{text: text}
+	dt, err := p.parse()
+	if err == nil && p.peek() != 0 {
+		err = p.errorf("unexpected %q", p.text[p.pos:])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return dt, nil
+}
+
+// typeParser is a small recursive-descent parser over the type grammar DESCRIBE prints.
+type typeParser struct {
+	text string
+	pos  int
+}
+
+func (p *typeParser) parse() (arrow.DataType, error) {
+	name := strings.ToLower(p.word())
+	switch name {
+	case "boolean":
+		return arrow.FixedWidthTypes.Boolean, nil
+	case "tinyint", "byte":
+		return arrow.PrimitiveTypes.Int8, nil
+	case "smallint", "short":
+		return arrow.PrimitiveTypes.Int16, nil
+	case "int", "integer":
+		return arrow.PrimitiveTypes.Int32, nil
+	case "bigint", "long":
+		return arrow.PrimitiveTypes.Int64, nil
+	case "float", "real":
+		return arrow.PrimitiveTypes.Float32, nil
+	case "double":
+		return arrow.PrimitiveTypes.Float64, nil
+	case "date":
+		return arrow.FixedWidthTypes.Date32, nil
+	case "timestamp":
+		return arrow.FixedWidthTypes.Timestamp_us, nil
+	case "timestamp_ntz":
+		return &arrow.TimestampType{Unit: arrow.Microsecond}, nil
+	case "binary":
+		return arrow.BinaryTypes.Binary, nil
+	case "void":
+		return arrow.Null, nil
+	case "string", "variant":
+		return arrow.BinaryTypes.String, nil
+	case "varchar", "char":
+		// The length is not part of the fetched type.
+		if p.peek() == '(' {
+			if _, err := p.arguments(); err != nil {
+				return nil, err
+			}
+		}
+		return arrow.BinaryTypes.String, nil
+	case "decimal", "dec", "numeric":
+		// DECIMAL alone is DECIMAL(10,0), and DECIMAL(p) has a scale of 0.
+		dt := &arrow.Decimal128Type{Precision: 10}
+		if p.peek() == '(' {
+			args, err := p.arguments()
+			if err != nil {
+				return nil, err
+			}
+			if len(args) > 2 || args[0] < 1 || args[0] > 38 || len(args) == 2 && (args[1] < 0 || args[1] > args[0]) {
+				return nil, p.errorf("invalid decimal precision or scale %v", args)
+			}
+			dt.Precision = int32(args[0])
+			if len(args) == 2 {
+				dt.Scale = int32(args[1])
+			}
+		}
+		return dt, nil
+	case "interval":
+		// Intervals arrive as their text form, e.g. "INTERVAL '1' DAY".
+		for p.peek() != 0 && p.peek() != ',' && p.peek() != '>' {
+			p.pos++
+		}
+		return arrow.BinaryTypes.String, nil
+	case "array":
+		if err := p.expect('<'); err != nil {
+			return nil, err
+		}
+		elem, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		return arrow.ListOf(elem), p.expect('>')
+	case "map":
+		if err := p.expect('<'); err != nil {
+			return nil, err
+		}
+		key, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		value, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		return arrow.MapOf(key, value), p.expect('>')
+	case "struct":
+		return p.structType()
+	case "":
+		return nil, p.errorf("expected a type")
+	default:
+		return nil, p.errorf("unsupported type %q", name)
+	}
+}
+
+// structType parses the <name:type, ...> part of a struct. Fields may be quoted with
+// backticks and followed by NOT NULL or a COMMENT.
+func (p *typeParser) structType() (arrow.DataType, error) {
+	if err := p.expect('<'); err != nil {
+		return nil, err
+	}
+	var fields []arrow.Field
+	for p.peek() != '>' {
+		if len(fields) > 0 {
+			if err := p.expect(','); err != nil {
+				return nil, err
+			}
+		}
+		name := p.name()
+		if name == "" {
+			return nil, p.errorf("expected a field name")
+		}
+		if err := p.expect(':'); err != nil {
+			return nil, err
+		}
+		dt, err := p.parse()
+		if err != nil {
+			return nil, err
+		}
+		field := arrow.Field{Name: name, Type: dt, Nullable: true}
+		for {
+			if p.keyword("not") {
+				if !p.keyword("null") {
+					return nil, p.errorf("expected NULL after NOT")
+				}
+				field.Nullable = false
+			} else if p.keyword("comment") {
+				if _, err := p.quoted('\''); err != nil {
+					return nil, err
+				}
+			} else {
+				break
+			}
+		}
+		fields = append(fields, field)
+	}
+	p.pos++
+	return arrow.StructOf(fields...), nil
+}
+
+// arguments parses a parenthesised list of integers, e.g. (10,2).
+func (p *typeParser) arguments() ([]int, error) {
+	if err := p.expect('('); err != nil {
+		return nil, err
+	}
+	var args []int
+	for {
+		n, err := strconv.Atoi(p.word())
+		if err != nil {
+			return nil, p.errorf("expected a number")
+		}
+		args = append(args, n)
+		if p.peek() == ')' {
+			p.pos++
+			return args, nil
+		}
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// peek skips blanks and returns the next character, or 0 at the end of the text.
+func (p *typeParser) peek() byte {
+	for p.pos < len(p.text) && p.text[p.pos] == ' ' {
+		p.pos++
+	}
+	if p.pos == len(p.text) {
+		return 0
+	}
+	return p.text[p.pos]
+}
+
+// expect consumes c or fails.
+func (p *typeParser) expect(c byte) error {
+	if p.peek() != c {
+		return p.errorf("expected %q", c)
+	}
+	p.pos++
+	return nil
+}
+
+// word consumes a run of letters, digits and underscores.
+func (p *typeParser) word() string {
+	p.peek()
+	start := p.pos
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		if c != '_' && (c < 'a' || c > 'z') && (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			break
+		}
+		p.pos++
+	}
+	return p.text[start:p.pos]
+}
+
+// name consumes a field name, either a word or a backtick-quoted identifier.
+func (p *typeParser) name() string {
+	if p.peek() == '`' {
+		name, err := p.quoted('`')
+		if err != nil {
+			return ""
+		}
+		return name
+	}
+	return p.word()
+}
+
+// keyword consumes kw, ignoring case, if it is the next word.
+func (p *typeParser) keyword(kw string) bool {
+	start := p.pos
+	if strings.EqualFold(p.word(), kw) {
+		return true
+	}
+	p.pos = start
+	return false
+}
+
+// quoted consumes a string enclosed in q, where a doubled q stands for itself.
+func (p *typeParser) quoted(q byte) (string, error) {
+	if err := p.expect(q); err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	for p.pos < len(p.text) {
+		c := p.text[p.pos]
+		p.pos++
+		if c != q {
+			b.WriteByte(c)
+			continue
+		}
+		if p.pos < len(p.text) && p.text[p.pos] == q {
+			b.WriteByte(q)
+			p.pos++
+			continue
+		}
+		return b.String(), nil
+	}
+	return "", p.errorf("unterminated %c", q)
+}
+
+func (p *typeParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid type %q at position %d: %s", p.text, p.pos, fmt.Sprintf(format, args...))
+}
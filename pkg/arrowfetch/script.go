@@ -0,0 +1,116 @@
+package arrowfetch
+
+import (
+	"strings"
+	"unicode"
+)
+
+// SplitStatements splits a SQL script into its statements at the semicolons that are
+// not inside quotes, backquoted identifiers or comments. Empty statements are dropped
+// and each statement is returned without its terminating semicolon.
+func SplitStatements(script string) []string {
+	statements, rest := CompleteStatements(script)
+	return appendStatement(statements, rest)
+}
+
+// CompleteStatements returns the statements of script that are terminated by a
+// semicolon and the unterminated text after them, such as a statement still being
+// typed at a prompt.
+func CompleteStatements(script string) (statements []string, rest string) {
+	start := 0
+	for i := 0; i < len(script); i++ {
+		switch c := script[i]; {
+		case c == '\'' || c == '"' || c == '`':
+			// Skip to the closing quote; a backslash escapes the next character in strings.
+			for i++; i < len(script) && script[i] != c; i++ {
+				if script[i] == '\\' && c != '`' {
+					i++
+				}
+			}
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			for i < len(script) && script[i] != '\n' {
+				i++
+			}
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			end := strings.Index(script[i+2:], "*/")
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end + 3
+			}
+		case c == ';':
+			statements = appendStatement(statements, script[start:i])
+			start = i + 1
+		}
+	}
+	if start < len(script) {
+		rest = script[start:]
+	}
+	return statements, rest
+}
+
+// appendStatement adds stmt unless it holds nothing but whitespace and comments.
+func appendStatement(statements []string, stmt string) []string {
+	stmt = strings.TrimSpace(stmt)
+	if leadingKeyword(stmt) == "" {
+		return statements
+	}
+	return append(statements, stmt)
+}
+
+// QuoteString returns s as a SQL string literal. Databricks SQL escapes quotes and
+// backslashes with a backslash, as SplitStatements expects; a doubled quote would end
+// the literal and start another, which the parser concatenates.
+func QuoteString(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return "'" + strings.ReplaceAll(s, "'", `\'`) + "'"
+}
+
+// ReturnsRows reports whether stmt is a query whose result is worth keeping, such as
+// SELECT, WITH, SHOW or DESCRIBE, as opposed to DDL, DML or SET.
+func ReturnsRows(stmt string) bool {
+	switch leadingKeyword(stmt) {
+	case "SELECT", "WITH", "VALUES", "TABLE", "FROM", "SHOW", "DESCRIBE", "DESC", "EXPLAIN", "LIST":
+		return true
+	}
+	return false
+}
+
+// IsSubquery reports whether stmt is a query that can be nested in another one, as in
+// SELECT ... FROM (stmt): SELECT, WITH, VALUES, TABLE or FROM. SHOW, DESCRIBE, EXPLAIN
+// and LIST return rows too, but cannot be nested.
+func IsSubquery(stmt string) bool {
+	switch leadingKeyword(stmt) {
+	case "SELECT", "WITH", "VALUES", "TABLE", "FROM":
+		return true
+	}
+	return false
+}
+
+// leadingKeyword returns the first word of stmt in upper case, skipping comments
+// and opening parentheses.
+func leadingKeyword(stmt string) string {
+	for {
+		stmt = strings.TrimLeftFunc(stmt, func(r rune) bool { return unicode.IsSpace(r) || r == '(' })
+		switch {
+		case strings.HasPrefix(stmt, "--"):
+			end := strings.IndexByte(stmt, '\n')
+			if end < 0 {
+				return ""
+			}
+			stmt = stmt[end+1:]
+		case strings.HasPrefix(stmt, "/*"):
+			end := strings.Index(stmt, "*/")
+			if end < 0 {
+				return ""
+			}
+			stmt = stmt[end+2:]
+		default:
+			end := strings.IndexFunc(stmt, func(r rune) bool { return !unicode.IsLetter(r) })
+			if end < 0 {
+				end = len(stmt)
+			}
+			return strings.ToUpper(stmt[:end])
+		}
+	}
+}
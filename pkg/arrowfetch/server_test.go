@@ -0,0 +1,149 @@
+package arrowfetch_test
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/decimal128"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// The tests below go through the Databricks driver and its Thrift client to a local
+// server, so they cover connecting and paging through results as well.
+
+func TestServerFetch(t *testing.T) {
+	recs := arrowfetchtest.Batches(3, 4)
+	defer release(recs)
+	srv := arrowfetchtest.NewServer(arrowfetchtest.Static(recs...))
+	defer srv.Close()
+
+	fake, err := arrowfetchtest.NewClient(arrowfetchtest.Static(recs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fake.Close()
+	for _, mode := range []struct {
+		name string
+		opts []arrowfetch.Option
+	}{
+		{"arrow", nil},
+		{"rows", []arrowfetch.Option{arrowfetch.WithRowMode()}},
+	} {
+		t.Run(mode.name, func(t *testing.T) {
+			client, err := srv.NewClient(mode.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer client.Close()
+
+			want, _ := collect(t, fake, "select * from t")
+			got, _ := collect(t, client, "select * from t")
+			if len(got) != 12 {
+				t.Fatalf("got %d rows, want 12", len(got))
+			}
+			for i := range want {
+				for j := range want[i] {
+					if got[i][j] != want[i][j] {
+						t.Errorf("row %d, column %s: %q through the server, %q from the fake driver", i, arrowfetchtest.Schema.Field(j).Name, got[i][j], want[i][j])
+					}
+				}
+			}
+		})
+	}
+	if q := srv.Queries(); len(q) != 2 || q[0] != "select * from t" {
+		t.Errorf("queries = %q", q)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	srv := arrowfetchtest.NewServer(arrowfetchtest.Fail(errors.New("TABLE_OR_VIEW_NOT_FOUND")))
+	defer srv.Close()
+	client, err := srv.NewClient(arrowfetch.WithRetry(arrowfetch.RetryPolicy{MaxAttempts: 1}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	err = client.Fetch(context.Background(), "select * from missing", func(arrow.Record) error { return nil })
+	if err == nil || !strings.Contains(err.Error(), "TABLE_OR_VIEW_NOT_FOUND") {
+		t.Fatalf("Fetch error = %v, want the server's message", err)
+	}
+}
+
+func TestServerParameters(t *testing.T) {
+	var got []driver.NamedValue
+	srv := arrowfetchtest.NewServer(func(_ string, args []driver.NamedValue) ([]arrow.Record, error) {
+		got = args
+		return nil, nil
+	})
+	defer srv.Close()
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	err = client.Fetch(context.Background(), "select * from t where id = :id", func(arrow.Record) error { return nil }, sql.Named("id", 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].Name != "id" || got[0].Value != "42" {
+		t.Errorf("arguments = %+v, want id = \"42\"", got)
+	}
+}
+
+func TestServerDecimals(t *testing.T) {
+	dt := &arrow.Decimal128Type{Precision: 10, Scale: 2}
+	b := array.NewDecimal128Builder(memory.DefaultAllocator, dt)
+	defer b.Release()
+	for _, v := range []string{"12.5", "-0.07", "99999999.99"} {
+		n, err := decimal128.FromString(v, dt.Precision, dt.Scale)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Append(n)
+	}
+	b.AppendNull()
+	col := b.NewArray()
+	defer col.Release()
+	rec := array.NewRecord(arrow.NewSchema([]arrow.Field{{Name: "amount", Type: dt, Nullable: true}}, nil), []arrow.Array{col}, 4)
+	defer rec.Release()
+
+	srv := arrowfetchtest.NewServer(arrowfetchtest.Static(rec))
+	defer srv.Close()
+	client, err := srv.NewClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	// The warehouse sends the decimals as text; they are fetched as decimals again.
+	var got []string
+	err = client.Fetch(context.Background(), "select amount from t", func(rec arrow.Record) error {
+		if !arrow.TypeEqual(rec.Schema().Field(0).Type, dt) {
+			t.Errorf("type = %s, want %s", rec.Schema().Field(0).Type, dt)
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			var buf strings.Builder
+			arrowfetch.PrintValue(&buf, rec.Column(0), i)
+			got = append(got, buf.String())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"12.50", "-0.07", "99999999.99", "NULL"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("values = %q, want %q", got, want)
+	}
+}
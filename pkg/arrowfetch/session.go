@@ -0,0 +1,50 @@
+package arrowfetch
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// Session runs statements one after another on a single connection, so session state
+// set by one statement (USE, SET, temporary views) is visible to the next.
+type Session struct {
+	client *Client
+	conn   *sql.Conn
+}
+
+// Session opens a connection reserved for the returned Session until it is closed.
+func (c *Client) Session(ctx context.Context) (*Session, error) {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to open connection: %w", err)
+	}
+	return &Session{client: c, conn: conn}, nil
+}
+
+// Query executes query on the session and returns an iterator over its Arrow batches.
+// The batches must be closed before the next statement runs.
+func (s *Session) Query(ctx context.Context, query string, args ...any) (*Batches, error) {
+	return s.client.query(ctx, s.conn, query, args)
+}
+
+// Fetch executes query on the session and calls fn for every record batch, as Client.Fetch.
+func (s *Session) Fetch(ctx context.Context, query string, fn func(arrow.Record) error, args ...any) error {
+	batches, err := s.Query(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	return batches.each(fn)
+}
+
+// Exec executes a statement on the session and discards any result it returns.
+func (s *Session) Exec(ctx context.Context, query string, args ...any) error {
+	return s.Fetch(ctx, query, func(arrow.Record) error { return nil }, args...)
+}
+
+// Close releases the session's connection.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
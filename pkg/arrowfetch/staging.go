@@ -0,0 +1,93 @@
+package arrowfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/databricks/databricks-sql-go/driverctx"
+)
+
+// Staging statements move files between the local file system and a Unity Catalog
+// volume: PUT uploads a local file, GET downloads a file and REMOVE deletes one. The
+// driver runs the transfer itself, with presigned URLs returned by the warehouse, and
+// only reads or writes local files under the directories the caller allows.
+
+// IsStaging reports whether stmt is a PUT, GET or REMOVE staging statement, which must
+// be run with Stage rather than as a query.
+func IsStaging(stmt string) bool {
+	switch leadingKeyword(stmt) {
+	case "PUT", "GET", "REMOVE":
+		return true
+	}
+	return false
+}
+
+// Stage runs a staging statement such as
+//
+//	PUT '/data/trips.csv' INTO '/Volumes/main/raw/landing/trips.csv' OVERWRITE
+//
+// The local file it names must be inside one of allowedDirs. The driver sends the
+// transfer without ctx, so canceling ctx does not stop an upload or download already
+// under way.
+func (c *Client) Stage(ctx context.Context, stmt string, allowedDirs ...string) error {
+	if len(allowedDirs) == 0 {
+		return errors.New("staging statement needs a local directory it may use")
+	}
+	ctx = driverctx.NewContextWithStagingInfo(ctx, allowedDirs)
+	if _, err := c.db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("unable to run the staging statement: %w", err)
+	}
+	return nil
+}
+
+// Put uploads localFile to volumePath, e.g. /Volumes/main/raw/landing/trips.csv. An
+// existing file at volumePath is replaced when overwrite is set, and is an error
+// otherwise.
+func (c *Client) Put(ctx context.Context, localFile, volumePath string, overwrite bool) error {
+	// The driver reports a missing file only as a failed statement.
+	info, err := os.Stat(localFile)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", localFile)
+	}
+	abs, err := filepath.Abs(localFile)
+	if err != nil {
+		return err
+	}
+	stmt := fmt.Sprintf("PUT %s INTO %s", QuoteString(abs), QuoteString(volumePath))
+	if overwrite {
+		stmt += " OVERWRITE"
+	}
+	if err := c.Stage(ctx, stmt, filepath.Dir(abs)); err != nil {
+		return fmt.Errorf("unable to upload %s to %s: %w", localFile, volumePath, err)
+	}
+	return nil
+}
+
+// Get downloads the file at volumePath to localFile, replacing any file there. The
+// file is read into memory whole before it is written.
+func (c *Client) Get(ctx context.Context, volumePath, localFile string) error {
+	abs, err := filepath.Abs(localFile)
+	if err != nil {
+		return err
+	}
+	stmt := fmt.Sprintf("GET %s TO %s", QuoteString(volumePath), QuoteString(abs))
+	if err := c.Stage(ctx, stmt, filepath.Dir(abs)); err != nil {
+		return fmt.Errorf("unable to download %s to %s: %w", volumePath, localFile, err)
+	}
+	return nil
+}
+
+// Remove deletes the file at volumePath.
+func (c *Client) Remove(ctx context.Context, volumePath string) error {
+	// REMOVE touches no local file, but the driver wants a staging context all the same.
+	if err := c.Stage(ctx, "REMOVE "+QuoteString(volumePath), os.TempDir()); err != nil {
+		return fmt.Errorf("unable to remove %s: %w", volumePath, err)
+	}
+	return nil
+}
@@ -0,0 +1,332 @@
+package arrowfetch
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	dbsql "github.com/databricks/databricks-sql-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The Statement Execution API keeps a statement running, and its result available,
+// independently of the client that submitted it. Submit and FetchStatement use it
+// to detach from long-running queries and collect their Arrow results later.
+
+// statementResponse is the part of a Statement Execution API response used here.
+type statementResponse struct {
+	StatementID string `json:"statement_id"`
+	Status      struct {
+		State string `json:"state"`
+		Error *struct {
+			ErrorCode string `json:"error_code"`
+			Message   string `json:"message"`
+		} `json:"error"`
+	} `json:"status"`
+	Result *statementChunk `json:"result"`
+}
+
+// statementChunk lists the download links of one chunk of a result.
+type statementChunk struct {
+	ExternalLinks []struct {
+		ChunkIndex            int               `json:"chunk_index"`
+		ExternalLink          string            `json:"external_link"`
+		NextChunkInternalLink string            `json:"next_chunk_internal_link"`
+		HTTPHeaders           map[string]string `json:"http_headers"`
+	} `json:"external_links"`
+}
+
+// statementParameter is a named parameter of a submitted statement.
+type statementParameter struct {
+	Name  string  `json:"name"`
+	Value *string `json:"value"`
+	Type  string  `json:"type,omitempty"`
+}
+
+// Submit starts query on the warehouse without waiting for it and returns its
+// statement ID. The statement keeps running after the client exits; pass the ID
+// to FetchStatement to retrieve the result. Only named parameters are supported.
+func (c *Client) Submit(ctx context.Context, query string, args ...any) (string, error) {
+	warehouseID, err := c.warehouseID()
+	if err != nil {
+		return "", err
+	}
+	params, err := statementParameters(args)
+	if err != nil {
+		return "", err
+	}
+
+	req := map[string]any{
+		"warehouse_id":    warehouseID,
+		"statement":       query,
+		"wait_timeout":    "0s",
+		"on_wait_timeout": "CONTINUE",
+		"disposition":     "EXTERNAL_LINKS",
+		"format":          "ARROW_STREAM",
+		"parameters":      params,
+	}
+	if c.cfg.catalog != "" {
+		req["catalog"] = c.cfg.catalog
+	}
+	if c.cfg.schema != "" {
+		req["schema"] = c.cfg.schema
+	}
+	var resp statementResponse
+	if err := c.api(ctx, http.MethodPost, "/api/2.0/sql/statements/", req, &resp); err != nil {
+		return "", fmt.Errorf("unable to submit the statement: %w", err)
+	}
+	if err := resp.failure(); err != nil {
+		return "", err
+	}
+	return resp.StatementID, nil
+}
+
+// StatementState returns the state of a submitted statement: PENDING, RUNNING,
+// SUCCEEDED, FAILED, CANCELED or CLOSED.
+func (c *Client) StatementState(ctx context.Context, id string) (string, error) {
+	var resp statementResponse
+	if err := c.api(ctx, http.MethodGet, "/api/2.0/sql/statements/"+id, nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Status.State, nil
+}
+
+// CancelStatement asks the warehouse to stop a submitted statement.
+func (c *Client) CancelStatement(ctx context.Context, id string) error {
+	return c.api(ctx, http.MethodPost, "/api/2.0/sql/statements/"+id+"/cancel", nil, nil)
+}
+
+// FetchStatement waits for a submitted statement to finish and calls fn for every
+// record batch of its result, as Fetch does. Cancelling ctx stops waiting but leaves
+// the statement running on the warehouse.
+func (c *Client) FetchStatement(ctx context.Context, id string, fn func(arrow.Record) error) (err error) {
+	ctx, span := tracer.Start(ctx, "fetch statement", trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.String("databricks.query_id", id)))
+	defer func() { endSpan(span, err) }()
+
+	start := time.Now()
+	if obs := c.cfg.observer; obs != nil {
+		// The time of each batch runs from the end of the previous one, as the chunks
+		// are downloaded and decoded as a stream.
+		inner, last := fn, start
+		fn = func(rec arrow.Record) error {
+			obs.BatchFetched(rec.NumRows(), RecordSize(rec), time.Since(last), nil)
+			err := inner(rec)
+			last = time.Now()
+			return err
+		}
+	}
+	if t := timingsFrom(ctx); t != nil {
+		// The statement was sent earlier, by Submit: its phases start with this call.
+		*t = Timings{QueryID: id, Start: start}
+		defer func() { t.End = time.Now() }()
+		inner := fn
+		fn = func(rec arrow.Record) error {
+			if t.FirstBatch.IsZero() {
+				t.FirstBatch = time.Now()
+			}
+			return inner(rec)
+		}
+	}
+
+	// Poll until the statement leaves the PENDING and RUNNING states.
+	var resp statementResponse
+	for wait := time.Second; ; wait = min(2*wait, 10*time.Second) {
+		resp = statementResponse{}
+		if err := c.api(ctx, http.MethodGet, "/api/2.0/sql/statements/"+id, nil, &resp); err != nil {
+			return fmt.Errorf("unable to get statement %s: %w", id, err)
+		}
+		if s := resp.Status.State; s != "PENDING" && s != "RUNNING" {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+	err = resp.failure()
+	if obs := c.cfg.observer; obs != nil {
+		obs.QueryExecuted(time.Since(start), err)
+	}
+	if err != nil {
+		return err
+	}
+	if t := timingsFrom(ctx); t != nil {
+		t.Executed = time.Now()
+	}
+
+	// Download the chunks in order, following the link to the next one.
+	chunk := resp.Result
+	for chunk != nil && len(chunk.ExternalLinks) > 0 {
+		next := ""
+		for _, link := range chunk.ExternalLinks {
+			cctx, cspan := tracer.Start(ctx, "download chunk", trace.WithAttributes(attribute.Int("chunk", link.ChunkIndex)))
+			err := c.readChunk(cctx, link.ExternalLink, link.HTTPHeaders, fn)
+			endSpan(cspan, err)
+			if err != nil {
+				return fmt.Errorf("unable to read chunk %d: %w", link.ChunkIndex, err)
+			}
+			next = link.NextChunkInternalLink
+		}
+		if next == "" {
+			break
+		}
+		chunk = &statementChunk{}
+		if err := c.api(ctx, http.MethodGet, next, nil, chunk); err != nil {
+			return fmt.Errorf("unable to get the next chunk: %w", err)
+		}
+	}
+	return nil
+}
+
+// readChunk downloads one Arrow IPC stream from cloud storage and passes its records to fn.
+// The link is presigned, so it must not carry the workspace credentials.
+func (c *Client) readChunk(ctx context.Context, url string, headers map[string]string, fn func(arrow.Record) error) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("download failed: %s", resp.Status)
+	}
+
+	// With a memory limit the chunk is decoded into the accounted allocator, so reading
+	// waits while the batches kept by fn are over the limit.
+	var opts []ipc.Option
+	if c.cfg.mem != nil {
+		opts = append(opts, ipc.WithAllocator(c.cfg.mem))
+	}
+	r, err := ipc.NewReader(resp.Body, opts...)
+	if err != nil {
+		return err
+	}
+	defer r.Release()
+	for r.Next() {
+		if err := fn(r.Record()); err != nil {
+			return err
+		}
+	}
+	return r.Err()
+}
+
+// api calls the workspace REST API and decodes the JSON response into out.
+func (c *Client) api(ctx context.Context, method, apiPath string, in, out any) error {
+	if c.cfg.host == "" {
+		return errors.New("the statement API needs the workspace host (WithHost)")
+	}
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, "https://"+c.cfg.host+apiPath, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.userAgent != "" {
+		// Appended to the agent net/http would send, as the driver appends it to its own.
+		req.Header.Set("User-Agent", "Go-http-client/1.1 ("+c.cfg.userAgent+")")
+	}
+	if c.cfg.auth != nil {
+		if err := c.cfg.auth.Authenticate(req); err != nil {
+			return err
+		}
+	} else {
+		req.Header.Set("Authorization", "Bearer "+c.cfg.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &apiErr) == nil && apiErr.Message != "" {
+			return fmt.Errorf("%s: %s", resp.Status, apiErr.Message)
+		}
+		return errors.New(resp.Status)
+	}
+	if out == nil {
+		return nil
+	}
+	return json.Unmarshal(data, out)
+}
+
+// warehouseID extracts the SQL warehouse ID from the HTTP path /sql/1.0/warehouses/<id>.
+func (c *Client) warehouseID() (string, error) {
+	dir, id := path.Split(strings.TrimSuffix(c.cfg.httpPath, "/"))
+	if !strings.HasSuffix(dir, "/warehouses/") || id == "" {
+		return "", fmt.Errorf("the statement API needs a SQL warehouse HTTP path (/sql/1.0/warehouses/<id>), got %q", c.cfg.httpPath)
+	}
+	return id, nil
+}
+
+// failure returns the error of a statement that did not succeed.
+func (r *statementResponse) failure() error {
+	switch r.Status.State {
+	case "PENDING", "RUNNING", "SUCCEEDED":
+		return nil
+	}
+	if e := r.Status.Error; e != nil {
+		return fmt.Errorf("statement %s %s: %s: %s", r.StatementID, strings.ToLower(r.Status.State), e.ErrorCode, e.Message)
+	}
+	return fmt.Errorf("statement %s %s", r.StatementID, strings.ToLower(r.Status.State))
+}
+
+// statementParameters converts named query arguments to API parameters.
+func statementParameters(args []any) ([]statementParameter, error) {
+	params := make([]statementParameter, 0, len(args))
+	for _, arg := range args {
+		var p statementParameter
+		var value any
+		switch a := arg.(type) {
+		case sql.NamedArg:
+			p.Name, value = a.Name, a.Value
+		case dbsql.Parameter:
+			p.Name, value = a.Name, a.Value
+			if a.Type != dbsql.SqlUnkown {
+				p.Type = a.Type.String()
+			}
+		}
+		if p.Name == "" {
+			return nil, errors.New("submitted statements only support named parameters")
+		}
+		if value != nil {
+			s := fmt.Sprint(value)
+			p.Value = &s
+		}
+		params = append(params, p)
+	}
+	return params, nil
+}
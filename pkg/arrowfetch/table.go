@@ -0,0 +1,61 @@
+package arrowfetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+)
+
+// ErrTableTooLarge is returned by FetchTable when the result does not fit in the
+// table limit.
+var ErrTableTooLarge = errors.New("result exceeds the table limit")
+
+// FetchTable executes query and assembles the whole result into one arrow.Table, for
+// callers that need random access to the rows rather than a single pass over the
+// batches. The table must be released by the caller.
+//
+// Every batch is kept in memory, so the fetch fails with ErrTableTooLarge once the
+// result reaches the limit set with WithTableLimit (1 GiB by default), or the memory
+// limit when that is lower. A result without any batch gives a table without columns.
+func (c *Client) FetchTable(ctx context.Context, query string, args ...any) (arrow.Table, error) {
+	limit := c.cfg.tableLimit
+	if c.cfg.mem != nil && (limit == 0 || c.cfg.mem.limit < limit) {
+		// Batches kept over the memory limit would make the fetch wait forever.
+		limit = c.cfg.mem.limit
+	}
+
+	var (
+		records []arrow.Record
+		size    int64
+	)
+	defer func() {
+		for _, rec := range records {
+			rec.Release()
+		}
+	}()
+	err := c.Fetch(ctx, query, func(rec arrow.Record) error {
+		if len(records) > 0 && !rec.Schema().Equal(records[0].Schema()) {
+			return errors.New("the schema changed between batches")
+		}
+		size += RecordSize(rec)
+		if limit > 0 && size >= limit {
+			return fmt.Errorf("%w of %d bytes", ErrTableTooLarge, limit)
+		}
+		rec.Retain()
+		records = append(records, rec)
+		return nil
+	}, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	schema := arrow.NewSchema(nil, nil)
+	if len(records) > 0 {
+		schema = records[0].Schema()
+	}
+	// The table keeps its own references to the columns.
+	return array.NewTableFromRecords(schema, records), nil
+}
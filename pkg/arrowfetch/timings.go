@@ -0,0 +1,125 @@
+package arrowfetch
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Timings records when the phases of a query ended, as seen by the client. Pass it to
+// a query with WithTimings and read it once the result has been read and closed.
+type Timings struct {
+	QueryID string // the warehouse's ID of the statement, for QueryMetrics
+	Query   string // the text of the statement
+
+	Start      time.Time // the query was sent
+	Executed   time.Time // the statement finished running and its result was ready
+	FirstBatch time.Time // the first record batch arrived
+	End        time.Time // the result was read, or reading stopped
+}
+
+// Execution returns the time from sending the query until its result was ready. It
+// includes the time the statement was queued on the warehouse.
+func (t *Timings) Execution() time.Duration { return span(t.Start, t.Executed) }
+
+// FirstByte returns the time from sending the query until the first batch arrived.
+func (t *Timings) FirstByte() time.Duration { return span(t.Start, t.FirstBatch) }
+
+// Fetch returns the time spent reading the result once it was ready.
+func (t *Timings) Fetch() time.Duration { return span(t.Executed, t.End) }
+
+// span returns the time between two recorded instants, 0 when either is missing.
+func span(from, to time.Time) time.Duration {
+	if from.IsZero() || to.IsZero() {
+		return 0
+	}
+	return to.Sub(from)
+}
+
+type timingsKey struct{}
+
+// WithTimings returns a context under which the queries of a Client record their phases
+// in t. With several queries run under it, t describes the last one.
+func WithTimings(ctx context.Context, t *Timings) context.Context {
+	return context.WithValue(ctx, timingsKey{}, t)
+}
+
+// timingsFrom returns the Timings attached to ctx, or nil.
+func timingsFrom(ctx context.Context) *Timings {
+	t, _ := ctx.Value(timingsKey{}).(*Timings)
+	return t
+}
+
+// QueryMetrics are the warehouse's own measurements of a statement, from the Query
+// History API.
+type QueryMetrics struct {
+	Queue       time.Duration // waiting for the warehouse to start or to have capacity
+	Compilation time.Duration
+	Execution   time.Duration
+	ResultFetch time.Duration
+	Total       time.Duration
+	ReadBytes   int64
+	Rows        int64
+	FromCache   bool // the result was served from the warehouse's result cache
+}
+
+// queryHistoryResponse is the part of a Query History API response used here.
+type queryHistoryResponse struct {
+	Res []struct {
+		Metrics struct {
+			TotalTimeMs                     int64 `json:"total_time_ms"`
+			CompilationTimeMs               int64 `json:"compilation_time_ms"`
+			ExecutionTimeMs                 int64 `json:"execution_time_ms"`
+			ResultFetchTimeMs               int64 `json:"result_fetch_time_ms"`
+			ReadBytes                       int64 `json:"read_bytes"`
+			RowsProducedCount               int64 `json:"rows_produced_count"`
+			ResultFromCache                 bool  `json:"result_from_cache"`
+			OverloadingQueueStartTimestamp  int64 `json:"overloading_queue_start_timestamp"`
+			ProvisioningQueueStartTimestamp int64 `json:"provisioning_queue_start_timestamp"`
+			QueryCompilationStartTimestamp  int64 `json:"query_compilation_start_timestamp"`
+		} `json:"metrics"`
+	} `json:"res"`
+}
+
+// QueryMetrics looks up the warehouse's metrics of a finished statement by its ID (see
+// Timings.QueryID). The Query History API lists a statement a few seconds after it
+// ends, so the lookup is retried until ctx expires.
+func (c *Client) QueryMetrics(ctx context.Context, queryID string) (*QueryMetrics, error) {
+	q := url.Values{}
+	q.Set("filter_by.statement_ids", queryID)
+	q.Set("include_metrics", "true")
+	for wait := 500 * time.Millisecond; ; wait = min(2*wait, 5*time.Second) {
+		var resp queryHistoryResponse
+		if err := c.api(ctx, http.MethodGet, "/api/2.0/sql/history/queries?"+q.Encode(), nil, &resp); err != nil {
+			return nil, fmt.Errorf("unable to get the metrics of query %s: %w", queryID, err)
+		}
+		if len(resp.Res) > 0 {
+			m := resp.Res[0].Metrics
+			metrics := &QueryMetrics{
+				Compilation: time.Duration(m.CompilationTimeMs) * time.Millisecond,
+				Execution:   time.Duration(m.ExecutionTimeMs) * time.Millisecond,
+				ResultFetch: time.Duration(m.ResultFetchTimeMs) * time.Millisecond,
+				Total:       time.Duration(m.TotalTimeMs) * time.Millisecond,
+				ReadBytes:   m.ReadBytes,
+				Rows:        m.RowsProducedCount,
+				FromCache:   m.ResultFromCache,
+			}
+			// The statement was queued from the first queue it entered until compilation.
+			queued := m.ProvisioningQueueStartTimestamp
+			if q := m.OverloadingQueueStartTimestamp; q > 0 && (queued == 0 || q < queued) {
+				queued = q
+			}
+			if queued > 0 && m.QueryCompilationStartTimestamp > queued {
+				metrics.Queue = time.Duration(m.QueryCompilationStartTimestamp-queued) * time.Millisecond
+			}
+			return metrics, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("query %s is not in the query history yet: %w", queryID, ctx.Err())
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package arrowfetch
+
+import (
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer creates the spans of the query lifecycle: a "query" span for each query with
+// "connect", "execute" and one "fetch batch" span per batch below it. They go to the
+// global OpenTelemetry provider, which discards them unless the program installs one.
+var tracer = otel.Tracer("dbx_arrow_dbsql/pkg/arrowfetch")
+
+// endSpan marks span as failed when err is set and ends it.
+func endSpan(span trace.Span, err error) {
+	spanError(span, err)
+	span.End()
+}
+
+// spanError records err on span and marks it as failed, unless err is nil.
+func spanError(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
@@ -0,0 +1,88 @@
+package arrowfetch
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+
+	"golang.org/x/net/http/httpproxy"
+)
+
+// newTransport builds the HTTP transport used by the connector when the default one,
+// which already honors HTTPS_PROXY and NO_PROXY, has to be customized.
+func newTransport(cfg config) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+
+	if cfg.proxy != "" {
+		proxy, err := parseProxy(cfg.proxy)
+		if err != nil {
+			return nil, err
+		}
+		// The explicit proxy replaces HTTP(S)_PROXY but keeps the NO_PROXY exclusions.
+		proxyFunc := (&httpproxy.Config{
+			HTTPProxy:  proxy.String(),
+			HTTPSProxy: proxy.String(),
+			NoProxy:    httpproxy.FromEnvironment().NoProxy,
+		}).ProxyFunc()
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			return proxyFunc(req.URL)
+		}
+	}
+
+	if cfg.caCert != "" || cfg.certFile != "" {
+		tlsConfig, err := newTLSConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		transport.TLSClientConfig = tlsConfig
+	}
+	return transport, nil
+}
+
+// newTLSConfig loads the CA bundle and client certificate selected by the options.
+func newTLSConfig(cfg config) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if cfg.caCert != "" {
+		pem, err := os.ReadFile(cfg.caCert)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read CA bundle: %w", err)
+		}
+		// Extend the system roots so public endpoints (e.g. cloud fetch storage) still verify.
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no PEM certificates found in %s", cfg.caCert)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if cfg.certFile != "" {
+		// validate has checked that the key file is set as well.
+		cert, err := tls.LoadX509KeyPair(cfg.certFile, cfg.keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("unable to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return tlsConfig, nil
+}
+
+// parseProxy validates a proxy URL such as http://proxy.corp:3128.
+func parseProxy(raw string) (*url.URL, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid proxy URL %q", raw)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5":
+		return u, nil
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q, expected http, https or socks5", u.Scheme)
+	}
+}
@@ -0,0 +1,57 @@
+package dbauth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"golang.org/x/oauth2"
+)
+
+// azureDatabricksScope is the Azure AD scope of the AzureDatabricks first-party application.
+const azureDatabricksScope = "2ff814a6-3304-4ab8-85cb-cd0e6f879c1d/.default"
+
+// AzureCredentials selects the Azure AD identity used to sign in to Azure Databricks.
+type AzureCredentials struct {
+	// TenantID, ClientID and ClientSecret identify a service principal. Without a secret,
+	// a managed identity is used; ClientID then picks a user-assigned identity.
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+}
+
+// NewAzureAD returns an authenticator that sends Azure AD tokens for a service principal
+// (client credentials) or a managed identity. Tokens are renewed shortly before they
+// expire, so requests made while batches are still being fetched stay authorized.
+func NewAzureAD(ctx context.Context, creds AzureCredentials) (*Refresher, error) {
+	var cred azcore.TokenCredential
+	var err error
+	if creds.ClientSecret != "" {
+		cred, err = azidentity.NewClientSecretCredential(creds.TenantID, creds.ClientID, creds.ClientSecret, nil)
+	} else {
+		opts := &azidentity.ManagedIdentityCredentialOptions{}
+		if creds.ClientID != "" {
+			opts.ID = azidentity.ClientID(creds.ClientID)
+		}
+		cred, err = azidentity.NewManagedIdentityCredential(opts)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Azure AD credential: %w", err)
+	}
+
+	src := NewRefresher(ctx, ProviderFunc(func(ctx context.Context) (*oauth2.Token, error) {
+		t, err := cred.GetToken(ctx, policy.TokenRequestOptions{Scopes: []string{azureDatabricksScope}})
+		if err != nil {
+			return nil, err
+		}
+		return &oauth2.Token{AccessToken: t.Token, TokenType: "Bearer", Expiry: t.ExpiresOn}, nil
+	}), RefreshMargin)
+
+	// Request the first token now so bad credentials fail before the query starts.
+	if _, err := src.Token(); err != nil {
+		return nil, fmt.Errorf("unable to get an Azure AD token: %w", err)
+	}
+	return src, nil
+}
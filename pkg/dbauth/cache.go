@@ -0,0 +1,86 @@
+package dbauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"golang.org/x/oauth2"
+)
+
+// TokenCache persists OAuth tokens between runs so the browser login is only needed
+// when the refresh token has expired.
+type TokenCache interface {
+	// Load returns the cached token for key, or nil when there is none.
+	Load(key string) (*oauth2.Token, error)
+
+	// Save stores the token for key.
+	Save(key string, token *oauth2.Token) error
+}
+
+// FileCache stores tokens in a JSON file readable only by the current user.
+type FileCache struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileCache returns a cache backed by the file at path. The file is created on the first Save.
+func NewFileCache(path string) *FileCache {
+	return &FileCache{path: path}
+}
+
+// Load returns the cached token for key, or nil when there is none.
+func (c *FileCache) Load(key string) (*oauth2.Token, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tokens, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	return tokens[key], nil
+}
+
+// Save stores the token for key, keeping the tokens of other keys.
+func (c *FileCache) Save(key string, token *oauth2.Token) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	tokens, err := c.read()
+	if err != nil {
+		return err
+	}
+	tokens[key] = token
+
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0o700); err != nil {
+		return fmt.Errorf("unable to create token cache directory: %w", err)
+	}
+	// Write to a temporary file first so a crash never leaves a half-written cache.
+	tmp := c.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("unable to write token cache: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// read loads all cached tokens; a missing file is an empty cache.
+func (c *FileCache) read() (map[string]*oauth2.Token, error) {
+	tokens := map[string]*oauth2.Token{}
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return tokens, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to read token cache: %w", err)
+	}
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("unable to parse token cache %s: %w", c.path, err)
+	}
+	return tokens, nil
+}
@@ -0,0 +1,67 @@
+package dbauth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// commandTokenLifetime is how long a plain-text token printed by a command is used
+// before the command runs again.
+const commandTokenLifetime = time.Hour
+
+// NewCommandProvider returns a Provider that runs command through the shell and reads a
+// token from its output, e.g. "databricks auth token --host ...". The output is either
+// JSON with access_token and an RFC 3339 expiry, or the bare token.
+func NewCommandProvider(command string) Provider {
+	return ProviderFunc(func(ctx context.Context) (*oauth2.Token, error) {
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.CommandContext(ctx, "cmd", "/C", command)
+		} else {
+			cmd = exec.CommandContext(ctx, "sh", "-c", command)
+		}
+		var stdout bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return nil, fmt.Errorf("token command failed: %w", err)
+		}
+		return parseCommandToken(stdout.Bytes())
+	})
+}
+
+// parseCommandToken reads the token printed by a token command.
+func parseCommandToken(out []byte) (*oauth2.Token, error) {
+	out = bytes.TrimSpace(out)
+	if len(out) == 0 {
+		return nil, errors.New("token command printed no token")
+	}
+	if out[0] == '{' {
+		var resp struct {
+			AccessToken string    `json:"access_token"`
+			TokenType   string    `json:"token_type"`
+			Expiry      time.Time `json:"expiry"`
+		}
+		if err := json.Unmarshal(out, &resp); err != nil {
+			return nil, fmt.Errorf("unable to parse token command output: %w", err)
+		}
+		if resp.AccessToken == "" {
+			return nil, errors.New("token command output has no access_token")
+		}
+		return &oauth2.Token{AccessToken: resp.AccessToken, TokenType: resp.TokenType, Expiry: resp.Expiry}, nil
+	}
+	return &oauth2.Token{
+		AccessToken: strings.TrimSpace(string(out)),
+		Expiry:      time.Now().Add(commandTokenLifetime),
+	}, nil
+}
@@ -0,0 +1,4 @@
+// Package dbauth provides authenticators for the Databricks SQL connector beyond
+// personal access tokens, such as the OAuth browser login. Every method is a Provider
+// of fresh tokens wrapped in a Refresher, which renews the token before it expires.
+package dbauth
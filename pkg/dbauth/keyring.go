@@ -0,0 +1,37 @@
+package dbauth
+
+import (
+	"errors"
+
+	"github.com/zalando/go-keyring"
+)
+
+// keyringService is the service name under which tokens are stored in the OS keychain.
+const keyringService = "dbarrow"
+
+// ErrNoStoredToken is returned when the keychain has no token for a host.
+var ErrNoStoredToken = errors.New("no token stored for this host")
+
+// StoreToken saves the access token for host in the OS keychain (macOS Keychain,
+// Windows Credential Manager, or the Secret Service on Linux).
+func StoreToken(host, token string) error {
+	return keyring.Set(keyringService, host, token)
+}
+
+// StoredToken returns the access token saved for host.
+func StoredToken(host string) (string, error) {
+	token, err := keyring.Get(keyringService, host)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrNoStoredToken
+	}
+	return token, err
+}
+
+// DeleteToken removes the access token saved for host.
+func DeleteToken(host string) error {
+	err := keyring.Delete(keyringService, host)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return ErrNoStoredToken
+	}
+	return err
+}
@@ -0,0 +1,26 @@
+package dbauth
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/databricks/databricks-sql-go/auth/oauth/m2m"
+)
+
+// NewM2M returns an authenticator for the OAuth machine-to-machine flow of a service
+// principal. Workspace tokens are requested from the Databricks token endpoint with the
+// client credentials and renewed shortly before they expire.
+func NewM2M(ctx context.Context, host, clientID, clientSecret string) (*Refresher, error) {
+	config, err := m2m.GetConfig(ctx, host, clientID, clientSecret, m2m.GetScopes(host, nil))
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure OAuth for %s: %w", host, err)
+	}
+
+	src := NewRefresher(ctx, ProviderFunc(config.Token), RefreshMargin)
+
+	// Request the first token now so bad credentials fail before the query starts.
+	if _, err := src.Token(); err != nil {
+		return nil, fmt.Errorf("unable to get a token for the service principal: %w", err)
+	}
+	return src, nil
+}
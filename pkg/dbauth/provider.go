@@ -0,0 +1,85 @@
+package dbauth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/oauth2"
+)
+
+// RefreshMargin is how long before expiry a token is replaced, so requests sent during a
+// long export never carry a token that expires on the way.
+const RefreshMargin = 5 * time.Minute
+
+// Provider obtains a new access token each time it is called. Providers do not cache;
+// a Refresher decides when a new token is needed.
+type Provider interface {
+	FetchToken(ctx context.Context) (*oauth2.Token, error)
+}
+
+// ProviderFunc adapts a function to the Provider interface.
+type ProviderFunc func(ctx context.Context) (*oauth2.Token, error)
+
+// FetchToken calls f.
+func (f ProviderFunc) FetchToken(ctx context.Context) (*oauth2.Token, error) { return f(ctx) }
+
+// Refresher caches the token of a Provider and fetches a new one shortly before the
+// current one expires. It is both an oauth2.TokenSource and a connector authenticator:
+// the connector calls Authenticate for every request, so a refreshed token is injected
+// as soon as it is available, also while batches are still being fetched.
+type Refresher struct {
+	ctx      context.Context
+	provider Provider
+	margin   time.Duration
+
+	// OnRefresh, when set, is called with every new token, e.g. to persist it.
+	OnRefresh func(*oauth2.Token) error
+
+	mu    sync.Mutex
+	token *oauth2.Token
+}
+
+// NewRefresher returns a Refresher for p. Tokens are replaced margin before they expire;
+// tokens without an expiry time are kept for the life of the process.
+func NewRefresher(ctx context.Context, p Provider, margin time.Duration) *Refresher {
+	return &Refresher{ctx: ctx, provider: p, margin: margin}
+}
+
+// Token returns a token that stays valid for at least the refresh margin when possible.
+// If fetching a new token fails while the current one has not expired yet, the current
+// one is returned so a temporary outage of the token endpoint does not fail the export.
+func (r *Refresher) Token() (*oauth2.Token, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.token != nil && (r.token.Expiry.IsZero() || time.Until(r.token.Expiry) > r.margin) {
+		return r.token, nil
+	}
+	token, err := r.provider.FetchToken(r.ctx)
+	if err != nil {
+		if r.token != nil && r.token.Valid() {
+			return r.token, nil
+		}
+		return nil, err
+	}
+	if r.OnRefresh != nil {
+		if err := r.OnRefresh(token); err != nil {
+			return nil, err
+		}
+	}
+	r.token = token
+	return token, nil
+}
+
+// Authenticate adds the Authorization header with the current token to the request.
+func (r *Refresher) Authenticate(req *http.Request) error {
+	token, err := r.Token()
+	if err != nil {
+		return fmt.Errorf("unable to get access token: %w", err)
+	}
+	token.SetAuthHeader(req)
+	return nil
+}
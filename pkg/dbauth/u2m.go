@@ -0,0 +1,156 @@
+package dbauth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/databricks/databricks-sql-go/auth/oauth"
+	"github.com/databricks/databricks-sql-go/auth/oauth/u2m"
+	"github.com/pkg/browser"
+	"golang.org/x/oauth2"
+)
+
+// Public OAuth clients registered by Databricks for SQL connectors, with their redirect address.
+const (
+	connectorClientID      = "databricks-sql-connector"
+	azureConnectorClientID = "96eecda7-19ea-49cc-abb5-240097d554f5"
+	redirectAddr           = "localhost:8030"
+)
+
+// loginTimeout bounds how long the browser login waits for the user.
+const loginTimeout = 2 * time.Minute
+
+// NewU2M returns an authenticator for the OAuth user-to-machine flow. A token cached for
+// host is refreshed silently; without one (or when the refresh token has expired) the
+// user logs in through the browser with an authorization code and PKCE.
+func NewU2M(ctx context.Context, host string, cache TokenCache) (*Refresher, error) {
+	clientID := connectorClientID
+	if oauth.InferCloudFromHost(host) == oauth.Azure {
+		clientID = azureConnectorClientID
+	}
+	config, err := u2m.GetConfig(ctx, host, clientID, "", redirectAddr, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure OAuth for %s: %w", host, err)
+	}
+
+	key := "u2m:" + host
+	token, err := cache.Load(key)
+	if err != nil {
+		return nil, err
+	}
+	if token != nil {
+		// Check the cached refresh token now, so an expired one leads to a new login
+		// before the query starts rather than a failure half way through.
+		if token, err = refreshToken(ctx, config, token); err != nil {
+			token = nil
+		}
+	}
+	if token == nil {
+		if token, err = browserLogin(ctx, config); err != nil {
+			return nil, err
+		}
+	}
+
+	// Later tokens are obtained with the latest refresh token, which the identity
+	// provider may rotate, and every new token is written back to the cache.
+	current := token
+	src := NewRefresher(ctx, ProviderFunc(func(ctx context.Context) (*oauth2.Token, error) {
+		return refreshToken(ctx, config, current)
+	}), RefreshMargin)
+	src.OnRefresh = func(t *oauth2.Token) error {
+		current = t
+		return cache.Save(key, t)
+	}
+	src.token = token
+	if err := cache.Save(key, token); err != nil {
+		return nil, err
+	}
+	return src, nil
+}
+
+// refreshToken exchanges the refresh token of t for a new token. The refresh token is
+// kept when the response does not rotate it.
+func refreshToken(ctx context.Context, config oauth2.Config, t *oauth2.Token) (*oauth2.Token, error) {
+	if t.RefreshToken == "" {
+		return nil, errors.New("no refresh token")
+	}
+	return config.TokenSource(ctx, &oauth2.Token{RefreshToken: t.RefreshToken}).Token()
+}
+
+// browserLogin runs the authorization code flow with PKCE: it opens the login page,
+// waits for the redirect on the local callback address and exchanges the code for a token.
+func browserLogin(ctx context.Context, config oauth2.Config) (*oauth2.Token, error) {
+	stateBytes := make([]byte, 16)
+	if _, err := rand.Read(stateBytes); err != nil {
+		return nil, err
+	}
+	state := hex.EncodeToString(stateBytes)
+	challenge, method, verifier, err := u2m.GetAuthCodeOptions()
+	if err != nil {
+		return nil, err
+	}
+
+	listener, err := net.Listen("tcp", redirectAddr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to listen for the OAuth callback on %s: %w", redirectAddr, err)
+	}
+
+	// Serve the callback until the first request that carries our state arrives.
+	type result struct {
+		code string
+		err  error
+	}
+	done := make(chan result, 1)
+	finish := func(res result) {
+		select {
+		case done <- res:
+		default: // A result was already delivered.
+		}
+	}
+	srv := &http.Server{ReadHeaderTimeout: 3 * time.Second, Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("state") != state {
+			http.Error(w, "Unexpected login state, please try again.", http.StatusBadRequest)
+			return
+		}
+		if e := q.Get("error"); e != "" {
+			http.Error(w, "Login failed: "+e, http.StatusBadRequest)
+			finish(result{err: fmt.Errorf("identity provider error: %s: %s", e, q.Get("error_description"))})
+			return
+		}
+		fmt.Fprintln(w, "Login complete. You can close this window and return to the terminal.")
+		finish(result{code: q.Get("code")})
+	})}
+	go srv.Serve(listener)
+	defer srv.Close()
+
+	loginURL := config.AuthCodeURL(state, challenge, method)
+	fmt.Fprintf(os.Stderr, "Opening the browser to log in to Databricks. If it does not open, visit:\n%s\n", loginURL)
+	browser.Stdout = os.Stderr // Keep stdout clean for the query result.
+	if err := browser.OpenURL(loginURL); err != nil {
+		fmt.Fprintln(os.Stderr, "Unable to open the browser automatically.")
+	}
+
+	select {
+	case res := <-done:
+		if res.err != nil {
+			return nil, res.err
+		}
+		token, err := config.Exchange(ctx, res.code, verifier)
+		if err != nil {
+			return nil, fmt.Errorf("unable to exchange the authorization code: %w", err)
+		}
+		return token, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(loginTimeout):
+		return nil, errors.New("timed out waiting for the browser login")
+	}
+}
@@ -0,0 +1,583 @@
+package flightserver
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/flight"
+	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
+	"github.com/apache/arrow/go/v12/arrow/flight/flightsql/schema_ref"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// tableTypes are the values of table_type in the Unity Catalog information schema.
+var tableTypes = []string{"MANAGED", "EXTERNAL", "VIEW", "MATERIALIZED_VIEW", "STREAMING_TABLE", "FOREIGN"}
+
+// SQLServer implements the Flight SQL protocol on top of an arrowfetch.Client, so that
+// ADBC drivers, the Flight SQL JDBC driver and the BI tools using them can query
+// Databricks through it. It supports statements, prepared statements with one row of
+// parameters, updates, and the catalog, schema, table and table type listings, which it
+// reads from the Unity Catalog information schema.
+type SQLServer struct {
+	flightsql.BaseServer
+	client *arrowfetch.Client
+
+	mu       sync.Mutex
+	prepared map[string]*preparedStatement
+}
+
+// preparedStatement is a query prepared by a client, with its bound parameters.
+type preparedStatement struct {
+	query  string
+	schema *arrow.Schema // described by the warehouse, nil when it cannot be
+	args   []any
+}
+
+// NewSQL returns a SQLServer running the statements of its clients with client. Pass it
+// to Serve through flightsql.NewFlightServer.
+func NewSQL(client *arrowfetch.Client) (*SQLServer, error) {
+	s := &SQLServer{client: client, prepared: make(map[string]*preparedStatement)}
+	for id, v := range map[flightsql.SqlInfo]any{
+		flightsql.SqlInfoFlightSqlServerName:         "dbarrow",
+		flightsql.SqlInfoFlightSqlServerVersion:      "Databricks SQL",
+		flightsql.SqlInfoFlightSqlServerArrowVersion: "12.0.1",
+		flightsql.SqlInfoFlightSqlServerReadOnly:     false,
+		flightsql.SqlInfoFlightSqlServerSql:          true,
+		flightsql.SqlInfoFlightSqlServerSubstrait:    false,
+	} {
+		if err := s.RegisterSqlInfo(id, v); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// GetFlightInfoStatement returns the ticket of a query. The schema is left to the
+// stream, to avoid describing every query on the warehouse before running it.
+func (s *SQLServer) GetFlightInfoStatement(_ context.Context, cmd flightsql.StatementQuery, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	query := strings.TrimSpace(cmd.GetQuery())
+	if query == "" {
+		return nil, status.Error(codes.InvalidArgument, "empty query")
+	}
+	tkt, err := flightsql.CreateStatementQueryTicket([]byte(query))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &flight.FlightInfo{
+		FlightDescriptor: desc,
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: tkt}}},
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+	}, nil
+}
+
+// GetSchemaStatement describes the result of a query without running it.
+func (s *SQLServer) GetSchemaStatement(ctx context.Context, cmd flightsql.StatementQuery, _ *flight.FlightDescriptor) (*flight.SchemaResult, error) {
+	schema, err := s.client.Schema(ctx, cmd.GetQuery())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &flight.SchemaResult{Schema: flight.SerializeSchema(schema, memory.DefaultAllocator)}, nil
+}
+
+// DoGetStatement runs the query of a ticket from GetFlightInfoStatement.
+func (s *SQLServer) DoGetStatement(ctx context.Context, tkt flightsql.StatementQueryTicket) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	return s.stream(ctx, string(tkt.GetStatementHandle()))
+}
+
+// DoPutCommandStatementUpdate runs a statement returning no result, such as an INSERT.
+func (s *SQLServer) DoPutCommandStatementUpdate(ctx context.Context, cmd flightsql.StatementUpdate) (int64, error) {
+	return s.exec(ctx, cmd.GetQuery())
+}
+
+// CreatePreparedStatement registers a query under a new handle. Databricks has no
+// server-side prepared statements, so the query is only described, which fails for
+// statements other than queries; their dataset schema is then left out.
+func (s *SQLServer) CreatePreparedStatement(ctx context.Context, req flightsql.ActionCreatePreparedStatementRequest) (flightsql.ActionCreatePreparedStatementResult, error) {
+	query := strings.TrimSpace(req.GetQuery())
+	if query == "" {
+		return flightsql.ActionCreatePreparedStatementResult{}, status.Error(codes.InvalidArgument, "empty query")
+	}
+	stmt := &preparedStatement{query: query}
+	if schema, err := s.client.Schema(ctx, query); err == nil {
+		stmt.schema = schema
+	}
+	handle := make([]byte, 16)
+	if _, err := rand.Read(handle); err != nil {
+		return flightsql.ActionCreatePreparedStatementResult{}, status.Error(codes.Internal, err.Error())
+	}
+	handle = []byte(hex.EncodeToString(handle))
+
+	s.mu.Lock()
+	s.prepared[string(handle)] = stmt
+	s.mu.Unlock()
+	return flightsql.ActionCreatePreparedStatementResult{Handle: handle, DatasetSchema: stmt.schema}, nil
+}
+
+// ClosePreparedStatement forgets a prepared statement.
+func (s *SQLServer) ClosePreparedStatement(_ context.Context, req flightsql.ActionClosePreparedStatementRequest) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.prepared, string(req.GetPreparedStatementHandle()))
+	return nil
+}
+
+// DoPutPreparedStatementQuery binds the parameters of a prepared query.
+func (s *SQLServer) DoPutPreparedStatementQuery(_ context.Context, cmd flightsql.PreparedStatementQuery, rdr flight.MessageReader, _ flight.MetadataWriter) error {
+	stmt, err := s.lookup(cmd.GetPreparedStatementHandle())
+	if err != nil {
+		return err
+	}
+	args, err := bindParameters(rdr)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	stmt.args = args
+	s.mu.Unlock()
+	return nil
+}
+
+// GetFlightInfoPreparedStatement returns the ticket of a prepared query.
+func (s *SQLServer) GetFlightInfoPreparedStatement(_ context.Context, cmd flightsql.PreparedStatementQuery, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	stmt, err := s.lookup(cmd.GetPreparedStatementHandle())
+	if err != nil {
+		return nil, err
+	}
+	return commandInfo(desc, stmt.schema), nil
+}
+
+// GetSchemaPreparedStatement returns the schema described when the query was prepared.
+func (s *SQLServer) GetSchemaPreparedStatement(_ context.Context, cmd flightsql.PreparedStatementQuery, _ *flight.FlightDescriptor) (*flight.SchemaResult, error) {
+	stmt, err := s.lookup(cmd.GetPreparedStatementHandle())
+	if err != nil {
+		return nil, err
+	}
+	if stmt.schema == nil {
+		return nil, status.Error(codes.FailedPrecondition, "the statement does not return a result")
+	}
+	return &flight.SchemaResult{Schema: flight.SerializeSchema(stmt.schema, memory.DefaultAllocator)}, nil
+}
+
+// DoGetPreparedStatement runs a prepared query with its bound parameters.
+func (s *SQLServer) DoGetPreparedStatement(ctx context.Context, cmd flightsql.PreparedStatementQuery) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	stmt, err := s.lookup(cmd.GetPreparedStatementHandle())
+	if err != nil {
+		return nil, nil, err
+	}
+	s.mu.Lock()
+	args := stmt.args
+	s.mu.Unlock()
+	return s.stream(ctx, stmt.query, args...)
+}
+
+// DoPutPreparedStatementUpdate runs a prepared statement returning no result, with the
+// parameters sent along or else the ones bound before.
+func (s *SQLServer) DoPutPreparedStatementUpdate(ctx context.Context, cmd flightsql.PreparedStatementUpdate, rdr flight.MessageReader) (int64, error) {
+	stmt, err := s.lookup(cmd.GetPreparedStatementHandle())
+	if err != nil {
+		return 0, err
+	}
+	args, err := bindParameters(rdr)
+	if err != nil {
+		return 0, err
+	}
+	if args == nil {
+		s.mu.Lock()
+		args = stmt.args
+		s.mu.Unlock()
+	}
+	return s.exec(ctx, stmt.query, args...)
+}
+
+// GetFlightInfoCatalogs returns the ticket of the catalog listing.
+func (s *SQLServer) GetFlightInfoCatalogs(_ context.Context, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	return commandInfo(desc, schema_ref.Catalogs), nil
+}
+
+// DoGetCatalogs lists the catalogs visible to the user.
+func (s *SQLServer) DoGetCatalogs(ctx context.Context) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	return s.listing(ctx, schema_ref.Catalogs,
+		"SELECT catalog_name FROM system.information_schema.catalogs ORDER BY catalog_name")
+}
+
+// GetFlightInfoSchemas returns the ticket of the schema listing.
+func (s *SQLServer) GetFlightInfoSchemas(_ context.Context, _ flightsql.GetDBSchemas, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	return commandInfo(desc, schema_ref.DBSchemas), nil
+}
+
+// DoGetDBSchemas lists the schemas of a catalog, or of all catalogs, whose name matches
+// the LIKE pattern of the request.
+func (s *SQLServer) DoGetDBSchemas(ctx context.Context, cmd flightsql.GetDBSchemas) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	var f filter
+	f.equal("catalog_name", cmd.GetCatalog())
+	f.like("schema_name", cmd.GetDBSchemaFilterPattern())
+	return s.listing(ctx, schema_ref.DBSchemas,
+		"SELECT catalog_name, schema_name FROM system.information_schema.schemata"+f.where()+" ORDER BY catalog_name, schema_name", f.args...)
+}
+
+// GetFlightInfoTables returns the ticket of the table listing.
+func (s *SQLServer) GetFlightInfoTables(_ context.Context, cmd flightsql.GetTables, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	if cmd.GetIncludeSchema() {
+		return commandInfo(desc, schema_ref.TablesWithIncludedSchema), nil
+	}
+	return commandInfo(desc, schema_ref.Tables), nil
+}
+
+// DoGetTables lists the tables and views matching the request, with the Arrow schema
+// of each when asked for.
+func (s *SQLServer) DoGetTables(ctx context.Context, cmd flightsql.GetTables) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	f := tableFilter(cmd, "")
+	query := "SELECT table_catalog, table_schema, table_name, table_type FROM system.information_schema.tables" +
+		f.where() + " ORDER BY table_catalog, table_schema, table_name"
+	if !cmd.GetIncludeSchema() {
+		return s.listing(ctx, schema_ref.Tables, query, f.args...)
+	}
+	rec, err := s.tablesWithSchemas(ctx, query, f, tableFilter(cmd, "t."))
+	if err != nil {
+		return nil, nil, toStatus(err)
+	}
+	return single(rec)
+}
+
+// GetFlightInfoTableTypes returns the ticket of the table type listing.
+func (s *SQLServer) GetFlightInfoTableTypes(_ context.Context, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	return commandInfo(desc, schema_ref.TableTypes), nil
+}
+
+// DoGetTableTypes lists the table types of Unity Catalog.
+func (s *SQLServer) DoGetTableTypes(context.Context) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	b := array.NewStringBuilder(memory.DefaultAllocator)
+	defer b.Release()
+	b.AppendValues(tableTypes, nil)
+	col := b.NewArray()
+	defer col.Release()
+	return single(array.NewRecord(schema_ref.TableTypes, []arrow.Array{col}, int64(col.Len())))
+}
+
+// lookup returns the prepared statement of handle.
+func (s *SQLServer) lookup(handle []byte) (*preparedStatement, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stmt, ok := s.prepared[string(handle)]
+	if !ok {
+		return nil, status.Error(codes.NotFound, "unknown prepared statement")
+	}
+	return stmt, nil
+}
+
+// stream runs query and sends its batches on the returned channel, which the Flight SQL
+// server drains and releases. The schema is the one of the first batch, or the one the
+// warehouse describes for an empty result.
+func (s *SQLServer) stream(ctx context.Context, query string, args ...any) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	batches, err := s.client.Query(ctx, query, args...)
+	if err != nil {
+		return nil, nil, toStatus(err)
+	}
+	var first arrow.Record
+	if batches.HasNext() {
+		if first, err = batches.Next(); err != nil {
+			batches.Close()
+			return nil, nil, toStatus(err)
+		}
+	}
+	var schema *arrow.Schema
+	if first != nil {
+		schema = first.Schema()
+	} else if schema, err = s.client.Schema(ctx, query, args...); err != nil {
+		batches.Close()
+		return nil, nil, toStatus(err)
+	}
+
+	ch := make(chan flight.StreamChunk)
+	go func() {
+		defer close(ch)
+		defer batches.Close()
+		rec := first
+		for {
+			if rec != nil {
+				select {
+				case ch <- flight.StreamChunk{Data: rec}:
+				case <-ctx.Done():
+					// The client went away; nobody will release the batch.
+					rec.Release()
+					return
+				}
+			}
+			if !batches.HasNext() {
+				return
+			}
+			if rec, err = batches.Next(); err != nil {
+				select {
+				case ch <- flight.StreamChunk{Err: toStatus(err)}:
+				case <-ctx.Done():
+				}
+				return
+			}
+		}
+	}()
+	return schema, ch, nil
+}
+
+// listing runs a metadata query and streams its batches under schema, the reference
+// schema of the Flight SQL command, whose column types they already have.
+func (s *SQLServer) listing(ctx context.Context, schema *arrow.Schema, query string, args ...any) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	_, ch, err := s.stream(ctx, query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	out := make(chan flight.StreamChunk)
+	go func() {
+		defer close(out)
+		for chunk := range ch {
+			if chunk.Data != nil {
+				rec := array.NewRecord(schema, chunk.Data.Columns(), chunk.Data.NumRows())
+				chunk.Data.Release()
+				chunk.Data = rec
+			}
+			select {
+			case out <- chunk:
+			case <-ctx.Done():
+				if chunk.Data != nil {
+					chunk.Data.Release()
+				}
+				// Drain the source so it can finish and close its batches.
+				for chunk := range ch {
+					if chunk.Data != nil {
+						chunk.Data.Release()
+					}
+				}
+				return
+			}
+		}
+	}()
+	return schema, out, nil
+}
+
+// tableFilter selects the tables of a GetTables request, with the columns of the
+// information schema's tables view qualified by prefix.
+func tableFilter(cmd flightsql.GetTables, prefix string) filter {
+	var f filter
+	f.equal(prefix+"table_catalog", cmd.GetCatalog())
+	f.like(prefix+"table_schema", cmd.GetDBSchemaFilterPattern())
+	f.like(prefix+"table_name", cmd.GetTableNameFilterPattern())
+	f.in(prefix+"table_type", cmd.GetTableTypes())
+	return f
+}
+
+// tablesWithSchemas lists the tables of query, selected by f, and builds the Arrow
+// schema of each from the columns the information schema records for the tables
+// selected by joined, the same filter on the joined tables view.
+func (s *SQLServer) tablesWithSchemas(ctx context.Context, query string, f, joined filter) (arrow.Record, error) {
+	type table struct{ catalog, schema, name, kind string }
+	var tables []table
+	err := s.client.Fetch(ctx, query, func(rec arrow.Record) error {
+		cols, err := stringColumns(rec)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			tables = append(tables, table{cols[0].Value(i), cols[1].Value(i), cols[2].Value(i), cols[3].Value(i)})
+		}
+		return nil
+	}, f.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[table][]arrow.Field)
+	columns := "SELECT c.table_catalog, c.table_schema, c.table_name, c.column_name, c.full_data_type, c.is_nullable" +
+		" FROM system.information_schema.columns c JOIN system.information_schema.tables t" +
+		" ON c.table_catalog = t.table_catalog AND c.table_schema = t.table_schema AND c.table_name = t.table_name" +
+		joined.where() + " ORDER BY c.ordinal_position"
+	err = s.client.Fetch(ctx, columns, func(rec arrow.Record) error {
+		cols, err := stringColumns(rec)
+		if err != nil {
+			return err
+		}
+		for i := 0; i < int(rec.NumRows()); i++ {
+			dt, err := arrowfetch.ParseSQLType(cols[4].Value(i))
+			if err != nil {
+				return fmt.Errorf("column %s of %s: %w", cols[3].Value(i), cols[2].Value(i), err)
+			}
+			key := table{cols[0].Value(i), cols[1].Value(i), cols[2].Value(i), ""}
+			fields[key] = append(fields[key], arrow.Field{
+				Name:     cols[3].Value(i),
+				Type:     dt,
+				Nullable: cols[5].Value(i) != "NO",
+				Metadata: arrow.NewMetadata([]string{arrowfetch.SQLTypeKey}, []string{cols[4].Value(i)}),
+			})
+		}
+		return nil
+	}, joined.args...)
+	if err != nil {
+		return nil, err
+	}
+
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema_ref.TablesWithIncludedSchema)
+	defer b.Release()
+	for _, t := range tables {
+		b.Field(0).(*array.StringBuilder).Append(t.catalog)
+		b.Field(1).(*array.StringBuilder).Append(t.schema)
+		b.Field(2).(*array.StringBuilder).Append(t.name)
+		b.Field(3).(*array.StringBuilder).Append(t.kind)
+		schema := arrow.NewSchema(fields[table{t.catalog, t.schema, t.name, ""}], nil)
+		b.Field(4).(*array.BinaryBuilder).Append(flight.SerializeSchema(schema, memory.DefaultAllocator))
+	}
+	return b.NewRecord(), nil
+}
+
+// exec runs a statement returning no result and reports the rows it affected.
+func (s *SQLServer) exec(ctx context.Context, query string, args ...any) (int64, error) {
+	if strings.TrimSpace(query) == "" {
+		return 0, status.Error(codes.InvalidArgument, "empty statement")
+	}
+	res, err := s.client.DB().ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, toStatus(err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return -1, nil // unknown
+	}
+	return n, nil
+}
+
+// commandInfo returns the FlightInfo of a command whose ticket is the command itself.
+func commandInfo(desc *flight.FlightDescriptor, schema *arrow.Schema) *flight.FlightInfo {
+	info := &flight.FlightInfo{
+		FlightDescriptor: desc,
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: desc.Cmd}}},
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+	}
+	if schema != nil {
+		info.Schema = flight.SerializeSchema(schema, memory.DefaultAllocator)
+	}
+	return info
+}
+
+// single returns a stream of one record.
+func single(rec arrow.Record) (*arrow.Schema, <-chan flight.StreamChunk, error) {
+	ch := make(chan flight.StreamChunk, 1)
+	ch <- flight.StreamChunk{Data: rec}
+	close(ch)
+	return rec.Schema(), ch, nil
+}
+
+// stringColumns returns the columns of rec, all strings in the information schema.
+func stringColumns(rec arrow.Record) ([]*array.String, error) {
+	cols := make([]*array.String, rec.NumCols())
+	for i, col := range rec.Columns() {
+		var ok bool
+		if cols[i], ok = col.(*array.String); !ok {
+			return nil, fmt.Errorf("unexpected information schema result: %s", rec.Schema())
+		}
+	}
+	return cols, nil
+}
+
+// bindParameters reads the parameters sent with a prepared statement: one row whose
+// columns bind the statement's ? markers in order. It returns nil when none are sent.
+func bindParameters(rdr flight.MessageReader) ([]any, error) {
+	var args []any
+	for rdr.Next() {
+		rec := rdr.Record()
+		if rec.NumRows() == 0 {
+			continue
+		}
+		if args != nil || rec.NumRows() > 1 {
+			return nil, status.Error(codes.InvalidArgument, "only one row of parameters is supported")
+		}
+		args = make([]any, rec.NumCols())
+		for i, col := range rec.Columns() {
+			args[i] = parameterValue(col, 0)
+		}
+	}
+	if err := rdr.Err(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	return args, nil
+}
+
+// parameterValue converts the value at i to a Go value the driver can bind.
+func parameterValue(col arrow.Array, i int) any {
+	if col.IsNull(i) {
+		return nil
+	}
+	switch a := col.(type) {
+	case *array.Timestamp:
+		return a.Value(i).ToTime(a.DataType().(*arrow.TimestampType).Unit)
+	case *array.Date32:
+		return a.Value(i).ToTime()
+	case *array.Date64:
+		return a.Value(i).ToTime()
+	case *array.Binary:
+		return string(a.Value(i))
+	}
+	switch v := col.GetOneForMarshal(i).(type) {
+	case bool, string, int8, int16, int32, int64, uint8, uint16, uint32, uint64, float32, float64, time.Time:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// filter collects the WHERE conditions of a metadata query with their parameters.
+type filter struct {
+	conds []string
+	args  []any
+}
+
+// equal matches column against value, unless value is nil or empty.
+func (f *filter) equal(column string, value *string) {
+	if value != nil && *value != "" {
+		f.conds = append(f.conds, column+" = "+f.param(*value))
+	}
+}
+
+// like matches column against the SQL LIKE pattern, unless pattern is nil or empty.
+func (f *filter) like(column string, pattern *string) {
+	if pattern != nil && *pattern != "" {
+		f.conds = append(f.conds, column+" LIKE "+f.param(*pattern))
+	}
+}
+
+// in matches column against any of values, unless there are none.
+func (f *filter) in(column string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	markers := make([]string, len(values))
+	for i, v := range values {
+		markers[i] = f.param(v)
+	}
+	f.conds = append(f.conds, column+" IN ("+strings.Join(markers, ", ")+")")
+}
+
+// param adds a parameter holding value and returns its marker.
+func (f *filter) param(value string) string {
+	name := fmt.Sprintf("p%d", len(f.args))
+	f.args = append(f.args, sql.Named(name, value))
+	return ":" + name
+}
+
+// where returns the WHERE clause, or nothing without conditions.
+func (f *filter) where() string {
+	if len(f.conds) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(f.conds, " AND ")
+}
@@ -0,0 +1,125 @@
+// Package flightserver serves Databricks query results over Arrow Flight. With Server a
+// client sends the SQL text as the ticket of DoGet; SQLServer speaks the Flight SQL
+// protocol instead. Either way the record batches fetched from the warehouse are
+// streamed back as they arrive, in the Arrow IPC format they are already in, without
+// converting them.
+package flightserver
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/flight"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements the Flight service on top of an arrowfetch.Client.
+type Server struct {
+	flight.BaseFlightServer
+	client *arrowfetch.Client
+}
+
+// New returns a Server running the queries of its clients with client.
+func New(client *arrowfetch.Client) *Server {
+	return &Server{client: client}
+}
+
+// Serve listens on addr, e.g. localhost:8815, and serves the Flight requests of srv, a
+// Server or a SQLServer wrapped by flightsql.NewFlightServer, until ctx is done. The
+// listener is opened before Serve blocks, so a busy port fails at once.
+func Serve(ctx context.Context, addr string, srv flight.FlightServer) error {
+	s := flight.NewServerWithMiddleware(nil)
+	s.RegisterFlightService(srv)
+	if err := s.Init(addr); err != nil {
+		return err
+	}
+	go func() {
+		<-ctx.Done()
+		s.Shutdown()
+	}()
+	return s.Serve()
+}
+
+// GetFlightInfo describes the result of the SQL query given as a command descriptor,
+// without running it, and returns the ticket to fetch it with DoGet.
+func (s *Server) GetFlightInfo(ctx context.Context, desc *flight.FlightDescriptor) (*flight.FlightInfo, error) {
+	query, err := commandQuery(desc)
+	if err != nil {
+		return nil, err
+	}
+	schema, err := s.client.Schema(ctx, query)
+	if err != nil {
+		return nil, toStatus(err)
+	}
+	return &flight.FlightInfo{
+		Schema:           flight.SerializeSchema(schema, memory.DefaultAllocator),
+		FlightDescriptor: desc,
+		Endpoint:         []*flight.FlightEndpoint{{Ticket: &flight.Ticket{Ticket: []byte(query)}}},
+		TotalRecords:     -1,
+		TotalBytes:       -1,
+	}, nil
+}
+
+// DoGet runs the SQL query held in the ticket and streams its record batches.
+func (s *Server) DoGet(tkt *flight.Ticket, stream flight.FlightService_DoGetServer) error {
+	query := strings.TrimSpace(string(tkt.GetTicket()))
+	if query == "" {
+		return status.Error(codes.InvalidArgument, "the ticket must hold a SQL query")
+	}
+	ctx := stream.Context()
+
+	// The schema of the stream is the one of the first batch, so the writer is created
+	// once it arrives. The query is cancelled if the client goes away.
+	var w *flight.Writer
+	err := s.client.Fetch(ctx, query, func(rec arrow.Record) error {
+		if w == nil {
+			w = flight.NewRecordWriter(stream, ipc.WithSchema(rec.Schema()))
+		}
+		return w.Write(rec)
+	})
+	if err != nil {
+		if w != nil {
+			w.Close()
+		}
+		return toStatus(err)
+	}
+	if w == nil {
+		// An empty result still sends its schema, described by the warehouse.
+		schema, err := s.client.Schema(ctx, query)
+		if err != nil {
+			return toStatus(err)
+		}
+		w = flight.NewRecordWriter(stream, ipc.WithSchema(schema))
+	}
+	return w.Close()
+}
+
+// commandQuery returns the SQL text of a command descriptor.
+func commandQuery(desc *flight.FlightDescriptor) (string, error) {
+	if desc.GetType() != flight.DescriptorCMD {
+		return "", status.Error(codes.InvalidArgument, "expected a command descriptor holding a SQL query")
+	}
+	query := strings.TrimSpace(string(desc.GetCmd()))
+	if query == "" {
+		return "", status.Error(codes.InvalidArgument, "the command must hold a SQL query")
+	}
+	return query, nil
+}
+
+// toStatus maps a query error to the gRPC status the client sees.
+func toStatus(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, arrowfetch.ErrQueryTimeout), errors.Is(err, arrowfetch.ErrFetchTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,338 @@
+// Package httpserver serves Databricks query results over HTTP. POST /query runs the
+// query in the request body and streams the result back as it is fetched, as an Arrow
+// IPC stream, NDJSON or CSV depending on the Accept header. GET /ws does the same over a
+// WebSocket, pushing the rows to browser clients as JSON messages.
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/metrics"
+	"dbx_arrow_dbsql/pkg/pipeline"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	dbsql "github.com/databricks/databricks-sql-go"
+)
+
+// Media types of the result formats.
+const (
+	ArrowStream = "application/vnd.apache.arrow.stream"
+	NDJSON      = "application/x-ndjson"
+	CSV         = "text/csv"
+)
+
+// maxBodySize bounds the request body, which holds a query and its parameters.
+const maxBodySize = 1 << 20
+
+// Limits bound the requests of a Server. A request may ask for less, never for more.
+type Limits struct {
+	Timeout       time.Duration // time for running the query and sending its result, 0 for none
+	MaxRows       int64         // rows returned per request, 0 for no limit
+	MaxConcurrent int           // queries running at once, 0 for no limit; more get 503
+}
+
+// Server is the http.Handler of the query endpoint.
+type Server struct {
+	client  *arrowfetch.Client
+	limits  Limits
+	slots   chan struct{} // one per running query, when MaxConcurrent is set
+	origins []string      // further origins allowed to open the WebSocket endpoint
+	mux     *http.ServeMux
+}
+
+// New returns a Server running the queries of its clients with client.
+func New(client *arrowfetch.Client, limits Limits) *Server {
+	s := &Server{client: client, limits: limits, mux: http.NewServeMux()}
+	if limits.MaxConcurrent > 0 {
+		s.slots = make(chan struct{}, limits.MaxConcurrent)
+	}
+	s.mux.HandleFunc("POST /query", s.query)
+	s.mux.HandleFunc("GET /ws", s.socket)
+	return s
+}
+
+// Handle registers another handler on the server's mux, e.g. for a further endpoint.
+func (s *Server) Handle(pattern string, h http.Handler) {
+	s.mux.Handle(pattern, h)
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// Request is the JSON body of POST /query. A body of any other content type is taken as
+// the SQL text, with max_rows and timeout given as URL query parameters.
+type Request struct {
+	Query      string      `json:"query"`
+	Parameters []Parameter `json:"parameters,omitempty"`
+	MaxRows    int64       `json:"max_rows,omitempty"`
+	Timeout    string      `json:"timeout,omitempty"` // e.g. 30s
+}
+
+// Parameter binds a value to the :name marker of the query, or to the next ? marker
+// when unnamed. Type is a SQL type such as INT or DATE; STRING when empty.
+type Parameter struct {
+	Name  string `json:"name,omitempty"`
+	Value string `json:"value"`
+	Type  string `json:"type,omitempty"`
+}
+
+// query handles POST /query.
+func (s *Server) query(w http.ResponseWriter, r *http.Request) {
+	format, ok := negotiate(r.Header.Get("Accept"))
+	if !ok {
+		httpError(w, http.StatusNotAcceptable, fmt.Errorf("supported result types are %s, %s and %s", ArrowStream, NDJSON, CSV))
+		return
+	}
+	req, err := readRequest(r)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	args, err := req.args()
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+	timeout, maxRows, err := s.bounds(req)
+	if err != nil {
+		httpError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		default:
+			w.Header().Set("Retry-After", "1")
+			httpError(w, http.StatusServiceUnavailable, errors.New("too many queries running, retry later"))
+			return
+		}
+	}
+
+	ctx := r.Context()
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	// The status and headers go out with the first batch, so a query that fails to run
+	// still gets an error status.
+	out := &response{w: w, format: format}
+	p := pipeline.Pipeline{Source: pipeline.Query(s.client, req.Query, args...), Sink: out}
+	if maxRows > 0 {
+		p.Transforms = []pipeline.Transform{pipeline.Head(maxRows)}
+	}
+	_, err = p.Run(ctx)
+	if err == nil && out.sink == nil {
+		// An empty result still sends its columns, described by the warehouse.
+		var schema *arrow.Schema
+		if schema, err = s.client.Schema(ctx, req.Query, args...); err == nil {
+			b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+			rec := b.NewRecord()
+			err = out.Write(rec)
+			rec.Release()
+			b.Release()
+		}
+	}
+	if err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		if out.sink == nil {
+			httpError(w, errorStatus(err), err)
+			return
+		}
+		// The status is gone already: cut the connection so that the truncated result
+		// is not taken for a complete one.
+		panic(http.ErrAbortHandler)
+	}
+}
+
+// readRequest decodes the body of POST /query.
+func readRequest(r *http.Request) (*Request, error) {
+	body, err := io.ReadAll(http.MaxBytesReader(nil, r.Body, maxBodySize))
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the request: %w", err)
+	}
+	req := &Request{}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == "application/json" {
+		if err := json.Unmarshal(body, req); err != nil {
+			return nil, fmt.Errorf("invalid JSON request: %w", err)
+		}
+	} else {
+		req.Query = string(body)
+		req.Timeout = r.URL.Query().Get("timeout")
+		if v := r.URL.Query().Get("max_rows"); v != "" {
+			if req.MaxRows, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return nil, fmt.Errorf("invalid max_rows %q", v)
+			}
+		}
+	}
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		return nil, errors.New("empty query")
+	}
+	return req, nil
+}
+
+// args converts the request parameters to dbsql.Parameter arguments.
+func (req *Request) args() ([]any, error) {
+	args := make([]any, len(req.Parameters))
+	for i, p := range req.Parameters {
+		param := dbsql.Parameter{Name: p.Name, Value: p.Value}
+		if p.Type != "" {
+			t, ok := arrowfetch.ParameterType(p.Type)
+			if !ok {
+				return nil, fmt.Errorf("unsupported parameter type %q", p.Type)
+			}
+			param.Type = t
+		}
+		if i > 0 && (req.Parameters[0].Name == "") != (p.Name == "") {
+			return nil, errors.New("named and positional parameters cannot be mixed")
+		}
+		args[i] = param
+	}
+	return args, nil
+}
+
+// bounds returns the timeout and row limit of req within the server's limits.
+func (s *Server) bounds(req *Request) (time.Duration, int64, error) {
+	timeout, maxRows := s.limits.Timeout, s.limits.MaxRows
+	if req.Timeout != "" {
+		d, err := time.ParseDuration(req.Timeout)
+		if err != nil || d <= 0 {
+			return 0, 0, fmt.Errorf("invalid timeout %q, expected a duration such as 30s", req.Timeout)
+		}
+		if timeout == 0 || d < timeout {
+			timeout = d
+		}
+	}
+	if req.MaxRows < 0 {
+		return 0, 0, errors.New("max_rows must not be negative")
+	}
+	if req.MaxRows > 0 && (maxRows == 0 || req.MaxRows < maxRows) {
+		maxRows = req.MaxRows
+	}
+	return timeout, maxRows, nil
+}
+
+// negotiate picks the result format from an Accept header, NDJSON when any will do.
+// Quality values are not weighed: the first supported type listed wins.
+func negotiate(accept string) (string, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return NDJSON, true
+	}
+	for _, part := range strings.Split(accept, ",") {
+		mt, _, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		switch mt {
+		case ArrowStream, CSV:
+			return mt, true
+		case NDJSON, "application/ndjson", "application/jsonl", "application/json-seq":
+			return NDJSON, true
+		case "*/*", "application/*":
+			return NDJSON, true
+		case "text/*":
+			return CSV, true
+		}
+	}
+	return "", false
+}
+
+// response is the sink writing the result to the client. It sends the headers and
+// creates the writer of the negotiated format with the first batch, and flushes every
+// batch to the client as soon as it is encoded.
+type response struct {
+	w      http.ResponseWriter
+	format string
+	sink   sink.Writer
+}
+
+func (r *response) Write(rec arrow.Record) error {
+	if r.sink == nil {
+		r.w.Header().Set("Content-Type", r.format)
+		r.w.Header().Set("X-Content-Type-Options", "nosniff")
+		r.w.WriteHeader(http.StatusOK)
+		switch r.format {
+		case ArrowStream:
+			r.sink = sink.NewIPCStreamWriter(r.w)
+		case CSV:
+			r.sink = sink.NewCSVWriter(r.w, sink.CSVOptions{})
+		default:
+			r.sink = sink.NewNDJSONWriter(r.w, sink.NDJSONOptions{})
+		}
+	}
+	if err := r.sink.Write(rec); err != nil {
+		return err
+	}
+	return http.NewResponseController(r.w).Flush()
+}
+
+func (r *response) Close() error {
+	if r.sink == nil {
+		return nil
+	}
+	return r.sink.Close()
+}
+
+// errorStatus maps a query error to an HTTP status.
+func errorStatus(err error) int {
+	switch metrics.ErrorType(err) {
+	case "sql":
+		return http.StatusBadRequest
+	case "timeout":
+		return http.StatusGatewayTimeout
+	case "throttled":
+		return http.StatusServiceUnavailable
+	case "canceled":
+		return 499 // client closed the request; it does not see the status anyway
+	}
+	return http.StatusBadGateway
+}
+
+// httpError writes err as a JSON error body with status.
+func httpError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+}
+
+// Serve listens on addr, e.g. localhost:8080, and serves h until ctx is done. The
+// listener is opened before Serve blocks, so a busy port fails at once. Requests in
+// progress are allowed to finish.
+func Serve(ctx context.Context, addr string, h http.Handler) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{Handler: h, ReadHeaderTimeout: 10 * time.Second}
+	done := make(chan error, 1)
+	go func() {
+		<-ctx.Done()
+		done <- srv.Shutdown(context.Background())
+	}()
+	if err := srv.Serve(lis); !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return <-done
+}
@@ -0,0 +1,239 @@
+package httpserver
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/gorilla/websocket"
+)
+
+// rowsPerMessage bounds the rows of one "rows" message, so that a browser can render a
+// large batch piece by piece.
+const rowsPerMessage = 1000
+
+// ClientMessage is a message a client sends to the WebSocket endpoint: "query", with the
+// fields of a Request, or "cancel" to cancel the query running.
+type ClientMessage struct {
+	Type string `json:"type"`
+	Request
+}
+
+// Message is a message the WebSocket endpoint sends for a query: "schema" once the
+// columns are known, "rows" as the batches are fetched, then "done" with the row count,
+// or "error".
+type Message struct {
+	Type string `json:"type"`
+
+	// schema
+	Columns []Column `json:"columns,omitempty"`
+
+	// rows: values of each row in column order, encoded as in NDJSON
+	Rows [][]any `json:"rows,omitempty"`
+
+	// done
+	RowCount int64 `json:"row_count,omitempty"`
+
+	// error
+	Error string `json:"error,omitempty"`
+}
+
+// Column describes a column of the result.
+type Column struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// AllowOrigins lets browser pages from origins, such as https://dash.example.com, open
+// the WebSocket endpoint. Without it only pages served from the server's own host can.
+func (s *Server) AllowOrigins(origins ...string) {
+	s.origins = append(s.origins, origins...)
+}
+
+// socket handles GET /ws, running the queries a client sends one after another on
+// one connection. Rows are sent as they are fetched; a slow client slows the fetch down
+// instead of the result piling up in memory.
+func (s *Server) socket(w http.ResponseWriter, r *http.Request) {
+	upgrader := websocket.Upgrader{CheckOrigin: s.checkOrigin}
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		return // Upgrade has answered the request
+	}
+	defer conn.Close()
+	ws := &wsWriter{conn: conn}
+
+	// A reader goroutine passes queries on and cancels the running one on "cancel" or
+	// when the connection goes away.
+	var (
+		mu      sync.Mutex
+		cancel  context.CancelFunc = func() {}
+		queries                    = make(chan *Request)
+	)
+	ctx, stop := context.WithCancel(r.Context())
+	defer stop()
+	go func() {
+		defer close(queries)
+		for {
+			var msg ClientMessage
+			if err := conn.ReadJSON(&msg); err != nil {
+				stop()
+				return
+			}
+			switch msg.Type {
+			case "query":
+				req := msg.Request
+				select {
+				case queries <- &req:
+				default:
+					ws.send(Message{Type: "error", Error: "a query is running already, cancel it or wait for it to finish"})
+				}
+			case "cancel":
+				mu.Lock()
+				cancel()
+				mu.Unlock()
+			default:
+				ws.send(Message{Type: "error", Error: fmt.Sprintf("unknown message type %q", msg.Type)})
+			}
+		}
+	}()
+
+	for req := range queries {
+		qctx, qcancel := context.WithCancel(ctx)
+		mu.Lock()
+		cancel = qcancel
+		mu.Unlock()
+		err := s.wsQuery(qctx, ws, req)
+		qcancel()
+		if err != nil {
+			if ws.send(Message{Type: "error", Error: err.Error()}) != nil {
+				return
+			}
+		}
+	}
+}
+
+// wsQuery runs req and sends its result to ws.
+func (s *Server) wsQuery(ctx context.Context, ws *wsWriter, req *Request) error {
+	req.Query = strings.TrimSpace(req.Query)
+	if req.Query == "" {
+		return errors.New("empty query")
+	}
+	args, err := req.args()
+	if err != nil {
+		return err
+	}
+	timeout, maxRows, err := s.bounds(req)
+	if err != nil {
+		return err
+	}
+	if s.slots != nil {
+		select {
+		case s.slots <- struct{}{}:
+			defer func() { <-s.slots }()
+		default:
+			return errors.New("too many queries running, retry later")
+		}
+	}
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	ws.rows, ws.schema = 0, nil
+	p := pipeline.Pipeline{Source: pipeline.Query(s.client, req.Query, args...), Sink: ws}
+	if maxRows > 0 {
+		p.Transforms = []pipeline.Transform{pipeline.Head(maxRows)}
+	}
+	if _, err := p.Run(ctx); err != nil {
+		return err
+	}
+	if ws.schema == nil {
+		// An empty result still sends its columns, described by the warehouse.
+		schema, err := s.client.Schema(ctx, req.Query, args...)
+		if err != nil {
+			return err
+		}
+		if err := ws.sendSchema(schema); err != nil {
+			return err
+		}
+	}
+	return ws.send(Message{Type: "done", RowCount: ws.rows})
+}
+
+// checkOrigin accepts requests without an Origin header (not from a browser), from the
+// server's own host, and from the allowed origins.
+func (s *Server) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, o := range s.origins {
+		if o == "*" || strings.EqualFold(o, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// wsWriter is the sink sending batches as "rows" messages.
+type wsWriter struct {
+	conn   *websocket.Conn
+	mu     sync.Mutex // the reader goroutine sends errors too
+	schema *arrow.Schema
+	rows   int64
+}
+
+func (ws *wsWriter) Write(rec arrow.Record) error {
+	if ws.schema == nil {
+		if err := ws.sendSchema(rec.Schema()); err != nil {
+			return err
+		}
+	}
+	n := int(rec.NumRows())
+	for start := 0; start < n; start += rowsPerMessage {
+		end := min(start+rowsPerMessage, n)
+		rows := make([][]any, 0, end-start)
+		for i := start; i < end; i++ {
+			row := make([]any, rec.NumCols())
+			for j, col := range rec.Columns() {
+				row[j] = arrowfetch.JSONValue(col, i)
+			}
+			rows = append(rows, row)
+		}
+		if err := ws.send(Message{Type: "rows", Rows: rows}); err != nil {
+			return err
+		}
+	}
+	ws.rows += int64(n)
+	return nil
+}
+
+func (ws *wsWriter) Close() error { return nil }
+
+func (ws *wsWriter) sendSchema(schema *arrow.Schema) error {
+	ws.schema = schema
+	cols := make([]Column, len(schema.Fields()))
+	for i, f := range schema.Fields() {
+		cols[i] = Column{Name: f.Name, Type: f.Type.String()}
+	}
+	return ws.send(Message{Type: "schema", Columns: cols})
+}
+
+// send writes msg, giving up on a client that has not read anything for a minute.
+func (ws *wsWriter) send(msg Message) error {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	ws.conn.SetWriteDeadline(time.Now().Add(time.Minute))
+	return ws.conn.WriteJSON(msg)
+}
@@ -0,0 +1,128 @@
+// Package metrics exports the activity of an arrowfetch.Client as Prometheus metrics:
+// queries run, rows and bytes fetched, query and batch latencies, and errors by type.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	dbsqlerr "github.com/databricks/databricks-sql-go/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Collector is an arrowfetch.Observer recording Prometheus metrics. Pass it to the
+// client with arrowfetch.WithObserver.
+type Collector struct {
+	queries      *prometheus.CounterVec
+	queryLatency prometheus.Histogram
+	batches      prometheus.Counter
+	rows         prometheus.Counter
+	bytes        prometheus.Counter
+	batchLatency prometheus.Histogram
+	errors       *prometheus.CounterVec
+}
+
+// New creates the metrics and registers them with reg.
+func New(reg prometheus.Registerer) *Collector {
+	c := &Collector{
+		queries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dbarrow_queries_total",
+			Help: "Queries executed, by status (ok or error).",
+		}, []string{"status"}),
+		queryLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "dbarrow_query_duration_seconds",
+			Help:    "Time from sending a query until its result was ready, including time queued on the warehouse.",
+			Buckets: prometheus.ExponentialBuckets(0.1, 2, 14), // 100ms to about 14m
+		}),
+		batches: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dbarrow_batches_fetched_total",
+			Help: "Arrow record batches fetched.",
+		}),
+		rows: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dbarrow_rows_fetched_total",
+			Help: "Rows fetched.",
+		}),
+		bytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "dbarrow_bytes_fetched_total",
+			Help: "Size of the Arrow buffers fetched.",
+		}),
+		batchLatency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "dbarrow_batch_fetch_duration_seconds",
+			Help:    "Time to fetch one record batch, including retries.",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 14), // 5ms to about 40s
+		}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "dbarrow_errors_total",
+			Help: "Failed queries and batch fetches, by type: timeout, canceled, throttled, auth, sql, network or other.",
+		}, []string{"type"}),
+	}
+	reg.MustRegister(c.queries, c.queryLatency, c.batches, c.rows, c.bytes, c.batchLatency, c.errors)
+	return c
+}
+
+var _ arrowfetch.Observer = (*Collector)(nil)
+
+// QueryExecuted counts a query and its outcome.
+func (c *Collector) QueryExecuted(d time.Duration, err error) {
+	c.queryLatency.Observe(d.Seconds())
+	if err != nil {
+		c.queries.WithLabelValues("error").Inc()
+		c.errors.WithLabelValues(ErrorType(err)).Inc()
+		return
+	}
+	c.queries.WithLabelValues("ok").Inc()
+}
+
+// BatchFetched counts a batch, its rows and bytes, and the fetch latency.
+func (c *Collector) BatchFetched(rows, bytes int64, d time.Duration, err error) {
+	c.batchLatency.Observe(d.Seconds())
+	if err != nil {
+		c.errors.WithLabelValues(ErrorType(err)).Inc()
+		return
+	}
+	c.batches.Inc()
+	c.rows.Add(float64(rows))
+	c.bytes.Add(float64(bytes))
+}
+
+// ErrorType classifies err for the type label of dbarrow_errors_total.
+func ErrorType(err error) string {
+	var execErr dbsqlerr.DBExecutionError
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.Is(err, arrowfetch.ErrQueryTimeout), errors.Is(err, arrowfetch.ErrFetchTimeout), errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case strings.Contains(msg, "429") || strings.Contains(msg, "too many requests") || strings.Contains(msg, "503") || strings.Contains(msg, "service unavailable"):
+		return "throttled"
+	case strings.Contains(msg, "401") || strings.Contains(msg, "403") || strings.Contains(msg, "unauthorized") || strings.Contains(msg, "forbidden"):
+		return "auth"
+	case errors.As(err, &execErr):
+		// The warehouse ran the statement and rejected it: a syntax, permission or data error.
+		return "sql"
+	case arrowfetch.IsTransient(err):
+		return "network"
+	}
+	return "other"
+}
+
+// NewRegistry returns a registry holding the Go runtime and process metrics, to which
+// New adds the query metrics.
+func NewRegistry() *prometheus.Registry {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectors.NewGoCollector(), collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}))
+	return reg
+}
+
+// Handler serves the metrics of reg in the Prometheus exposition format.
+func Handler(reg *prometheus.Registry) http.Handler {
+	return promhttp.HandlerFor(reg, promhttp.HandlerOpts{Registry: reg})
+}
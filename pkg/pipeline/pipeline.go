@@ -0,0 +1,138 @@
+// Package pipeline streams Arrow record batches from a Source through a chain of
+// Transforms into a Sink. New sources, transformations and output formats plug in
+// through these interfaces without changing the loop that connects them.
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracer records a "pipeline" span for each run, with the source's spans and one "write"
+// span per batch, covering the transforms and the sink, below it.
+var tracer = otel.Tracer("dbx_arrow_dbsql/pkg/pipeline")
+
+// Source produces the record batches of a result.
+type Source interface {
+	// Records calls fn for every batch and stops at the first error fn returns. A batch
+	// is only valid during the call; fn must retain it to keep it longer.
+	Records(ctx context.Context, fn func(arrow.Record) error) error
+}
+
+// SourceFunc adapts a function to the Source interface.
+type SourceFunc func(ctx context.Context, fn func(arrow.Record) error) error
+
+// Records calls f.
+func (f SourceFunc) Records(ctx context.Context, fn func(arrow.Record) error) error {
+	return f(ctx, fn)
+}
+
+// Transform changes the batches on their way to the sink, e.g. by dropping rows or
+// columns.
+type Transform interface {
+	// Wrap returns a Writer that transforms the batches written to it and passes the
+	// result to next. Closing the returned Writer closes next.
+	Wrap(next sink.Writer) sink.Writer
+}
+
+// TransformFunc adapts a Writer constructor to the Transform interface.
+type TransformFunc func(next sink.Writer) sink.Writer
+
+// Wrap calls f.
+func (f TransformFunc) Wrap(next sink.Writer) sink.Writer {
+	return f(next)
+}
+
+// Sink receives the transformed batches: an output format or a database table.
+type Sink = sink.Writer
+
+// Pipeline connects a Source to a Sink through Transforms.
+type Pipeline struct {
+	Source Source
+
+	// Transforms are applied in order: the first one sees the batches of the source.
+	Transforms []Transform
+
+	Sink Sink
+
+	// OnBatch, when set, is called with every batch of the source before it is
+	// transformed, numbered from 0.
+	OnBatch func(n int, rec arrow.Record)
+}
+
+// Stats describes a run of a Pipeline.
+type Stats struct {
+	Batches int
+	Rows    int64 // rows read from the source
+	Bytes   int64 // size of the Arrow buffers read from the source
+	Elapsed time.Duration
+
+	// Stopped is set when a transform needed no more batches (sink.ErrStop), such as
+	// a row limit, and the source was closed before its end.
+	Stopped bool
+}
+
+// Run streams the batches of the source through the transforms into the sink, and then
+// flushes what the transforms held back, such as an aggregate. When ctx is cancelled
+// the batches read so far are flushed as well, and ctx's error is returned. Run does not
+// close the sink.
+func (p *Pipeline) Run(ctx context.Context) (stats Stats, err error) {
+	w := p.Sink
+	for i := len(p.Transforms) - 1; i >= 0; i-- {
+		w = p.Transforms[i].Wrap(w)
+	}
+
+	ctx, span := tracer.Start(ctx, "pipeline")
+	defer func() {
+		span.SetAttributes(attribute.Int("batches", stats.Batches), attribute.Int64("rows", stats.Rows), attribute.Int64("bytes", stats.Bytes))
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	start := time.Now()
+	err = p.Source.Records(ctx, func(rec arrow.Record) error {
+		if p.OnBatch != nil {
+			p.OnBatch(stats.Batches, rec)
+		}
+		_, ws := tracer.Start(ctx, "write", trace.WithAttributes(attribute.Int("batch", stats.Batches), attribute.Int64("rows", rec.NumRows())))
+		stats.Batches++
+		stats.Rows += rec.NumRows()
+		stats.Bytes += arrowfetch.RecordSize(rec)
+		err := w.Write(rec)
+		if err != nil && !errors.Is(err, sink.ErrStop) {
+			ws.RecordError(err)
+			ws.SetStatus(codes.Error, err.Error())
+		}
+		ws.End()
+		return err
+	})
+	stats.Elapsed = time.Since(start)
+
+	if errors.Is(err, sink.ErrStop) {
+		stats.Stopped, err = true, nil
+	}
+	switch {
+	case ctx.Err() != nil:
+		// An interrupted run keeps what was read: flush it and report the cancellation.
+		if ferr := sink.Flush(w); ferr != nil {
+			return stats, ferr
+		}
+		return stats, context.Cause(ctx)
+	case err != nil:
+		return stats, err
+	}
+	return stats, sink.Flush(w)
+}
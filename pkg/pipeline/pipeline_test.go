@@ -0,0 +1,96 @@
+package pipeline_test
+
+import (
+	"context"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+	"dbx_arrow_dbsql/pkg/pipeline"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// collector is a sink counting the rows and batches written to it.
+type collector struct {
+	batches int
+	rows    int64
+	closed  bool
+}
+
+func (c *collector) Write(rec arrow.Record) error {
+	c.batches++
+	c.rows += rec.NumRows()
+	return nil
+}
+
+func (c *collector) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRun(t *testing.T) {
+	recs := arrowfetchtest.Batches(4, 10)
+	defer func() {
+		for _, rec := range recs {
+			rec.Release()
+		}
+	}()
+	client, err := arrowfetchtest.NewClient(arrowfetchtest.Static(recs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	tests := []struct {
+		name       string
+		transforms []pipeline.Transform
+		rows       int64 // rows reaching the sink
+		read       int64 // rows read from the source
+		stopped    bool
+	}{
+		{name: "all", rows: 40, read: 40},
+		{name: "head", transforms: []pipeline.Transform{pipeline.Head(15)}, rows: 15, read: 20, stopped: true},
+		{name: "filter", transforms: []pipeline.Transform{pipeline.Filter("active")}, rows: 20, read: 40},
+		{name: "filter then head", transforms: []pipeline.Transform{pipeline.Filter("amount > 30"), pipeline.Head(5)}, rows: 5, read: 30, stopped: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := &collector{}
+			p := pipeline.Pipeline{Source: pipeline.Query(client, "select * from t"), Transforms: tt.transforms, Sink: out}
+			stats, err := p.Run(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if out.rows != tt.rows {
+				t.Errorf("sink got %d rows, want %d", out.rows, tt.rows)
+			}
+			if stats.Rows != tt.read || stats.Stopped != tt.stopped {
+				t.Errorf("stats: read %d rows, stopped %v; want %d, %v", stats.Rows, stats.Stopped, tt.read, tt.stopped)
+			}
+			if out.closed {
+				t.Error("Run closed the sink")
+			}
+		})
+	}
+}
+
+func TestRunCancelled(t *testing.T) {
+	recs := arrowfetchtest.Batches(2, 5)
+	defer func() {
+		for _, rec := range recs {
+			rec.Release()
+		}
+	}()
+	client, err := arrowfetchtest.NewClient(arrowfetchtest.Static(recs...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	p := pipeline.Pipeline{Source: pipeline.Query(client, "select 1"), Sink: &collector{}}
+	if _, err := p.Run(ctx); err != context.Canceled {
+		t.Fatalf("Run = %v, want %v", err, context.Canceled)
+	}
+}
@@ -0,0 +1,30 @@
+package pipeline
+
+import (
+	"context"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// Query returns a Source running query with client, binding args as in Client.Fetch.
+func Query(client *arrowfetch.Client, query string, args ...any) Source {
+	return SourceFunc(func(ctx context.Context, fn func(arrow.Record) error) error {
+		return client.Fetch(ctx, query, fn, args...)
+	})
+}
+
+// SessionQuery returns a Source running query on session, so it sees the session's state.
+func SessionQuery(session *arrowfetch.Session, query string, args ...any) Source {
+	return SourceFunc(func(ctx context.Context, fn func(arrow.Record) error) error {
+		return session.Fetch(ctx, query, fn, args...)
+	})
+}
+
+// Statement returns a Source reading the result of a statement submitted earlier.
+func Statement(client *arrowfetch.Client, id string) Source {
+	return SourceFunc(func(ctx context.Context, fn func(arrow.Record) error) error {
+		return client.FetchStatement(ctx, id, fn)
+	})
+}
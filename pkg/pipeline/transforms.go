@@ -0,0 +1,77 @@
+package pipeline
+
+import (
+	"io"
+
+	"dbx_arrow_dbsql/pkg/sink"
+)
+
+// Filter keeps the rows for which the expr expression is true (sink.FilterWriter).
+func Filter(expression string) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewFilterWriter(next, expression)
+	})
+}
+
+// Sample keeps each row with probability fraction (sink.SampleWriter).
+func Sample(fraction float64) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewSampleWriter(next, fraction)
+	})
+}
+
+// Head passes on the first n rows and then stops the source (sink.HeadWriter).
+func Head(n int64) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewHeadWriter(next, n)
+	})
+}
+
+// Aggregate reduces the rows to one per group (sink.AggregateWriter).
+func Aggregate(aggs []sink.Aggregation, groupBy []string) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewAggregateWriter(next, aggs, groupBy)
+	})
+}
+
+// PostSQL replaces the rows by the result of a DuckDB query over them (sink.PostSQLWriter).
+func PostSQL(query string) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewPostSQLWriter(next, query)
+	})
+}
+
+// Project keeps the given columns, in that order (sink.ProjectWriter).
+func Project(columns []string) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewProjectWriter(next, columns)
+	})
+}
+
+// Cast converts columns to other types as the rules say (sink.CastWriter).
+func Cast(rules []sink.CastRule) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewCastWriter(next, rules)
+	})
+}
+
+// TimeZone renders timestamps in the given time zone (sink.TimeZoneWriter).
+func TimeZone(zone string) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewTimeZoneWriter(next, zone)
+	})
+}
+
+// EncodeBinary writes binary columns as hex, base64 or raw text (sink.BinaryWriter).
+func EncodeBinary(encoding string) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewBinaryWriter(next, encoding)
+	})
+}
+
+// ColumnStats reports column statistics to report (sink.StatsWriter).
+func ColumnStats(report io.Writer, perBatch bool) Transform {
+	return TransformFunc(func(next sink.Writer) sink.Writer {
+		return sink.NewStatsWriter(next, report, perBatch)
+	})
+}
@@ -0,0 +1,5 @@
+// Package queryv1 holds the protocol buffer messages and the gRPC bindings of the
+// dbarrow.query.v1 QueryService defined in query.proto.
+package queryv1
+
+//go:generate protoc -I ../../.. --go_out=../../.. --go_opt=paths=source_relative pkg/queryservice/queryv1/query.proto
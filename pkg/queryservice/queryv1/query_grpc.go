@@ -0,0 +1,76 @@
+package queryv1
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+)
+
+// The gRPC bindings of QueryService, written against the generic stream types of
+// grpc-go rather than generated, since the service has a single method.
+
+// QueryService_ExecuteQuery_FullMethodName is the full gRPC name of ExecuteQuery.
+const QueryService_ExecuteQuery_FullMethodName = "/dbarrow.query.v1.QueryService/ExecuteQuery"
+
+// QueryServiceClient is the client API of QueryService.
+type QueryServiceClient interface {
+	// ExecuteQuery runs a query and streams its result as Arrow IPC chunks.
+	ExecuteQuery(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RecordBatchChunk], error)
+}
+
+type queryServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+// NewQueryServiceClient returns a QueryServiceClient calling the service over cc.
+func NewQueryServiceClient(cc grpc.ClientConnInterface) QueryServiceClient {
+	return &queryServiceClient{cc}
+}
+
+func (c *queryServiceClient) ExecuteQuery(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[RecordBatchChunk], error) {
+	stream, err := c.cc.NewStream(ctx, &QueryService_ServiceDesc.Streams[0], QueryService_ExecuteQuery_FullMethodName, opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[QueryRequest, RecordBatchChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// QueryServiceServer is the server API of QueryService.
+type QueryServiceServer interface {
+	// ExecuteQuery runs a query and streams its result as Arrow IPC chunks.
+	ExecuteQuery(*QueryRequest, grpc.ServerStreamingServer[RecordBatchChunk]) error
+}
+
+// RegisterQueryServiceServer registers srv with s.
+func RegisterQueryServiceServer(s grpc.ServiceRegistrar, srv QueryServiceServer) {
+	s.RegisterService(&QueryService_ServiceDesc, srv)
+}
+
+func executeQueryHandler(srv any, stream grpc.ServerStream) error {
+	m := new(QueryRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(QueryServiceServer).ExecuteQuery(m, &grpc.GenericServerStream[QueryRequest, RecordBatchChunk]{ServerStream: stream})
+}
+
+// QueryService_ServiceDesc describes QueryService for grpc.ServiceRegistrar.
+var QueryService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "dbarrow.query.v1.QueryService",
+	HandlerType: (*QueryServiceServer)(nil),
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "ExecuteQuery",
+			Handler:       executeQueryHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "pkg/queryservice/queryv1/query.proto",
+}
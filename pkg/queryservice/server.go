@@ -0,0 +1,163 @@
+// Package queryservice implements the gRPC QueryService of package queryv1: it runs
+// queries with an arrowfetch.Client and streams their results to the caller as Arrow
+// IPC, one record batch per message, as the batches are fetched.
+package queryservice
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+	"dbx_arrow_dbsql/pkg/queryservice/queryv1"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	dbsql "github.com/databricks/databricks-sql-go"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Server implements queryv1.QueryServiceServer.
+type Server struct {
+	client *arrowfetch.Client
+}
+
+var _ queryv1.QueryServiceServer = (*Server)(nil)
+
+// New returns a Server running the queries of its callers with client.
+func New(client *arrowfetch.Client) *Server {
+	return &Server{client: client}
+}
+
+// Serve listens on addr, e.g. localhost:9090, and serves srv until ctx is done. The
+// listener is opened before Serve blocks, so a busy port fails at once.
+func Serve(ctx context.Context, addr string, srv *Server, opts ...grpc.ServerOption) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	s := grpc.NewServer(opts...)
+	queryv1.RegisterQueryServiceServer(s, srv)
+	go func() {
+		<-ctx.Done()
+		s.GracefulStop()
+	}()
+	return s.Serve(lis)
+}
+
+// ExecuteQuery runs the query of req and sends its result as chunks of one Arrow IPC
+// stream. The query runs in the context of the call, so the caller's deadline and
+// cancellation apply to it.
+func (s *Server) ExecuteQuery(req *queryv1.QueryRequest, stream grpc.ServerStreamingServer[queryv1.RecordBatchChunk]) error {
+	query := strings.TrimSpace(req.GetQuery())
+	if query == "" {
+		return status.Error(codes.InvalidArgument, "empty query")
+	}
+	if req.GetMaxRows() < 0 {
+		return status.Error(codes.InvalidArgument, "max_rows must not be negative")
+	}
+	args, err := parameters(req.GetParameters())
+	if err != nil {
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	ctx := stream.Context()
+	w := &chunkWriter{stream: stream}
+	w.ipc = sink.NewIPCStreamWriter(&w.buf)
+	p := pipeline.Pipeline{Source: pipeline.Query(s.client, query, args...), Sink: w}
+	if req.GetMaxRows() > 0 {
+		p.Transforms = []pipeline.Transform{pipeline.Head(req.GetMaxRows())}
+	}
+	if _, err := p.Run(ctx); err != nil {
+		return toStatus(err)
+	}
+	if w.chunks == 0 {
+		// An empty result still sends its schema, described by the warehouse.
+		schema, err := s.client.Schema(ctx, query, args...)
+		if err != nil {
+			return toStatus(err)
+		}
+		if err := ipc.NewWriter(&w.buf, ipc.WithSchema(schema)).Close(); err != nil {
+			return toStatus(err)
+		}
+		return w.send(0)
+	}
+	return w.Close()
+}
+
+// parameters converts the request parameters to dbsql.Parameter arguments.
+func parameters(params []*queryv1.Parameter) ([]any, error) {
+	args := make([]any, len(params))
+	for i, p := range params {
+		param := dbsql.Parameter{Name: p.GetName(), Value: p.GetValue()}
+		if p.GetType() != "" {
+			t, ok := arrowfetch.ParameterType(p.GetType())
+			if !ok {
+				return nil, fmt.Errorf("unsupported parameter type %q", p.GetType())
+			}
+			param.Type = t
+		}
+		if i > 0 && (params[0].GetName() == "") != (p.GetName() == "") {
+			return nil, errors.New("named and positional parameters cannot be mixed")
+		}
+		args[i] = param
+	}
+	return args, nil
+}
+
+// chunkWriter is a sink sending each batch, encoded as the next messages of an Arrow
+// IPC stream, as one RecordBatchChunk.
+type chunkWriter struct {
+	stream grpc.ServerStreamingServer[queryv1.RecordBatchChunk]
+	ipc    *sink.IPCStreamWriter
+	buf    bytes.Buffer
+	chunks int
+}
+
+func (w *chunkWriter) Write(rec arrow.Record) error {
+	if err := w.ipc.Write(rec); err != nil {
+		return err
+	}
+	return w.send(rec.NumRows())
+}
+
+// Close sends the end-of-stream marker as the last chunk.
+func (w *chunkWriter) Close() error {
+	if err := w.ipc.Close(); err != nil {
+		return err
+	}
+	return w.send(0)
+}
+
+// send sends what was encoded since the last chunk. The message is marshalled before
+// Send returns, so the buffer can be reused.
+func (w *chunkWriter) send(rows int64) error {
+	if w.buf.Len() == 0 {
+		return nil
+	}
+	err := w.stream.Send(&queryv1.RecordBatchChunk{Data: w.buf.Bytes(), Rows: rows})
+	w.buf.Reset()
+	w.chunks++
+	return err
+}
+
+// toStatus maps a query error to the gRPC status the caller sees.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, arrowfetch.ErrQueryTimeout), errors.Is(err, arrowfetch.ErrFetchTimeout):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,67 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+)
+
+// azureBlobURL converts an abfss:// or https:// blob URL into the blob endpoint URL.
+// ADLS Gen2 paths (abfss://container@account.dfs.core.windows.net/path) are written
+// through the Blob API of the same account, which hierarchical namespace accounts also serve.
+func azureBlobURL(u *url.URL) (string, error) {
+	switch u.Scheme {
+	case "abfss":
+		account, ok := strings.CutSuffix(u.Host, ".dfs.core.windows.net")
+		if !ok || u.User == nil || u.User.Username() == "" {
+			return "", errors.New("abfss URL must look like abfss://container@account.dfs.core.windows.net/path")
+		}
+		return (&url.URL{
+			Scheme: "https",
+			Host:   account + ".blob.core.windows.net",
+			Path:   "/" + u.User.Username() + u.Path,
+		}).String(), nil
+	case "https":
+		if !strings.HasSuffix(u.Host, ".blob.core.windows.net") {
+			return "", fmt.Errorf("unsupported https destination %s; only Azure Blob URLs are supported", u.Host)
+		}
+		if _, blob, _ := strings.Cut(strings.TrimPrefix(u.Path, "/"), "/"); blob == "" {
+			return "", errors.New("output URL must name an Azure container and a blob path")
+		}
+		return u.String(), nil
+	}
+	return "", fmt.Errorf("unsupported output URL scheme %q", u.Scheme)
+}
+
+// createAzure streams the blob to Azure Storage as staged blocks that are committed on Close.
+// Credentials come from DefaultAzureCredential (environment, workload or managed identity, az login).
+func createAzure(ctx context.Context, u *url.URL, opts Options) (*Upload, error) {
+	blobURL, err := azureBlobURL(u)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := azidentity.NewDefaultAzureCredential(nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load Azure credentials: %w", err)
+	}
+	client, err := blockblob.NewClient(blobURL, cred, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create Azure Blob client: %w", err)
+	}
+
+	return startUpload(ctx, func(ctx context.Context, r io.Reader) error {
+		// Blocks that are never committed are discarded by the service, so an
+		// aborted upload does not leave a partial blob behind.
+		_, err := client.UploadStream(ctx, r, &blockblob.UploadStreamOptions{
+			BlockSize:   opts.PartSize,
+			Concurrency: opts.Concurrency,
+		})
+		return err
+	}), nil
+}
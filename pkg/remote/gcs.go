@@ -0,0 +1,34 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"cloud.google.com/go/storage"
+)
+
+// createGCS streams the object to Google Cloud Storage using a resumable upload.
+// Credentials come from Application Default Credentials (GOOGLE_APPLICATION_CREDENTIALS,
+// gcloud auth application-default login, or the metadata server).
+func createGCS(ctx context.Context, bucket, key string, opts Options) (*Upload, error) {
+	client, err := storage.NewClient(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create GCS client: %w", err)
+	}
+
+	return startUpload(ctx, func(ctx context.Context, r io.Reader) error {
+		defer client.Close()
+
+		// Each chunk is sent as one request of the resumable session and retried on
+		// transient errors; the session is abandoned if ctx is canceled before Close.
+		w := client.Bucket(bucket).Object(key).NewWriter(ctx)
+		if opts.PartSize > 0 {
+			w.ChunkSize = int(opts.PartSize)
+		}
+		if _, err := io.Copy(w, r); err != nil {
+			return err
+		}
+		return w.Close()
+	}), nil
+}
@@ -0,0 +1,92 @@
+// Package remote streams output files to object stores as they are written.
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+)
+
+// IsRemote reports whether path names an object store location such as s3://bucket/key.
+func IsRemote(path string) bool {
+	scheme, _, ok := strings.Cut(path, "://")
+	return ok && scheme != "" && !strings.ContainsAny(scheme, `/\`)
+}
+
+// Options tunes how uploads are split into parts.
+type Options struct {
+	// PartSize is the size in bytes of each uploaded part or chunk; 0 uses the store's default.
+	PartSize int64
+
+	// Concurrency is the number of parts uploaded in parallel where the store supports it; 0 uses the default.
+	Concurrency int
+}
+
+// Create opens an object for writing at the given URL. Data is uploaded while it is written;
+// Close waits for the upload to finish and Abort discards it.
+func Create(ctx context.Context, rawURL string, opts Options) (*Upload, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid output URL: %w", err)
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" {
+		return nil, fmt.Errorf("output URL %s must name a bucket and an object key", rawURL)
+	}
+	switch u.Scheme {
+	case "s3":
+		return createS3(ctx, u.Host, key, opts)
+	case "gs":
+		return createGCS(ctx, u.Host, key, opts)
+	case "abfss", "https":
+		return createAzure(ctx, u, opts)
+	default:
+		return nil, fmt.Errorf("unsupported output URL scheme %q", u.Scheme)
+	}
+}
+
+// Upload is an io.WriteCloser that feeds the bytes written to it to an upload running
+// in the background, so results never have to be buffered on local disk.
+type Upload struct {
+	pw     *io.PipeWriter
+	done   chan error
+	cancel context.CancelFunc
+}
+
+// startUpload runs upload in a goroutine, giving it a reader over everything written to the Upload.
+func startUpload(ctx context.Context, upload func(ctx context.Context, r io.Reader) error) *Upload {
+	ctx, cancel := context.WithCancel(ctx)
+	pr, pw := io.Pipe()
+	u := &Upload{pw: pw, done: make(chan error, 1), cancel: cancel}
+	go func() {
+		err := upload(ctx, pr)
+		// Unblock any pending Write if the upload stopped reading early.
+		pr.CloseWithError(err)
+		u.done <- err
+	}()
+	return u
+}
+
+// Write passes p on to the upload.
+func (u *Upload) Write(p []byte) (int, error) {
+	return u.pw.Write(p)
+}
+
+// Close marks the end of the data and waits for the upload to complete.
+func (u *Upload) Close() error {
+	defer u.cancel()
+	u.pw.Close()
+	if err := <-u.done; err != nil {
+		return fmt.Errorf("upload failed: %w", err)
+	}
+	return nil
+}
+
+// Abort stops the upload without completing the object, so no partial file is left behind.
+func (u *Upload) Abort(err error) {
+	u.cancel()
+	u.pw.CloseWithError(err)
+	<-u.done
+}
@@ -0,0 +1,40 @@
+package remote
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// createS3 streams the object to S3 using a multipart upload.
+// Credentials and region come from the standard AWS chain (environment, shared config, SSO, instance role).
+func createS3(ctx context.Context, bucket, key string, opts Options) (*Upload, error) {
+	cfg, err := config.LoadDefaultConfig(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to load AWS configuration: %w", err)
+	}
+	uploader := manager.NewUploader(s3.NewFromConfig(cfg), func(u *manager.Uploader) {
+		if opts.PartSize > 0 {
+			u.PartSize = opts.PartSize
+		}
+		if opts.Concurrency > 0 {
+			u.Concurrency = opts.Concurrency
+		}
+	})
+
+	return startUpload(ctx, func(ctx context.Context, r io.Reader) error {
+		// The uploader sends each part (5 MiB by default) as soon as it is filled and aborts
+		// the multipart upload if the reader fails.
+		_, err := uploader.Upload(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(key),
+			Body:   r,
+		})
+		return err
+	}), nil
+}
@@ -0,0 +1,536 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"regexp"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/decimal128"
+	"github.com/apache/arrow/go/v12/arrow/decimal256"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// Aggregation is one aggregate of an --aggregate specification, e.g. sum(fare_amount).
+type Aggregation struct {
+	Func   string // count, sum, avg, min or max
+	Column string // source column, empty for count(*)
+	Name   string // name of the output column
+}
+
+var (
+	groupByPattern     = regexp.MustCompile(`(?i)\s+group\s+by\s+`)
+	aggregationPattern = regexp.MustCompile(`(?i)^(count|sum|avg|min|max)\s*\(\s*(\*|[^()]+?)\s*\)(?:\s+as\s+(\S+))?$`)
+)
+
+// ParseAggregate parses a specification such as
+// "sum(fare_amount), count(*) AS trips group by pickup_zip" into its aggregations and
+// grouping columns.
+func ParseAggregate(spec string) ([]Aggregation, []string, error) {
+	parts := groupByPattern.Split(strings.TrimSpace(spec), 2)
+
+	var aggs []Aggregation
+	for _, item := range strings.Split(parts[0], ",") {
+		item = strings.TrimSpace(item)
+		m := aggregationPattern.FindStringSubmatch(item)
+		if m == nil {
+			return nil, nil, fmt.Errorf("invalid aggregation %q, expected count, sum, avg, min or max of a column", item)
+		}
+		a := Aggregation{Func: strings.ToLower(m[1]), Column: m[2], Name: m[3]}
+		if a.Column == "*" {
+			if a.Func != "count" {
+				return nil, nil, fmt.Errorf("%s(*) is not supported, only count(*)", a.Func)
+			}
+			a.Column = ""
+		}
+		if a.Name == "" {
+			a.Name = item
+		}
+		aggs = append(aggs, a)
+	}
+
+	var groupBy []string
+	if len(parts) == 2 {
+		for _, col := range strings.Split(parts[1], ",") {
+			if col = strings.TrimSpace(col); col == "" {
+				return nil, nil, errors.New("empty column in group by")
+			}
+			groupBy = append(groupBy, col)
+		}
+	}
+	return aggs, groupBy, nil
+}
+
+// AggregateWriter computes aggregations over all the records written to it, grouped by
+// the values of some columns, and writes a single result record to the wrapped Writer
+// when it is flushed. Only the groups and their running totals are kept in memory.
+// The compute package of Arrow Go v12 has no aggregation kernels, hashed or not, so the
+// totals are accumulated row by row.
+type AggregateWriter struct {
+	w       Writer
+	aggs    []Aggregation
+	groupBy []string
+
+	schema  *arrow.Schema // schema of the input, fixed by the first record
+	aggCols []int         // input column of each aggregation, -1 for count(*)
+	keyCols []int         // input columns of the group keys
+
+	groups  map[string]int  // group key to group number, in order of first appearance
+	keys    [][]arrow.Array // per key column: concatenated key values and the pending ones
+	totals  [][]accumulator // per group: one accumulator per aggregation
+	flushed bool
+}
+
+// NewAggregateWriter returns a Writer that aggregates its input and writes the result to w.
+func NewAggregateWriter(w Writer, aggs []Aggregation, groupBy []string) *AggregateWriter {
+	return &AggregateWriter{w: w, aggs: aggs, groupBy: groupBy, groups: map[string]int{}}
+}
+
+// Write adds the rows of rec to the running totals.
+func (a *AggregateWriter) Write(rec arrow.Record) error {
+	if a.schema == nil {
+		if err := a.resolve(rec.Schema()); err != nil {
+			return err
+		}
+	} else if !a.schema.Equal(rec.Schema()) {
+		return errors.New("aggregate: the schema changed between batches")
+	}
+
+	groupsBefore := len(a.totals)
+	var key strings.Builder
+	for i := 0; i < int(rec.NumRows()); i++ {
+		key.Reset()
+		for _, c := range a.keyCols {
+			col := rec.Column(c)
+			if col.IsNull(i) {
+				key.WriteString("\x01")
+			} else {
+				key.WriteString("\x02")
+				key.WriteString(TextValue(col, i))
+			}
+			key.WriteString("\x00")
+		}
+		g, ok := a.groups[key.String()]
+		if !ok {
+			g = len(a.totals)
+			a.groups[key.String()] = g
+			a.totals = append(a.totals, make([]accumulator, len(a.aggs)))
+			for k, c := range a.keyCols {
+				a.keys[k] = append(a.keys[k], array.NewSlice(rec.Column(c), int64(i), int64(i+1)))
+			}
+		}
+		for j, c := range a.aggCols {
+			if c < 0 {
+				a.totals[g][j].count++
+				continue
+			}
+			a.totals[g][j].add(rec.Column(c), i)
+		}
+	}
+
+	// Copy the key values of new groups so the batch can be released.
+	if len(a.totals) > groupsBefore {
+		for k, arrs := range a.keys {
+			merged, err := array.Concatenate(arrs, memory.DefaultAllocator)
+			if err != nil {
+				return err
+			}
+			for _, arr := range arrs {
+				arr.Release()
+			}
+			a.keys[k] = []arrow.Array{merged}
+		}
+	}
+	return nil
+}
+
+// Flush writes the aggregated result to the wrapped Writer, once, and flushes it.
+func (a *AggregateWriter) Flush() error {
+	if !a.flushed && a.schema != nil {
+		a.flushed = true
+		if err := a.writeResult(); err != nil {
+			return err
+		}
+	}
+	return Flush(a.w)
+}
+
+// writeResult builds the record of the groups and their aggregates and writes it.
+func (a *AggregateWriter) writeResult() error {
+	fields := make([]arrow.Field, 0, len(a.keyCols)+len(a.aggs))
+	cols := make([]arrow.Array, 0, cap(fields))
+	for k, c := range a.keyCols {
+		fields = append(fields, a.schema.Field(c))
+		if len(a.keys[k]) == 0 {
+			// No rows at all: the key columns are empty.
+			a.keys[k] = []arrow.Array{array.MakeArrayOfNull(memory.DefaultAllocator, a.schema.Field(c).Type, 0)}
+		}
+		cols = append(cols, a.keys[k][0])
+	}
+	// count(*) without group by still yields one row when there was no input.
+	if len(a.keyCols) == 0 && len(a.totals) == 0 {
+		a.totals = append(a.totals, make([]accumulator, len(a.aggs)))
+	}
+	for j, agg := range a.aggs {
+		field, col, err := a.result(j, agg)
+		if err != nil {
+			return err
+		}
+		defer col.Release()
+		fields = append(fields, field)
+		cols = append(cols, col)
+	}
+	rec := array.NewRecord(arrow.NewSchema(fields, nil), cols, int64(len(a.totals)))
+	defer rec.Release()
+	return a.w.Write(rec)
+}
+
+// Close flushes the result and closes the wrapped Writer.
+func (a *AggregateWriter) Close() error {
+	err := a.Flush()
+	for _, arrs := range a.keys {
+		for _, arr := range arrs {
+			arr.Release()
+		}
+	}
+	a.keys = nil
+	if cerr := a.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// resolve finds the input columns of the aggregations and of the group keys.
+func (a *AggregateWriter) resolve(schema *arrow.Schema) error {
+	a.aggCols = make([]int, len(a.aggs))
+	for j, agg := range a.aggs {
+		if agg.Column == "" {
+			a.aggCols[j] = -1
+			continue
+		}
+		c := columnIndex(schema, agg.Column)
+		if c < 0 {
+			return fmt.Errorf("aggregate: column %q not found", agg.Column)
+		}
+		numeric := isNumeric(schema.Field(c).Type)
+		if (agg.Func == "sum" || agg.Func == "avg") && !numeric {
+			return fmt.Errorf("aggregate: %s needs a numeric column, %s is %s", agg.Func, agg.Column, schema.Field(c).Type)
+		}
+		if (agg.Func == "min" || agg.Func == "max") && !numeric && !isString(schema.Field(c).Type) {
+			return fmt.Errorf("aggregate: %s supports numeric and string columns, %s is %s", agg.Func, agg.Column, schema.Field(c).Type)
+		}
+		a.aggCols[j] = c
+	}
+	a.keyCols = make([]int, len(a.groupBy))
+	for k, name := range a.groupBy {
+		c := columnIndex(schema, name)
+		if c < 0 {
+			return fmt.Errorf("aggregate: group by column %q not found", name)
+		}
+		a.keyCols[k] = c
+	}
+	a.keys = make([][]arrow.Array, len(a.keyCols))
+	a.schema = schema
+	return nil
+}
+
+// result builds the output column of aggregation j. Counts are int64 and averages
+// float64. Sums and the min and max of numbers are exact: sums of integers are int64
+// and sums of decimals decimals with 10 more digits, as in Databricks SQL; min and max
+// keep the type of decimal, string and UINT64 columns, int64 for other integers and
+// float64 for floating point.
+func (a *AggregateWriter) result(j int, agg Aggregation) (arrow.Field, arrow.Array, error) {
+	mem := memory.DefaultAllocator
+	field := arrow.Field{Name: agg.Name, Nullable: true}
+	if agg.Func == "count" {
+		field.Type, field.Nullable = arrow.PrimitiveTypes.Int64, false
+		b := array.NewInt64Builder(mem)
+		defer b.Release()
+		for _, t := range a.totals {
+			b.Append(t[j].count)
+		}
+		return field, b.NewArray(), nil
+	}
+
+	dt := a.schema.Field(a.aggCols[j]).Type
+	kind := kindOf(dt)
+	switch {
+	case agg.Func == "avg":
+		field.Type = arrow.PrimitiveTypes.Float64
+	case kind == floatKind:
+		field.Type = arrow.PrimitiveTypes.Float64
+	case kind == stringKind:
+		field.Type = arrow.BinaryTypes.String
+	case kind == intKind || agg.Func == "sum" && kind == uintKind:
+		field.Type = arrow.PrimitiveTypes.Int64
+	case kind == uintKind:
+		field.Type = arrow.PrimitiveTypes.Uint64
+	case agg.Func == "sum":
+		field.Type = sumDecimalType(dt)
+	default:
+		field.Type = dt
+	}
+
+	b := array.NewBuilder(mem, field.Type)
+	defer b.Release()
+	for _, t := range a.totals {
+		if t[j].count == 0 {
+			b.AppendNull()
+			continue
+		}
+		if err := t[j].appendResult(b, agg.Func, kind); err != nil {
+			return field, nil, fmt.Errorf("aggregate: %s: %w", agg.Name, err)
+		}
+	}
+	return field, b.NewArray(), nil
+}
+
+// sumDecimalType returns the type of the sum of a decimal column: 10 more digits of
+// precision, as far as the decimal width allows.
+func sumDecimalType(dt arrow.DataType) arrow.DataType {
+	if d, ok := dt.(*arrow.Decimal256Type); ok {
+		return &arrow.Decimal256Type{Precision: min(d.Precision+10, 76), Scale: d.Scale}
+	}
+	d := dt.(*arrow.Decimal128Type)
+	return &arrow.Decimal128Type{Precision: min(d.Precision+10, 38), Scale: d.Scale}
+}
+
+// valueKind is how the values of an aggregated column are accumulated.
+type valueKind int
+
+const (
+	floatKind   valueKind = iota // floating point, as float64
+	intKind                      // signed integers and unsigned ones up to UINT32, as int64
+	uintKind                     // UINT64, as uint64
+	decimalKind                  // decimals, as unscaled big integers
+	stringKind
+)
+
+// kindOf returns the kind of values of type dt.
+func kindOf(dt arrow.DataType) valueKind {
+	switch dt.ID() {
+	case arrow.UINT64:
+		return uintKind
+	case arrow.DECIMAL128, arrow.DECIMAL256:
+		return decimalKind
+	case arrow.STRING, arrow.LARGE_STRING:
+		return stringKind
+	}
+	if isInteger(dt) {
+		return intKind
+	}
+	return floatKind
+}
+
+// accumulator holds the running totals of one aggregation for one group.
+// Nulls are skipped, as in SQL, so count is the number of non-null values. Integers and
+// decimals are also kept exactly, in the fields of their kind, since float64 cannot
+// hold every BIGINT above 2^53; sum always runs in float64 as well, for avg.
+type accumulator struct {
+	count         int64
+	sum, min, max float64
+
+	isum, imin, imax int64
+	overflow         bool // isum overflowed
+	umin, umax       uint64
+	dsum, dmin, dmax *big.Int
+
+	minStr, maxStr string
+}
+
+// add includes the value at row i of col.
+func (t *accumulator) add(col arrow.Array, i int) {
+	if col.IsNull(i) {
+		return
+	}
+	first := t.count == 0
+	t.count++
+	switch kindOf(col.DataType()) {
+	case stringKind:
+		s := TextValue(col, i)
+		if first || s < t.minStr {
+			t.minStr = s
+		}
+		if first || s > t.maxStr {
+			t.maxStr = s
+		}
+		return
+	case intKind:
+		v := intValue(col, i)
+		if first || v < t.imin {
+			t.imin = v
+		}
+		if first || v > t.imax {
+			t.imax = v
+		}
+		t.addInt(v, true)
+		t.sum += float64(v)
+	case uintKind:
+		v := col.(*array.Uint64).Value(i)
+		if first || v < t.umin {
+			t.umin = v
+		}
+		if first || v > t.umax {
+			t.umax = v
+		}
+		t.addInt(int64(v), v <= math.MaxInt64)
+		t.sum += float64(v)
+	case decimalKind:
+		v := decimalValue(col, i)
+		if first {
+			t.dsum, t.dmin, t.dmax = new(big.Int), v, v
+		}
+		if v.Cmp(t.dmin) < 0 {
+			t.dmin = v
+		}
+		if v.Cmp(t.dmax) > 0 {
+			t.dmax = v
+		}
+		t.dsum.Add(t.dsum, v)
+		t.sum += exprValue(col, i).(float64)
+	default:
+		v := floatValue(col, i)
+		if first || v < t.min {
+			t.min = v
+		}
+		if first || v > t.max {
+			t.max = v
+		}
+		t.sum += v
+	}
+}
+
+// addInt adds v to the integer sum. ok is false for a value that does not fit in an
+// int64, which overflows the sum like a sum beyond the int64 range.
+func (t *accumulator) addInt(v int64, ok bool) {
+	sum := t.isum + v
+	if !ok || (v > 0 && sum < t.isum) || (v < 0 && sum > t.isum) {
+		t.overflow = true
+	}
+	t.isum = sum
+}
+
+// appendResult appends the result of fn over the values added so far to b, a builder
+// of the type chosen by result.
+func (t *accumulator) appendResult(b array.Builder, fn string, kind valueKind) error {
+	if fn == "avg" {
+		b.(*array.Float64Builder).Append(t.sum / float64(t.count))
+		return nil
+	}
+	isMin := fn == "min"
+	switch kind {
+	case stringKind:
+		b.(*array.StringBuilder).Append(pick(isMin, t.minStr, t.maxStr))
+	case intKind, uintKind:
+		switch {
+		case fn == "sum" && t.overflow:
+			return errors.New("the sum overflows BIGINT")
+		case fn == "sum":
+			b.(*array.Int64Builder).Append(t.isum)
+		case kind == intKind:
+			b.(*array.Int64Builder).Append(pick(isMin, t.imin, t.imax))
+		default:
+			b.(*array.Uint64Builder).Append(pick(isMin, t.umin, t.umax))
+		}
+	case decimalKind:
+		v := t.dsum
+		if fn != "sum" {
+			v = pick(isMin, t.dmin, t.dmax)
+		}
+		return appendDecimal(b, v)
+	default:
+		b.(*array.Float64Builder).Append(pick(fn == "sum", t.sum, pick(isMin, t.min, t.max)))
+	}
+	return nil
+}
+
+// pick returns a if cond holds and b otherwise.
+func pick[T any](cond bool, a, b T) T {
+	if cond {
+		return a
+	}
+	return b
+}
+
+// intValue returns the value at row i of an integer column other than UINT64.
+func intValue(col arrow.Array, i int) int64 {
+	switch col := col.(type) {
+	case *array.Int8:
+		return int64(col.Value(i))
+	case *array.Int16:
+		return int64(col.Value(i))
+	case *array.Int32:
+		return int64(col.Value(i))
+	case *array.Int64:
+		return col.Value(i)
+	case *array.Uint8:
+		return int64(col.Value(i))
+	case *array.Uint16:
+		return int64(col.Value(i))
+	case *array.Uint32:
+		return int64(col.Value(i))
+	}
+	return 0
+}
+
+// floatValue returns the value at row i of a floating point column.
+func floatValue(col arrow.Array, i int) float64 {
+	switch col := col.(type) {
+	case *array.Float16:
+		return float64(col.Value(i).Float32())
+	case *array.Float32:
+		return float64(col.Value(i))
+	case *array.Float64:
+		return col.Value(i)
+	}
+	return 0
+}
+
+// decimalValue returns the unscaled value at row i of a decimal column.
+func decimalValue(col arrow.Array, i int) *big.Int {
+	if col, ok := col.(*array.Decimal256); ok {
+		return col.Value(i).BigInt()
+	}
+	return col.(*array.Decimal128).Value(i).BigInt()
+}
+
+// appendDecimal appends the unscaled value v to a decimal builder, failing when it has
+// more digits than the precision of the builder's type.
+func appendDecimal(b array.Builder, v *big.Int) error {
+	switch b := b.(type) {
+	case *array.Decimal128Builder:
+		if new(big.Int).Abs(v).Cmp(pow10(b.Type().(*arrow.Decimal128Type).Precision)) >= 0 {
+			return errors.New("the sum overflows the precision of DECIMAL(38)")
+		}
+		b.Append(decimal128.FromBigInt(v))
+	case *array.Decimal256Builder:
+		if new(big.Int).Abs(v).Cmp(pow10(b.Type().(*arrow.Decimal256Type).Precision)) >= 0 {
+			return errors.New("the sum overflows the precision of DECIMAL(76)")
+		}
+		b.Append(decimal256.FromBigInt(v))
+	}
+	return nil
+}
+
+// pow10 returns 10^n.
+func pow10(n int32) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
+
+// isInteger reports whether dt is a signed or unsigned integer type.
+func isInteger(dt arrow.DataType) bool {
+	switch dt.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return true
+	}
+	return false
+}
+
+// isString reports whether dt is a string type.
+func isString(dt arrow.DataType) bool {
+	return dt.ID() == arrow.STRING || dt.ID() == arrow.LARGE_STRING
+}
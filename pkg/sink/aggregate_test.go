@@ -0,0 +1,80 @@
+package sink
+
+import (
+	"testing"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/decimal128"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// captureWriter keeps the records written to it.
+type captureWriter struct{ recs []arrow.Record }
+
+func (c *captureWriter) Write(rec arrow.Record) error {
+	rec.Retain()
+	c.recs = append(c.recs, rec)
+	return nil
+}
+
+func (c *captureWriter) Close() error { return nil }
+
+func TestAggregateLargeIntegers(t *testing.T) {
+	mem := memory.DefaultAllocator
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "hash", Type: arrow.PrimitiveTypes.Uint64},
+		{Name: "amount", Type: &arrow.Decimal128Type{Precision: 38, Scale: 2}},
+	}, nil)
+	b := array.NewRecordBuilder(mem, schema)
+	defer b.Release()
+	// 2^53 + 1 and its neighbours cannot be told apart as float64.
+	b.Field(0).(*array.Int64Builder).AppendValues([]int64{1<<53 + 1, 1<<53 + 3, 1<<53 + 2}, nil)
+	b.Field(1).(*array.Uint64Builder).AppendValues([]uint64{1<<63 + 1, 5, 1<<63 + 7}, nil)
+	// 12345678901234567890.12 and friends have more digits than float64 keeps.
+	for _, v := range []string{"1234567890123456789012", "1", "-1234567890123456789011"} {
+		n, _ := decimal128.FromString(v, 38, 0)
+		b.Field(2).(*array.Decimal128Builder).Append(n)
+	}
+	rec := b.NewRecord()
+	defer rec.Release()
+
+	aggs, _, err := ParseAggregate("sum(id), min(id), max(id), min(hash), max(hash), sum(amount), max(amount)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out captureWriter
+	w := NewAggregateWriter(&out, aggs, nil)
+	if err := w.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	res := out.recs[0]
+	defer res.Release()
+	want := []string{
+		"27021597764222982", "9007199254740993", "9007199254740995",
+		"5", "9223372036854775815",
+		"0.02", "12345678901234567890.12",
+	}
+	for j, w := range want {
+		if got := TextValue(res.Column(j), 0); got != w {
+			t.Errorf("%s: got %s, want %s", aggs[j].Name, got, w)
+		}
+	}
+	if dt := res.Column(5).DataType().(*arrow.Decimal128Type); dt.Precision != 38 || dt.Scale != 2 {
+		t.Errorf("sum(amount) is %s, want decimal(38, 2)", dt)
+	}
+
+	// The sum of the UINT64 column does not fit in a BIGINT.
+	aggs, _, _ = ParseAggregate("sum(hash)")
+	w = NewAggregateWriter(&captureWriter{}, aggs, nil)
+	if err := w.Write(rec); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err == nil {
+		t.Error("sum(hash) succeeded, want an overflow error")
+	}
+}
@@ -0,0 +1,316 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/linkedin/goavro/v2"
+)
+
+// AvroOptions configures the Avro writer.
+type AvroOptions struct {
+	// Compression is the OCF block codec: snappy (the default), deflate or none.
+	Compression string
+
+	// RecordName is the name of the top-level Avro record. Defaults to "Row".
+	RecordName string
+}
+
+// AvroWriter streams batches into an Avro object container file (OCF).
+// The Avro schema is derived from the Arrow schema of the first batch.
+type AvroWriter struct {
+	w      io.Writer
+	opts   AvroOptions
+	ocf    *goavro.OCFWriter
+	fields []avroField
+}
+
+// avroField pairs an Arrow column with its Avro schema and value conversion.
+type avroField struct {
+	name string
+	typ  avroType
+}
+
+// avroType describes how one Arrow type is represented in Avro.
+type avroType struct {
+	// schema is the Avro type definition, ready to be marshalled as JSON.
+	schema interface{}
+
+	// branch is the goavro name of the type when it appears as a union member.
+	branch string
+
+	// nullable wraps the type in a ["null", type] union.
+	nullable bool
+
+	// value converts a non-null cell into goavro's native form.
+	value func(arr arrow.Array, i int) interface{}
+}
+
+// NewAvroWriter returns a Writer that encodes batches as an Avro OCF to w.
+func NewAvroWriter(w io.Writer, opts AvroOptions) (*AvroWriter, error) {
+	switch strings.ToLower(opts.Compression) {
+	case "", "snappy":
+		opts.Compression = goavro.CompressionSnappyLabel
+	case "deflate", "gzip":
+		opts.Compression = goavro.CompressionDeflateLabel
+	case "none", "null":
+		opts.Compression = goavro.CompressionNullLabel
+	default:
+		return nil, fmt.Errorf("avro: unsupported compression codec %q", opts.Compression)
+	}
+	if opts.RecordName == "" {
+		opts.RecordName = "Row"
+	}
+	// goavro tries to append to an existing container when handed an *os.File, so hide the concrete type.
+	return &AvroWriter{w: struct{ io.Writer }{w}, opts: opts}, nil
+}
+
+// Write appends the rows of the batch as one OCF block.
+func (a *AvroWriter) Write(rec arrow.Record) error {
+	if a.ocf == nil {
+		if err := a.start(rec.Schema()); err != nil {
+			return err
+		}
+	}
+
+	rows := make([]interface{}, rec.NumRows())
+	for i := range rows {
+		row := make(map[string]interface{}, len(a.fields))
+		for j, f := range a.fields {
+			row[f.name] = f.typ.datum(rec.Column(j), i)
+		}
+		rows[i] = row
+	}
+	if err := a.ocf.Append(rows); err != nil {
+		return fmt.Errorf("avro: %w", err)
+	}
+	return nil
+}
+
+// Close is a no-op; every batch is written as a complete block.
+func (a *AvroWriter) Close() error {
+	return nil
+}
+
+// start maps the Arrow schema to Avro and writes the container header.
+func (a *AvroWriter) start(schema *arrow.Schema) error {
+	fields, defs, err := avroFields(a.opts.RecordName, schema.Fields())
+	if err != nil {
+		return err
+	}
+	def, err := json.Marshal(avroRecordSchema(a.opts.RecordName, defs))
+	if err != nil {
+		return fmt.Errorf("avro: %w", err)
+	}
+
+	ocf, err := goavro.NewOCFWriter(goavro.OCFConfig{
+		W:               a.w,
+		Schema:          string(def),
+		CompressionName: a.opts.Compression,
+	})
+	if err != nil {
+		return fmt.Errorf("avro: %w", err)
+	}
+	a.ocf = ocf
+	a.fields = fields
+	return nil
+}
+
+// datum converts one cell, wrapping it in a union when the type is nullable.
+func (t avroType) datum(arr arrow.Array, i int) interface{} {
+	if arr.IsNull(i) {
+		return nil
+	}
+	v := t.value(arr, i)
+	if t.nullable {
+		return goavro.Union(t.branch, v)
+	}
+	return v
+}
+
+// fieldSchema returns the schema of the type as a record field or container item.
+func (t avroType) fieldSchema() interface{} {
+	if t.nullable {
+		return []interface{}{"null", t.schema}
+	}
+	return t.schema
+}
+
+// avroFields maps a list of Arrow fields to Avro record fields.
+// It returns the converters together with the field definitions of the schema.
+func avroFields(recordName string, fields []arrow.Field) ([]avroField, []interface{}, error) {
+	out := make([]avroField, len(fields))
+	defs := make([]interface{}, len(fields))
+	for i, f := range fields {
+		name := columnName(f.Name)
+		ft, err := avroTypeOf(recordName+"_"+name, f.Type)
+		if err != nil {
+			return nil, nil, fmt.Errorf("avro: field %s: %w", f.Name, err)
+		}
+		ft.nullable = f.Nullable
+		out[i] = avroField{name: name, typ: ft}
+
+		def := map[string]interface{}{"name": name, "type": ft.fieldSchema()}
+		if f.Nullable {
+			def["default"] = nil
+		}
+		defs[i] = def
+	}
+	return out, defs, nil
+}
+
+// avroRecordSchema builds the definition of a record type.
+func avroRecordSchema(name string, defs []interface{}) map[string]interface{} {
+	return map[string]interface{}{"type": "record", "name": name, "fields": defs}
+}
+
+// avroTypeOf maps an Arrow data type to its Avro representation.
+// name is used for the record types generated for nested structs.
+func avroTypeOf(name string, dt arrow.DataType) (avroType, error) {
+	switch dt := dt.(type) {
+	case *arrow.BooleanType:
+		return avroType{schema: "boolean", branch: "boolean", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Boolean).Value(i)
+		}}, nil
+	case *arrow.Int8Type:
+		return avroType{schema: "int", branch: "int", value: func(arr arrow.Array, i int) interface{} {
+			return int32(arr.(*array.Int8).Value(i))
+		}}, nil
+	case *arrow.Int16Type:
+		return avroType{schema: "int", branch: "int", value: func(arr arrow.Array, i int) interface{} {
+			return int32(arr.(*array.Int16).Value(i))
+		}}, nil
+	case *arrow.Int32Type:
+		return avroType{schema: "int", branch: "int", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Int32).Value(i)
+		}}, nil
+	case *arrow.Int64Type:
+		return avroType{schema: "long", branch: "long", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Int64).Value(i)
+		}}, nil
+	case *arrow.Uint8Type:
+		return avroType{schema: "int", branch: "int", value: func(arr arrow.Array, i int) interface{} {
+			return int32(arr.(*array.Uint8).Value(i))
+		}}, nil
+	case *arrow.Uint16Type:
+		return avroType{schema: "int", branch: "int", value: func(arr arrow.Array, i int) interface{} {
+			return int32(arr.(*array.Uint16).Value(i))
+		}}, nil
+	case *arrow.Uint32Type:
+		return avroType{schema: "long", branch: "long", value: func(arr arrow.Array, i int) interface{} {
+			return int64(arr.(*array.Uint32).Value(i))
+		}}, nil
+	case *arrow.Float32Type:
+		return avroType{schema: "float", branch: "float", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Float32).Value(i)
+		}}, nil
+	case *arrow.Float64Type:
+		return avroType{schema: "double", branch: "double", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Float64).Value(i)
+		}}, nil
+	case *arrow.StringType:
+		return avroType{schema: "string", branch: "string", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.String).Value(i)
+		}}, nil
+	case *arrow.LargeStringType:
+		return avroType{schema: "string", branch: "string", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.LargeString).Value(i)
+		}}, nil
+	case *arrow.BinaryType:
+		return avroType{schema: "bytes", branch: "bytes", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Binary).Value(i)
+		}}, nil
+	case *arrow.LargeBinaryType:
+		return avroType{schema: "bytes", branch: "bytes", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.LargeBinary).Value(i)
+		}}, nil
+	case *arrow.Date32Type:
+		return avroType{schema: map[string]interface{}{"type": "int", "logicalType": "date"}, branch: "int.date", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Date32).Value(i).ToTime()
+		}}, nil
+	case *arrow.Date64Type:
+		return avroType{schema: map[string]interface{}{"type": "int", "logicalType": "date"}, branch: "int.date", value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Date64).Value(i).ToTime()
+		}}, nil
+	case *arrow.TimestampType:
+		// Avro has no nanosecond timestamps, so everything finer than milliseconds is stored as micros.
+		logical := "timestamp-micros"
+		if dt.Unit == arrow.Second || dt.Unit == arrow.Millisecond {
+			logical = "timestamp-millis"
+		}
+		unit := dt.Unit
+		return avroType{schema: map[string]interface{}{"type": "long", "logicalType": logical}, branch: "long." + logical, value: func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Timestamp).Value(i).ToTime(unit)
+		}}, nil
+	case *arrow.Decimal128Type:
+		scale := dt.Scale
+		return avroType{schema: map[string]interface{}{"type": "bytes", "logicalType": "decimal", "precision": dt.Precision, "scale": dt.Scale}, branch: "bytes.decimal", value: func(arr arrow.Array, i int) interface{} {
+			return decimalRat(arr.(*array.Decimal128).Value(i).BigInt(), scale)
+		}}, nil
+	case *arrow.Decimal256Type:
+		scale := dt.Scale
+		return avroType{schema: map[string]interface{}{"type": "bytes", "logicalType": "decimal", "precision": dt.Precision, "scale": dt.Scale}, branch: "bytes.decimal", value: func(arr arrow.Array, i int) interface{} {
+			return decimalRat(arr.(*array.Decimal256).Value(i).BigInt(), scale)
+		}}, nil
+	case *arrow.ListType:
+		elem, err := avroTypeOf(name+"_item", dt.Elem())
+		if err != nil {
+			return avroType{}, err
+		}
+		elem.nullable = dt.ElemField().Nullable
+		return avroType{schema: map[string]interface{}{"type": "array", "items": elem.fieldSchema()}, branch: "array", value: func(arr arrow.Array, i int) interface{} {
+			list := arr.(*array.List)
+			start, end := list.ValueOffsets(i)
+			items := make([]interface{}, 0, end-start)
+			for j := start; j < end; j++ {
+				items = append(items, elem.datum(list.ListValues(), int(j)))
+			}
+			return items
+		}}, nil
+	case *arrow.MapType:
+		if _, ok := dt.KeyType().(*arrow.StringType); !ok {
+			return avroType{}, fmt.Errorf("map keys of type %s are not supported, Avro map keys are strings", dt.KeyType())
+		}
+		item, err := avroTypeOf(name+"_value", dt.ItemType())
+		if err != nil {
+			return avroType{}, err
+		}
+		item.nullable = dt.ItemField().Nullable
+		return avroType{schema: map[string]interface{}{"type": "map", "values": item.fieldSchema()}, branch: "map", value: func(arr arrow.Array, i int) interface{} {
+			m := arr.(*array.Map)
+			keys := m.Keys().(*array.String)
+			start, end := m.ValueOffsets(i)
+			out := make(map[string]interface{}, end-start)
+			for j := start; j < end; j++ {
+				out[keys.Value(int(j))] = item.datum(m.Items(), int(j))
+			}
+			return out
+		}}, nil
+	case *arrow.StructType:
+		fields, defs, err := avroFields(name, dt.Fields())
+		if err != nil {
+			return avroType{}, err
+		}
+		return avroType{schema: avroRecordSchema(name, defs), branch: name, value: func(arr arrow.Array, i int) interface{} {
+			st := arr.(*array.Struct)
+			row := make(map[string]interface{}, len(fields))
+			for j, f := range fields {
+				row[f.name] = f.typ.datum(st.Field(j), i)
+			}
+			return row
+		}}, nil
+	default:
+		return avroType{}, fmt.Errorf("unsupported arrow type %s", dt)
+	}
+}
+
+// decimalRat converts an unscaled decimal integer into the *big.Rat goavro expects.
+func decimalRat(unscaled *big.Int, scale int32) *big.Rat {
+	denom := new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale)), nil)
+	return new(big.Rat).SetFrac(unscaled, denom)
+}
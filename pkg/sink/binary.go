@@ -0,0 +1,93 @@
+package sink
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// BinaryWriter turns the BINARY columns of each record into string columns of their
+// encoded bytes before passing it to the wrapped Writer, for the text formats: the
+// bytes of hashes, fingerprints or blobs are written as hex, base64 or unchanged (raw).
+// Binary values nested in arrays, maps and structs keep the base64 of their JSON text.
+type BinaryWriter struct {
+	w        Writer
+	encoding string
+}
+
+// NewBinaryWriter returns a Writer that encodes binary columns with encoding, one of
+// hex, base64 or raw, and writes the records to w. An unknown encoding is reported by
+// the first Write.
+func NewBinaryWriter(w Writer, encoding string) *BinaryWriter {
+	return &BinaryWriter{w: w, encoding: encoding}
+}
+
+// BinaryEncoder returns the function encoding bytes as text with encoding.
+func BinaryEncoder(encoding string) (func([]byte) string, error) {
+	switch encoding {
+	case "hex":
+		return hex.EncodeToString, nil
+	case "base64":
+		return base64.StdEncoding.EncodeToString, nil
+	case "raw":
+		return func(b []byte) string { return string(b) }, nil
+	}
+	return nil, fmt.Errorf("unknown binary encoding %q, expected hex, base64 or raw", encoding)
+}
+
+// Write encodes the binary columns of rec and writes the result.
+func (b *BinaryWriter) Write(rec arrow.Record) error {
+	encode, err := BinaryEncoder(b.encoding)
+	if err != nil {
+		return err
+	}
+	fields := append([]arrow.Field(nil), rec.Schema().Fields()...)
+	cols := make([]arrow.Array, len(fields))
+	encoded := false
+	for c, col := range rec.Columns() {
+		bin, ok := col.(binaryArray)
+		if !ok {
+			cols[c] = col
+			continue
+		}
+		sb := array.NewStringBuilder(memory.DefaultAllocator)
+		for i := 0; i < col.Len(); i++ {
+			if col.IsNull(i) {
+				sb.AppendNull()
+			} else {
+				sb.Append(encode(bin.Value(i)))
+			}
+		}
+		cols[c] = sb.NewArray()
+		defer cols[c].Release()
+		sb.Release()
+		fields[c].Type = arrow.BinaryTypes.String
+		encoded = true
+	}
+	if !encoded {
+		return b.w.Write(rec)
+	}
+	md := rec.Schema().Metadata()
+	out := array.NewRecord(arrow.NewSchema(fields, &md), cols, rec.NumRows())
+	defer out.Release()
+	return b.w.Write(out)
+}
+
+// binaryArray is implemented by the Binary, LargeBinary and FixedSizeBinary arrays.
+type binaryArray interface {
+	Value(i int) []byte
+}
+
+// Flush flushes the wrapped Writer if it holds back output.
+func (b *BinaryWriter) Flush() error {
+	return Flush(b.w)
+}
+
+// Close closes the wrapped Writer.
+func (b *BinaryWriter) Close() error {
+	return b.w.Close()
+}
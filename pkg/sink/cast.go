@@ -0,0 +1,288 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/compute"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// CastRule converts columns to another type before they are written, so the output
+// matches what a downstream system expects, e.g. DOUBLE instead of DECIMAL.
+type CastRule struct {
+	// From selects the columns to convert: a type such as timestamp, decimal or bigint,
+	// or the name of a column. A column named like a type is written in backticks.
+	From   string
+	column bool // From is a column name
+
+	// To is the type the columns are converted to.
+	To arrow.DataType
+
+	// Format is the layout of timestamps and dates converted to strings: rfc3339,
+	// rfc3339nano, sql, or a Go layout such as 01/02/2006. Empty keeps the text the
+	// table output shows.
+	Format string
+}
+
+// castTypes are the types a CastRule can select, by their Databricks SQL name.
+var castTypes = map[string]func(arrow.DataType) bool{
+	"boolean":  idIs(arrow.BOOL),
+	"tinyint":  idIs(arrow.INT8),
+	"smallint": idIs(arrow.INT16),
+	"int":      idIs(arrow.INT32),
+	"bigint":   idIs(arrow.INT64),
+	"float":    idIs(arrow.FLOAT32),
+	"double":   idIs(arrow.FLOAT64),
+	"decimal":  idIs(arrow.DECIMAL128, arrow.DECIMAL256),
+	"string":   idIs(arrow.STRING, arrow.LARGE_STRING),
+	"binary":   idIs(arrow.BINARY, arrow.LARGE_BINARY, arrow.FIXED_SIZE_BINARY),
+	"date":     idIs(arrow.DATE32, arrow.DATE64),
+	"timestamp": func(dt arrow.DataType) bool {
+		ts, ok := dt.(*arrow.TimestampType)
+		return ok && ts.TimeZone != ""
+	},
+	"timestamp_ntz": func(dt arrow.DataType) bool {
+		ts, ok := dt.(*arrow.TimestampType)
+		return ok && ts.TimeZone == ""
+	},
+	"array":  idIs(arrow.LIST, arrow.LARGE_LIST, arrow.FIXED_SIZE_LIST),
+	"map":    idIs(arrow.MAP),
+	"struct": idIs(arrow.STRUCT),
+}
+
+func idIs(ids ...arrow.Type) func(arrow.DataType) bool {
+	return func(dt arrow.DataType) bool {
+		for _, id := range ids {
+			if dt.ID() == id {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// timeFormats are the named layouts of CastRule.Format.
+var timeFormats = map[string]string{
+	"rfc3339":     time.RFC3339,
+	"rfc3339nano": time.RFC3339Nano,
+	"sql":         "2006-01-02 15:04:05.999999",
+}
+
+// ParseCasts parses a specification such as
+// "decimal=double, timestamp=string:rfc3339, zip=int" into its rules. Each rule
+// converts the columns of a type, or one column, to a Databricks SQL type; a string
+// target may be followed by the format of timestamps and dates.
+func ParseCasts(spec string) ([]CastRule, error) {
+	var rules []CastRule
+	for _, item := range splitOutside(spec, ',') {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		from, to, ok := strings.Cut(item, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid cast %q, expected <type or column>=<type>, e.g. decimal=double", item)
+		}
+		r := CastRule{From: strings.TrimSpace(from)}
+		if name, ok := strings.CutPrefix(r.From, "`"); ok && strings.HasSuffix(name, "`") && len(name) > 1 {
+			r.From, r.column = strings.TrimSuffix(name, "`"), true
+		} else if _, ok := castTypes[strings.ToLower(r.From)]; ok {
+			r.From = strings.ToLower(r.From)
+		} else {
+			r.column = true
+		}
+		if r.From == "" {
+			return nil, fmt.Errorf("invalid cast %q: nothing to convert", item)
+		}
+
+		to, format, _ := strings.Cut(strings.TrimSpace(to), ":")
+		dt, err := arrowfetch.ParseSQLType(strings.TrimSpace(to))
+		if err != nil {
+			return nil, fmt.Errorf("invalid cast %q: %w", item, err)
+		}
+		r.To = dt
+		if format = strings.TrimSpace(format); format != "" {
+			if dt.ID() != arrow.STRING {
+				return nil, fmt.Errorf("invalid cast %q: a format applies to a string target only", item)
+			}
+			if layout, ok := timeFormats[strings.ToLower(format)]; ok {
+				format = layout
+			}
+			r.Format = format
+		}
+		rules = append(rules, r)
+	}
+	if len(rules) == 0 {
+		return nil, errors.New("no casts given")
+	}
+	return rules, nil
+}
+
+// splitOutside splits s at every sep that is not inside parentheses, so the commas of
+// decimal(12,2) stay within their rule.
+func splitOutside(s string, sep byte) []string {
+	var parts []string
+	depth, start := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case sep:
+			if depth == 0 {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
+
+// CastWriter converts the columns selected by its rules before passing each record to
+// the wrapped Writer. A rule naming a column applies before the rules selecting types,
+// and among those the first that matches a column wins. Conversions that would lose
+// data, such as a value out of the range of the new type, fail the write; strings are
+// written as the table output shows the values.
+type CastWriter struct {
+	w     Writer
+	rules []CastRule
+
+	// The conversion of each column is resolved on the first record and reused while the
+	// schema stays the same; a nil rule leaves the column unchanged.
+	schema *arrow.Schema
+	casts  []*CastRule
+	out    *arrow.Schema
+}
+
+// NewCastWriter returns a Writer that converts the columns of each record as rules say
+// and writes the result to w.
+func NewCastWriter(w Writer, rules []CastRule) *CastWriter {
+	return &CastWriter{w: w, rules: rules}
+}
+
+// Write converts the columns of rec and writes the result.
+func (c *CastWriter) Write(rec arrow.Record) error {
+	if c.schema == nil || !c.schema.Equal(rec.Schema()) {
+		if err := c.resolve(rec.Schema()); err != nil {
+			return err
+		}
+	}
+	if c.out == nil {
+		return c.w.Write(rec)
+	}
+	cols := make([]arrow.Array, rec.NumCols())
+	for i, col := range rec.Columns() {
+		r := c.casts[i]
+		if r == nil {
+			cols[i] = col
+			continue
+		}
+		cast, err := castColumn(col, r)
+		if err != nil {
+			return fmt.Errorf("cast %s from %s to %s: %w", rec.ColumnName(i), col.DataType(), r.To, err)
+		}
+		defer cast.Release()
+		cols[i] = cast
+	}
+	out := array.NewRecord(c.out, cols, rec.NumRows())
+	defer out.Release()
+	return c.w.Write(out)
+}
+
+// Flush flushes the wrapped Writer if it holds back output.
+func (c *CastWriter) Flush() error {
+	return Flush(c.w)
+}
+
+// Close closes the wrapped Writer.
+func (c *CastWriter) Close() error {
+	return c.w.Close()
+}
+
+// resolve picks the rule of every column of schema and the schema of the output, which
+// is nil when no column changes.
+func (c *CastWriter) resolve(schema *arrow.Schema) error {
+	casts := make([]*CastRule, len(schema.Fields()))
+	for k := range c.rules {
+		r := &c.rules[k]
+		if !r.column {
+			continue
+		}
+		idx := columnIndex(schema, r.From)
+		if idx < 0 {
+			return fmt.Errorf("cast: the result has no column %q", r.From)
+		}
+		casts[idx] = r
+	}
+	fields := append([]arrow.Field(nil), schema.Fields()...)
+	changed := false
+	for i, f := range fields {
+		if casts[i] == nil {
+			for k := range c.rules {
+				if r := &c.rules[k]; !r.column && castTypes[r.From](f.Type) {
+					casts[i] = r
+					break
+				}
+			}
+		}
+		r := casts[i]
+		if r == nil {
+			continue
+		}
+		if r.Format != "" && !idIs(arrow.TIMESTAMP, arrow.DATE32, arrow.DATE64)(f.Type) {
+			return fmt.Errorf("cast %s: a format applies to timestamps and dates, not %s", f.Name, f.Type)
+		}
+		if arrow.TypeEqual(f.Type, r.To) && r.Format == "" {
+			casts[i] = nil
+			continue
+		}
+		// The SQL type recorded for the column no longer describes it.
+		fields[i] = arrow.Field{Name: f.Name, Type: r.To, Nullable: f.Nullable}
+		changed = true
+	}
+	c.schema, c.casts, c.out = schema, casts, nil
+	if changed {
+		md := schema.Metadata()
+		c.out = arrow.NewSchema(fields, &md)
+	}
+	return nil
+}
+
+// castColumn converts col as r says. Strings are formatted here, the other types are
+// converted by the Arrow cast kernels.
+func castColumn(col arrow.Array, r *CastRule) (arrow.Array, error) {
+	if r.To.ID() != arrow.STRING {
+		return compute.CastArray(context.Background(), col, compute.SafeCastOptions(r.To))
+	}
+	format := func(i int) string { return TextValue(col, i) }
+	if r.Format != "" {
+		switch col := col.(type) {
+		case *array.Timestamp:
+			format = func(i int) string { return timestampValue(col, i).Format(r.Format) }
+		case *array.Date32:
+			format = func(i int) string { return col.Value(i).ToTime().Format(r.Format) }
+		case *array.Date64:
+			format = func(i int) string { return col.Value(i).ToTime().Format(r.Format) }
+		}
+	}
+	b := array.NewStringBuilder(memory.DefaultAllocator)
+	defer b.Release()
+	b.Reserve(col.Len())
+	for i := 0; i < col.Len(); i++ {
+		if col.IsNull(i) {
+			b.AppendNull()
+		} else {
+			b.Append(format(i))
+		}
+	}
+	return b.NewArray(), nil
+}
@@ -0,0 +1,46 @@
+package sink_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+	"dbx_arrow_dbsql/pkg/sink"
+)
+
+func TestCastWriter(t *testing.T) {
+	rules, err := sink.ParseCasts("double=string, `day`=string:01/02/2006, created=string:sql, id=smallint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := arrowfetchtest.Batches(1, 2)
+	defer recs[0].Release()
+	var buf bytes.Buffer
+	w := sink.NewCastWriter(sink.NewCSVWriter(&buf, sink.CSVOptions{}), rules)
+	if err := w.Write(recs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := "id,name,amount,active,day,created\n" +
+		"0,,0,true,01/01/2024,2024-01-01 00:00:00\n" +
+		"1,name-1,1.5,false,01/02/2024,2024-01-01 00:01:00\n"
+	if got := buf.String(); got != want {
+		t.Errorf("CSV output\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParseCastsErrors(t *testing.T) {
+	for spec, want := range map[string]string{
+		"decimal":                "expected <type or column>=<type>",
+		"decimal=money":          "money",
+		"decimal=double:rfc3339": "string target only",
+		" , ":                    "no casts given",
+	} {
+		if _, err := sink.ParseCasts(spec); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseCasts(%q) = %v, want an error mentioning %q", spec, err, want)
+		}
+	}
+}
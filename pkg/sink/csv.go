@@ -0,0 +1,68 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/csv"
+)
+
+// CSVOptions controls how CSVWriter encodes the result.
+type CSVOptions struct {
+	// NullString is written for missing values instead of an empty field when set,
+	// e.g. \N for loaders that tell NULL apart from an empty string.
+	NullString *string
+}
+
+// csvOptions returns the Arrow CSV writer options for opts.
+func csvOptions(opts CSVOptions, header bool) []csv.Option {
+	null := ""
+	if opts.NullString != nil {
+		null = *opts.NullString
+	}
+	return []csv.Option{csv.WithHeader(header), csv.WithNullWriter(null)}
+}
+
+// CSVWriter streams batches as CSV using the Arrow CSV writer.
+// The header row is written once, before the first batch.
+type CSVWriter struct {
+	w    io.Writer
+	opts []csv.Option
+	csv  *csv.Writer
+}
+
+// NewCSVWriter returns a Writer that encodes batches as CSV to w.
+// The writer is created lazily because the schema is only known once the first batch arrives.
+func NewCSVWriter(w io.Writer, opts CSVOptions) *CSVWriter {
+	return &CSVWriter{w: w, opts: csvOptions(opts, true)}
+}
+
+// Write encodes the batch as CSV rows. Array, map and struct values are written as their
+// JSON text, and timestamps as the time in the zone of their column.
+func (c *CSVWriter) Write(rec arrow.Record) (err error) {
+	rec = csvText(rec)
+	defer rec.Release()
+	if c.csv == nil {
+		// The Arrow CSV writer panics on types it cannot encode (e.g. unions).
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("csv: %v", r)
+			}
+		}()
+		c.csv = csv.NewWriter(c.w, rec.Schema(), c.opts...)
+	}
+	if err := c.csv.Write(rec); err != nil {
+		return fmt.Errorf("csv: %w", err)
+	}
+	// Flush after every batch so the output streams instead of growing in memory.
+	return c.csv.Flush()
+}
+
+// Close flushes buffered rows.
+func (c *CSVWriter) Close() error {
+	if c.csv == nil {
+		return nil
+	}
+	return c.csv.Flush()
+}
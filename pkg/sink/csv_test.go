@@ -0,0 +1,118 @@
+package sink_test
+
+import (
+	"bytes"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+	"dbx_arrow_dbsql/pkg/sink"
+)
+
+func TestCSVWriter(t *testing.T) {
+	recs := arrowfetchtest.Batches(2, 2)
+	var buf bytes.Buffer
+	w := sink.NewCSVWriter(&buf, sink.CSVOptions{})
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+		rec.Release()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The header is written once and a NULL is an empty field.
+	want := "id,name,amount,active,day,created\n" +
+		"0,,0,true,2024-01-01,2024-01-01 00:00:00\n" +
+		"1,name-1,1.5,false,2024-01-02,2024-01-01 00:01:00\n" +
+		"2,name-2,3,true,2024-01-03,2024-01-01 00:02:00\n" +
+		"3,name-3,4.5,false,2024-01-04,2024-01-01 00:03:00\n"
+	if got := buf.String(); got != want {
+		t.Errorf("CSV output\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestHeadWriter(t *testing.T) {
+	recs := arrowfetchtest.Batches(3, 4)
+	defer func() {
+		for _, rec := range recs {
+			rec.Release()
+		}
+	}()
+	var buf bytes.Buffer
+	w := sink.NewHeadWriter(sink.NewNDJSONWriter(&buf, sink.NDJSONOptions{}), 5)
+	var err error
+	written := 0
+	for _, rec := range recs {
+		if err = w.Write(rec); err != nil {
+			break
+		}
+		written++
+	}
+	if err != sink.ErrStop || written != 1 {
+		t.Fatalf("Write = %v after %d batches, want ErrStop after 1", err, written)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != 5 {
+		t.Errorf("wrote %d rows, want 5", lines)
+	}
+}
+
+func TestNullString(t *testing.T) {
+	null := `\N`
+	for _, tc := range []struct {
+		name string
+		new  func(buf *bytes.Buffer) sink.Writer
+		want string
+	}{
+		{"csv", func(buf *bytes.Buffer) sink.Writer { return sink.NewCSVWriter(buf, sink.CSVOptions{NullString: &null}) }, `0,\N,0`},
+		{"parallel csv", func(buf *bytes.Buffer) sink.Writer {
+			return sink.NewParallelWriter(buf, 2, true, sink.CSVEncoder(sink.CSVOptions{NullString: &null}))
+		}, `0,\N,0`},
+		{"ndjson", func(buf *bytes.Buffer) sink.Writer {
+			return sink.NewNDJSONWriter(buf, sink.NDJSONOptions{NullString: &null})
+		}, `"name":"\\N"`},
+		{"table", func(buf *bytes.Buffer) sink.Writer {
+			return sink.NewTableWriter(buf, sink.TableOptions{NullString: &null})
+		}, `| \N `},
+		{"markdown", func(buf *bytes.Buffer) sink.Writer {
+			return sink.NewMarkdownWriter(buf, sink.MarkdownOptions{NullString: &null})
+		}, `| 0 | \N |`},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			recs := arrowfetchtest.Batches(1, 2)
+			defer recs[0].Release()
+			var buf bytes.Buffer
+			w := tc.new(&buf)
+			if err := w.Write(recs[0]); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Contains(buf.Bytes(), []byte(tc.want)) {
+				t.Errorf("output\n%s\ndoes not contain %s", buf.String(), tc.want)
+			}
+			if bytes.Contains(buf.Bytes(), []byte("NULL")) {
+				t.Errorf("output\n%s\nstill contains NULL", buf.String())
+			}
+		})
+	}
+
+	// "null" keeps JSON null in ndjson.
+	json := "null"
+	recs := arrowfetchtest.Batches(1, 1)
+	defer recs[0].Release()
+	var buf bytes.Buffer
+	w := sink.NewNDJSONWriter(&buf, sink.NDJSONOptions{NullString: &json})
+	if err := w.Write(recs[0]); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	if !bytes.Contains(buf.Bytes(), []byte(`"name":null`)) {
+		t.Errorf("ndjson output %s, want a JSON null", buf.String())
+	}
+}
@@ -0,0 +1,35 @@
+package sink
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// ParseDatabaseURL splits a database sink URL such as duckdb://file.db?table=trips
+// into the database file path and the target table name.
+func ParseDatabaseURL(raw string) (scheme, path, table string, err error) {
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if !ok {
+		return "", "", "", fmt.Errorf("invalid sink %q, expected scheme://file?table=name", raw)
+	}
+	path, rawQuery, _ := strings.Cut(rest, "?")
+	query, err := url.ParseQuery(rawQuery)
+	if err != nil {
+		return "", "", "", fmt.Errorf("invalid sink %q: %w", raw, err)
+	}
+	table = query.Get("table")
+	if path == "" || table == "" {
+		return "", "", "", fmt.Errorf("sink %q must name a database file and a table, e.g. %s://results.db?table=trips", raw, scheme)
+	}
+	return scheme, path, table, nil
+}
+
+// quoteIdent quotes a possibly schema-qualified table name for use in SQL.
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
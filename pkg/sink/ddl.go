@@ -0,0 +1,146 @@
+package sink
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// Dialects are the databases CreateTableSQL writes statements for.
+var Dialects = []string{"postgres", "duckdb", "sqlite"}
+
+// CreateTableSQL returns the CREATE TABLE statement of a table named table with the
+// columns of schema, in the SQL of dialect: postgres, duckdb or sqlite. Columns that are
+// not nullable are declared NOT NULL. The types are those the sinks write the values
+// as; nested values, which Postgres and SQLite have no column types for, are JSON.
+func CreateTableSQL(dialect, table string, schema *arrow.Schema) (string, error) {
+	var typeName func(arrow.DataType) string
+	switch dialect {
+	case "postgres":
+		typeName = postgresType
+	case "duckdb":
+		typeName = duckdbType
+	case "sqlite":
+		typeName = sqliteType
+	default:
+		return "", fmt.Errorf("unknown dialect %q, expected %s", dialect, strings.Join(Dialects, ", "))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "CREATE TABLE %s (\n", quoteIdent(table))
+	for i, f := range schema.Fields() {
+		fmt.Fprintf(&b, "  %s %s", quoteIdent(f.Name), typeName(f.Type))
+		if !f.Nullable {
+			b.WriteString(" NOT NULL")
+		}
+		if i < len(schema.Fields())-1 {
+			b.WriteString(",")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(");\n")
+	return b.String(), nil
+}
+
+// listType is implemented by the list, large list and fixed-size list types.
+type listType interface {
+	arrow.DataType
+	Elem() arrow.DataType
+}
+
+// postgresType returns the PostgreSQL column type for an Arrow type. Arrays of scalars
+// become Postgres arrays, maps and structs jsonb.
+func postgresType(dt arrow.DataType) string {
+	switch dt := dt.(type) {
+	case *arrow.BooleanType:
+		return "boolean"
+	case *arrow.Int8Type, *arrow.Int16Type, *arrow.Uint8Type:
+		return "smallint"
+	case *arrow.Int32Type, *arrow.Uint16Type:
+		return "integer"
+	case *arrow.Int64Type, *arrow.Uint32Type:
+		return "bigint"
+	case *arrow.Uint64Type:
+		return "numeric(20,0)"
+	case *arrow.Float16Type, *arrow.Float32Type:
+		return "real"
+	case *arrow.Float64Type:
+		return "double precision"
+	case *arrow.Decimal128Type:
+		return fmt.Sprintf("numeric(%d,%d)", dt.Precision, dt.Scale)
+	case *arrow.Decimal256Type:
+		return fmt.Sprintf("numeric(%d,%d)", dt.Precision, dt.Scale)
+	case *arrow.BinaryType, *arrow.LargeBinaryType, *arrow.FixedSizeBinaryType:
+		return "bytea"
+	case *arrow.Date32Type, *arrow.Date64Type:
+		return "date"
+	case *arrow.TimestampType:
+		if dt.TimeZone == "" {
+			return "timestamp"
+		}
+		return "timestamptz"
+	case listType:
+		if elem := dt.Elem(); !isNested(elem) {
+			return postgresType(elem) + "[]"
+		}
+		return "jsonb"
+	case *arrow.MapType, *arrow.StructType:
+		return "jsonb"
+	default:
+		return "text"
+	}
+}
+
+// duckdbType returns the DuckDB column type for an Arrow type, nested types included.
+func duckdbType(dt arrow.DataType) string {
+	switch dt := dt.(type) {
+	case *arrow.BooleanType:
+		return "BOOLEAN"
+	case *arrow.Int8Type:
+		return "TINYINT"
+	case *arrow.Int16Type:
+		return "SMALLINT"
+	case *arrow.Int32Type:
+		return "INTEGER"
+	case *arrow.Int64Type:
+		return "BIGINT"
+	case *arrow.Uint8Type:
+		return "UTINYINT"
+	case *arrow.Uint16Type:
+		return "USMALLINT"
+	case *arrow.Uint32Type:
+		return "UINTEGER"
+	case *arrow.Uint64Type:
+		return "UBIGINT"
+	case *arrow.Float16Type, *arrow.Float32Type:
+		return "REAL"
+	case *arrow.Float64Type:
+		return "DOUBLE"
+	case *arrow.Decimal128Type:
+		return fmt.Sprintf("DECIMAL(%d,%d)", dt.Precision, dt.Scale)
+	case *arrow.Decimal256Type:
+		// DuckDB decimals hold at most 38 digits.
+		return "VARCHAR"
+	case *arrow.BinaryType, *arrow.LargeBinaryType, *arrow.FixedSizeBinaryType:
+		return "BLOB"
+	case *arrow.Date32Type, *arrow.Date64Type:
+		return "DATE"
+	case *arrow.TimestampType:
+		if dt.TimeZone == "" {
+			return "TIMESTAMP"
+		}
+		return "TIMESTAMPTZ"
+	case *arrow.MapType:
+		return fmt.Sprintf("MAP(%s, %s)", duckdbType(dt.KeyType()), duckdbType(dt.ItemType()))
+	case listType:
+		return duckdbType(dt.Elem()) + "[]"
+	case *arrow.StructType:
+		fields := make([]string, len(dt.Fields()))
+		for i, f := range dt.Fields() {
+			fields[i] = quoteIdent(f.Name) + " " + duckdbType(f.Type)
+		}
+		return "STRUCT(" + strings.Join(fields, ", ") + ")"
+	default:
+		return "VARCHAR"
+	}
+}
@@ -0,0 +1,34 @@
+package sink_test
+
+import (
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+func TestCreateTableSQL(t *testing.T) {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "id", Type: arrow.PrimitiveTypes.Int64},
+		{Name: "fare", Type: &arrow.Decimal128Type{Precision: 10, Scale: 2}, Nullable: true},
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+		{Name: "pickup", Type: arrow.FixedWidthTypes.Timestamp_us, Nullable: true},
+	}, nil)
+	for dialect, want := range map[string]string{
+		"postgres": "CREATE TABLE \"trips\" (\n  \"id\" bigint NOT NULL,\n  \"fare\" numeric(10,2),\n  \"tags\" text[],\n  \"pickup\" timestamptz\n);\n",
+		"duckdb":   "CREATE TABLE \"trips\" (\n  \"id\" BIGINT NOT NULL,\n  \"fare\" DECIMAL(10,2),\n  \"tags\" VARCHAR[],\n  \"pickup\" TIMESTAMPTZ\n);\n",
+		"sqlite":   "CREATE TABLE \"trips\" (\n  \"id\" INTEGER NOT NULL,\n  \"fare\" TEXT,\n  \"tags\" TEXT,\n  \"pickup\" TEXT\n);\n",
+	} {
+		got, err := sink.CreateTableSQL(dialect, "trips", schema)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != want {
+			t.Errorf("%s:\n%s\nwant\n%s", dialect, got, want)
+		}
+	}
+	if _, err := sink.CreateTableSQL("oracle", "trips", schema); err == nil {
+		t.Error("CreateTableSQL accepted an unknown dialect")
+	}
+}
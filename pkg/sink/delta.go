@@ -0,0 +1,333 @@
+package sink
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/google/uuid"
+)
+
+// DeltaWriter appends the result to a local Delta Lake table. All batches go into one
+// Parquet data file, which is added to the table by a single commit when the writer closes.
+type DeltaWriter struct {
+	dir    string
+	opts   ParquetOptions
+	schema *arrow.Schema
+	name   string
+	file   *os.File
+	pq     *ParquetWriter
+	rows   int64
+}
+
+// NewDeltaWriter returns a Writer that appends to the Delta table in dir, creating the table
+// on the first commit.
+func NewDeltaWriter(dir string, opts ParquetOptions) (*DeltaWriter, error) {
+	if _, err := parseCodec(opts.Compression); err != nil {
+		return nil, err
+	}
+	return &DeltaWriter{dir: dir, opts: opts}, nil
+}
+
+// Write appends the batch to the data file of this commit.
+func (d *DeltaWriter) Write(rec arrow.Record) error {
+	if d.pq == nil {
+		if err := d.start(rec.Schema()); err != nil {
+			return err
+		}
+	}
+	d.rows += rec.NumRows()
+	return d.pq.Write(rec)
+}
+
+// Close finishes the data file and commits it to the transaction log.
+func (d *DeltaWriter) Close() error {
+	if d.pq == nil {
+		return nil // Nothing was fetched, so there is nothing to commit.
+	}
+	err := d.pq.Close()
+	if cerr := d.file.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = d.commit()
+	}
+	if err != nil {
+		os.Remove(filepath.Join(d.dir, d.name))
+		return fmt.Errorf("delta: %w", err)
+	}
+	return nil
+}
+
+// Abort removes the data file without committing it, leaving the table unchanged.
+func (d *DeltaWriter) Abort(error) {
+	if d.file != nil {
+		d.file.Close()
+		os.Remove(filepath.Join(d.dir, d.name))
+	}
+}
+
+// start creates the data file for this run.
+func (d *DeltaWriter) start(schema *arrow.Schema) error {
+	if err := os.MkdirAll(filepath.Join(d.dir, "_delta_log"), 0o755); err != nil {
+		return fmt.Errorf("delta: %w", err)
+	}
+	d.schema = schema
+	d.name = fmt.Sprintf("part-00000-%s-c000.parquet", uuid.NewString())
+	f, err := os.Create(filepath.Join(d.dir, d.name))
+	if err != nil {
+		return fmt.Errorf("delta: %w", err)
+	}
+	pq, err := NewParquetWriter(f, d.opts)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	d.file, d.pq = f, pq
+	return nil
+}
+
+// commit writes the next version of the transaction log. The commit file is created
+// exclusively, so a concurrent writer that took the same version makes this one fail
+// instead of overwriting it.
+func (d *DeltaWriter) commit() error {
+	schemaString, err := deltaSchemaString(d.schema)
+	if err != nil {
+		return err
+	}
+	version, tableSchema, err := d.latest()
+	if err != nil {
+		return err
+	}
+	if tableSchema != "" && !deltaSchemaEqual(tableSchema, schemaString) {
+		return errors.New("the result schema does not match the schema of the existing table")
+	}
+
+	info, err := os.Stat(filepath.Join(d.dir, d.name))
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+	stats, _ := json.Marshal(map[string]int64{"numRecords": d.rows})
+
+	var actions []map[string]any
+	if version < 0 {
+		actions = append(actions,
+			map[string]any{"protocol": map[string]any{"minReaderVersion": 1, "minWriterVersion": 2}},
+			map[string]any{"metaData": map[string]any{
+				"id":               uuid.NewString(),
+				"format":           map[string]any{"provider": "parquet", "options": map[string]string{}},
+				"schemaString":     schemaString,
+				"partitionColumns": []string{},
+				"configuration":    map[string]string{},
+				"createdTime":      now,
+			}},
+		)
+	}
+	actions = append(actions,
+		map[string]any{"add": map[string]any{
+			"path":             d.name,
+			"partitionValues":  map[string]string{},
+			"size":             info.Size(),
+			"modificationTime": now,
+			"dataChange":       true,
+			"stats":            string(stats),
+		}},
+		map[string]any{"commitInfo": map[string]any{
+			"timestamp":           now,
+			"operation":           "WRITE",
+			"operationParameters": map[string]string{"mode": "Append", "partitionBy": "[]"},
+			"engineInfo":          "dbarrow",
+		}},
+	)
+
+	var log strings.Builder
+	for _, a := range actions {
+		line, err := json.Marshal(a)
+		if err != nil {
+			return err
+		}
+		log.Write(line)
+		log.WriteString("\n")
+	}
+
+	path := filepath.Join(d.dir, "_delta_log", fmt.Sprintf("%020d.json", version+1))
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+	if err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return fmt.Errorf("version %d was committed by another writer", version+1)
+		}
+		return err
+	}
+	if _, err := f.WriteString(log.String()); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// latest returns the newest committed version (-1 for a new table) and the schema string
+// of the most recent metadata action found in the JSON commits.
+func (d *DeltaWriter) latest() (int64, string, error) {
+	entries, err := os.ReadDir(filepath.Join(d.dir, "_delta_log"))
+	if err != nil {
+		return 0, "", err
+	}
+	var versions []int64
+	for _, e := range entries {
+		name, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok || len(name) != 20 {
+			continue
+		}
+		if v, err := strconv.ParseInt(name, 10, 64); err == nil {
+			versions = append(versions, v)
+		}
+	}
+	if len(versions) == 0 {
+		return -1, "", nil
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+
+	// Walk back from the newest commit to find the current schema. Older commits may
+	// have been replaced by a checkpoint, in which case the check is skipped.
+	for _, v := range versions {
+		data, err := os.ReadFile(filepath.Join(d.dir, "_delta_log", fmt.Sprintf("%020d.json", v)))
+		if err != nil {
+			return 0, "", err
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			var action struct {
+				MetaData *struct {
+					SchemaString string `json:"schemaString"`
+				} `json:"metaData"`
+			}
+			if json.Unmarshal([]byte(line), &action) == nil && action.MetaData != nil {
+				return versions[0], action.MetaData.SchemaString, nil
+			}
+		}
+	}
+	return versions[0], "", nil
+}
+
+// deltaSchemaString encodes the Arrow schema as a Delta (Spark) struct type.
+func deltaSchemaString(schema *arrow.Schema) (string, error) {
+	t, err := deltaStruct(schema.Fields())
+	if err != nil {
+		return "", err
+	}
+	b, err := json.Marshal(t)
+	return string(b), err
+}
+
+// deltaSchemaEqual compares two schema strings, ignoring key order and column metadata
+// such as comments that other writers may have added.
+func deltaSchemaEqual(a, b string) bool {
+	var va, vb any
+	if json.Unmarshal([]byte(a), &va) != nil || json.Unmarshal([]byte(b), &vb) != nil {
+		return false
+	}
+	return reflect.DeepEqual(stripMetadata(va), stripMetadata(vb))
+}
+
+// stripMetadata removes the "metadata" entries from a decoded schema.
+func stripMetadata(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		delete(v, "metadata")
+		for k, e := range v {
+			v[k] = stripMetadata(e)
+		}
+	case []any:
+		for i, e := range v {
+			v[i] = stripMetadata(e)
+		}
+	}
+	return v
+}
+
+// deltaStructType is a Delta struct type.
+type deltaStructType struct {
+	Type   string       `json:"type"`
+	Fields []deltaField `json:"fields"`
+}
+
+// deltaField is one field of a Delta struct type.
+type deltaField struct {
+	Name     string            `json:"name"`
+	Type     any               `json:"type"`
+	Nullable bool              `json:"nullable"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+// deltaStruct builds the struct type for a list of Arrow fields.
+func deltaStruct(fields []arrow.Field) (*deltaStructType, error) {
+	out := make([]deltaField, len(fields))
+	for i, f := range fields {
+		t, err := deltaType(f.Type)
+		if err != nil {
+			return nil, fmt.Errorf("column %s: %w", f.Name, err)
+		}
+		out[i] = deltaField{Name: f.Name, Type: t, Nullable: f.Nullable, Metadata: map[string]string{}}
+	}
+	return &deltaStructType{Type: "struct", Fields: out}, nil
+}
+
+// deltaType maps an Arrow type to the matching Delta type.
+func deltaType(dt arrow.DataType) (any, error) {
+	switch dt := dt.(type) {
+	case *arrow.BooleanType:
+		return "boolean", nil
+	case *arrow.Int8Type:
+		return "byte", nil
+	case *arrow.Int16Type, *arrow.Uint8Type:
+		return "short", nil
+	case *arrow.Int32Type, *arrow.Uint16Type:
+		return "integer", nil
+	case *arrow.Int64Type, *arrow.Uint32Type:
+		return "long", nil
+	case *arrow.Float32Type:
+		return "float", nil
+	case *arrow.Float64Type:
+		return "double", nil
+	case *arrow.StringType, *arrow.LargeStringType:
+		return "string", nil
+	case *arrow.BinaryType, *arrow.LargeBinaryType, *arrow.FixedSizeBinaryType:
+		return "binary", nil
+	case *arrow.Date32Type, *arrow.Date64Type:
+		return "date", nil
+	case *arrow.TimestampType:
+		return "timestamp", nil
+	case *arrow.Decimal128Type:
+		return fmt.Sprintf("decimal(%d,%d)", dt.Precision, dt.Scale), nil
+	case *arrow.ListType:
+		elem, err := deltaType(dt.Elem())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "array", "elementType": elem, "containsNull": dt.ElemField().Nullable}, nil
+	case *arrow.MapType:
+		key, err := deltaType(dt.KeyType())
+		if err != nil {
+			return nil, err
+		}
+		value, err := deltaType(dt.ItemType())
+		if err != nil {
+			return nil, err
+		}
+		return map[string]any{"type": "map", "keyType": key, "valueType": value, "valueContainsNull": dt.ItemField().Nullable}, nil
+	case *arrow.StructType:
+		return deltaStruct(dt.Fields())
+	default:
+		return nil, fmt.Errorf("type %s is not supported by Delta", dt)
+	}
+}
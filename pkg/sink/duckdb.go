@@ -0,0 +1,215 @@
+//go:build duckdb
+
+package sink
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	arrowv18 "github.com/apache/arrow-go/v18/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/marcboeker/go-duckdb"
+)
+
+// DuckDBSupported reports whether DuckDB is compiled into this build.
+const DuckDBSupported = true
+
+// duckdbView is the name under which each batch is exposed to DuckDB while it is inserted.
+const duckdbView = "dbarrow_batch"
+
+// DuckDBWriter appends batches to a table of a local DuckDB database through DuckDB's
+// Arrow scan, so values are copied column by column without per-row conversion.
+type DuckDBWriter struct {
+	db      *sql.DB
+	conn    *sql.Conn
+	arrow   *duckdb.Arrow
+	table   string
+	created bool
+}
+
+// NewDuckDBWriter opens (or creates) the database file at path and appends batches to table.
+// The table is created from the schema of the first batch when it does not exist yet.
+func NewDuckDBWriter(path, table string) (Writer, error) {
+	db, err := sql.Open("duckdb", path)
+	if err != nil {
+		return nil, fmt.Errorf("duckdb: %w", err)
+	}
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("duckdb: %w", err)
+	}
+
+	// The Arrow interface works on the driver connection underneath conn.
+	var ar *duckdb.Arrow
+	err = conn.Raw(func(dc any) error {
+		ar, err = duckdb.NewArrowFromConn(dc.(driver.Conn))
+		return err
+	})
+	if err != nil {
+		conn.Close()
+		db.Close()
+		return nil, fmt.Errorf("duckdb: %w", err)
+	}
+	return &DuckDBWriter{db: db, conn: conn, arrow: ar, table: quoteIdent(table)}, nil
+}
+
+// Write inserts the rows of the batch into the table.
+func (d *DuckDBWriter) Write(rec arrow.Record) error {
+	ctx := context.Background()
+
+	// go-duckdb is built on a newer Arrow release, so hand the batch over as an IPC stream.
+	var buf bytes.Buffer
+	w := ipc.NewWriter(&buf, ipc.WithSchema(rec.Schema()))
+	if err := w.Write(rec); err != nil {
+		return fmt.Errorf("duckdb: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("duckdb: %w", err)
+	}
+	reader, err := arrowv18.NewReader(&buf)
+	if err != nil {
+		return fmt.Errorf("duckdb: %w", err)
+	}
+	defer reader.Release()
+
+	release, err := d.arrow.RegisterView(reader, duckdbView)
+	if err != nil {
+		return fmt.Errorf("duckdb: unable to register batch: %w", err)
+	}
+	defer release()
+
+	if !d.created {
+		stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s AS SELECT * FROM %s LIMIT 0", d.table, duckdbView)
+		if _, err := d.conn.ExecContext(ctx, stmt); err != nil {
+			return fmt.Errorf("duckdb: unable to create table: %w", err)
+		}
+		d.created = true
+	}
+
+	// Match columns by name so an existing table may order its columns differently.
+	stmt := fmt.Sprintf("INSERT INTO %s BY NAME SELECT * FROM %s", d.table, duckdbView)
+	if _, err := d.conn.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("duckdb: unable to insert batch: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (d *DuckDBWriter) Close() error {
+	if err := d.conn.Close(); err != nil {
+		d.db.Close()
+		return fmt.Errorf("duckdb: %w", err)
+	}
+	return d.db.Close()
+}
+
+// PostSQLTable is the table holding the fetched result that a --post-sql query reads.
+const PostSQLTable = "result"
+
+// PostSQLWriter loads the batches written to it into the table "result" of an in-memory
+// DuckDB database and, when it is flushed, runs a query over that table and writes the
+// query's result to the wrapped Writer. Follow-up SQL thus runs locally, without going
+// back to the warehouse. DuckDB spills the table to temporary files when it outgrows
+// the memory limit.
+type PostSQLWriter struct {
+	w       Writer
+	query   string
+	db      *DuckDBWriter
+	err     error // error opening the database, reported by the first Write
+	flushed bool
+}
+
+// NewPostSQLWriter returns a PostSQLWriter running query over the batches and writing
+// its result to w.
+func NewPostSQLWriter(w Writer, query string) Writer {
+	p := &PostSQLWriter{w: w, query: query}
+	db, err := NewDuckDBWriter("", PostSQLTable)
+	if err != nil {
+		p.err = err
+	} else {
+		p.db = db.(*DuckDBWriter)
+	}
+	return p
+}
+
+// Write inserts the rows of the batch into the result table.
+func (p *PostSQLWriter) Write(rec arrow.Record) error {
+	if p.err != nil {
+		return p.err
+	}
+	return p.db.Write(rec)
+}
+
+// Flush runs the query once all the batches are loaded and writes its result.
+func (p *PostSQLWriter) Flush() error {
+	if p.err != nil {
+		return p.err
+	}
+	if !p.flushed {
+		p.flushed = true
+		if !p.db.created {
+			// Without a batch there is no schema to create the table from.
+			return fmt.Errorf("post-sql: the query returned no rows, so there is no %s table to query", PostSQLTable)
+		}
+		if err := p.run(); err != nil {
+			return err
+		}
+	}
+	return Flush(p.w)
+}
+
+// run runs the query and passes its batches on, converted back from the Arrow release
+// of go-duckdb through an IPC stream.
+func (p *PostSQLWriter) run() error {
+	reader, err := p.db.arrow.QueryContext(context.Background(), p.query)
+	if err != nil {
+		return fmt.Errorf("post-sql: %w", err)
+	}
+	defer reader.Release()
+
+	var buf bytes.Buffer
+	w := arrowv18.NewWriter(&buf, arrowv18.WithSchema(reader.Schema()))
+	for reader.Next() {
+		if err := w.Write(reader.Record()); err != nil {
+			return fmt.Errorf("post-sql: %w", err)
+		}
+	}
+	if err := reader.Err(); err != nil {
+		return fmt.Errorf("post-sql: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("post-sql: %w", err)
+	}
+
+	r, err := ipc.NewReader(&buf, ipc.WithAllocator(memory.DefaultAllocator))
+	if err != nil {
+		return fmt.Errorf("post-sql: %w", err)
+	}
+	defer r.Release()
+	for r.Next() {
+		if err := p.w.Write(r.Record()); err != nil {
+			return err
+		}
+	}
+	return r.Err()
+}
+
+// Close flushes the result, closes the database and then the wrapped Writer.
+func (p *PostSQLWriter) Close() error {
+	err := p.Flush()
+	if p.db != nil {
+		if cerr := p.db.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if cerr := p.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,31 @@
+//go:build !duckdb
+
+package sink
+
+import (
+	"errors"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// DuckDBSupported reports whether DuckDB is compiled into this build.
+const DuckDBSupported = false
+
+// errNoDuckDB is returned by the DuckDB writers of a build without DuckDB.
+var errNoDuckDB = errors.New("this binary was built without DuckDB support; rebuild with: go build -tags duckdb")
+
+// NewDuckDBWriter reports that DuckDB support was left out of this build.
+// DuckDB is linked through cgo, so it is only compiled in with -tags duckdb.
+func NewDuckDBWriter(path, table string) (Writer, error) {
+	return nil, errNoDuckDB
+}
+
+// NewPostSQLWriter returns a Writer failing like NewDuckDBWriter.
+func NewPostSQLWriter(w Writer, query string) Writer {
+	return noDuckDB{w}
+}
+
+type noDuckDB struct{ w Writer }
+
+func (n noDuckDB) Write(arrow.Record) error { return errNoDuckDB }
+func (n noDuckDB) Close() error             { return n.w.Close() }
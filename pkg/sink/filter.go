@@ -0,0 +1,172 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/compute"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/vm"
+)
+
+// FilterWriter keeps only the rows of each record for which a boolean expression is true,
+// before passing the record to the wrapped Writer. The expression uses the expr language
+// (https://expr-lang.org) with the columns as variables, e.g. fare_amount > 20 && trip_distance < 2.
+// As in SQL, a row whose expression fails on a NULL value is dropped.
+type FilterWriter struct {
+	w      Writer
+	source string
+
+	// The program is compiled against the first schema and recompiled when it changes.
+	schema  *arrow.Schema
+	program *vm.Program
+	env     map[string]any
+}
+
+// NewFilterWriter returns a Writer that writes to w only the rows matching the expression.
+// The expression is checked against the column types when the first record arrives.
+func NewFilterWriter(w Writer, expression string) *FilterWriter {
+	return &FilterWriter{w: w, source: expression}
+}
+
+// Write filters rec and writes the remaining rows, if any.
+func (f *FilterWriter) Write(rec arrow.Record) error {
+	if f.schema == nil || !f.schema.Equal(rec.Schema()) {
+		if err := f.compile(rec.Schema()); err != nil {
+			return err
+		}
+	}
+
+	// Evaluate the expression row by row into a selection mask.
+	mask := array.NewBooleanBuilder(memory.DefaultAllocator)
+	defer mask.Release()
+	mask.Reserve(int(rec.NumRows()))
+	selected := 0
+	for i := 0; i < int(rec.NumRows()); i++ {
+		hasNull := false
+		for j, col := range rec.Columns() {
+			v := exprValue(col, i)
+			hasNull = hasNull || v == nil
+			f.env[rec.Schema().Field(j).Name] = v
+		}
+		out, err := expr.Run(f.program, f.env)
+		if err != nil {
+			if !hasNull {
+				return fmt.Errorf("filter failed on row %d: %w", i, err)
+			}
+			out = false
+		}
+		keep, _ := out.(bool)
+		mask.Append(keep)
+		if keep {
+			selected++
+		}
+	}
+	switch {
+	case selected == 0:
+		return nil
+	case selected == int(rec.NumRows()):
+		return f.w.Write(rec)
+	}
+
+	filter := mask.NewArray()
+	defer filter.Release()
+	filtered, err := compute.FilterRecordBatch(context.Background(), rec, filter, compute.DefaultFilterOptions())
+	if err != nil {
+		return fmt.Errorf("unable to filter the batch: %w", err)
+	}
+	defer filtered.Release()
+	return f.w.Write(filtered)
+}
+
+// Flush flushes the wrapped Writer if it holds back output.
+func (f *FilterWriter) Flush() error {
+	return Flush(f.w)
+}
+
+// Close closes the wrapped Writer.
+func (f *FilterWriter) Close() error {
+	return f.w.Close()
+}
+
+// compile type-checks the expression against the columns of schema.
+func (f *FilterWriter) compile(schema *arrow.Schema) error {
+	env := make(map[string]any, len(schema.Fields()))
+	for _, field := range schema.Fields() {
+		env[field.Name] = exprZero(field.Type)
+	}
+	program, err := expr.Compile(f.source, expr.Env(env), expr.AsBool())
+	if err != nil {
+		return fmt.Errorf("invalid filter expression: %w", err)
+	}
+	f.schema, f.program, f.env = schema, program, env
+	return nil
+}
+
+// exprZero returns a value of the Go type a column of type dt is given in expressions.
+func exprZero(dt arrow.DataType) any {
+	switch dt.ID() {
+	case arrow.BOOL:
+		return false
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64, arrow.UINT8, arrow.UINT16, arrow.UINT32:
+		return 0
+	case arrow.UINT64:
+		return uint64(0)
+	case arrow.FLOAT32, arrow.FLOAT64, arrow.DECIMAL128, arrow.DECIMAL256:
+		return 0.0
+	case arrow.TIMESTAMP, arrow.DATE32, arrow.DATE64:
+		return time.Time{}
+	default:
+		return ""
+	}
+}
+
+// exprValue returns the value at row i of col for use in an expression: int (uint64 for
+// UINT64), float64, bool, string or time.Time, and nil for NULL. Nested values are given
+// as their text form.
+func exprValue(col arrow.Array, i int) any {
+	if col.IsNull(i) {
+		return nil
+	}
+	switch col := col.(type) {
+	case *array.Boolean:
+		return col.Value(i)
+	case *array.Int8:
+		return int(col.Value(i))
+	case *array.Int16:
+		return int(col.Value(i))
+	case *array.Int32:
+		return int(col.Value(i))
+	case *array.Int64:
+		return int(col.Value(i))
+	case *array.Uint8:
+		return int(col.Value(i))
+	case *array.Uint16:
+		return int(col.Value(i))
+	case *array.Uint32:
+		return int(col.Value(i))
+	case *array.Uint64:
+		// Values above MaxInt64 would wrap as an int.
+		return col.Value(i)
+	case *array.Float32:
+		return float64(col.Value(i))
+	case *array.Float64:
+		return col.Value(i)
+	case *array.Decimal128:
+		return col.Value(i).ToFloat64(col.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		return col.Value(i).ToFloat64(col.DataType().(*arrow.Decimal256Type).Scale)
+	case *array.Timestamp:
+		return timestampValue(col, i)
+	case *array.Date32:
+		return col.Value(i).ToTime()
+	case *array.Date64:
+		return col.Value(i).ToTime()
+	default:
+		return TextValue(col, i)
+	}
+}
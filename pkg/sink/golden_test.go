@@ -0,0 +1,153 @@
+package sink_test
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/decimal128"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// update rewrites the golden files with the current output:
+//
+//	go test ./pkg/sink -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite the golden files in testdata/golden")
+
+// goldenFormats are the text formats compared against testdata/golden/<fixture>.<format>.
+var goldenFormats = []struct {
+	name string
+	new  func(w io.Writer) sink.Writer
+}{
+	{"table", func(w io.Writer) sink.Writer { return sink.NewTableWriter(w, sink.TableOptions{MaxColWidth: 20}) }},
+	{"csv", func(w io.Writer) sink.Writer { return sink.NewCSVWriter(w, sink.CSVOptions{}) }},
+	{"ndjson", func(w io.Writer) sink.Writer { return sink.NewNDJSONWriter(w, sink.NDJSONOptions{}) }},
+	{"md", func(w io.Writer) sink.Writer { return sink.NewMarkdownWriter(w, sink.MarkdownOptions{}) }},
+}
+
+// goldenFixtures are the batches rendered in every format. Each returns batches owned by
+// the caller.
+var goldenFixtures = []struct {
+	name  string
+	batch func() []arrow.Record
+}{
+	{"basic", func() []arrow.Record { return arrowfetchtest.Batches(2, 4) }},
+	{"text", textFixture},
+	{"nested", nestedFixture},
+	{"empty", func() []arrow.Record { return arrowfetchtest.Batches(1, 0) }},
+}
+
+// textFixture holds values that formats must escape, align or truncate.
+func textFixture() []arrow.Record {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "label", Type: arrow.BinaryTypes.String, Nullable: true},
+		{Name: "price", Type: arrow.BinaryTypes.String, Nullable: true}, // decimals arrive as strings
+		{Name: "qty", Type: arrow.PrimitiveTypes.Int32, Nullable: true},
+		{Name: "ratio", Type: arrow.PrimitiveTypes.Float32, Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+	b.Field(0).(*array.StringBuilder).AppendValues([]string{
+		"plain",
+		"comma, and \"quotes\"",
+		"line\nbreak",
+		"pipe | and tab\tend",
+		"ünïcødé 日本語",
+		"a value that is much longer than the column width",
+		"",
+	}, []bool{true, true, true, true, true, true, false})
+	b.Field(1).(*array.StringBuilder).AppendValues([]string{"1.00", "-12.50", "0.00", "1234567.89", "0.01", "99.99", ""}, []bool{true, true, true, true, true, true, false})
+	b.Field(2).(*array.Int32Builder).AppendValues([]int32{1, -2, 0, 2147483647, -2147483648, 42, 0}, []bool{true, true, true, true, true, true, false})
+	b.Field(3).(*array.Float32Builder).AppendValues([]float32{0.5, -0.25, 0, 1e10, 1.0 / 3, 2.5, 0}, []bool{true, true, true, true, true, true, false})
+	return []arrow.Record{b.NewRecord()}
+}
+
+// nestedFixture holds ARRAY, MAP and STRUCT columns, with NULLs at both levels.
+func nestedFixture() []arrow.Record {
+	schema := arrow.NewSchema([]arrow.Field{
+		{Name: "tags", Type: arrow.ListOf(arrow.BinaryTypes.String), Nullable: true},
+		{Name: "counts", Type: arrow.MapOf(arrow.BinaryTypes.String, arrow.PrimitiveTypes.Int64), Nullable: true},
+		{Name: "zone", Type: arrow.StructOf(
+			arrow.Field{Name: "name", Type: arrow.BinaryTypes.String, Nullable: true},
+			arrow.Field{Name: "fare", Type: &arrow.Decimal128Type{Precision: 10, Scale: 2}, Nullable: true},
+		), Nullable: true},
+	}, nil)
+	b := array.NewRecordBuilder(memory.DefaultAllocator, schema)
+	defer b.Release()
+
+	tags := b.Field(0).(*array.ListBuilder)
+	tagValues := tags.ValueBuilder().(*array.StringBuilder)
+	tags.Append(true)
+	tagValues.AppendValues([]string{"airport", "night, late"}, nil)
+	tags.Append(true)
+	tags.AppendNull()
+
+	counts := b.Field(1).(*array.MapBuilder)
+	keys, items := counts.KeyBuilder().(*array.StringBuilder), counts.ItemBuilder().(*array.Int64Builder)
+	counts.Append(true)
+	keys.AppendValues([]string{"b", "a"}, nil)
+	items.AppendValues([]int64{2, 1}, nil)
+	counts.AppendNull()
+	counts.Append(true)
+	keys.Append("z")
+	items.AppendNull()
+
+	zone := b.Field(2).(*array.StructBuilder)
+	names, fares := zone.FieldBuilder(0).(*array.StringBuilder), zone.FieldBuilder(1).(*array.Decimal128Builder)
+	zone.Append(true)
+	names.Append("JFK")
+	fares.Append(decimal128.FromI64(5250))
+	zone.Append(true)
+	names.AppendNull()
+	fares.Append(decimal128.FromI64(-7))
+	zone.AppendNull()
+	names.AppendNull()
+	fares.AppendNull()
+	return []arrow.Record{b.NewRecord()}
+}
+
+// TestGolden renders the fixtures in every text format and compares the output with the
+// golden files, so that formatting changes show up as test failures and in review.
+func TestGolden(t *testing.T) {
+	for _, fx := range goldenFixtures {
+		for _, format := range goldenFormats {
+			t.Run(fx.name+"."+format.name, func(t *testing.T) {
+				recs := fx.batch()
+				var buf bytes.Buffer
+				w := format.new(&buf)
+				for _, rec := range recs {
+					if err := w.Write(rec); err != nil {
+						t.Fatal(err)
+					}
+					rec.Release()
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+
+				path := filepath.Join("testdata", "golden", fx.name+"."+format.name)
+				if *update {
+					if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatalf("%v (run with -update to create it)", err)
+				}
+				if got := buf.String(); got != string(want) {
+					t.Errorf("output differs from %s (run with -update to accept it)\ngot:\n%s\nwant:\n%s", path, got, want)
+				}
+			})
+		}
+	}
+}
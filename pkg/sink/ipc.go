@@ -0,0 +1,91 @@
+package sink
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/ipc"
+)
+
+// IPCStreamWriter writes batches in the Arrow IPC streaming format.
+// The schema returned by the warehouse is written unchanged. Each batch is encoded into
+// a buffer and written out as a whole before Write returns, so a reader at the other end
+// of a pipe, such as polars.read_ipc_stream, gets every batch as soon as it is fetched
+// without one system call per column buffer.
+type IPCStreamWriter struct {
+	w   *bufio.Writer
+	ipc *ipc.Writer
+}
+
+// NewIPCStreamWriter returns a Writer that encodes batches as an Arrow IPC stream to w.
+func NewIPCStreamWriter(w io.Writer) *IPCStreamWriter {
+	return &IPCStreamWriter{w: bufio.NewWriterSize(w, 1<<20)}
+}
+
+// Write appends the batch to the stream.
+func (s *IPCStreamWriter) Write(rec arrow.Record) error {
+	if s.ipc == nil {
+		s.ipc = ipc.NewWriter(s.w, ipc.WithSchema(rec.Schema()))
+	}
+	if err := s.ipc.Write(rec); err != nil {
+		return fmt.Errorf("arrow stream: %w", err)
+	}
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("arrow stream: %w", err)
+	}
+	return nil
+}
+
+// Close writes the end-of-stream marker.
+func (s *IPCStreamWriter) Close() error {
+	if s.ipc == nil {
+		return nil
+	}
+	if err := s.ipc.Close(); err != nil {
+		return fmt.Errorf("arrow stream: %w", err)
+	}
+	if err := s.w.Flush(); err != nil {
+		return fmt.Errorf("arrow stream: %w", err)
+	}
+	return nil
+}
+
+// FeatherWriter writes batches into an Arrow IPC file (Feather v2).
+// Record bodies are left uncompressed so readers can memory-map the file.
+type FeatherWriter struct {
+	w   io.WriteSeeker
+	ipc *ipc.FileWriter
+}
+
+// NewFeatherWriter returns a Writer that encodes batches as an Arrow IPC file to w.
+func NewFeatherWriter(w io.WriteSeeker) *FeatherWriter {
+	return &FeatherWriter{w: w}
+}
+
+// Write appends the batch to the file.
+func (f *FeatherWriter) Write(rec arrow.Record) error {
+	if f.ipc == nil {
+		fw, err := ipc.NewFileWriter(f.w, ipc.WithSchema(rec.Schema()))
+		if err != nil {
+			return fmt.Errorf("feather: %w", err)
+		}
+		f.ipc = fw
+	}
+	if err := f.ipc.Write(rec); err != nil {
+		return fmt.Errorf("feather: %w", err)
+	}
+	return nil
+}
+
+// Close writes the file footer.
+func (f *FeatherWriter) Close() error {
+	if f.ipc == nil {
+		return nil
+	}
+	if err := f.ipc.Close(); err != nil {
+		return fmt.Errorf("feather: %w", err)
+	}
+	return nil
+}
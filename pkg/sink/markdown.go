@@ -0,0 +1,87 @@
+package sink
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// markdownEscaper escapes the characters that would break a Markdown table cell.
+var markdownEscaper = strings.NewReplacer("|", `\|`, "\r\n", "<br>", "\n", "<br>")
+
+// MarkdownOptions controls how MarkdownWriter renders the result.
+type MarkdownOptions struct {
+	// MaxRows stops rendering after this many rows; 0 renders every row.
+	MaxRows int64
+
+	// NullString replaces the NULL shown for missing values when set.
+	NullString *string
+}
+
+// MarkdownWriter renders batches as a single GitHub-flavored Markdown table.
+// Numeric columns are right-aligned and everything else is left-aligned.
+type MarkdownWriter struct {
+	w       *bufio.Writer
+	opts    MarkdownOptions
+	rows    int64
+	hidden  int64
+	started bool
+}
+
+// NewMarkdownWriter returns a Writer that renders batches as a Markdown table to w.
+func NewMarkdownWriter(w io.Writer, opts MarkdownOptions) *MarkdownWriter {
+	return &MarkdownWriter{w: bufio.NewWriter(w), opts: opts}
+}
+
+// Write appends the rows of the batch to the table, printing the header on the first batch.
+func (m *MarkdownWriter) Write(rec arrow.Record) error {
+	if !m.started {
+		m.writeHeader(rec.Schema())
+		m.started = true
+	}
+
+	n := rec.NumRows()
+	if m.opts.MaxRows > 0 && m.rows+n > m.opts.MaxRows {
+		m.hidden += m.rows + n - m.opts.MaxRows
+		n = m.opts.MaxRows - m.rows
+	}
+	for i := 0; i < int(n); i++ {
+		m.w.WriteString("|")
+		for _, col := range rec.Columns() {
+			m.w.WriteString(" ")
+			m.w.WriteString(markdownEscaper.Replace(cellText(col, i, m.opts.NullString)))
+			m.w.WriteString(" |")
+		}
+		m.w.WriteString("\n")
+	}
+	m.rows += n
+	return m.w.Flush()
+}
+
+// Close notes how many rows were left out and flushes the output.
+func (m *MarkdownWriter) Close() error {
+	if m.hidden > 0 {
+		fmt.Fprintf(m.w, "\n_%d more rows not shown._\n", m.hidden)
+	}
+	return m.w.Flush()
+}
+
+// writeHeader prints the column names and the alignment row.
+func (m *MarkdownWriter) writeHeader(schema *arrow.Schema) {
+	m.w.WriteString("|")
+	for _, f := range schema.Fields() {
+		fmt.Fprintf(m.w, " %s |", markdownEscaper.Replace(f.Name))
+	}
+	m.w.WriteString("\n|")
+	for _, f := range schema.Fields() {
+		if isNumeric(f.Type) {
+			m.w.WriteString(" ---: |")
+		} else {
+			m.w.WriteString(" :--- |")
+		}
+	}
+	m.w.WriteString("\n")
+}
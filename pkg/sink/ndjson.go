@@ -0,0 +1,77 @@
+package sink
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// NDJSONOptions controls how NDJSONWriter encodes the result.
+type NDJSONOptions struct {
+	// NullString is written as a JSON string for missing values when set; "null"
+	// keeps them JSON null. Only top-level NULL values are replaced: NULL elements of
+	// arrays, maps and structs stay null.
+	NullString *string
+}
+
+// NDJSONWriter writes one JSON object per row, with keys in schema order.
+type NDJSONWriter struct {
+	w    *bufio.Writer
+	null []byte // encoded NULL value
+}
+
+// NewNDJSONWriter returns a Writer that encodes batches as newline-delimited JSON to w.
+func NewNDJSONWriter(w io.Writer, opts NDJSONOptions) *NDJSONWriter {
+	null := []byte("null")
+	if opts.NullString != nil && *opts.NullString != "null" {
+		null, _ = json.Marshal(*opts.NullString)
+	}
+	return &NDJSONWriter{w: bufio.NewWriter(w), null: null}
+}
+
+// Write encodes every row of the batch as a JSON object on its own line.
+func (n *NDJSONWriter) Write(rec arrow.Record) error {
+	// Encode the column names once per batch.
+	fields := rec.Schema().Fields()
+	keys := make([][]byte, len(fields))
+	for i, f := range fields {
+		key, err := json.Marshal(f.Name)
+		if err != nil {
+			return fmt.Errorf("ndjson: %w", err)
+		}
+		keys[i] = key
+	}
+
+	for row := 0; row < int(rec.NumRows()); row++ {
+		n.w.WriteByte('{')
+		for i, col := range rec.Columns() {
+			if i > 0 {
+				n.w.WriteByte(',')
+			}
+			n.w.Write(keys[i])
+			n.w.WriteByte(':')
+			if col.IsNull(row) {
+				n.w.Write(n.null)
+				continue
+			}
+			val, err := json.Marshal(arrowfetch.JSONValue(col, row))
+			if err != nil {
+				return fmt.Errorf("ndjson: column %s: %w", fields[i].Name, err)
+			}
+			n.w.Write(val)
+		}
+		n.w.WriteString("}\n")
+	}
+	// Flush after every batch so the output streams instead of growing in memory.
+	return n.w.Flush()
+}
+
+// Close flushes buffered rows.
+func (n *NDJSONWriter) Close() error {
+	return n.w.Flush()
+}
@@ -0,0 +1,242 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/scritchley/orc"
+)
+
+// ORCOptions configures the ORC writer.
+type ORCOptions struct {
+	// Compression is the stream codec: zlib (the default) or none.
+	Compression string
+}
+
+// ORCWriter streams batches into an ORC file.
+// The ORC schema is derived from the Arrow schema of the first batch.
+type ORCWriter struct {
+	w      io.Writer
+	codec  orc.CompressionCodec
+	orc    *orc.Writer
+	values []orcValueFunc
+}
+
+// orcValueFunc converts a non-null cell into the Go value the ORC writer expects.
+type orcValueFunc func(arr arrow.Array, i int) interface{}
+
+// NewORCWriter returns a Writer that encodes batches as an ORC file to w.
+func NewORCWriter(w io.Writer, opts ORCOptions) (*ORCWriter, error) {
+	var codec orc.CompressionCodec
+	switch strings.ToLower(opts.Compression) {
+	case "", "zlib", "gzip", "deflate":
+		codec = orc.CompressionZlib{Level: -1}
+	case "none":
+		codec = orc.CompressionNone{}
+	default:
+		return nil, fmt.Errorf("orc: unsupported compression codec %q", opts.Compression)
+	}
+	return &ORCWriter{w: w, codec: codec}, nil
+}
+
+// Write appends the rows of the batch to the current stripe.
+func (o *ORCWriter) Write(rec arrow.Record) error {
+	if o.orc == nil {
+		if err := o.start(rec.Schema()); err != nil {
+			return err
+		}
+	}
+
+	row := make([]interface{}, len(o.values))
+	for i := 0; i < int(rec.NumRows()); i++ {
+		for j, value := range o.values {
+			row[j] = orcDatum(value, rec.Column(j), i)
+		}
+		if err := o.orc.Write(row...); err != nil {
+			return fmt.Errorf("orc: %w", err)
+		}
+	}
+	return nil
+}
+
+// Close writes the last stripe and the file footer.
+func (o *ORCWriter) Close() error {
+	if o.orc == nil {
+		return nil
+	}
+	if err := o.orc.Close(); err != nil {
+		return fmt.Errorf("orc: %w", err)
+	}
+	return nil
+}
+
+// start maps the Arrow schema to ORC and creates the file writer.
+func (o *ORCWriter) start(schema *arrow.Schema) error {
+	def, values, err := orcStruct(schema.Fields())
+	if err != nil {
+		return err
+	}
+	td, err := orc.ParseSchema(def)
+	if err != nil {
+		return fmt.Errorf("orc: invalid schema %s: %w", def, err)
+	}
+	w, err := orc.NewWriter(o.w, orc.SetSchema(td), orc.SetCompression(o.codec))
+	if err != nil {
+		return fmt.Errorf("orc: %w", err)
+	}
+	o.orc = w
+	o.values = values
+	return nil
+}
+
+// orcDatum converts one cell, passing nulls through as nil.
+func orcDatum(value orcValueFunc, arr arrow.Array, i int) interface{} {
+	if arr.IsNull(i) {
+		return nil
+	}
+	return value(arr, i)
+}
+
+// orcStruct maps a list of Arrow fields to an ORC struct type definition.
+func orcStruct(fields []arrow.Field) (string, []orcValueFunc, error) {
+	defs := make([]string, len(fields))
+	values := make([]orcValueFunc, len(fields))
+	for i, f := range fields {
+		def, value, err := orcTypeOf(f.Type)
+		if err != nil {
+			return "", nil, fmt.Errorf("orc: field %s: %w", f.Name, err)
+		}
+		defs[i] = columnName(f.Name) + ":" + def
+		values[i] = value
+	}
+	return "struct<" + strings.Join(defs, ",") + ">", values, nil
+}
+
+// orcTypeOf maps an Arrow data type to an ORC type definition and value conversion.
+// The ORC library cannot write tinyint, binary or decimal columns, so small integers
+// are widened to smallint and decimals are written as strings with their exact digits.
+func orcTypeOf(dt arrow.DataType) (string, orcValueFunc, error) {
+	switch dt := dt.(type) {
+	case *arrow.BooleanType:
+		return "boolean", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Boolean).Value(i)
+		}, nil
+	case *arrow.Int8Type:
+		return "smallint", func(arr arrow.Array, i int) interface{} {
+			return int64(arr.(*array.Int8).Value(i))
+		}, nil
+	case *arrow.Int16Type:
+		return "smallint", func(arr arrow.Array, i int) interface{} {
+			return int64(arr.(*array.Int16).Value(i))
+		}, nil
+	case *arrow.Int32Type:
+		return "int", func(arr arrow.Array, i int) interface{} {
+			return int64(arr.(*array.Int32).Value(i))
+		}, nil
+	case *arrow.Int64Type:
+		return "bigint", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Int64).Value(i)
+		}, nil
+	case *arrow.Uint8Type:
+		return "smallint", func(arr arrow.Array, i int) interface{} {
+			return int64(arr.(*array.Uint8).Value(i))
+		}, nil
+	case *arrow.Uint16Type:
+		return "int", func(arr arrow.Array, i int) interface{} {
+			return int64(arr.(*array.Uint16).Value(i))
+		}, nil
+	case *arrow.Uint32Type:
+		return "bigint", func(arr arrow.Array, i int) interface{} {
+			return int64(arr.(*array.Uint32).Value(i))
+		}, nil
+	case *arrow.Float32Type:
+		return "float", func(arr arrow.Array, i int) interface{} {
+			return float32(arr.(*array.Float32).Value(i))
+		}, nil
+	case *arrow.Float64Type:
+		return "double", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Float64).Value(i)
+		}, nil
+	case *arrow.StringType:
+		return "string", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.String).Value(i)
+		}, nil
+	case *arrow.LargeStringType:
+		return "string", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.LargeString).Value(i)
+		}, nil
+	case *arrow.Date32Type:
+		return "date", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Date32).Value(i).ToTime()
+		}, nil
+	case *arrow.Date64Type:
+		return "date", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Date64).Value(i).ToTime()
+		}, nil
+	case *arrow.TimestampType:
+		unit := dt.Unit
+		return "timestamp", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Timestamp).Value(i).ToTime(unit)
+		}, nil
+	case *arrow.Decimal128Type:
+		scale := dt.Scale
+		return "string", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Decimal128).Value(i).ToString(scale)
+		}, nil
+	case *arrow.Decimal256Type:
+		scale := dt.Scale
+		return "string", func(arr arrow.Array, i int) interface{} {
+			return arr.(*array.Decimal256).Value(i).ToString(scale)
+		}, nil
+	case *arrow.ListType:
+		def, elem, err := orcTypeOf(dt.Elem())
+		if err != nil {
+			return "", nil, err
+		}
+		return "array<" + def + ">", func(arr arrow.Array, i int) interface{} {
+			list := arr.(*array.List)
+			start, end := list.ValueOffsets(i)
+			items := make([]interface{}, 0, end-start)
+			for j := start; j < end; j++ {
+				items = append(items, orcDatum(elem, list.ListValues(), int(j)))
+			}
+			return items
+		}, nil
+	case *arrow.MapType:
+		keyDef, key, err := orcTypeOf(dt.KeyType())
+		if err != nil {
+			return "", nil, err
+		}
+		itemDef, item, err := orcTypeOf(dt.ItemType())
+		if err != nil {
+			return "", nil, err
+		}
+		return "map<" + keyDef + "," + itemDef + ">", func(arr arrow.Array, i int) interface{} {
+			m := arr.(*array.Map)
+			start, end := m.ValueOffsets(i)
+			out := make(map[interface{}]interface{}, end-start)
+			for j := start; j < end; j++ {
+				out[key(m.Keys(), int(j))] = orcDatum(item, m.Items(), int(j))
+			}
+			return out
+		}, nil
+	case *arrow.StructType:
+		def, fields, err := orcStruct(dt.Fields())
+		if err != nil {
+			return "", nil, err
+		}
+		return def, func(arr arrow.Array, i int) interface{} {
+			st := arr.(*array.Struct)
+			row := make([]interface{}, len(fields))
+			for j, value := range fields {
+				row[j] = orcDatum(value, st.Field(j), i)
+			}
+			return row
+		}, nil
+	default:
+		return "", nil, fmt.Errorf("unsupported arrow type %s", dt)
+	}
+}
@@ -0,0 +1,249 @@
+package sink
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/csv"
+)
+
+// Encoder encodes one record batch to w. header asks for the column header first, for
+// formats that have one.
+type Encoder func(w io.Writer, rec arrow.Record, header bool) error
+
+// CSVEncoder returns an Encoder that encodes the rows of a batch as CSV, as CSVWriter
+// does with opts.
+func CSVEncoder(opts CSVOptions) Encoder {
+	return func(w io.Writer, rec arrow.Record, header bool) (err error) {
+		rec = csvText(rec)
+		defer rec.Release()
+		// The Arrow CSV writer panics on types it cannot encode (e.g. unions).
+		defer func() {
+			if r := recover(); r != nil {
+				err = fmt.Errorf("csv: %v", r)
+			}
+		}()
+		cw := csv.NewWriter(w, rec.Schema(), csvOptions(opts, header)...)
+		if err := cw.Write(rec); err != nil {
+			return fmt.Errorf("csv: %w", err)
+		}
+		return cw.Flush()
+	}
+}
+
+// NDJSONEncoder returns an Encoder that encodes the rows of a batch as newline-delimited
+// JSON, as NDJSONWriter does with opts.
+func NDJSONEncoder(opts NDJSONOptions) Encoder {
+	return func(w io.Writer, rec arrow.Record, header bool) error {
+		n := NewNDJSONWriter(w, opts)
+		if err := n.Write(rec); err != nil {
+			return err
+		}
+		return n.Close()
+	}
+}
+
+// ParallelWriter encodes batches on several goroutines and writes the encoded bytes to
+// one output. In ordered mode the batches appear in the order they were written;
+// otherwise each appears as soon as it is encoded, which keeps all workers busy when
+// some batches take longer than others.
+type ParallelWriter struct {
+	out     io.Writer
+	encode  Encoder
+	ordered bool
+
+	jobs    chan encodeJob
+	results chan encodeJob
+	workers sync.WaitGroup
+	writer  sync.WaitGroup
+	seq     int
+
+	mu  sync.Mutex
+	err error // first error of a worker or of the output
+}
+
+// encodeJob is one batch to encode and, once done, its encoding.
+type encodeJob struct {
+	seq  int
+	rec  arrow.Record
+	data []byte
+	err  error
+}
+
+// NewParallelWriter returns a Writer that encodes batches with encode on workers
+// goroutines and writes them to out.
+func NewParallelWriter(out io.Writer, workers int, ordered bool, encode Encoder) *ParallelWriter {
+	p := &ParallelWriter{
+		out:     out,
+		encode:  encode,
+		ordered: ordered,
+		jobs:    make(chan encodeJob, workers),
+		results: make(chan encodeJob, workers),
+	}
+	for i := 0; i < workers; i++ {
+		p.workers.Add(1)
+		go p.work()
+	}
+	p.writer.Add(1)
+	go p.collect()
+	return p
+}
+
+// Write queues rec for encoding. It blocks while all workers are busy and returns the
+// first error met by a worker or the output so far.
+func (p *ParallelWriter) Write(rec arrow.Record) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+	if p.seq == 0 {
+		// The header goes out before any batch, whichever is encoded first.
+		empty := rec.NewSlice(0, 0)
+		err := p.encode(p.out, empty, true)
+		empty.Release()
+		if err != nil {
+			return err
+		}
+	}
+	rec.Retain()
+	p.jobs <- encodeJob{seq: p.seq, rec: rec}
+	p.seq++
+	return nil
+}
+
+// Close waits for the queued batches to be encoded and written.
+func (p *ParallelWriter) Close() error {
+	close(p.jobs)
+	p.workers.Wait()
+	close(p.results)
+	p.writer.Wait()
+	return p.failed()
+}
+
+// work encodes batches until the queue is closed.
+func (p *ParallelWriter) work() {
+	defer p.workers.Done()
+	for job := range p.jobs {
+		var buf bytes.Buffer
+		job.err = p.encode(&buf, job.rec, false)
+		job.data = buf.Bytes()
+		job.rec.Release()
+		job.rec = nil
+		p.results <- job
+	}
+}
+
+// collect writes the encoded batches to the output, holding back the ones that are
+// early in ordered mode.
+func (p *ParallelWriter) collect() {
+	defer p.writer.Done()
+	early := map[int]encodeJob{}
+	next := 0
+	for job := range p.results {
+		if !p.ordered {
+			p.emit(job)
+			continue
+		}
+		early[job.seq] = job
+		for {
+			job, ok := early[next]
+			if !ok {
+				break
+			}
+			delete(early, next)
+			p.emit(job)
+			next++
+		}
+	}
+}
+
+// emit writes one encoded batch, unless an error already stopped the output.
+func (p *ParallelWriter) emit(job encodeJob) {
+	if p.failed() != nil {
+		return
+	}
+	err := job.err
+	if err == nil {
+		_, err = p.out.Write(job.data)
+	}
+	if err != nil {
+		p.mu.Lock()
+		p.err = err
+		p.mu.Unlock()
+	}
+}
+
+func (p *ParallelWriter) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// PoolWriter hands batches to several Writers, each running on its own goroutine, such
+// as Parquet writers to separate part files. A batch goes to whichever Writer is free,
+// so the order of the rows across the parts is not defined.
+type PoolWriter struct {
+	writers []Writer
+	jobs    chan arrow.Record
+	wg      sync.WaitGroup
+
+	mu  sync.Mutex
+	err error
+}
+
+// NewPoolWriter returns a Writer that spreads batches over writers.
+func NewPoolWriter(writers []Writer) *PoolWriter {
+	p := &PoolWriter{writers: writers, jobs: make(chan arrow.Record)}
+	for _, w := range writers {
+		p.wg.Add(1)
+		go func(w Writer) {
+			defer p.wg.Done()
+			for rec := range p.jobs {
+				err := w.Write(rec)
+				rec.Release()
+				if err != nil {
+					p.setErr(err)
+				}
+			}
+		}(w)
+	}
+	return p
+}
+
+// Write passes rec to the next free Writer and returns the first error met so far.
+func (p *PoolWriter) Write(rec arrow.Record) error {
+	if err := p.failed(); err != nil {
+		return err
+	}
+	rec.Retain()
+	p.jobs <- rec
+	return nil
+}
+
+// Close waits for the Writers to finish their batches and closes them.
+func (p *PoolWriter) Close() error {
+	close(p.jobs)
+	p.wg.Wait()
+	for _, w := range p.writers {
+		if err := w.Close(); err != nil {
+			p.setErr(err)
+		}
+	}
+	return p.failed()
+}
+
+func (p *PoolWriter) setErr(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *PoolWriter) failed() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
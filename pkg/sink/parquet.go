@@ -0,0 +1,204 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/compress"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+)
+
+// ParquetOptions configures the Parquet writer.
+type ParquetOptions struct {
+	// Compression is the codec name: snappy, zstd, gzip, brotli or none.
+	Compression string
+
+	// RowGroupSize is the maximum number of rows per row group. Zero keeps the library default.
+	RowGroupSize int64
+
+	// DataPageSize is the size in bytes at which a data page is closed. Smaller pages let
+	// readers skip more precisely, larger ones compress better. Zero keeps the library
+	// default of 1 MiB.
+	DataPageSize int64
+
+	// Dictionary turns dictionary encoding on or off for every column; nil keeps it on.
+	// ColumnDictionary overrides it for single columns, by name, nested columns included.
+	Dictionary       *bool
+	ColumnDictionary map[string]bool
+
+	// Version is the version of the format the file declares, 1.0, 2.4 or 2.6; readers
+	// that only know 1.0 cannot read the newer logical types, such as nanosecond
+	// timestamps. Empty keeps 2.6.
+	Version string
+
+	// DataPageVersion is the version of the data pages, 1 or 2. Not every reader
+	// supports version 2. Zero keeps version 1.
+	DataPageVersion int
+}
+
+// parquetVersions are the format versions of ParquetOptions.Version.
+var parquetVersions = map[string]parquet.Version{"1.0": parquet.V1_0, "2.4": parquet.V2_4, "2.6": parquet.V2_6}
+
+// ParseDictionary parses a dictionary encoding specification such as "off" or
+// "off, payment_type=on, vendor=on": on or off for every column, and column=on or
+// column=off for single columns.
+func ParseDictionary(spec string) (all *bool, columns map[string]bool, err error) {
+	columns = map[string]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		if !ok {
+			name, value = "", item
+		}
+		var on bool
+		switch strings.ToLower(strings.TrimSpace(value)) {
+		case "on", "true":
+			on = true
+		case "off", "false":
+		default:
+			return nil, nil, fmt.Errorf("invalid dictionary setting %q, expected on, off, or <column>=on|off", item)
+		}
+		if name = strings.TrimSpace(name); name == "" && !ok {
+			all = &on
+		} else if name != "" {
+			columns[name] = on
+		} else {
+			return nil, nil, fmt.Errorf("invalid dictionary setting %q: no column name", item)
+		}
+	}
+	return all, columns, nil
+}
+
+// ParquetWriter writes batches into a single Parquet file.
+// Rows are buffered across batches until a row group is full.
+type ParquetWriter struct {
+	w     io.Writer
+	opts  ParquetOptions
+	props []parquet.WriterProperty
+	pq    *pqarrow.FileWriter
+}
+
+// NewParquetWriter returns a Writer that encodes batches as a Parquet file to w.
+func NewParquetWriter(w io.Writer, opts ParquetOptions) (*ParquetWriter, error) {
+	codec, err := parseCodec(opts.Compression)
+	if err != nil {
+		return nil, err
+	}
+
+	props := []parquet.WriterProperty{parquet.WithCompression(codec)}
+	if opts.RowGroupSize > 0 {
+		props = append(props, parquet.WithMaxRowGroupLength(opts.RowGroupSize))
+	}
+	if opts.DataPageSize > 0 {
+		props = append(props, parquet.WithDataPageSize(opts.DataPageSize))
+	}
+	if opts.Dictionary != nil {
+		props = append(props, parquet.WithDictionaryDefault(*opts.Dictionary))
+	}
+	if opts.Version != "" {
+		version, ok := parquetVersions[opts.Version]
+		if !ok {
+			return nil, fmt.Errorf("parquet: unsupported format version %q, expected 1.0, 2.4 or 2.6", opts.Version)
+		}
+		props = append(props, parquet.WithVersion(version))
+	}
+	switch opts.DataPageVersion {
+	case 0, 1:
+	case 2:
+		props = append(props, parquet.WithDataPageVersion(parquet.DataPageV2))
+	default:
+		return nil, fmt.Errorf("parquet: unsupported data page version %d, expected 1 or 2", opts.DataPageVersion)
+	}
+
+	// The Parquet file writer closes its sink, so hide Close from it.
+	return &ParquetWriter{
+		w:     struct{ io.Writer }{w},
+		opts:  opts,
+		props: props,
+	}, nil
+}
+
+// columnDictionary returns the properties of the dictionary settings of single
+// columns in schema, which apply to every leaf column under a nested one.
+func (p *ParquetWriter) columnDictionary(schema *arrow.Schema, arrowProps pqarrow.ArrowWriterProperties) ([]parquet.WriterProperty, error) {
+	if len(p.opts.ColumnDictionary) == 0 {
+		return nil, nil
+	}
+	names := map[string]bool{}
+	for name := range p.opts.ColumnDictionary {
+		idx := columnIndex(schema, name)
+		if idx < 0 {
+			return nil, fmt.Errorf("dictionary setting for %q, which is not a column of the result", name)
+		}
+		names[schema.Field(idx).Name] = p.opts.ColumnDictionary[name]
+	}
+	sc, err := pqarrow.ToParquet(schema, parquet.NewWriterProperties(p.props...), arrowProps)
+	if err != nil {
+		return nil, err
+	}
+	var props []parquet.WriterProperty
+	for i := 0; i < sc.NumColumns(); i++ {
+		path := sc.Column(i).ColumnPath()
+		if on, ok := names[path[0]]; ok {
+			props = append(props, parquet.WithDictionaryPath(path, on))
+		}
+	}
+	return props, nil
+}
+
+// parseCodec maps a codec name to the Parquet compression type.
+func parseCodec(name string) (compress.Compression, error) {
+	switch strings.ToLower(name) {
+	case "", "snappy":
+		return compress.Codecs.Snappy, nil
+	case "zstd":
+		return compress.Codecs.Zstd, nil
+	case "gzip":
+		return compress.Codecs.Gzip, nil
+	case "brotli":
+		return compress.Codecs.Brotli, nil
+	case "none", "uncompressed":
+		return compress.Codecs.Uncompressed, nil
+	default:
+		return compress.Codecs.Uncompressed, fmt.Errorf("parquet: unsupported compression codec %q", name)
+	}
+}
+
+// Write appends the batch to the current row group.
+func (p *ParquetWriter) Write(rec arrow.Record) error {
+	if p.pq == nil {
+		// Store the Arrow schema in the file metadata so readers get the exact types back.
+		arrowProps := pqarrow.NewArrowWriterProperties(pqarrow.WithStoreSchema())
+		dict, err := p.columnDictionary(rec.Schema(), arrowProps)
+		if err != nil {
+			return fmt.Errorf("parquet: %w", err)
+		}
+		props := parquet.NewWriterProperties(append(p.props, dict...)...)
+		pq, err := pqarrow.NewFileWriter(rec.Schema(), p.w, props, arrowProps)
+		if err != nil {
+			return fmt.Errorf("parquet: %w", err)
+		}
+		p.pq = pq
+	}
+	if err := p.pq.WriteBuffered(rec); err != nil {
+		return fmt.Errorf("parquet: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the last row group and writes the file footer.
+func (p *ParquetWriter) Close() error {
+	if p.pq == nil {
+		return nil
+	}
+	if err := p.pq.Close(); err != nil {
+		return fmt.Errorf("parquet: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package sink_test
+
+import (
+	"bytes"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/parquet"
+	"github.com/apache/arrow/go/v12/parquet/file"
+)
+
+func TestParquetTuning(t *testing.T) {
+	all, columns, err := sink.ParseDictionary("off, NAME=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recs := arrowfetchtest.Batches(1, 50)
+	defer recs[0].Release()
+	var buf bytes.Buffer
+	w, err := sink.NewParquetWriter(&buf, sink.ParquetOptions{
+		Dictionary:       all,
+		ColumnDictionary: columns,
+		Version:          "1.0",
+		DataPageVersion:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Write(recs[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := file.NewParquetReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if v := r.MetaData().Version(); v != parquet.V1_0 {
+		t.Errorf("version %s, want 1.0", v)
+	}
+	rg := r.MetaData().RowGroup(0)
+	for i := 0; i < rg.NumColumns(); i++ {
+		col, err := rg.ColumnChunk(i)
+		if err != nil {
+			t.Fatal(err)
+		}
+		name := col.PathInSchema().String()
+		if want := name == "name"; col.HasDictionaryPage() != want {
+			t.Errorf("column %s has a dictionary page: %t, want %t", name, col.HasDictionaryPage(), want)
+		}
+	}
+}
+
+func TestParseDictionaryErrors(t *testing.T) {
+	for _, spec := range []string{"maybe", "=on", "zip=yes"} {
+		if _, _, err := sink.ParseDictionary(spec); err == nil {
+			t.Errorf("ParseDictionary(%q) succeeded", spec)
+		}
+	}
+}
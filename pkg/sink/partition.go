@@ -0,0 +1,276 @@
+package sink
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/compute"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// HiveNullPartition is the directory name of the partition of NULL values, as Hive and
+// Spark name it.
+const HiveNullPartition = "__HIVE_DEFAULT_PARTITION__"
+
+// PartitionWriter splits the rows of each record by the values of some columns and
+// writes each group to the Writer of its partition, opened on first use for the Hive-style
+// path of the values, e.g. pickup_zip=10001 or year=2024/month=1. The partition columns
+// are left out of the records written, as their values are in the path.
+//
+// At most maxOpen Writers are open at once: opening one more closes the Writer of the
+// partition written least recently, and a partition seen again after its Writer was
+// closed gets a new Writer from open, which must then write to a new file. With maxOpen
+// 0 the Writers of all partitions stay open until Close.
+type PartitionWriter struct {
+	columns []string
+	maxOpen int
+	open    func(dir string) (Writer, error)
+
+	writers map[string]Writer // the open Writers
+	used    map[string]int64  // when each open Writer was last written to
+	writes  int64
+	seen    map[string]bool
+	order   []string // partition paths in the order they were first seen
+
+	// The partition columns are resolved on the first record and reused while the
+	// schema stays the same.
+	schema  *arrow.Schema
+	indices []int
+	out     *arrow.Schema
+}
+
+// NewPartitionWriter returns a Writer that partitions records by columns and writes
+// them to the Writers returned by open for each partition path, keeping at most maxOpen
+// of them open (0 for no limit).
+func NewPartitionWriter(columns []string, maxOpen int, open func(dir string) (Writer, error)) *PartitionWriter {
+	return &PartitionWriter{
+		columns: columns,
+		maxOpen: maxOpen,
+		open:    open,
+		writers: map[string]Writer{},
+		used:    map[string]int64{},
+		seen:    map[string]bool{},
+	}
+}
+
+// Write splits rec by partition and writes each part.
+func (p *PartitionWriter) Write(rec arrow.Record) error {
+	if p.schema == nil || !p.schema.Equal(rec.Schema()) {
+		if err := p.resolve(rec.Schema()); err != nil {
+			return err
+		}
+	}
+
+	// Group the rows by the path of their partition, in order of appearance.
+	var dirs []string
+	rows := map[string][]int{}
+	for i := 0; i < int(rec.NumRows()); i++ {
+		parts := make([]string, len(p.indices))
+		for k, idx := range p.indices {
+			parts[k] = partitionSegment(rec.ColumnName(idx), rec.Column(idx), i)
+		}
+		dir := strings.Join(parts, "/")
+		if _, ok := rows[dir]; !ok {
+			dirs = append(dirs, dir)
+		}
+		rows[dir] = append(rows[dir], i)
+	}
+
+	for _, dir := range dirs {
+		part, err := p.partRows(rec, rows[dir])
+		if err != nil {
+			return err
+		}
+		err = p.writePart(dir, part)
+		part.Release()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// partRows returns the given rows of rec without the partition columns.
+func (p *PartitionWriter) partRows(rec arrow.Record, rows []int) (arrow.Record, error) {
+	cols := make([]arrow.Array, 0, len(p.out.Fields()))
+	for i, col := range rec.Columns() {
+		if !p.isPartition(i) {
+			cols = append(cols, col)
+		}
+	}
+	data := array.NewRecord(p.out, cols, rec.NumRows())
+	if len(rows) == int(rec.NumRows()) {
+		return data, nil
+	}
+	defer data.Release()
+	if last := rows[len(rows)-1]; last-rows[0] == len(rows)-1 {
+		// The rows of the partition are adjacent, as with a result ordered by it.
+		return data.NewSlice(int64(rows[0]), int64(last+1)), nil
+	}
+	mask := array.NewBooleanBuilder(memory.DefaultAllocator)
+	defer mask.Release()
+	keep := make([]bool, rec.NumRows())
+	for _, i := range rows {
+		keep[i] = true
+	}
+	mask.AppendValues(keep, nil)
+	filter := mask.NewBooleanArray()
+	defer filter.Release()
+	return compute.FilterRecordBatch(context.Background(), data, filter, compute.DefaultFilterOptions())
+}
+
+// writePart writes rows to the Writer of the partition dir, opening it if needed.
+func (p *PartitionWriter) writePart(dir string, rows arrow.Record) error {
+	w, ok := p.writers[dir]
+	if !ok {
+		if p.maxOpen > 0 && len(p.writers) >= p.maxOpen {
+			if err := p.closeLeastRecent(); err != nil {
+				return err
+			}
+		}
+		var err error
+		if w, err = p.open(dir); err != nil {
+			return fmt.Errorf("partition %s: %w", dir, err)
+		}
+		p.writers[dir] = w
+		if !p.seen[dir] {
+			p.seen[dir] = true
+			p.order = append(p.order, dir)
+		}
+	}
+	p.writes++
+	p.used[dir] = p.writes
+	return w.Write(rows)
+}
+
+// closeLeastRecent closes the open Writer written to least recently.
+func (p *PartitionWriter) closeLeastRecent() error {
+	var oldest string
+	for dir, n := range p.used {
+		if oldest == "" || n < p.used[oldest] {
+			oldest = dir
+		}
+	}
+	w := p.writers[oldest]
+	delete(p.writers, oldest)
+	delete(p.used, oldest)
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("partition %s: %w", oldest, err)
+	}
+	return nil
+}
+
+// Partitions returns the number of partitions written so far.
+func (p *PartitionWriter) Partitions() int {
+	return len(p.order)
+}
+
+// Flush flushes the open Writers of all partitions that hold back output.
+func (p *PartitionWriter) Flush() error {
+	for _, dir := range p.order {
+		if w, ok := p.writers[dir]; ok {
+			if err := Flush(w); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// Close closes the open Writers of all partitions.
+func (p *PartitionWriter) Close() error {
+	var first error
+	for _, dir := range p.order {
+		if w, ok := p.writers[dir]; ok {
+			if err := w.Close(); err != nil && first == nil {
+				first = fmt.Errorf("partition %s: %w", dir, err)
+			}
+		}
+	}
+	return first
+}
+
+// Abort discards the partitions whose open Writers support it, such as uploads, and
+// closes the others. Writers already closed to keep within maxOpen stay written.
+func (p *PartitionWriter) Abort(err error) {
+	for _, dir := range p.order {
+		w, ok := p.writers[dir]
+		if !ok {
+			continue
+		}
+		if a, ok := w.(interface{ Abort(error) }); ok {
+			a.Abort(err)
+		} else {
+			w.Close()
+		}
+	}
+}
+
+// resolve finds the partition columns in schema and the schema of the records written.
+func (p *PartitionWriter) resolve(schema *arrow.Schema) error {
+	indices := make([]int, len(p.columns))
+	for i, name := range p.columns {
+		idx := columnIndex(schema, name)
+		if idx < 0 {
+			return fmt.Errorf("partition column %q is not a column of the result", name)
+		}
+		if dt := schema.Field(idx).Type; isNested(dt) {
+			return fmt.Errorf("partition column %q has type %s; only scalar columns can partition the output", name, dt)
+		}
+		indices[i] = idx
+	}
+	p.schema, p.indices = schema, indices
+
+	var fields []arrow.Field
+	for i, f := range schema.Fields() {
+		if !p.isPartition(i) {
+			fields = append(fields, f)
+		}
+	}
+	if len(fields) == 0 {
+		return fmt.Errorf("every column is a partition column; the data files would have none")
+	}
+	md := schema.Metadata()
+	p.out = arrow.NewSchema(fields, &md)
+	return nil
+}
+
+func (p *PartitionWriter) isPartition(col int) bool {
+	for _, idx := range p.indices {
+		if idx == col {
+			return true
+		}
+	}
+	return false
+}
+
+// partitionSegment returns the path segment name=value of the value of col at row i,
+// escaped as Hive escapes partition paths.
+func partitionSegment(name string, col arrow.Array, i int) string {
+	value := HiveNullPartition
+	if !col.IsNull(i) {
+		value = escapePartition(TextValue(col, i))
+	}
+	return escapePartition(name) + "=" + value
+}
+
+// escapePartition percent-encodes the characters Hive does not allow in a partition
+// path, such as / and =, so every value maps to one directory and back.
+func escapePartition(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c < 0x20 || c == 0x7f || strings.IndexByte("\"#%'*/:=?\\{[]^", c) >= 0 {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	if b.Len() == 0 {
+		return HiveNullPartition
+	}
+	return b.String()
+}
@@ -0,0 +1,103 @@
+package sink_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+	"dbx_arrow_dbsql/pkg/sink"
+)
+
+func TestPartitionWriter(t *testing.T) {
+	recs := arrowfetchtest.Batches(2, 2)
+	defer func() {
+		for _, rec := range recs {
+			rec.Release()
+		}
+	}()
+	files := map[string]*bytes.Buffer{}
+	var order []string
+	w := sink.NewPartitionWriter([]string{"active"}, 0, func(dir string) (sink.Writer, error) {
+		files[dir] = &bytes.Buffer{}
+		order = append(order, dir)
+		return sink.NewCSVWriter(files[dir], sink.CSVOptions{}), nil
+	})
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(order, " "); got != "active=true active=false" {
+		t.Fatalf("partitions %s, want active=true active=false", got)
+	}
+	for dir, want := range map[string]string{
+		"active=true":  "id,name,amount,day,created\n0,,0,2024-01-01,2024-01-01 00:00:00\n2,name-2,3,2024-01-03,2024-01-01 00:02:00\n",
+		"active=false": "id,name,amount,day,created\n1,name-1,1.5,2024-01-02,2024-01-01 00:01:00\n3,name-3,4.5,2024-01-04,2024-01-01 00:03:00\n",
+	} {
+		if got := files[dir].String(); got != want {
+			t.Errorf("%s\n%s\nwant\n%s", dir, got, want)
+		}
+	}
+}
+
+func TestPartitionWriterMaxOpen(t *testing.T) {
+	recs := arrowfetchtest.Batches(2, 2)
+	defer func() {
+		for _, rec := range recs {
+			rec.Release()
+		}
+	}()
+	// The partitions alternate, so with one open file every row closes the other one.
+	var files []string
+	var bufs []*bytes.Buffer
+	w := sink.NewPartitionWriter([]string{"active"}, 1, func(dir string) (sink.Writer, error) {
+		files = append(files, dir)
+		bufs = append(bufs, &bytes.Buffer{})
+		return sink.NewCSVWriter(bufs[len(bufs)-1], sink.CSVOptions{}), nil
+	})
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(files, " "), "active=true active=false active=true active=false"; got != want {
+		t.Fatalf("files opened %s, want %s", got, want)
+	}
+	if w.Partitions() != 2 {
+		t.Errorf("Partitions() = %d, want 2", w.Partitions())
+	}
+	for i, want := range []string{"0,", "1,", "2,", "3,"} {
+		if lines := strings.Split(bufs[i].String(), "\n"); len(lines) != 3 || !strings.HasPrefix(lines[1], want) {
+			t.Errorf("file %d of %s:\n%s", i, files[i], bufs[i])
+		}
+	}
+}
+
+func TestPartitionWriterPaths(t *testing.T) {
+	recs := arrowfetchtest.Batches(1, 3)
+	defer recs[0].Release()
+	var dirs []string
+	w := sink.NewPartitionWriter([]string{"name", "id"}, 0, func(dir string) (sink.Writer, error) {
+		dirs = append(dirs, dir)
+		return sink.NewCSVWriter(&bytes.Buffer{}, sink.CSVOptions{}), nil
+	})
+	if err := w.Write(recs[0]); err != nil {
+		t.Fatal(err)
+	}
+	want := "name=" + sink.HiveNullPartition + "/id=0 name=name-1/id=1 name=name-2/id=2"
+	if got := strings.Join(dirs, " "); got != want {
+		t.Errorf("partitions %s, want %s", got, want)
+	}
+
+	w = sink.NewPartitionWriter([]string{"zip"}, 0, nil)
+	if err := w.Write(recs[0]); err == nil || !strings.Contains(err.Error(), `"zip"`) {
+		t.Errorf("Write with an unknown partition column = %v", err)
+	}
+}
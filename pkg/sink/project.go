@@ -0,0 +1,88 @@
+package sink
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+)
+
+// ProjectWriter keeps only the selected columns of each record, in the requested order,
+// before passing it to the wrapped Writer.
+type ProjectWriter struct {
+	w       Writer
+	columns []string
+
+	// The column indices are resolved on the first record and reused while the schema stays the same.
+	schema  *arrow.Schema
+	indices []int
+	out     *arrow.Schema
+}
+
+// NewProjectWriter returns a Writer that writes only columns of each record to w.
+// Names match exactly first and case-insensitively otherwise, as in Databricks SQL.
+func NewProjectWriter(w Writer, columns []string) *ProjectWriter {
+	return &ProjectWriter{w: w, columns: columns}
+}
+
+// Write projects rec onto the selected columns and writes the result.
+func (p *ProjectWriter) Write(rec arrow.Record) error {
+	if p.schema == nil || !p.schema.Equal(rec.Schema()) {
+		if err := p.resolve(rec.Schema()); err != nil {
+			return err
+		}
+	}
+	cols := make([]arrow.Array, len(p.indices))
+	for i, idx := range p.indices {
+		cols[i] = rec.Column(idx)
+	}
+	projected := array.NewRecord(p.out, cols, rec.NumRows())
+	defer projected.Release()
+	return p.w.Write(projected)
+}
+
+// Flush flushes the wrapped Writer if it holds back output.
+func (p *ProjectWriter) Flush() error {
+	return Flush(p.w)
+}
+
+// Close closes the wrapped Writer.
+func (p *ProjectWriter) Close() error {
+	return p.w.Close()
+}
+
+// resolve maps the requested column names to the fields of schema.
+func (p *ProjectWriter) resolve(schema *arrow.Schema) error {
+	indices := make([]int, len(p.columns))
+	fields := make([]arrow.Field, len(p.columns))
+	for i, name := range p.columns {
+		idx := columnIndex(schema, name)
+		if idx < 0 {
+			names := make([]string, len(schema.Fields()))
+			for j, f := range schema.Fields() {
+				names[j] = f.Name
+			}
+			return fmt.Errorf("column %q not found; the result has: %s", name, strings.Join(names, ", "))
+		}
+		indices[i] = idx
+		fields[i] = schema.Field(idx)
+	}
+	md := schema.Metadata()
+	p.schema, p.indices, p.out = schema, indices, arrow.NewSchema(fields, &md)
+	return nil
+}
+
+// columnIndex returns the index of the named field, preferring an exact match over a
+// case-insensitive one, or -1 when there is none.
+func columnIndex(schema *arrow.Schema, name string) int {
+	if idx := schema.FieldIndices(name); len(idx) > 0 {
+		return idx[0]
+	}
+	for i, f := range schema.Fields() {
+		if strings.EqualFold(f.Name, name) {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,162 @@
+package sink
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// Sizer is implemented by Writers that know how many bytes they have written so far.
+type Sizer interface {
+	Size() int64
+}
+
+// RollingOptions are the limits at which a RollingWriter starts the next file. Zero
+// means no limit.
+type RollingOptions struct {
+	// MaxRows is the most rows written to one file.
+	MaxRows int64
+
+	// MaxBytes is the size at which a file is closed. The Writers returned by open must
+	// be Sizers. A file is checked after each batch, and formats that buffer their output,
+	// such as Parquet with its row groups, can go past the limit by a batch or a row group.
+	MaxBytes int64
+}
+
+// RollingWriter writes a result to a sequence of files, part 0, 1, 2 and so on, starting
+// the next once the current one holds MaxRows rows or MaxBytes bytes. A batch is split
+// across files to keep to MaxRows. Every file is a complete file of its format, readable
+// on its own.
+type RollingWriter struct {
+	opts RollingOptions
+	open func(part int) (Writer, error)
+
+	cur   Writer
+	rows  int64 // rows written to cur
+	parts int   // files opened so far
+}
+
+// NewRollingWriter returns a Writer that writes to the files returned by open for each
+// part number, as opts limits them.
+func NewRollingWriter(opts RollingOptions, open func(part int) (Writer, error)) *RollingWriter {
+	return &RollingWriter{opts: opts, open: open}
+}
+
+// Write writes rec to the current file, continuing in new files as they fill up.
+func (r *RollingWriter) Write(rec arrow.Record) error {
+	if rec.NumRows() == 0 {
+		// An empty batch still carries the schema, for formats that write it.
+		if r.cur == nil && r.parts == 0 {
+			if err := r.next(); err != nil {
+				return err
+			}
+		}
+		if r.cur == nil {
+			return nil
+		}
+		return r.cur.Write(rec)
+	}
+	for off := int64(0); off < rec.NumRows(); {
+		if r.cur == nil {
+			if err := r.next(); err != nil {
+				return err
+			}
+		}
+		n := rec.NumRows() - off
+		if r.opts.MaxRows > 0 {
+			n = min(n, r.opts.MaxRows-r.rows)
+		}
+		var err error
+		if n == rec.NumRows() {
+			err = r.cur.Write(rec)
+		} else {
+			part := rec.NewSlice(off, off+n)
+			err = r.cur.Write(part)
+			part.Release()
+		}
+		if err != nil {
+			return err
+		}
+		off += n
+		r.rows += n
+		if err := r.roll(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// roll closes the current file once it has reached a limit. The next file is opened by
+// the next Write, so a result that ends on a limit has no empty last file.
+func (r *RollingWriter) roll() error {
+	full := r.opts.MaxRows > 0 && r.rows >= r.opts.MaxRows
+	if !full && r.opts.MaxBytes > 0 {
+		sizer, ok := r.cur.(Sizer)
+		if !ok {
+			return errors.New("the output cannot report its size for a maximum file size")
+		}
+		full = sizer.Size() >= r.opts.MaxBytes
+	}
+	if !full {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	if err != nil {
+		return fmt.Errorf("part %d: %w", r.parts-1, err)
+	}
+	return nil
+}
+
+func (r *RollingWriter) next() error {
+	w, err := r.open(r.parts)
+	if err != nil {
+		return fmt.Errorf("part %d: %w", r.parts, err)
+	}
+	r.cur, r.rows = w, 0
+	r.parts++
+	return nil
+}
+
+// Parts returns the number of files written so far.
+func (r *RollingWriter) Parts() int {
+	return r.parts
+}
+
+// Flush flushes the current file if its Writer holds back output.
+func (r *RollingWriter) Flush() error {
+	if r.cur == nil {
+		return nil
+	}
+	return Flush(r.cur)
+}
+
+// Close closes the current file. An empty result is still written as one file.
+func (r *RollingWriter) Close() error {
+	if r.parts == 0 {
+		if err := r.next(); err != nil {
+			return err
+		}
+	}
+	if r.cur == nil {
+		return nil
+	}
+	err := r.cur.Close()
+	r.cur = nil
+	return err
+}
+
+// Abort discards the current file if its Writer supports it, such as an upload; the
+// files already complete are kept.
+func (r *RollingWriter) Abort(err error) {
+	if r.cur == nil {
+		return
+	}
+	if a, ok := r.cur.(interface{ Abort(error) }); ok {
+		a.Abort(err)
+	} else {
+		r.cur.Close()
+	}
+	r.cur = nil
+}
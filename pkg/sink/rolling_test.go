@@ -0,0 +1,58 @@
+package sink_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+	"dbx_arrow_dbsql/pkg/sink"
+)
+
+func TestRollingWriter(t *testing.T) {
+	recs := arrowfetchtest.Batches(2, 3)
+	defer func() {
+		for _, rec := range recs {
+			rec.Release()
+		}
+	}()
+	var files []*bytes.Buffer
+	w := sink.NewRollingWriter(sink.RollingOptions{MaxRows: 4}, func(part int) (sink.Writer, error) {
+		if part != len(files) {
+			t.Errorf("opened part %d after %d parts", part, len(files))
+		}
+		files = append(files, &bytes.Buffer{})
+		return sink.NewCSVWriter(files[part], sink.CSVOptions{}), nil
+	})
+	for _, rec := range recs {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("%d files, want 2", len(files))
+	}
+	for i, want := range []int{4, 2} {
+		// One header line and a line per row.
+		if got := strings.Count(files[i].String(), "\n") - 1; got != want {
+			t.Errorf("part %d has %d rows, want %d", i, got, want)
+		}
+	}
+}
+
+func TestRollingWriterEmpty(t *testing.T) {
+	parts := 0
+	w := sink.NewRollingWriter(sink.RollingOptions{MaxRows: 10}, func(part int) (sink.Writer, error) {
+		parts++
+		return sink.NewCSVWriter(&bytes.Buffer{}, sink.CSVOptions{}), nil
+	})
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if parts != 1 {
+		t.Errorf("an empty result opened %d files, want 1", parts)
+	}
+}
@@ -0,0 +1,110 @@
+package sink
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/compute"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// ErrStop is returned by Write when a Writer needs no more records, e.g. HeadWriter
+// after its row limit. The caller stops fetching and finishes the output as complete.
+var ErrStop = errors.New("no more rows needed")
+
+// HeadWriter passes on the first rows written to it and then reports ErrStop.
+type HeadWriter struct {
+	w    Writer
+	left int64
+}
+
+// NewHeadWriter returns a Writer that writes only the first n rows to w.
+func NewHeadWriter(w Writer, n int64) *HeadWriter {
+	return &HeadWriter{w: w, left: n}
+}
+
+// Write writes the rows of rec still within the limit and returns ErrStop once it is reached.
+func (h *HeadWriter) Write(rec arrow.Record) error {
+	if h.left <= 0 {
+		return ErrStop
+	}
+	if rec.NumRows() > h.left {
+		rec = rec.NewSlice(0, h.left)
+		defer rec.Release()
+	}
+	h.left -= rec.NumRows()
+	if err := h.w.Write(rec); err != nil {
+		return err
+	}
+	if h.left == 0 {
+		return ErrStop
+	}
+	return nil
+}
+
+// Flush flushes the wrapped Writer if it holds back output.
+func (h *HeadWriter) Flush() error {
+	return Flush(h.w)
+}
+
+// Close closes the wrapped Writer.
+func (h *HeadWriter) Close() error {
+	return h.w.Close()
+}
+
+// SampleWriter keeps every row with a fixed probability, independently of the others,
+// so the sample is spread across all the batches of the result.
+type SampleWriter struct {
+	w        Writer
+	fraction float64
+	rand     *rand.Rand
+}
+
+// NewSampleWriter returns a Writer that writes about fraction of the rows to w.
+func NewSampleWriter(w Writer, fraction float64) *SampleWriter {
+	return &SampleWriter{w: w, fraction: fraction, rand: rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))}
+}
+
+// Write writes the sampled rows of rec, if any.
+func (s *SampleWriter) Write(rec arrow.Record) error {
+	mask := array.NewBooleanBuilder(memory.DefaultAllocator)
+	defer mask.Release()
+	mask.Reserve(int(rec.NumRows()))
+	selected := 0
+	for i := 0; i < int(rec.NumRows()); i++ {
+		keep := s.rand.Float64() < s.fraction
+		mask.Append(keep)
+		if keep {
+			selected++
+		}
+	}
+	switch {
+	case selected == 0:
+		return nil
+	case selected == int(rec.NumRows()):
+		return s.w.Write(rec)
+	}
+
+	filter := mask.NewArray()
+	defer filter.Release()
+	sampled, err := compute.FilterRecordBatch(context.Background(), rec, filter, compute.DefaultFilterOptions())
+	if err != nil {
+		return fmt.Errorf("unable to sample the batch: %w", err)
+	}
+	defer sampled.Release()
+	return s.w.Write(sampled)
+}
+
+// Flush flushes the wrapped Writer if it holds back output.
+func (s *SampleWriter) Flush() error {
+	return Flush(s.w)
+}
+
+// Close closes the wrapped Writer.
+func (s *SampleWriter) Close() error {
+	return s.w.Close()
+}
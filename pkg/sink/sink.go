@@ -0,0 +1,43 @@
+// Package sink encodes Arrow record batches into output formats.
+package sink
+
+import (
+	"regexp"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// Writer consumes the record batches of a result and encodes them to an output.
+type Writer interface {
+	// Write encodes one record batch. The record is not retained after Write returns.
+	Write(rec arrow.Record) error
+
+	// Close flushes any buffered output. It does not close the underlying io.Writer.
+	Close() error
+}
+
+// Flusher is implemented by Writers that hold back output until the whole result has
+// been written, such as AggregateWriter. Flush writes that output to the wrapped Writer.
+type Flusher interface {
+	Flush() error
+}
+
+// Flush calls w.Flush when w is a Flusher and does nothing otherwise.
+func Flush(w Writer) error {
+	if f, ok := w.(Flusher); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// invalidNameChars matches the characters that Avro and ORC do not allow in field names.
+var invalidNameChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// columnName turns a column name into an identifier that schema-based formats accept.
+func columnName(name string) string {
+	name = invalidNameChars.ReplaceAllString(name, "_")
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,145 @@
+package sink
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	_ "modernc.org/sqlite" // Registers the pure Go "sqlite" driver.
+)
+
+// SQLiteWriter appends batches to a table of a SQLite database, one transaction per batch.
+type SQLiteWriter struct {
+	db      *sql.DB
+	table   string
+	insert  string
+	created bool
+}
+
+// NewSQLiteWriter opens (or creates) the database file at path and appends batches to table.
+// The table is created from the schema of the first batch when it does not exist yet.
+func NewSQLiteWriter(path, table string) (Writer, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("sqlite: %w", err)
+	}
+	// SQLite allows a single writer; one connection keeps the transactions in order.
+	db.SetMaxOpenConns(1)
+	return &SQLiteWriter{db: db, table: quoteIdent(table)}, nil
+}
+
+// Write inserts the rows of the batch in a single transaction.
+func (s *SQLiteWriter) Write(rec arrow.Record) error {
+	ctx := context.Background()
+	if !s.created {
+		if err := s.createTable(ctx, rec.Schema()); err != nil {
+			return err
+		}
+		s.created = true
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+	defer tx.Rollback() // No-op once the transaction is committed.
+
+	stmt, err := tx.PrepareContext(ctx, s.insert)
+	if err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+	defer stmt.Close()
+
+	args := make([]any, rec.NumCols())
+	for i := 0; i < int(rec.NumRows()); i++ {
+		for j, col := range rec.Columns() {
+			args[j] = sqliteValue(col, i)
+		}
+		if _, err := stmt.ExecContext(ctx, args...); err != nil {
+			return fmt.Errorf("sqlite: unable to insert row: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("sqlite: %w", err)
+	}
+	return nil
+}
+
+// Close closes the database.
+func (s *SQLiteWriter) Close() error {
+	return s.db.Close()
+}
+
+// createTable creates the table from the Arrow schema and prepares the insert statement.
+func (s *SQLiteWriter) createTable(ctx context.Context, schema *arrow.Schema) error {
+	columns := make([]string, len(schema.Fields()))
+	names := make([]string, len(schema.Fields()))
+	marks := make([]string, len(schema.Fields()))
+	for i, f := range schema.Fields() {
+		names[i] = quoteIdent(f.Name)
+		columns[i] = names[i] + " " + sqliteType(f.Type)
+		marks[i] = "?"
+	}
+	stmt := fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", s.table, strings.Join(columns, ", "))
+	if _, err := s.db.ExecContext(ctx, stmt); err != nil {
+		return fmt.Errorf("sqlite: unable to create table: %w", err)
+	}
+	s.insert = fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", s.table, strings.Join(names, ", "), strings.Join(marks, ", "))
+	return nil
+}
+
+// sqliteType returns the declared column type for an Arrow type. Decimals are stored as
+// TEXT to keep their exact digits; timestamps and dates as ISO 8601 TEXT.
+func sqliteType(dt arrow.DataType) string {
+	switch dt.ID() {
+	case arrow.BOOL, arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64:
+		return "INTEGER"
+	case arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64:
+		return "REAL"
+	case arrow.BINARY, arrow.LARGE_BINARY, arrow.FIXED_SIZE_BINARY:
+		return "BLOB"
+	default:
+		return "TEXT"
+	}
+}
+
+// sqliteValue converts one value into an argument for the insert statement.
+func sqliteValue(col arrow.Array, i int) any {
+	if col.IsNull(i) {
+		return nil
+	}
+	switch col := col.(type) {
+	case *array.Boolean:
+		return col.Value(i)
+	case *array.Int8:
+		return int64(col.Value(i))
+	case *array.Int16:
+		return int64(col.Value(i))
+	case *array.Int32:
+		return int64(col.Value(i))
+	case *array.Int64:
+		return col.Value(i)
+	case *array.Uint8:
+		return int64(col.Value(i))
+	case *array.Uint16:
+		return int64(col.Value(i))
+	case *array.Uint32:
+		return int64(col.Value(i))
+	case *array.Float32:
+		return float64(col.Value(i))
+	case *array.Float64:
+		return col.Value(i)
+	case *array.Binary:
+		return col.Value(i)
+	case *array.Timestamp:
+		unit := col.DataType().(*arrow.TimestampType).Unit
+		return col.Value(i).ToTime(unit).UTC().Format(time.RFC3339Nano)
+	default:
+		return TextValue(col, i)
+	}
+}
@@ -0,0 +1,271 @@
+package sink
+
+import (
+	"fmt"
+	"hash/maphash"
+	"io"
+	"math"
+	"math/bits"
+	"text/tabwriter"
+	"time"
+	"unicode/utf8"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// ColumnStats summarises the values of one column: the row and NULL counts, the
+// smallest and largest values, and an estimate of the number of distinct values.
+type ColumnStats struct {
+	Name     string
+	Type     string
+	Rows     int64
+	Nulls    int64
+	Min, Max string // text form of the extremes, empty when the type has no ordering
+	Distinct uint64 // HyperLogLog estimate, within about 2%
+
+	min, max any
+	sketch   hll
+}
+
+// StatsWriter computes statistics over every column of the records passing through it
+// to the wrapped Writer. When flushed it prints a summary table to the report writer,
+// preceded by one table per batch when perBatch is set.
+type StatsWriter struct {
+	w        Writer
+	report   io.Writer
+	perBatch bool
+
+	seed    maphash.Seed
+	batches int
+	columns []*ColumnStats
+	index   map[string]int // column name to position in columns
+	printed bool
+}
+
+// NewStatsWriter returns a Writer that writes the records to w unchanged and reports
+// column statistics to report.
+func NewStatsWriter(w Writer, report io.Writer, perBatch bool) *StatsWriter {
+	return &StatsWriter{w: w, report: report, perBatch: perBatch, seed: maphash.MakeSeed(), index: map[string]int{}}
+}
+
+// Write adds the values of rec to the statistics and writes it.
+func (s *StatsWriter) Write(rec arrow.Record) error {
+	s.batches++
+	batch := make([]*ColumnStats, rec.NumCols())
+	for c, col := range rec.Columns() {
+		field := rec.Schema().Field(c)
+		st := &ColumnStats{Name: field.Name, Type: field.Type.String()}
+		for i := 0; i < col.Len(); i++ {
+			st.add(col, i, s.seed)
+		}
+		st.Distinct = st.sketch.estimate()
+		batch[c] = st
+
+		// Merge into the totals; a column seen for the first time is added at the end.
+		k, ok := s.index[field.Name]
+		if !ok {
+			k = len(s.columns)
+			s.index[field.Name] = k
+			s.columns = append(s.columns, &ColumnStats{Name: field.Name, Type: st.Type})
+		}
+		s.columns[k].merge(st)
+	}
+	if s.perBatch {
+		fmt.Fprintf(s.report, "batch %d: %d rows\n", s.batches, rec.NumRows())
+		if err := WriteStats(s.report, batch); err != nil {
+			return err
+		}
+	}
+	return s.w.Write(rec)
+}
+
+// Stats returns the statistics of all the records written so far.
+func (s *StatsWriter) Stats() []*ColumnStats {
+	return s.columns
+}
+
+// Flush prints the summary once and flushes the wrapped Writer.
+func (s *StatsWriter) Flush() error {
+	if !s.printed {
+		s.printed = true
+		fmt.Fprintf(s.report, "column statistics over %d batches:\n", s.batches)
+		if err := WriteStats(s.report, s.columns); err != nil {
+			return err
+		}
+	}
+	return Flush(s.w)
+}
+
+// Close prints the summary if it was not printed yet and closes the wrapped Writer.
+func (s *StatsWriter) Close() error {
+	err := s.Flush()
+	if cerr := s.w.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// WriteStats prints stats as an aligned table.
+func WriteStats(w io.Writer, stats []*ColumnStats) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "COLUMN\tTYPE\tROWS\tNULLS\tNULL %\tMIN\tMAX\tDISTINCT")
+	for _, st := range stats {
+		nullPct := 0.0
+		if st.Rows > 0 {
+			nullPct = 100 * float64(st.Nulls) / float64(st.Rows)
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%.1f\t%s\t%s\t~%d\n",
+			st.Name, st.Type, st.Rows, st.Nulls, nullPct, shorten(st.Min), shorten(st.Max), st.Distinct)
+	}
+	return tw.Flush()
+}
+
+// shorten cuts values longer than 40 characters so the table stays readable.
+func shorten(s string) string {
+	if utf8.RuneCountInString(s) <= 40 {
+		return s
+	}
+	return string([]rune(s)[:39]) + "…"
+}
+
+// add includes the value at row i of col.
+func (st *ColumnStats) add(col arrow.Array, i int, seed maphash.Seed) {
+	st.Rows++
+	if col.IsNull(i) {
+		st.Nulls++
+		return
+	}
+	text := TextValue(col, i)
+	st.sketch.add(maphash.String(seed, text))
+
+	// Nested and binary values have no useful ordering.
+	if !ordered(col.DataType()) {
+		return
+	}
+	v := exprValue(col, i)
+	if c, _ := compareValues(v, st.min); st.min == nil || c < 0 {
+		st.min, st.Min = v, text
+	}
+	if c, _ := compareValues(v, st.max); st.max == nil || c > 0 {
+		st.max, st.Max = v, text
+	}
+}
+
+// merge adds the statistics of another part of the same column.
+func (st *ColumnStats) merge(o *ColumnStats) {
+	st.Rows += o.Rows
+	st.Nulls += o.Nulls
+	if c, ok := compareValues(o.min, st.min); o.min != nil && (st.min == nil || ok && c < 0) {
+		st.min, st.Min = o.min, o.Min
+	}
+	if c, ok := compareValues(o.max, st.max); o.max != nil && (st.max == nil || ok && c > 0) {
+		st.max, st.Max = o.max, o.Max
+	}
+	st.sketch.merge(&o.sketch)
+	st.Distinct = st.sketch.estimate()
+}
+
+// ordered reports whether values of type dt can be compared for the minimum and maximum.
+func ordered(dt arrow.DataType) bool {
+	switch dt.ID() {
+	case arrow.BOOL, arrow.STRING, arrow.LARGE_STRING, arrow.TIMESTAMP, arrow.DATE32, arrow.DATE64:
+		return true
+	}
+	return isNumeric(dt) && dt.ID() != arrow.FLOAT16
+}
+
+// compareValues orders two values of the same kind as returned by exprValue. ok is
+// false for values that cannot be ordered.
+func compareValues(a, b any) (c int, ok bool) {
+	cmp := func(less, greater bool) int {
+		switch {
+		case less:
+			return -1
+		case greater:
+			return 1
+		}
+		return 0
+	}
+	switch a := a.(type) {
+	case int:
+		if b, isInt := b.(int); isInt {
+			return cmp(a < b, a > b), true
+		}
+	case uint64:
+		if b, isUint := b.(uint64); isUint {
+			return cmp(a < b, a > b), true
+		}
+	case float64:
+		if b, isFloat := b.(float64); isFloat {
+			return cmp(a < b, a > b), true
+		}
+	case bool:
+		if b, isBool := b.(bool); isBool {
+			return cmp(!a && b, a && !b), true
+		}
+	case time.Time:
+		if b, isTime := b.(time.Time); isTime {
+			return a.Compare(b), true
+		}
+	case string:
+		if b, isString := b.(string); isString {
+			return cmp(a < b, a > b), true
+		}
+	}
+	return 0, false
+}
+
+// hllPrecision is the number of hash bits selecting a HyperLogLog register: 2^12
+// registers of one byte give a standard error of about 1.6%.
+const hllPrecision = 12
+
+// hll is a HyperLogLog sketch estimating the number of distinct hashes added to it.
+// The registers are allocated on the first add.
+type hll struct {
+	registers []uint8
+}
+
+func (h *hll) add(hash uint64) {
+	if h.registers == nil {
+		h.registers = make([]uint8, 1<<hllPrecision)
+	}
+	idx := hash >> (64 - hllPrecision)
+	rank := uint8(bits.LeadingZeros64(hash<<hllPrecision|1<<(hllPrecision-1)) + 1)
+	if rank > h.registers[idx] {
+		h.registers[idx] = rank
+	}
+}
+
+func (h *hll) merge(o *hll) {
+	if o.registers == nil {
+		return
+	}
+	if h.registers == nil {
+		h.registers = make([]uint8, len(o.registers))
+	}
+	for i, r := range o.registers {
+		if r > h.registers[i] {
+			h.registers[i] = r
+		}
+	}
+}
+
+func (h *hll) estimate() uint64 {
+	if h.registers == nil {
+		return 0
+	}
+	m := float64(len(h.registers))
+	sum, zeros := 0.0, 0
+	for _, r := range h.registers {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+	e := 0.7213 / (1 + 1.079/m) * m * m / sum
+	// Small cardinalities are estimated more accurately by linear counting.
+	if e <= 2.5*m && zeros > 0 {
+		e = m * math.Log(m/float64(zeros))
+	}
+	return uint64(math.Round(e))
+}
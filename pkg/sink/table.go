@@ -0,0 +1,158 @@
+package sink
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// TableOptions controls how the terminal table is rendered.
+type TableOptions struct {
+	// MaxColWidth truncates longer values to this many characters; 0 disables truncation.
+	MaxColWidth int
+
+	// MaxRows stops rendering after this many rows; 0 renders every row.
+	MaxRows int64
+
+	// NullString replaces the NULL shown for missing values when set.
+	NullString *string
+
+	// Highlight, when set, is called with every value shown and its row, counted across
+	// batches, and the values it returns true for are shown in reverse video, e.g. those
+	// that changed since the query last ran.
+	Highlight func(row int64, column, value string) bool
+}
+
+// tableCleaner keeps every value on a single line of the table.
+var tableCleaner = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+// TableWriter prints batches as aligned, boxed tables for reading in a terminal.
+// Each batch is rendered as its own table sized to the values it contains.
+type TableWriter struct {
+	w      *bufio.Writer
+	opts   TableOptions
+	rows   int64
+	hidden int64
+}
+
+// NewTableWriter returns a Writer that prints each batch to w.
+func NewTableWriter(w io.Writer, opts TableOptions) *TableWriter {
+	return &TableWriter{w: bufio.NewWriter(w), opts: opts}
+}
+
+// Write prints the batch with a header row.
+func (t *TableWriter) Write(rec arrow.Record) error {
+	// Work out how many rows of this batch are still within the display limit.
+	n := rec.NumRows()
+	if t.opts.MaxRows > 0 && t.rows+n > t.opts.MaxRows {
+		t.hidden += t.rows + n - t.opts.MaxRows
+		n = t.opts.MaxRows - t.rows
+	}
+	if n <= 0 {
+		return nil
+	}
+	first := t.rows
+	t.rows += n
+
+	// Format every cell first so the column widths can be measured.
+	fields := rec.Schema().Fields()
+	header := make([]string, len(fields))
+	widths := make([]int, len(fields))
+	for j, f := range fields {
+		header[j] = t.clip(f.Name)
+		widths[j] = utf8.RuneCountInString(header[j])
+	}
+	cells := make([][]string, n)
+	var marked [][]bool
+	if t.opts.Highlight != nil {
+		marked = make([][]bool, n)
+	}
+	for i := range cells {
+		cells[i] = make([]string, len(fields))
+		if marked != nil {
+			marked[i] = make([]bool, len(fields))
+		}
+		for j, col := range rec.Columns() {
+			v := cellText(col, i, t.opts.NullString)
+			if marked != nil {
+				marked[i][j] = t.opts.Highlight(first+int64(i), fields[j].Name, v)
+			}
+			cells[i][j] = t.clip(v)
+			if w := utf8.RuneCountInString(cells[i][j]); w > widths[j] {
+				widths[j] = w
+			}
+		}
+	}
+
+	// Print the header, the rows and the closing border; numbers are right-aligned.
+	t.border(widths)
+	t.row(header, widths, nil, nil)
+	t.border(widths)
+	right := make([]bool, len(fields))
+	for j, f := range fields {
+		right[j] = isNumeric(f.Type)
+	}
+	for i, row := range cells {
+		var m []bool
+		if marked != nil {
+			m = marked[i]
+		}
+		t.row(row, widths, right, m)
+	}
+	t.border(widths)
+	t.w.WriteString("\n") // Extra newline for readability between batches.
+	return t.w.Flush()
+}
+
+// Close notes how many rows were left out and flushes the output.
+func (t *TableWriter) Close() error {
+	if t.hidden > 0 {
+		fmt.Fprintf(t.w, "(%d more rows not shown)\n", t.hidden)
+	}
+	return t.w.Flush()
+}
+
+// clip flattens a value to one line and truncates it to the maximum column width.
+func (t *TableWriter) clip(s string) string {
+	s = tableCleaner.Replace(s)
+	if t.opts.MaxColWidth <= 0 || utf8.RuneCountInString(s) <= t.opts.MaxColWidth {
+		return s
+	}
+	if t.opts.MaxColWidth == 1 {
+		return "…"
+	}
+	return string([]rune(s)[:t.opts.MaxColWidth-1]) + "…"
+}
+
+// border prints a separator line such as +----+------+.
+func (t *TableWriter) border(widths []int) {
+	for _, w := range widths {
+		t.w.WriteString("+")
+		t.w.WriteString(strings.Repeat("-", w+2))
+	}
+	t.w.WriteString("+\n")
+}
+
+// row prints one line of cells padded to the column widths, the marked ones in
+// reverse video.
+func (t *TableWriter) row(cells []string, widths []int, right, marked []bool) {
+	for j, cell := range cells {
+		pad := strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell))
+		if right != nil && right[j] {
+			cell = pad + cell
+		} else {
+			cell += pad
+		}
+		if marked != nil && marked[j] {
+			cell = "\x1b[7m" + cell + "\x1b[0m"
+		}
+		t.w.WriteString("| ")
+		t.w.WriteString(cell)
+		t.w.WriteString(" ")
+	}
+	t.w.WriteString("|\n")
+}
@@ -0,0 +1,37 @@
+package sink_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+	"dbx_arrow_dbsql/pkg/sink"
+)
+
+func TestTableHighlight(t *testing.T) {
+	// Rows are counted across batches.
+	var rows []int64
+	var buf bytes.Buffer
+	w := sink.NewTableWriter(&buf, sink.TableOptions{Highlight: func(row int64, column, value string) bool {
+		if column == "id" {
+			rows = append(rows, row)
+		}
+		return row == 2 && column == "name"
+	}})
+	for _, rec := range arrowfetchtest.Batches(2, 2) {
+		if err := w.Write(rec); err != nil {
+			t.Fatal(err)
+		}
+		rec.Release()
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 4 || rows[3] != 3 {
+		t.Errorf("got rows %v, want 0 to 3", rows)
+	}
+	if n := strings.Count(buf.String(), "\x1b[7m"); n != 1 || !strings.Contains(buf.String(), "\x1b[7mname-2\x1b[0m") {
+		t.Errorf("got %d highlighted values in\n%s\nwant name-2 only", n, buf.String())
+	}
+}
@@ -0,0 +1,145 @@
+package sink
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+)
+
+// TextValue formats one value for the human-readable outputs, numbers at full precision.
+// Nulls are rendered as "NULL".
+func TextValue(col arrow.Array, i int) string {
+	if col.IsNull(i) {
+		return "NULL"
+	}
+	switch col := col.(type) {
+	case *array.Boolean:
+		return strconv.FormatBool(col.Value(i))
+	case *array.Int8:
+		return strconv.FormatInt(int64(col.Value(i)), 10)
+	case *array.Int16:
+		return strconv.FormatInt(int64(col.Value(i)), 10)
+	case *array.Int32:
+		return strconv.FormatInt(int64(col.Value(i)), 10)
+	case *array.Int64:
+		return strconv.FormatInt(col.Value(i), 10)
+	case *array.Uint8:
+		return strconv.FormatUint(uint64(col.Value(i)), 10)
+	case *array.Uint16:
+		return strconv.FormatUint(uint64(col.Value(i)), 10)
+	case *array.Uint32:
+		return strconv.FormatUint(uint64(col.Value(i)), 10)
+	case *array.Uint64:
+		return strconv.FormatUint(col.Value(i), 10)
+	case *array.Float32:
+		return strconv.FormatFloat(float64(col.Value(i)), 'f', -1, 32)
+	case *array.Float64:
+		return strconv.FormatFloat(col.Value(i), 'f', -1, 64)
+	case *array.String:
+		return col.Value(i)
+	case *array.LargeString:
+		return col.Value(i)
+	case *array.Timestamp:
+		return timestampValue(col, i).Format(time.RFC3339Nano)
+	case *array.Date32:
+		return col.Value(i).ToTime().Format("2006-01-02")
+	case *array.Date64:
+		return col.Value(i).ToTime().Format("2006-01-02")
+	case *array.Decimal128:
+		return col.Value(i).ToString(col.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		return col.Value(i).ToString(col.DataType().(*arrow.Decimal256Type).Scale)
+	default:
+		// Nested and binary values are shown as their JSON encoding, e.g.
+		// {"city":"Oslo","zip":["0150","0151"]}.
+		text, err := json.Marshal(arrowfetch.JSONValue(col, i))
+		if err != nil {
+			return fmt.Sprint(col.GetOneForMarshal(i))
+		}
+		return string(text)
+	}
+}
+
+// cellText is TextValue with NULL values written as null instead, when it is set.
+func cellText(col arrow.Array, i int, null *string) string {
+	if null != nil && col.IsNull(i) {
+		return *null
+	}
+	return TextValue(col, i)
+}
+
+// isNested reports whether values of the type are arrays, maps or structs.
+func isNested(dt arrow.DataType) bool {
+	switch dt.ID() {
+	case arrow.LIST, arrow.LARGE_LIST, arrow.FIXED_SIZE_LIST, arrow.MAP, arrow.STRUCT:
+		return true
+	}
+	return false
+}
+
+// csvText returns rec with the columns the Arrow CSV writer cannot encode as wanted
+// replaced by string columns of their text: nested values as JSON, and timestamps of
+// zones other than UTC as the time in their zone, since the CSV writer always writes
+// UTC. rec is returned, retained, when no column needs it; either way the caller
+// releases the result.
+func csvText(rec arrow.Record) arrow.Record {
+	fields := append([]arrow.Field(nil), rec.Schema().Fields()...)
+	cols := make([]arrow.Array, len(fields))
+	converted := false
+	for c, col := range rec.Columns() {
+		var format func(i int) string
+		switch dt := col.DataType().(type) {
+		case *arrow.TimestampType:
+			if loc, err := dt.GetZone(); err == nil && loc != time.UTC {
+				ts := col.(*array.Timestamp)
+				format = func(i int) string { return timestampValue(ts, i).Format("2006-01-02 15:04:05.999999999") }
+			}
+		default:
+			if isNested(dt) {
+				format = func(i int) string { return TextValue(col, i) }
+			}
+		}
+		if format == nil {
+			cols[c] = col
+			continue
+		}
+		b := array.NewStringBuilder(memory.DefaultAllocator)
+		for i := 0; i < col.Len(); i++ {
+			if col.IsNull(i) {
+				b.AppendNull()
+			} else {
+				b.Append(format(i))
+			}
+		}
+		cols[c] = b.NewArray()
+		defer cols[c].Release()
+		b.Release()
+		fields[c].Type = arrow.BinaryTypes.String
+		converted = true
+	}
+	if !converted {
+		rec.Retain()
+		return rec
+	}
+	md := rec.Schema().Metadata()
+	return array.NewRecord(arrow.NewSchema(fields, &md), cols, rec.NumRows())
+}
+
+// isNumeric reports whether values of the type should be right-aligned.
+func isNumeric(dt arrow.DataType) bool {
+	switch dt.ID() {
+	case arrow.INT8, arrow.INT16, arrow.INT32, arrow.INT64,
+		arrow.UINT8, arrow.UINT16, arrow.UINT32, arrow.UINT64,
+		arrow.FLOAT16, arrow.FLOAT32, arrow.FLOAT64,
+		arrow.DECIMAL128, arrow.DECIMAL256:
+		return true
+	}
+	return false
+}
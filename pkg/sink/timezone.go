@@ -0,0 +1,85 @@
+package sink
+
+import (
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+)
+
+// TimeZoneWriter sets the time zone of the TIMESTAMP columns of each record before
+// passing it to the wrapped Writer, so the text formats render them in that zone. The
+// values are instants and stay unchanged; only the zone recorded in the column type,
+// which the text formats display the values in, is replaced. TIMESTAMP_NTZ columns,
+// which have no zone, are left alone.
+type TimeZoneWriter struct {
+	w    Writer
+	zone string
+}
+
+// NewTimeZoneWriter returns a Writer that writes records to w with their timestamps in
+// zone, as accepted by LoadTimeZone. An unknown zone is reported by the first Write.
+func NewTimeZoneWriter(w Writer, zone string) *TimeZoneWriter {
+	return &TimeZoneWriter{w: w, zone: zone}
+}
+
+// Write relabels the timestamp columns of rec and writes the result.
+func (z *TimeZoneWriter) Write(rec arrow.Record) error {
+	zone := z.zone
+	if _, err := LoadTimeZone(zone); err != nil {
+		return err
+	}
+	fields := append([]arrow.Field(nil), rec.Schema().Fields()...)
+	cols := make([]arrow.Array, len(fields))
+	changed := false
+	for c, col := range rec.Columns() {
+		dt, ok := col.DataType().(*arrow.TimestampType)
+		if !ok || dt.TimeZone == "" || dt.TimeZone == zone {
+			cols[c] = col
+			continue
+		}
+		data := col.Data()
+		zoned := &arrow.TimestampType{Unit: dt.Unit, TimeZone: zone}
+		relabeled := array.NewData(zoned, data.Len(), data.Buffers(), nil, data.NullN(), data.Offset())
+		cols[c] = array.MakeFromData(relabeled)
+		relabeled.Release()
+		defer cols[c].Release()
+		fields[c].Type = zoned
+		changed = true
+	}
+	if !changed {
+		return z.w.Write(rec)
+	}
+	md := rec.Schema().Metadata()
+	out := array.NewRecord(arrow.NewSchema(fields, &md), cols, rec.NumRows())
+	defer out.Release()
+	return z.w.Write(out)
+}
+
+// Flush flushes the wrapped Writer if it holds back output.
+func (z *TimeZoneWriter) Flush() error {
+	return Flush(z.w)
+}
+
+// Close closes the wrapped Writer.
+func (z *TimeZoneWriter) Close() error {
+	return z.w.Close()
+}
+
+// LoadTimeZone returns the location of a time zone given as Arrow records it in a
+// timestamp type: an IANA name such as Europe/Paris, UTC, or a fixed offset such as
+// +05:30.
+func LoadTimeZone(zone string) (*time.Location, error) {
+	return (&arrow.TimestampType{TimeZone: zone}).GetZone()
+}
+
+// timestampValue returns a timestamp value in the time zone of its column, or in UTC
+// for TIMESTAMP_NTZ columns and zones Go does not know.
+func timestampValue(col *array.Timestamp, i int) time.Time {
+	dt := col.DataType().(*arrow.TimestampType)
+	t := col.Value(i).ToTime(dt.Unit)
+	if loc, err := dt.GetZone(); err == nil {
+		return t.In(loc)
+	}
+	return t
+}
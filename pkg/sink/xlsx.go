@@ -0,0 +1,169 @@
+package sink
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/xuri/excelize/v2"
+)
+
+// XLSXMaxRows is the number of data rows that fit on a worksheet below the header row.
+const XLSXMaxRows = excelize.TotalRows - 1
+
+// XLSXWriter writes batches into a single worksheet of an Excel workbook.
+// Rows beyond Excel's row limit are dropped and counted.
+type XLSXWriter struct {
+	w        io.Writer
+	file     *excelize.File
+	stream   *excelize.StreamWriter
+	dateID   int
+	tsID     int
+	rows     int
+	dropped  int64
+	finished bool
+}
+
+// NewXLSXWriter returns a Writer that encodes batches as an Excel workbook to w.
+// The workbook is written to w when the writer is closed.
+func NewXLSXWriter(w io.Writer) (*XLSXWriter, error) {
+	file := excelize.NewFile()
+	dateFmt := "yyyy-mm-dd"
+	dateID, err := file.NewStyle(&excelize.Style{CustomNumFmt: &dateFmt})
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %w", err)
+	}
+	tsFmt := "yyyy-mm-dd hh:mm:ss"
+	tsID, err := file.NewStyle(&excelize.Style{CustomNumFmt: &tsFmt})
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %w", err)
+	}
+	stream, err := file.NewStreamWriter("Sheet1")
+	if err != nil {
+		return nil, fmt.Errorf("xlsx: %w", err)
+	}
+	return &XLSXWriter{w: w, file: file, stream: stream, dateID: dateID, tsID: tsID}, nil
+}
+
+// Write appends the rows of the batch to the worksheet.
+func (x *XLSXWriter) Write(rec arrow.Record) error {
+	if x.rows == 0 {
+		if err := x.writeHeader(rec.Schema()); err != nil {
+			return err
+		}
+	}
+
+	n := int(rec.NumRows())
+	if room := XLSXMaxRows - (x.rows - 1); n > room {
+		x.dropped += int64(n - room)
+		n = room
+	}
+
+	row := make([]interface{}, rec.NumCols())
+	for i := 0; i < n; i++ {
+		for j, col := range rec.Columns() {
+			row[j] = x.cell(col, i)
+		}
+		x.rows++
+		cell, _ := excelize.CoordinatesToCellName(1, x.rows)
+		if err := x.stream.SetRow(cell, row); err != nil {
+			return fmt.Errorf("xlsx: %w", err)
+		}
+	}
+	return nil
+}
+
+// Dropped returns the number of rows that did not fit on the worksheet.
+func (x *XLSXWriter) Dropped() int64 {
+	return x.dropped
+}
+
+// Close finishes the worksheet and writes the workbook to the output.
+func (x *XLSXWriter) Close() error {
+	if x.finished {
+		return nil
+	}
+	x.finished = true
+	defer x.file.Close()
+
+	if err := x.stream.Flush(); err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	if err := x.file.Write(x.w); err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	return nil
+}
+
+// writeHeader writes the column names as a bold, frozen first row.
+func (x *XLSXWriter) writeHeader(schema *arrow.Schema) error {
+	boldID, err := x.file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	header := make([]interface{}, len(schema.Fields()))
+	for i, f := range schema.Fields() {
+		header[i] = excelize.Cell{StyleID: boldID, Value: f.Name}
+	}
+	if err := x.stream.SetPanes(&excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	if err := x.stream.SetRow("A1", header); err != nil {
+		return fmt.Errorf("xlsx: %w", err)
+	}
+	x.rows = 1
+	return nil
+}
+
+// cell converts one value into an Excel cell, keeping numbers, booleans and dates typed.
+// Decimals become numbers since Excel only stores doubles; nested values are written as JSON text.
+func (x *XLSXWriter) cell(col arrow.Array, i int) interface{} {
+	if col.IsNull(i) {
+		return nil
+	}
+	switch col := col.(type) {
+	case *array.Boolean:
+		return col.Value(i)
+	case *array.Int8:
+		return col.Value(i)
+	case *array.Int16:
+		return col.Value(i)
+	case *array.Int32:
+		return col.Value(i)
+	case *array.Int64:
+		return col.Value(i)
+	case *array.Uint8:
+		return col.Value(i)
+	case *array.Uint16:
+		return col.Value(i)
+	case *array.Uint32:
+		return col.Value(i)
+	case *array.Uint64:
+		return col.Value(i)
+	case *array.Float32:
+		return col.Value(i)
+	case *array.Float64:
+		return col.Value(i)
+	case *array.String:
+		return col.Value(i)
+	case *array.LargeString:
+		return col.Value(i)
+	case *array.Decimal128:
+		return col.Value(i).ToFloat64(col.DataType().(*arrow.Decimal128Type).Scale)
+	case *array.Decimal256:
+		return col.Value(i).ToFloat64(col.DataType().(*arrow.Decimal256Type).Scale)
+	case *array.Date32:
+		return excelize.Cell{StyleID: x.dateID, Value: col.Value(i).ToTime()}
+	case *array.Date64:
+		return excelize.Cell{StyleID: x.dateID, Value: col.Value(i).ToTime()}
+	case *array.Timestamp:
+		// Excel times have no zone: write the wall time in the zone of the column.
+		t := timestampValue(col, i)
+		wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+		return excelize.Cell{StyleID: x.tsID, Value: wall}
+	default:
+		return TextValue(col, i)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+)
+
+// startPprof serves the runtime profiles on addr for the rest of the run, e.g.
+//
+//	go tool pprof http://localhost:6060/debug/pprof/heap
+//	curl -o run.trace 'http://localhost:6060/debug/pprof/trace?seconds=10'
+//
+// With a memory limit, /debug/arrow reports the bytes held in result batches, which
+// grow without bound when records are not released.
+func startPprof(addr string, mem *arrowfetch.LimitedAllocator) error {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	mux.HandleFunc("/debug/arrow", func(w http.ResponseWriter, r *http.Request) {
+		if mem == nil {
+			http.Error(w, "batch memory is only accounted with --memory-limit", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]int64{"in_use_bytes": mem.InUse(), "peak_bytes": mem.Peak()})
+	})
+
+	// Listen before returning so a busy port fails the run instead of going unnoticed.
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	slog.Info("profiling on http://" + ln.Addr().String() + "/debug/pprof/")
+	go func() {
+		if err := http.Serve(ln, mux); err != nil {
+			slog.Error("pprof server", "err", err)
+		}
+	}()
+	return nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/term"
+)
+
+// progressInterval is the minimum time between two redraws of the progress line, so a
+// fast fetch of small batches does not spend its time writing to the terminal.
+const progressInterval = 200 * time.Millisecond
+
+// progress draws a one-line summary of a running fetch on stderr, overwriting it as
+// batches arrive: the batches and rows read, their Arrow size, the throughput and, when
+// the number of rows is known in advance, the estimated time left.
+type progress struct {
+	w      io.Writer
+	total  int64  // expected rows, 0 when unknown
+	prefix string // shown before the figures, e.g. the queries done of a run spec
+
+	start   time.Time
+	drawn   time.Time
+	width   int // length of the last line drawn, to blank what the next one leaves
+	batches int
+	rows    int64
+	bytes   int64
+}
+
+// newProgress returns a progress line for a fetch expecting total rows (0 if unknown).
+func newProgress(w io.Writer, total int64) *progress {
+	// The first line waits for an interval too: rates over a few microseconds mean little.
+	now := time.Now()
+	return &progress{w: w, total: total, start: now, drawn: now}
+}
+
+// showProgress reports whether the --progress mode draws a progress line: "auto" only
+// does when stderr is a terminal, where the line can be redrawn in place.
+func showProgress(mode string) bool {
+	switch mode {
+	case "always":
+		return true
+	case "never":
+		return false
+	}
+	return term.IsTerminal(int(os.Stderr.Fd()))
+}
+
+// add counts a batch of rows and bytes and redraws the line if it is due.
+func (p *progress) add(rows, bytes int64) {
+	p.batches++
+	p.rows += rows
+	p.bytes += bytes
+	if time.Since(p.drawn) >= progressInterval {
+		p.draw()
+	}
+}
+
+// done draws the final figures and ends the line, so later log output starts on a line
+// of its own.
+func (p *progress) done() {
+	p.draw()
+	fmt.Fprintln(p.w)
+}
+
+func (p *progress) draw() {
+	p.drawn = time.Now()
+	elapsed := p.drawn.Sub(p.start)
+	secs := elapsed.Seconds()
+	if secs <= 0 {
+		secs = 1e-9
+	}
+
+	var b strings.Builder
+	if p.prefix != "" {
+		fmt.Fprintf(&b, "%s | ", p.prefix)
+	}
+	fmt.Fprintf(&b, "%d batches, %d rows", p.batches, p.rows)
+	if p.total > 0 {
+		fmt.Fprintf(&b, " (%.0f%%)", 100*float64(min(p.rows, p.total))/float64(p.total))
+	}
+	fmt.Fprintf(&b, ", %s | %.0f rows/s, %s/s | %s",
+		formatBytes(p.bytes), float64(p.rows)/secs, formatBytes(int64(float64(p.bytes)/secs)), elapsed.Round(time.Second))
+	if p.total > 0 && p.rows > 0 && p.rows < p.total {
+		left := time.Duration(float64(elapsed) * float64(p.total-p.rows) / float64(p.rows))
+		fmt.Fprintf(&b, ", ETA %s", left.Round(time.Second))
+	}
+
+	line := b.String()
+	pad := max(p.width-len(line), 0)
+	p.width = len(line)
+	fmt.Fprintf(p.w, "\r%s%s", line, strings.Repeat(" ", pad))
+}
+
+// formatBytes prints n with a binary unit, e.g. 12.3 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+
+	"github.com/chzyer/readline"
+)
+
+const replHelp = `Enter SQL statements terminated by ; (they may span several lines).
+Commands:
+  \format <name>  switch the output format (table, markdown, csv or ndjson)
+  \help           show this help
+  \q, exit, quit  leave the shell
+Ctrl-C cancels the running statement or clears the current input; Ctrl-D exits.`
+
+// replHistoryPath returns the file keeping the statements entered in the shell.
+func replHistoryPath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(home, ".dbarrow", "repl_history")
+}
+
+// runREPL runs an interactive SQL shell on one session, so USE and SET carry over
+// between statements. Results are printed to stdout in the text format from --format.
+func runREPL(client *arrowfetch.Client, prof profile, opts *cliOptions) error {
+	if !textFormat(opts.format) {
+		return fmt.Errorf("the repl prints results and supports the table, markdown, csv and ndjson formats, not %s", opts.format)
+	}
+
+	historyFile := replHistoryPath()
+	if historyFile != "" {
+		os.MkdirAll(filepath.Dir(historyFile), 0o700)
+	}
+	rl, err := readline.NewEx(&readline.Config{
+		Prompt:                 "dbarrow> ",
+		HistoryFile:            historyFile,
+		DisableAutoSaveHistory: true, // a statement is saved once, not line by line
+		InterruptPrompt:        "^C",
+		EOFPrompt:              "exit",
+	})
+	if err != nil {
+		return err
+	}
+	defer rl.Close()
+	// Route the query logs through readline so they do not garble the prompt.
+	defer logOutput.set(rl.Stderr())()
+
+	session, err := client.Session(context.Background())
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	fmt.Fprintf(rl.Stdout(), "Connected to %s. Type \\help for help.\n", prof.Host)
+
+	var buf strings.Builder
+	for {
+		if buf.Len() == 0 {
+			rl.SetPrompt("dbarrow> ")
+		} else {
+			rl.SetPrompt("      -> ")
+		}
+		line, err := rl.Readline()
+		if errors.Is(err, readline.ErrInterrupt) {
+			buf.Reset() // Ctrl-C drops the statement being typed
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// Shell commands are recognized only at the start of a statement.
+		if buf.Len() == 0 {
+			switch cmd := strings.Fields(strings.TrimSpace(line)); {
+			case len(cmd) == 0:
+				continue
+			case cmd[0] == `\q` || cmd[0] == "exit" || cmd[0] == "quit":
+				return nil
+			case cmd[0] == `\help` || cmd[0] == `\h` || cmd[0] == "help":
+				fmt.Fprintln(rl.Stdout(), replHelp)
+				continue
+			case cmd[0] == `\format`:
+				if len(cmd) != 2 || !textFormat(cmd[1]) {
+					fmt.Fprintln(rl.Stdout(), `usage: \format table|markdown|csv|ndjson`)
+				} else {
+					opts.format = cmd[1]
+				}
+				continue
+			}
+		}
+
+		buf.WriteString(line)
+		buf.WriteString("\n")
+		statements, rest := arrowfetch.CompleteStatements(buf.String())
+		if len(statements) == 0 {
+			continue // keep reading until the statement is terminated
+		}
+		rl.SaveHistory(strings.TrimSpace(strings.TrimSuffix(buf.String(), rest)))
+		buf.Reset()
+		buf.WriteString(strings.TrimLeft(rest, " \t\n"))
+
+		for _, stmt := range statements {
+			if err := replExecute(session, prof, opts, stmt, rl.Stdout()); err != nil {
+				fmt.Fprintf(rl.Stderr(), "error: %v\n", err)
+				break
+			}
+		}
+	}
+}
+
+// replExecute runs one statement and prints its result. Ctrl-C cancels just this statement.
+func replExecute(session *arrowfetch.Session, prof profile, opts *cliOptions, stmt string, out io.Writer) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	writer, err := newWriter(opts, out)
+	if err != nil {
+		return err
+	}
+	start := time.Now()
+	p := pipeline.Pipeline{
+		Source:     pipeline.SessionQuery(session, stmt),
+		Transforms: transforms(opts),
+		Sink:       writer,
+	}
+	result, err := p.Run(ctx)
+	stats := runStats{rows: result.Rows, bytes: result.Bytes}
+	if cerr := writer.Close(); err == nil {
+		err = cerr
+	}
+
+	interrupted := ctx.Err() != nil
+	if !opts.noHistory {
+		recordHistory(opts, prof, stmt, start, stats, err, interrupted)
+	}
+	if interrupted {
+		return errors.New("statement cancelled")
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "(%d rows in %s)\n", stats.rows, time.Since(start).Round(time.Millisecond))
+	return nil
+}
+
+// textFormat reports whether format can be printed to a terminal.
+func textFormat(format string) bool {
+	switch format {
+	case "table", "markdown", "csv", "ndjson":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+)
+
+// savedQuery renders the named query of the config file. Its {{.name}} placeholders are
+// filled from --var; {{quote .name}} inserts the value as a SQL string literal.
+// Every placeholder must have a value.
+func savedQuery(configPath, name string, vars map[string]string) (string, error) {
+	cfg, err := loadConfigFile(configPath)
+	if err != nil {
+		return "", err
+	}
+	text, ok := cfg.Queries[name]
+	if !ok {
+		names := make([]string, 0, len(cfg.Queries))
+		for n := range cfg.Queries {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return "", fmt.Errorf("query %q not found: %s has no saved queries", name, configPath)
+		}
+		return "", fmt.Errorf("query %q not found in %s; saved queries: %s", name, configPath, strings.Join(names, ", "))
+	}
+
+	tmpl, err := template.New(name).
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"quote": arrowfetch.QuoteString}).
+		Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("unable to parse saved query %q: %w", name, err)
+	}
+	if vars == nil {
+		vars = map[string]string{}
+	}
+	var b strings.Builder
+	if err := tmpl.Execute(&b, vars); err != nil {
+		return "", fmt.Errorf("unable to fill saved query %q (set its variables with --var): %w", name, err)
+	}
+	return strings.TrimSpace(b.String()), nil
+}
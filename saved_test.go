@@ -0,0 +1,29 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+)
+
+func TestSavedQueryQuote(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(config, []byte("queries:\n  by_name: SELECT * FROM people WHERE name = {{quote .name}}; SELECT 1\n"), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := savedQuery(config, "by_name", map[string]string{"name": `O'Brien \ Co`})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `SELECT * FROM people WHERE name = 'O\'Brien \\ Co'; SELECT 1`
+	if query != want {
+		t.Errorf("got %s, want %s", query, want)
+	}
+	// The escaped quote must not end the literal, or the script would split inside it.
+	if statements := arrowfetch.SplitStatements(query); len(statements) != 2 {
+		t.Errorf("got %d statements, want 2: %q", len(statements), statements)
+	}
+}
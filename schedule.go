@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+)
+
+// scheduleJob is a job of the config file run by "dbarrow schedule": a query written to
+// its output on the cron schedule.
+type scheduleJob struct {
+	Schedule  string `yaml:"schedule"`
+	querySpec `yaml:",inline"`
+}
+
+// jobState is the status of a job kept in the schedule state file.
+type jobState struct {
+	Status    string    `json:"status"` // running, ok, error or interrupted
+	Runs      int       `json:"runs"`
+	LastStart time.Time `json:"last_start"`
+	Duration  float64   `json:"duration_seconds"`
+	Rows      int64     `json:"rows"`
+	Bytes     int64     `json:"bytes"`
+	Error     string    `json:"error,omitempty"`
+	LastOK    time.Time `json:"last_ok"`
+	NextRun   time.Time `json:"next_run"`
+}
+
+// scheduleStatePath returns the file the daemon records the state of its jobs in.
+func scheduleStatePath() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return filepath.Join(os.TempDir(), "dbarrow-schedule.json")
+	}
+	return filepath.Join(home, ".dbarrow", "schedule.json")
+}
+
+// scheduleState is the state of every job, saved to path after each change.
+type scheduleState struct {
+	mu   sync.Mutex
+	path string
+	jobs map[string]*jobState
+}
+
+// loadScheduleState reads the state file at path. A missing file is an empty state.
+func loadScheduleState(path string) (*scheduleState, error) {
+	s := &scheduleState{path: path, jobs: map[string]*jobState{}}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.jobs); err != nil {
+		return nil, fmt.Errorf("corrupt schedule state %s: %w", path, err)
+	}
+	return s, nil
+}
+
+// update changes the state of the named job with fn and saves the state. A failure to
+// save is only logged, so it never stops the jobs themselves.
+func (s *scheduleState) update(name string, fn func(*jobState)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j := s.jobs[name]
+	if j == nil {
+		j = &jobState{}
+		s.jobs[name] = j
+	}
+	fn(j)
+	if err := s.save(); err != nil {
+		slog.Warn("unable to save the schedule state", "path", s.path, "err", err)
+	}
+}
+
+// save writes the state to a temporary file and renames it into place, so a reader
+// never sees a partial file.
+func (s *scheduleState) save() error {
+	data, err := json.MarshalIndent(s.jobs, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0o700); err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// scheduledJob is a job ready to run: its parsed schedule and command line.
+type scheduledJob struct {
+	name  string
+	cron  *cronSchedule
+	opts  *cliOptions
+	query string
+}
+
+// loadJobs reads the jobs of the config file and parses their schedules and flags, so a
+// mistake in any job is reported before the daemon starts.
+func loadJobs(configPath string) ([]scheduledJob, error) {
+	cfg, err := loadConfigFile(configPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(cfg.Jobs) == 0 {
+		return nil, fmt.Errorf("%s has no jobs to schedule; define them under jobs:", configPath)
+	}
+	names := make([]string, 0, len(cfg.Jobs))
+	for name := range cfg.Jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var jobs []scheduledJob
+	for _, name := range names {
+		j, err := cfg.Jobs[name].parse(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("job %s: %w", name, err)
+		}
+		j.name = name
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// parse checks the job and turns it into the options of a run.
+func (j scheduleJob) parse(configPath string) (scheduledJob, error) {
+	c, err := parseCron(j.Schedule)
+	if err != nil {
+		return scheduledJob{}, err
+	}
+	opts, query, err := j.options(configPath)
+	if err != nil {
+		return scheduledJob{}, err
+	}
+	// Progress lines of jobs running together would overwrite each other.
+	opts.progress = "never"
+	return scheduledJob{cron: c, opts: opts, query: query}, nil
+}
+
+// runSchedule runs the "schedule" daemon: every job of the config file runs on its cron
+// schedule, in local time, until the daemon is interrupted. Jobs run side by side on
+// the connection of the daemon's profile. A job still running when its next time comes
+// skips that run. The state of every job is kept in scheduleStatePath for "schedule
+// status".
+func runSchedule(ctx context.Context, client *arrowfetch.Client, opts *cliOptions) error {
+	jobs, err := loadJobs(opts.configPath)
+	if err != nil {
+		return err
+	}
+	state, err := loadScheduleState(scheduleStatePath())
+	if err != nil {
+		return err
+	}
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				next := j.cron.next(time.Now())
+				state.update(j.name, func(s *jobState) { s.NextRun = next })
+				slog.Info("job scheduled", "job", j.name, "next_run", next.Format(time.DateTime))
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(time.Until(next)):
+				}
+				runJob(ctx, client, j, state)
+			}
+		}()
+	}
+	slog.Info("scheduler started", "jobs", len(jobs), "state", state.path)
+	wg.Wait()
+	return nil
+}
+
+// runJob runs a job once and records the outcome in state.
+func runJob(ctx context.Context, client *arrowfetch.Client, j scheduledJob, state *scheduleState) {
+	start := time.Now()
+	var n int
+	state.update(j.name, func(s *jobState) {
+		s.Status, s.LastStart, s.Error = "running", start, ""
+		n = s.Runs
+		s.Runs++
+	})
+	slog.Info("job started", "job", j.name, "run", n)
+
+	// {n} in the job's --out is the number of the run, so runs do not overwrite each other.
+	var stats runStats
+	var err error
+	if statements := arrowfetch.SplitStatements(j.query); len(statements) > 1 {
+		err = runScript(ctx, client, statements, j.opts, &stats)
+	} else {
+		err = writeResult(ctx, client, j.opts, n, pipeline.Query(client, j.query, j.opts.params.args()...), &stats)
+	}
+
+	state.update(j.name, func(s *jobState) {
+		s.Duration, s.Rows, s.Bytes = time.Since(start).Seconds(), stats.rows, stats.bytes
+		switch {
+		case ctx.Err() != nil:
+			s.Status = "interrupted"
+		case err != nil:
+			s.Status, s.Error = "error", err.Error()
+		default:
+			s.Status, s.LastOK = "ok", start
+		}
+	})
+	if err != nil {
+		slog.Error("job failed", "job", j.name, "run", n, "err", err)
+		return
+	}
+	slog.Info("job finished", "job", j.name, "run", n, "rows", stats.rows, "duration", time.Since(start).Round(time.Millisecond))
+}
+
+// runScheduleStatus implements "schedule status", which lists the jobs of the config file
+// with the outcome of their last run and when they run next.
+func runScheduleStatus(args []string) error {
+	set := flag.NewFlagSet("dbarrow schedule status", flag.ContinueOnError)
+	configPath := set.String("config", defaultConfigPath(), "path to the config file")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if set.NArg() > 0 {
+		return fmt.Errorf("unexpected arguments: %s", strings.Join(set.Args(), " "))
+	}
+	cfg, err := loadConfigFile(*configPath)
+	if err != nil {
+		return err
+	}
+	state, err := loadScheduleState(scheduleStatePath())
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(cfg.Jobs))
+	for name := range cfg.Jobs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "JOB\tSCHEDULE\tSTATUS\tRUNS\tLAST RUN\tDURATION\tROWS\tNEXT RUN\tERROR")
+	for _, name := range names {
+		s := state.jobs[name]
+		if s == nil {
+			s = &jobState{Status: "never run"}
+		}
+		// The next run follows from the schedule, which may have changed since the daemon
+		// last recorded it.
+		next := "invalid schedule"
+		if c, err := parseCron(cfg.Jobs[name].Schedule); err == nil {
+			next = c.next(time.Now()).Format(time.DateTime)
+		}
+		last, duration := "-", "-"
+		if !s.LastStart.IsZero() {
+			last = s.LastStart.Local().Format(time.DateTime)
+			duration = time.Duration(s.Duration * float64(time.Second)).Round(time.Millisecond).String()
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%s\t%s\t%d\t%s\t%s\n", name, cfg.Jobs[name].Schedule, s.Status, s.Runs, last, duration, s.Rows, next, s.Error)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"text/tabwriter"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+// schemaField is one column of the --schema-only=json output.
+type schemaField struct {
+	Name      string `json:"name"`
+	SQLType   string `json:"sql_type"`
+	ArrowType string `json:"arrow_type"`
+	Nullable  bool   `json:"nullable"`
+}
+
+// printSchema writes the columns of the query's result to --out, as a table or as JSON,
+// without fetching any rows.
+func printSchema(ctx context.Context, client *arrowfetch.Client, statements []string, opts *cliOptions) error {
+	if len(statements) != 1 {
+		return errors.New("--schema-only describes a single statement")
+	}
+	schema, err := client.Schema(ctx, statements[0], opts.params.args()...)
+	if err != nil {
+		return err
+	}
+
+	out, err := openOutput(opts.out, 0, opts.uploadOptions())
+	if err != nil {
+		return err
+	}
+	fields := make([]schemaField, len(schema.Fields()))
+	for i, f := range schema.Fields() {
+		fields[i] = schemaField{Name: f.Name, SQLType: sqlType(f), ArrowType: f.Type.String(), Nullable: f.Nullable}
+	}
+
+	if opts.schemaOnly == "json" {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		err = enc.Encode(map[string]any{"fields": fields})
+	} else {
+		tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, "COLUMN\tSQL TYPE\tARROW TYPE\tNULLABLE")
+		for _, f := range fields {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%t\n", f.Name, f.SQLType, f.ArrowType, f.Nullable)
+		}
+		err = tw.Flush()
+	}
+	return finish(out, err)
+}
+
+// sqlType returns the Databricks SQL type recorded in the field's metadata.
+func sqlType(f arrow.Field) string {
+	if i := f.Metadata.FindKey(arrowfetch.SQLTypeKey); i >= 0 {
+		return f.Metadata.Values()[i]
+	}
+	return ""
+}
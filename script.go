@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+)
+
+// runScript runs the statements of a multi-statement script in order on one session, so
+// USE, SET and temporary views carry over. The result of the last statement is written,
+// and with --results each also the result of every earlier query, each as its own result
+// numbered from 0 for the {n} placeholder of --out.
+func runScript(ctx context.Context, client *arrowfetch.Client, statements []string, opts *cliOptions, stats *runStats) error {
+	if len(opts.params) > 0 {
+		return errors.New("--param applies to a single query and cannot be used with a multi-statement script")
+	}
+
+	session, err := client.Session(ctx)
+	if err != nil {
+		return err
+	}
+	defer session.Close()
+
+	n := 0
+	for i, stmt := range statements {
+		slog.Info("statement", "n", i+1, "of", len(statements))
+
+		last := i == len(statements)-1
+		switch {
+		case arrowfetch.IsStaging(stmt):
+			// PUT, GET and REMOVE move a file and have no result to write. They name the
+			// volume file in full, so the session's state does not matter to them.
+			err = client.Stage(ctx, stmt, opts.stagingDir)
+		case !last && (opts.results != "each" || !arrowfetch.ReturnsRows(stmt)):
+			// Statements whose result is not kept only need to succeed.
+			err = session.Exec(ctx, stmt)
+		default:
+			err = writeResult(ctx, client, opts, n, pipeline.SessionQuery(session, stmt), stats)
+			n++
+		}
+		if err != nil {
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"log/slog"
+	"net"
+	"net/http"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/flightserver"
+	"dbx_arrow_dbsql/pkg/httpserver"
+	"dbx_arrow_dbsql/pkg/queryservice"
+
+	"github.com/apache/arrow/go/v12/arrow/flight/flightsql"
+)
+
+// serve answers the requests of "serve <protocol>" on --listen with the results of the
+// queries they send, until ctx is cancelled. Requests in progress are allowed to finish;
+// a second Ctrl-C exits at once.
+func serve(ctx context.Context, client *arrowfetch.Client, opts *cliOptions) error {
+	addr := opts.listen
+	if addr == "" {
+		addr = "localhost:8815"
+		switch opts.serve {
+		case "grpc":
+			addr = "localhost:50051"
+		case "http":
+			addr = "localhost:8080"
+		}
+	}
+	var err error
+	switch opts.serve {
+	case "flight":
+		slog.Info("serving Arrow Flight", "addr", addr)
+		err = flightserver.Serve(ctx, addr, flightserver.New(client))
+	case "flight-sql":
+		srv, serr := flightserver.NewSQL(client)
+		if serr != nil {
+			return serr
+		}
+		slog.Info("serving Arrow Flight SQL", "addr", addr)
+		err = flightserver.Serve(ctx, addr, flightsql.NewFlightServer(srv))
+	case "grpc":
+		slog.Info("serving gRPC QueryService", "addr", addr)
+		err = queryservice.Serve(ctx, addr, queryservice.New(client))
+	case "http":
+		srv := httpserver.New(client, httpserver.Limits{
+			Timeout:       opts.requestTimeout,
+			MaxRows:       opts.requestMaxRows,
+			MaxConcurrent: opts.maxConcurrent,
+		})
+		srv.AllowOrigins(opts.allowOrigins...)
+		slog.Info("serving HTTP", "addr", addr, "endpoints", "POST /query, GET /ws")
+		err = httpserver.Serve(ctx, addr, logRequests(srv))
+	}
+	if err != nil {
+		return err
+	}
+	slog.Info("server stopped")
+	return nil
+}
+
+// logRequests logs every HTTP request with its status, the bytes of the response and
+// its duration once it is complete or aborted.
+func logRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		start := time.Now()
+		defer func() {
+			attrs := []any{"method", r.Method, "path", r.URL.Path, "remote", r.RemoteAddr,
+				"status", rec.status, "bytes", rec.bytes, "elapsed", time.Since(start).Round(time.Millisecond)}
+			if v := recover(); v != nil {
+				// The handler cut the response short after a failure mid-stream.
+				slog.Warn("request aborted", attrs...)
+				panic(v)
+			}
+			slog.Info("request", attrs...)
+		}()
+		h.ServeHTTP(rec, r)
+	})
+}
+
+// statusRecorder captures the status and size of a response. Unwrap lets
+// http.ResponseController reach the flusher of the underlying writer; Hijack hands the
+// connection over to the WebSocket endpoint.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	n, err := s.ResponseWriter.Write(p)
+	s.bytes += int64(n)
+	return n, err
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	s.status = http.StatusSwitchingProtocols
+	return http.NewResponseController(s.ResponseWriter).Hijack()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
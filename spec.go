@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"gopkg.in/yaml.v3"
+)
+
+// querySpec is a query of a run spec or a scheduled job: its SQL, given as text, a file or
+// a saved query filled from vars, and the output its result is written to.
+type querySpec struct {
+	Query      string            `yaml:"query"`
+	QueryFile  string            `yaml:"query_file"`
+	SavedQuery string            `yaml:"saved_query"`
+	Vars       map[string]string `yaml:"vars"`
+	Format     string            `yaml:"format"`
+	Out        string            `yaml:"out"`
+	Sink       string            `yaml:"sink"`
+
+	// Flags are further command line flags for the output, e.g. ["--compression", "zstd"].
+	Flags []string `yaml:"flags"`
+}
+
+// options turns q into the options of a run, parsed and checked as the command line
+// would be, and returns them with the query to run.
+func (q querySpec) options(configPath string) (*cliOptions, string, error) {
+	set := 0
+	for _, v := range []string{q.Query, q.QueryFile, q.SavedQuery} {
+		if v != "" {
+			set++
+		}
+	}
+	var args []string
+	switch {
+	case set != 1:
+		return nil, "", errors.New("set one of query, query_file or saved_query")
+	case q.Query != "":
+		args = []string{"--query", q.Query}
+	case q.QueryFile != "":
+		args = []string{"--query-file", q.QueryFile}
+	default:
+		args = []string{"run", q.SavedQuery}
+		for k, v := range q.Vars {
+			args = append(args, "--var", k+"="+v)
+		}
+	}
+	if len(q.Vars) > 0 && q.SavedQuery == "" {
+		return nil, "", errors.New("vars fill the placeholders of saved_query")
+	}
+	args = append(args, "--config", configPath)
+	if q.Format != "" {
+		args = append(args, "--format", q.Format)
+	}
+	if q.Out != "" {
+		args = append(args, "--out", q.Out)
+	}
+	if q.Sink != "" {
+		args = append(args, "--sink", q.Sink)
+	}
+	opts, err := parseFlags(append(args, q.Flags...))
+	if err != nil {
+		return nil, "", err
+	}
+	if opts.command != "" || opts.watch > 0 || opts.incremental || opts.keysetColumn != "" {
+		return nil, "", errors.New("flags cannot select a command, --watch, --incremental or --keyset-column")
+	}
+	query, err := opts.resolveQuery()
+	if err != nil {
+		return nil, "", err
+	}
+	return opts, query, nil
+}
+
+// runSpec is the layout of the file run by "dbarrow run-spec".
+type runSpec struct {
+	Queries []struct {
+		Name      string `yaml:"name"`
+		querySpec `yaml:",inline"`
+	} `yaml:"queries"`
+}
+
+// specQuery is a query of a run spec ready to run.
+type specQuery struct {
+	name  string
+	opts  *cliOptions
+	query string
+}
+
+// loadSpec reads the run spec at path and parses the options of every query, so a
+// mistake in any of them is reported before the first one runs.
+func loadSpec(path, configPath string) ([]specQuery, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var spec runSpec
+	if err := yaml.Unmarshal(data, &spec); err != nil {
+		return nil, fmt.Errorf("unable to parse run spec %s: %w", path, err)
+	}
+	if len(spec.Queries) == 0 {
+		return nil, fmt.Errorf("run spec %s has no queries", path)
+	}
+	var queries []specQuery
+	seen := map[string]bool{}
+	for i, q := range spec.Queries {
+		name := q.Name
+		if name == "" {
+			name = fmt.Sprintf("query %d", i+1)
+		}
+		if seen[name] {
+			return nil, fmt.Errorf("run spec %s: query name %s is used twice", path, name)
+		}
+		seen[name] = true
+		opts, query, err := q.options(configPath)
+		if err != nil {
+			return nil, fmt.Errorf("run spec %s: %s: %w", path, name, err)
+		}
+		// The run draws a single progress line for all queries.
+		opts.progress = "never"
+		queries = append(queries, specQuery{name: name, opts: opts, query: query})
+	}
+	return queries, nil
+}
+
+// runSpecFile runs "run-spec <file>": the queries of the spec run side by side, up to
+// --parallel at a time, each on a connection of its own and written to its own output.
+// One progress line counts the rows of all of them. A query that fails does not stop the
+// others; the report at the end lists the outcome of each.
+func runSpecFile(ctx context.Context, client *arrowfetch.Client, opts *cliOptions, stats *runStats) error {
+	queries, err := loadSpec(opts.specFile, opts.configPath)
+	if err != nil {
+		return err
+	}
+	slog.Info("running queries", "queries", len(queries), "parallel", opts.parallel)
+
+	var (
+		bar *progress
+		mu  sync.Mutex // guards bar
+	)
+	if showProgress(opts.progress) {
+		bar = newProgress(os.Stderr, 0)
+		bar.prefix = fmt.Sprintf("0/%d queries", len(queries))
+	}
+	jobs := make([]batchJob, len(queries))
+	for i, q := range queries {
+		out := q.opts.out
+		if q.opts.sink != "" {
+			out = q.opts.sink
+		}
+		jobs[i] = batchJob{name: q.name, out: out, run: func(ctx context.Context, stats *runStats) error {
+			slog.Info("running", "query", q.name, "out", out)
+			return runSpecQuery(ctx, client, q, stats, func(rec arrow.Record) {
+				if bar != nil {
+					mu.Lock()
+					bar.add(rec.NumRows(), arrowfetch.RecordSize(rec))
+					mu.Unlock()
+				}
+			})
+		}}
+	}
+	results := runBatch(ctx, jobs, opts.parallel, stats, func(done int) {
+		if bar != nil {
+			mu.Lock()
+			bar.prefix = fmt.Sprintf("%d/%d queries", done, len(queries))
+			mu.Unlock()
+		}
+	})
+	if bar != nil {
+		bar.done()
+	}
+
+	if err := writeBatchReport(os.Stderr, results, "query", "queries", opts.summary); err != nil {
+		slog.Warn("unable to write the run report", "err", err)
+	}
+	return batchError(results, "queries")
+}
+
+// runSpecQuery runs one query of a run spec, a script on a session of its own, calling
+// onBatch with every batch read.
+func runSpecQuery(ctx context.Context, client *arrowfetch.Client, q specQuery, stats *runStats, onBatch func(arrow.Record)) error {
+	if statements := arrowfetch.SplitStatements(q.query); len(statements) > 1 {
+		return runScript(ctx, client, statements, q.opts, stats)
+	}
+	source := pipeline.SourceFunc(func(ctx context.Context, fn func(arrow.Record) error) error {
+		return client.Fetch(ctx, q.query, func(rec arrow.Record) error {
+			onBatch(rec)
+			return fn(rec)
+		}, q.opts.params.args()...)
+	})
+	return writeResult(ctx, client, q.opts, 0, source, stats)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch/arrowfetchtest"
+
+	"github.com/apache/arrow/go/v12/arrow"
+)
+
+func TestRunSpec(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "spec.yaml")
+	err := os.WriteFile(spec, []byte(`queries:
+  - name: a
+    query: SELECT a
+    format: csv
+    out: `+filepath.Join(dir, "a.csv")+`
+  - name: b
+    query: SELECT b
+    format: csv
+    out: `+filepath.Join(dir, "b.csv")+`
+  - name: broken
+    query: SELECT broken
+    format: csv
+    out: `+filepath.Join(dir, "broken.csv")+`
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := arrowfetchtest.NewClient(func(query string, _ []driver.NamedValue) ([]arrow.Record, error) {
+		if query == "SELECT broken" {
+			return nil, errors.New("table not found")
+		}
+		return arrowfetchtest.Batches(2, 3), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	opts, err := parseFlags([]string{"run-spec", spec, "--parallel", "2", "--progress", "never", "--summary", "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats runStats
+	err = runSpecFile(context.Background(), client, opts, &stats)
+	if err == nil || !strings.Contains(err.Error(), "1 of 3 queries failed") || !strings.Contains(err.Error(), "broken: unable to run the query: table not found") {
+		t.Errorf("got error %v, want the broken query to fail alone", err)
+	}
+	if stats.rows != 12 {
+		t.Errorf("got %d rows, want 12", stats.rows)
+	}
+	for _, name := range []string{"a.csv", "b.csv"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lines := strings.Count(string(data), "\n"); lines != 7 {
+			t.Errorf("%s has %d lines, want a header and 6 rows", name, lines)
+		}
+	}
+}
+
+func TestRunSpecInvalid(t *testing.T) {
+	dir := t.TempDir()
+	spec := filepath.Join(dir, "spec.yaml")
+	if err := os.WriteFile(spec, []byte("queries:\n  - name: a\n    query: SELECT 1\n    query_file: a.sql\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	_, err := loadSpec(spec, "")
+	if err == nil || !strings.Contains(err.Error(), "set one of query, query_file or saved_query") {
+		t.Errorf("got error %v", err)
+	}
+}
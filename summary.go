@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+)
+
+// warehouseMetricsTimeout bounds the wait for a statement to appear in the query history.
+const warehouseMetricsTimeout = 15 * time.Second
+
+// perfSummary describes where the time of one result went. Durations are in
+// milliseconds in the JSON form.
+type perfSummary struct {
+	QueryID string `json:"query_id,omitempty"`
+
+	// Client-side phases: execution runs from sending the query until its result is
+	// ready, so it includes any time queued on the warehouse.
+	ExecutionMs int64 `json:"execution_ms"`
+	FirstByteMs int64 `json:"first_byte_ms"`
+	FetchMs     int64 `json:"fetch_ms"`
+	TotalMs     int64 `json:"total_ms"`
+
+	Rows       int64   `json:"rows"`
+	Batches    int     `json:"batches"`
+	Bytes      int64   `json:"bytes"`
+	RowsPerSec float64 `json:"rows_per_sec"`
+
+	// Fetched is "cloud_fetch" when result files were downloaded from cloud storage while
+	// the result was read, with --cloud-fetch, and "inline" when the batches came in the
+	// responses of the warehouse.
+	Fetched         string `json:"fetched"`
+	CloudFetchFiles int64  `json:"cloud_fetch_files,omitempty"`
+	CloudFetchBytes int64  `json:"cloud_fetch_bytes,omitempty"`
+
+	// Warehouse measurements from the query history, with --warehouse-metrics.
+	Warehouse *warehouseSummary `json:"warehouse,omitempty"`
+}
+
+// warehouseSummary holds the warehouse's own timings of the statement.
+type warehouseSummary struct {
+	QueueMs       int64 `json:"queue_ms"`
+	CompilationMs int64 `json:"compilation_ms"`
+	ExecutionMs   int64 `json:"execution_ms"`
+	ResultFetchMs int64 `json:"result_fetch_ms"`
+	TotalMs       int64 `json:"total_ms"`
+	ReadBytes     int64 `json:"read_bytes"`
+	FromCache     bool  `json:"from_cache"`
+}
+
+// newPerfSummary combines the pipeline's counts with the phases of the query.
+func newPerfSummary(result pipeline.Stats, t *arrowfetch.Timings) *perfSummary {
+	s := &perfSummary{
+		QueryID:     t.QueryID,
+		ExecutionMs: t.Execution().Milliseconds(),
+		FirstByteMs: t.FirstByte().Milliseconds(),
+		FetchMs:     t.Fetch().Milliseconds(),
+		TotalMs:     result.Elapsed.Milliseconds(),
+		Rows:        result.Rows,
+		Batches:     result.Batches,
+		Bytes:       result.Bytes,
+	}
+	if secs := result.Elapsed.Seconds(); secs > 0 {
+		s.RowsPerSec = float64(result.Rows) / secs
+	}
+	return s
+}
+
+// addDownloads records the cloud fetch downloads made while the result was read. Queries
+// read side by side count each other's downloads.
+func (s *perfSummary) addDownloads(d downloadCount) {
+	s.Fetched = "inline"
+	if d.files > 0 {
+		s.Fetched, s.CloudFetchFiles, s.CloudFetchBytes = "cloud_fetch", d.files, d.bytes
+	}
+}
+
+// addWarehouseMetrics looks up the warehouse's timings of the query. A lookup that
+// fails only leaves them out of the summary.
+func (s *perfSummary) addWarehouseMetrics(ctx context.Context, client *arrowfetch.Client) {
+	if s.QueryID == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, warehouseMetricsTimeout)
+	defer cancel()
+	m, err := client.QueryMetrics(ctx, s.QueryID)
+	if err != nil {
+		slog.Warn("no warehouse metrics", "err", err)
+		return
+	}
+	s.Warehouse = &warehouseSummary{
+		QueueMs:       m.Queue.Milliseconds(),
+		CompilationMs: m.Compilation.Milliseconds(),
+		ExecutionMs:   m.Execution.Milliseconds(),
+		ResultFetchMs: m.ResultFetch.Milliseconds(),
+		TotalMs:       m.Total.Milliseconds(),
+		ReadBytes:     m.ReadBytes,
+		FromCache:     m.FromCache,
+	}
+}
+
+// write reports the summary: as log records for "text", following --log-format, or as
+// one JSON object on w for "json".
+func (s *perfSummary) write(w io.Writer, mode string) error {
+	if mode == "json" {
+		return json.NewEncoder(w).Encode(s)
+	}
+	slog.Info("result", "query_id", s.QueryID, "rows", s.Rows, "batches", s.Batches,
+		"bytes", s.Bytes, "size", formatBytes(s.Bytes), "rows_per_sec", math.Round(s.RowsPerSec), "fetched", s.Fetched)
+	if s.Fetched == "cloud_fetch" {
+		slog.Info("cloud fetch", "files", s.CloudFetchFiles, "bytes", s.CloudFetchBytes, "size", formatBytes(s.CloudFetchBytes))
+	}
+	slog.Info("timing", "total", ms(s.TotalMs), "execution", ms(s.ExecutionMs),
+		"first_batch", ms(s.FirstByteMs), "fetch", ms(s.FetchMs))
+	if wh := s.Warehouse; wh != nil {
+		slog.Info("warehouse", "queue", ms(wh.QueueMs), "compilation", ms(wh.CompilationMs),
+			"execution", ms(wh.ExecutionMs), "result_fetch", ms(wh.ResultFetchMs), "total", ms(wh.TotalMs),
+			"read_bytes", wh.ReadBytes, "from_cache", wh.FromCache)
+	}
+	return nil
+}
+
+// ms returns a duration given in milliseconds.
+func ms(n int64) time.Duration {
+	return time.Duration(n) * time.Millisecond
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracingShutdownTimeout bounds the final export of the spans when the run ends.
+const tracingShutdownTimeout = 5 * time.Second
+
+// setupTracing exports the spans of the run over OTLP/HTTP to endpoint, a URL such as
+// http://localhost:4318 or a host:port using HTTPS. With no endpoint, tracing is on only
+// when the standard OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+// variable is set, and the exporter then takes all its settings from the environment.
+// The returned function flushes the spans and must be called before the program exits;
+// calling it again does nothing.
+func setupTracing(ctx context.Context, endpoint string) (shutdown func(), err error) {
+	if endpoint == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" {
+		return func() {}, nil
+	}
+	var opts []otlptracehttp.Option
+	switch {
+	case strings.Contains(endpoint, "://"):
+		opts = append(opts, otlptracehttp.WithEndpointURL(endpoint))
+	case endpoint != "":
+		opts = append(opts, otlptracehttp.WithEndpoint(endpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, err
+	}
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the service name.
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", "dbarrow")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, err
+	}
+	provider := sdktrace.NewTracerProvider(sdktrace.WithBatcher(exporter), sdktrace.WithResource(res))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			ctx, cancel := context.WithTimeout(context.Background(), tracingShutdownTimeout)
+			defer cancel()
+			if err := provider.Shutdown(ctx); err != nil {
+				slog.Warn("unable to export the trace", "err", err)
+			}
+		})
+	}, nil
+}
+
+// startRunSpan starts the root span of the run. When the tool is started by a traced
+// job that sets TRACEPARENT (W3C Trace Context), the run joins that trace.
+func startRunSpan(ctx context.Context, opts *cliOptions) (context.Context, func(error)) {
+	if tp := os.Getenv("TRACEPARENT"); tp != "" {
+		ctx = propagation.TraceContext{}.Extract(ctx, propagation.MapCarrier{"traceparent": tp})
+	}
+	name := "dbarrow"
+	if opts.command != "" {
+		name += " " + opts.command
+	}
+	ctx, span := otel.Tracer("dbarrow").Start(ctx, name, trace.WithAttributes(
+		attribute.String("dbarrow.format", opts.format),
+		attribute.String("dbarrow.out", opts.out),
+		attribute.String("dbarrow.profile", opts.profile),
+	))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}
+}
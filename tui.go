@@ -0,0 +1,510 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+	"dbx_arrow_dbsql/pkg/sink"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const tuiHelp = "↑↓ row  PgUp/PgDn page  ←→ column  g/G first/last  s sort  / search  n/N next/previous  q quit"
+
+var (
+	tuiPlain    = lipgloss.NewStyle()
+	tuiHeader   = lipgloss.NewStyle().Bold(true)
+	tuiSelected = lipgloss.NewStyle().Reverse(true)
+	tuiStatus   = lipgloss.NewStyle().Faint(true)
+)
+
+// tuiCleaner keeps every value on a single line of the screen.
+var tuiCleaner = strings.NewReplacer("\r\n", " ", "\n", " ", "\r", " ", "\t", " ")
+
+// tuiBatch is a batch of the result as text, passed from the pipeline to the browser.
+// The last one has done set, and err if the query failed.
+type tuiBatch struct {
+	columns []string
+	numeric []bool
+	rows    [][]string
+	err     error
+	done    bool
+}
+
+// tuiWriter is the sink of the browser's pipeline. It hands every batch over as text
+// and waits until the browser takes it, so the result is only read as far as the user
+// scrolls.
+type tuiWriter struct {
+	ctx     context.Context
+	batches chan<- tuiBatch
+	null    *string
+}
+
+// Write formats rec and blocks until the browser asks for it.
+func (w *tuiWriter) Write(rec arrow.Record) error {
+	b := tuiBatch{rows: make([][]string, rec.NumRows())}
+	for _, f := range rec.Schema().Fields() {
+		id := f.Type.ID()
+		b.columns = append(b.columns, f.Name)
+		b.numeric = append(b.numeric, arrow.IsInteger(id) || arrow.IsFloating(id) || arrow.IsDecimal(id))
+	}
+	for i := range b.rows {
+		row := make([]string, rec.NumCols())
+		for j, col := range rec.Columns() {
+			if w.null != nil && col.IsNull(i) {
+				row[j] = *w.null
+			} else {
+				row[j] = sink.TextValue(col, i)
+			}
+		}
+		b.rows[i] = row
+	}
+	select {
+	case w.batches <- b:
+		return nil
+	case <-w.ctx.Done():
+		return w.ctx.Err()
+	}
+}
+
+// Close does nothing; the end of the result is sent once the pipeline returns.
+func (w *tuiWriter) Close() error { return nil }
+
+// runTUI browses the result of the query in the terminal. The transforms of the command
+// line apply as for any other output. The logs are held back while the browser owns the
+// screen and written once it exits.
+func runTUI(ctx context.Context, client *arrowfetch.Client, statements []string, opts *cliOptions, stats *runStats) error {
+	if len(statements) != 1 {
+		return errors.New("tui browses the result of a single statement")
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	batches := make(chan tuiBatch)
+	go func() {
+		p := pipeline.Pipeline{
+			Source:     pipeline.Query(client, statements[0], opts.params.args()...),
+			Transforms: transforms(opts),
+			Sink:       &tuiWriter{ctx: ctx, batches: batches, null: opts.nullString},
+		}
+		_, err := p.Run(ctx)
+		select {
+		case batches <- tuiBatch{err: err, done: true}:
+		case <-ctx.Done():
+		}
+	}()
+
+	var logs bytes.Buffer
+	restore := logOutput.set(&logs)
+	programOpts := []tea.ProgramOption{tea.WithAltScreen(), tea.WithContext(ctx)}
+	if stdinPiped() {
+		// The query came on stdin, so read the keys from the terminal.
+		programOpts = append(programOpts, tea.WithInputTTY())
+	}
+	m, err := tea.NewProgram(newBrowser(batches, opts.maxColWidth), programOpts...).Run()
+	restore()
+	os.Stderr.Write(logs.Bytes())
+	if err != nil {
+		if errors.Is(err, tea.ErrProgramKilled) && ctx.Err() != nil {
+			return nil // interrupted
+		}
+		return err
+	}
+	b := m.(*browser)
+	stats.rows += int64(len(b.rows))
+	return b.err
+}
+
+// browser is the bubbletea model of tui: a window of rows and columns over the part of
+// the result loaded so far, which grows as the user moves towards its end.
+type browser struct {
+	batches     <-chan tuiBatch
+	maxColWidth int
+
+	columns []string
+	numeric []bool
+	rows    [][]string
+	done    bool // every batch is loaded
+	loading bool // a batch has been asked for
+	err     error
+
+	width, height int
+	top, cursor   int // first row on screen and selected row
+	left, col     int // first column on screen and selected column
+
+	sortCol  int // -1 while in result order
+	sortDesc bool
+
+	searching bool   // the search is being typed
+	input     string // the search being typed
+	search    string // the last search
+	searchAt  int    // next row to search once more rows are loaded
+
+	// pending is what waits for more rows: "end" for G, "sort" to sort the whole result
+	// and "search" to continue the search at searchAt.
+	pending string
+	status  string
+}
+
+// newBrowser returns a browser of the batches received on batches.
+func newBrowser(batches <-chan tuiBatch, maxColWidth int) *browser {
+	return &browser{batches: batches, maxColWidth: maxColWidth, sortCol: -1}
+}
+
+// Init asks for the first batch.
+func (b *browser) Init() tea.Cmd {
+	return b.load()
+}
+
+// load returns the command receiving the next batch, or nil when one is already on its
+// way or the result is complete.
+func (b *browser) load() tea.Cmd {
+	if b.loading || b.done {
+		return nil
+	}
+	b.loading = true
+	batches := b.batches
+	return func() tea.Msg {
+		return <-batches
+	}
+}
+
+// pageSize is the number of rows on screen, below the header and above the status line.
+func (b *browser) pageSize() int {
+	return max(b.height-3, 1)
+}
+
+// Update handles a batch, a key or a new terminal size.
+func (b *browser) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		b.width, b.height = msg.Width, msg.Height
+	case tuiBatch:
+		b.receive(msg)
+	case tea.KeyMsg:
+		if b.searching {
+			b.typeSearch(msg)
+		} else if cmd := b.key(msg); cmd != nil {
+			return b, cmd
+		}
+	}
+	return b, b.resume()
+}
+
+// receive adds a batch to the rows loaded.
+func (b *browser) receive(batch tuiBatch) {
+	b.loading = false
+	if batch.done {
+		b.done, b.err = true, batch.err
+		if b.err != nil {
+			b.status = "error: " + b.err.Error()
+		}
+		return
+	}
+	if b.columns == nil {
+		b.columns, b.numeric = batch.columns, batch.numeric
+	}
+	b.rows = append(b.rows, batch.rows...)
+}
+
+// resume continues what waits for more rows once they are loaded, and loads the next
+// batch when the screen gets within a page of the end of the rows loaded.
+func (b *browser) resume() tea.Cmd {
+	switch b.pending {
+	case "end":
+		if b.done {
+			b.pending = ""
+			b.moveTo(len(b.rows) - 1)
+		}
+	case "sort":
+		if b.done {
+			b.pending = ""
+			b.sortRows()
+		}
+	case "search":
+		b.findNext()
+	}
+	if b.pending != "" || b.top+2*b.pageSize() >= len(b.rows) {
+		return b.load()
+	}
+	return nil
+}
+
+// key handles a key outside the search input, returning tea.Quit to leave.
+func (b *browser) key(msg tea.KeyMsg) tea.Cmd {
+	if b.err == nil {
+		b.status = ""
+	}
+	switch msg.String() {
+	case "q", "esc", "ctrl+c":
+		return tea.Quit
+	case "up", "k":
+		b.moveTo(b.cursor - 1)
+	case "down", "j":
+		b.moveTo(b.cursor + 1)
+	case "pgup", "b", "ctrl+b":
+		b.top = max(b.top-b.pageSize(), 0)
+		b.moveTo(b.cursor - b.pageSize())
+	case "pgdown", " ", "f", "ctrl+f":
+		b.top = max(min(b.top+b.pageSize(), len(b.rows)-b.pageSize()), 0)
+		b.moveTo(b.cursor + b.pageSize())
+	case "home", "g":
+		b.moveTo(0)
+	case "end", "G":
+		b.pending, b.status = "end", "loading the rest of the result…"
+	case "left", "h":
+		b.col = max(b.col-1, 0)
+	case "right", "l":
+		b.col = min(b.col+1, max(len(b.columns)-1, 0))
+	case "s":
+		if len(b.columns) == 0 {
+			break
+		}
+		// Sorting the same column again reverses the order.
+		b.sortDesc = b.sortCol == b.col && !b.sortDesc
+		b.sortCol = b.col
+		b.pending, b.status = "sort", "loading the rest of the result to sort it…"
+	case "/":
+		b.searching, b.input = true, ""
+	case "n":
+		if b.search != "" {
+			b.searchAt, b.pending = b.cursor+1, "search"
+		}
+	case "N":
+		b.findPrevious()
+	}
+	return nil
+}
+
+// typeSearch edits the search being typed; Enter starts it and Esc cancels it.
+func (b *browser) typeSearch(msg tea.KeyMsg) {
+	switch msg.Type {
+	case tea.KeyEnter:
+		b.searching = false
+		if b.input != "" {
+			b.search, b.searchAt, b.pending = strings.ToLower(b.input), b.cursor, "search"
+		}
+	case tea.KeyEsc, tea.KeyCtrlC:
+		b.searching = false
+	case tea.KeyBackspace:
+		if _, size := utf8.DecodeLastRuneInString(b.input); size > 0 {
+			b.input = b.input[:len(b.input)-size]
+		}
+	case tea.KeyRunes, tea.KeySpace:
+		b.input += string(msg.Runes)
+	}
+}
+
+// findNext moves to the first row from searchAt containing the search, ignoring case.
+// It keeps searching as batches arrive, and gives up at the end of the result.
+func (b *browser) findNext() {
+	for ; b.searchAt < len(b.rows); b.searchAt++ {
+		if b.matches(b.searchAt) {
+			b.pending = ""
+			b.moveTo(b.searchAt)
+			return
+		}
+	}
+	if b.done {
+		b.pending, b.status = "", fmt.Sprintf("no more rows containing %q", b.search)
+	} else {
+		b.status = fmt.Sprintf("searching for %q…", b.search)
+	}
+}
+
+// findPrevious moves to the nearest row above the cursor containing the search.
+func (b *browser) findPrevious() {
+	if b.search == "" {
+		return
+	}
+	for i := b.cursor - 1; i >= 0; i-- {
+		if b.matches(i) {
+			b.moveTo(i)
+			return
+		}
+	}
+	b.status = fmt.Sprintf("no earlier rows containing %q", b.search)
+}
+
+// matches reports whether a value of row i contains the search.
+func (b *browser) matches(i int) bool {
+	for _, v := range b.rows[i] {
+		if strings.Contains(strings.ToLower(v), b.search) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortRows sorts the rows by the selected column, numbers by value. The sort is
+// stable, so sorting by one column and then another orders rows by both.
+func (b *browser) sortRows() {
+	j := b.sortCol
+	slices.SortStableFunc(b.rows, func(x, y []string) int {
+		c := cmp.Compare(x[j], y[j])
+		if b.numeric[j] {
+			c = compareNumbers(x[j], y[j])
+		}
+		if b.sortDesc {
+			return -c
+		}
+		return c
+	})
+	b.moveTo(0)
+}
+
+// compareNumbers orders two numbers as written, with values that are not numbers,
+// such as NULL, after them.
+func compareNumbers(x, y string) int {
+	fx, errx := strconv.ParseFloat(x, 64)
+	fy, erry := strconv.ParseFloat(y, 64)
+	switch {
+	case errx != nil && erry != nil:
+		return cmp.Compare(x, y)
+	case errx != nil:
+		return 1
+	case erry != nil:
+		return -1
+	}
+	return cmp.Compare(fx, fy)
+}
+
+// moveTo selects row i, kept within the rows loaded, and scrolls it into view.
+func (b *browser) moveTo(i int) {
+	b.cursor = max(min(i, len(b.rows)-1), 0)
+	if b.cursor < b.top {
+		b.top = b.cursor
+	} else if b.cursor >= b.top+b.pageSize() {
+		b.top = b.cursor - b.pageSize() + 1
+	}
+}
+
+// View draws the header, the rows on screen and the status line.
+func (b *browser) View() string {
+	if b.width == 0 {
+		return ""
+	}
+	end := min(b.top+b.pageSize(), len(b.rows))
+	visible := b.rows[b.top:end]
+
+	// Size the columns to the values on screen, and scroll the selected one into view.
+	widths := make([]int, len(b.columns))
+	for j, name := range b.columns {
+		widths[j] = utf8.RuneCountInString(b.clip(name))
+		for _, row := range visible {
+			widths[j] = max(widths[j], utf8.RuneCountInString(b.clip(row[j])))
+		}
+	}
+	b.left = min(b.left, b.col)
+	for b.left < b.col && !b.fits(widths[b.left:b.col+1]) {
+		b.left++
+	}
+
+	var s strings.Builder
+	s.WriteString(b.line(b.columns, widths, func(j int) lipgloss.Style {
+		// The header marks the selected column, which s sorts by.
+		if j == b.col {
+			return tuiSelected
+		}
+		return tuiHeader
+	}))
+	s.WriteString("\n")
+	s.WriteString(tuiStatus.Render(strings.Repeat("─", b.width)))
+	s.WriteString("\n")
+	for i, row := range visible {
+		style := tuiPlain
+		if b.top+i == b.cursor {
+			style = tuiSelected
+		}
+		s.WriteString(b.line(row, widths, func(int) lipgloss.Style { return style }))
+		s.WriteString("\n")
+	}
+	for i := len(visible); i < b.pageSize(); i++ {
+		s.WriteString("\n")
+	}
+	s.WriteString(tuiStatus.Render(b.statusLine()))
+	return s.String()
+}
+
+// fits reports whether columns of the widths fit on one line.
+func (b *browser) fits(widths []int) bool {
+	total := 0
+	for _, w := range widths {
+		total += w + 2
+	}
+	return total <= b.width
+}
+
+// line draws the cells from the first column on screen that fit the width, padded to
+// the column widths and drawn in the style of their column.
+func (b *browser) line(cells []string, widths []int, style func(j int) lipgloss.Style) string {
+	var s strings.Builder
+	used := 0
+	for j := b.left; j < len(cells) && used < b.width; j++ {
+		cell := b.clip(cells[j])
+		pad := strings.Repeat(" ", widths[j]-utf8.RuneCountInString(cell))
+		if b.numeric[j] {
+			cell = pad + cell
+		} else {
+			cell += pad
+		}
+		if room := b.width - used; widths[j] > room {
+			cell = string([]rune(cell)[:room])
+		}
+		used += widths[j] + 2
+		s.WriteString(style(j).Render(cell))
+		if used <= b.width {
+			s.WriteString("  ")
+		}
+	}
+	return s.String()
+}
+
+// clip flattens a value to one line and truncates it to --max-col-width.
+func (b *browser) clip(s string) string {
+	s = tuiCleaner.Replace(s)
+	if b.maxColWidth <= 0 || utf8.RuneCountInString(s) <= b.maxColWidth {
+		return s
+	}
+	if b.maxColWidth == 1 {
+		return "…"
+	}
+	return string([]rune(s)[:b.maxColWidth-1]) + "…"
+}
+
+// statusLine describes the position in the result, or shows the search being typed.
+func (b *browser) statusLine() string {
+	if b.searching {
+		return "/" + b.input
+	}
+	total := strconv.Itoa(len(b.rows))
+	if !b.done {
+		total += "+"
+	}
+	parts := []string{fmt.Sprintf("row %d of %s", min(b.cursor+1, len(b.rows)), total)}
+	if b.sortCol >= 0 && b.pending != "sort" {
+		order := "ascending"
+		if b.sortDesc {
+			order = "descending"
+		}
+		parts = append(parts, fmt.Sprintf("sorted by %s, %s", b.columns[b.sortCol], order))
+	}
+	if b.status != "" {
+		parts = append(parts, b.status)
+	} else {
+		parts = append(parts, tuiHelp)
+	}
+	return strings.Join(parts, " │ ")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"slices"
+	"testing"
+
+	tea "github.com/charmbracelet/bubbletea"
+)
+
+// browse returns a browser of the given batches, on a screen of five rows, after
+// handling keys. A batch is only sent when the browser asks for it.
+func browse(t *testing.T, batches []tuiBatch, keys ...tea.KeyMsg) (*browser, int) {
+	t.Helper()
+	ch := make(chan tuiBatch)
+	sent := 0
+	b := newBrowser(ch, 40)
+	// run executes the command of an update, sending the next batch if it asks for one.
+	var run func(cmd tea.Cmd)
+	run = func(cmd tea.Cmd) {
+		if cmd == nil {
+			return
+		}
+		go func() {
+			if sent < len(batches) {
+				ch <- batches[sent]
+			} else {
+				ch <- tuiBatch{done: true}
+			}
+		}()
+		msg := cmd()
+		sent++
+		_, next := b.Update(msg)
+		run(next)
+	}
+	_, cmd := b.Update(tea.WindowSizeMsg{Width: 80, Height: 8})
+	run(cmd)
+	for _, k := range keys {
+		_, cmd := b.Update(k)
+		run(cmd)
+	}
+	return b, sent
+}
+
+// tuiRows returns a batch of one numeric column with the values.
+func tuiRows(values ...string) tuiBatch {
+	b := tuiBatch{columns: []string{"n"}, numeric: []bool{true}}
+	for _, v := range values {
+		b.rows = append(b.rows, []string{v})
+	}
+	return b
+}
+
+func runes(s string) tea.KeyMsg {
+	return tea.KeyMsg{Type: tea.KeyRunes, Runes: []rune(s)}
+}
+
+func TestBrowserLoadsLazily(t *testing.T) {
+	batches := []tuiBatch{tuiRows("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11")}
+	for i := 0; i < 5; i++ {
+		batches = append(batches, tuiRows("12", "13", "14", "15", "16", "17", "18", "19", "20", "21"))
+	}
+	b, sent := browse(t, batches)
+	if sent != 1 || len(b.rows) != 11 {
+		t.Errorf("got %d batches and %d rows before scrolling, want the first batch only", sent, len(b.rows))
+	}
+	b, _ = browse(t, batches, runes("G"))
+	if !b.done || b.cursor != len(b.rows)-1 || len(b.rows) != 61 {
+		t.Errorf("got cursor %d of %d rows, done %v after G, want the last of 61", b.cursor, len(b.rows), b.done)
+	}
+}
+
+func TestBrowserSortsNumbers(t *testing.T) {
+	b, _ := browse(t, []tuiBatch{tuiRows("10", "NULL", "9"), tuiRows("-1", "100")}, runes("s"))
+	var got []string
+	for _, row := range b.rows {
+		got = append(got, row[0])
+	}
+	if want := []string{"-1", "9", "10", "100", "NULL"}; !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestBrowserSearchLoadsBatches(t *testing.T) {
+	batches := []tuiBatch{
+		tuiRows("1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "11"),
+		tuiRows("12", "13"),
+		tuiRows("24", "25"),
+	}
+	keys := []tea.KeyMsg{runes("/"), runes("2"), runes("5"), {Type: tea.KeyEnter}}
+	b, _ := browse(t, batches, keys...)
+	if b.cursor != 14 || b.rows[b.cursor][0] != "25" {
+		t.Errorf("got row %d, want the row of 25", b.cursor)
+	}
+	b, _ = browse(t, batches, append(keys, runes("n"))...)
+	if b.cursor != 14 || b.status == "" {
+		t.Errorf("got row %d and status %q, want no more matches", b.cursor, b.status)
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"dbx_arrow_dbsql/pkg/remote"
+
+	"github.com/apache/arrow/go/v12/parquet/file"
+)
+
+// manifestName is the manifest "verify" looks for in an export directory.
+const manifestName = "_manifest.json"
+
+// runVerify runs "verify <manifest or directory>": every file listed in the manifest of
+// an export, --manifest, is checked to exist with the recorded size and SHA-256
+// checksum, and for Parquet the row count in its footer. The file rows must add up to
+// the total of the manifest. Relative paths are looked up in the directory of the
+// manifest, so an export can be verified from anywhere after it was moved; files
+// uploaded to object storage are not checked.
+func runVerify(args []string) error {
+	set := flag.NewFlagSet("dbarrow verify", flag.ContinueOnError)
+	quiet := set.Bool("quiet", false, "only report the files that fail")
+	if err := set.Parse(args); err != nil {
+		return err
+	}
+	if set.NArg() != 1 {
+		return errors.New("usage: dbarrow verify [--quiet] <manifest.json | export directory>")
+	}
+	path := set.Arg(0)
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		path = filepath.Join(path, manifestName)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var m manifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return fmt.Errorf("%s is not a manifest: %w", path, err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "FILE\tSTATUS\tROWS\tBYTES\tERROR")
+	var rows int64
+	failed, skipped := 0, 0
+	for _, f := range m.Files {
+		rows += f.Rows
+		status, problem := "ok", verifyFile(f, filepath.Dir(path), m.Format)
+		switch {
+		case remote.IsRemote(f.Path):
+			status, problem = "skipped", "not a local file"
+			skipped++
+		case problem != "":
+			status = "failed"
+			failed++
+		}
+		if !*quiet || status == "failed" {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", f.Path, status, f.Rows, f.Bytes, problem)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if rows != m.Rows {
+		return fmt.Errorf("the files hold %d rows, the manifest %d", rows, m.Rows)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d files failed verification", failed, len(m.Files))
+	}
+	fmt.Fprintf(os.Stderr, "%d files verified, %d skipped, %d rows\n", len(m.Files)-skipped, skipped, m.Rows)
+	return nil
+}
+
+// verifyFile checks one local file against the manifest in dir, returning what is
+// wrong with it or "" when nothing is.
+func verifyFile(f *manifestFile, dir, format string) string {
+	if remote.IsRemote(f.Path) {
+		return ""
+	}
+	path := filepath.FromSlash(f.Path)
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	size, sum, err := hashFile(path)
+	switch {
+	case err != nil:
+		return err.Error()
+	case size != f.Bytes:
+		return fmt.Sprintf("size %d, recorded %d", size, f.Bytes)
+	case f.SHA256 != "" && sum != f.SHA256:
+		return "SHA-256 checksum differs"
+	}
+	// A worker part that received no rows is empty, without a footer.
+	if format == "parquet" && size > 0 {
+		r, err := file.OpenParquetFile(path, false)
+		if err != nil {
+			return err.Error()
+		}
+		defer r.Close()
+		if n := r.NumRows(); n != f.Rows {
+			return fmt.Sprintf("%d rows, recorded %d", n, f.Rows)
+		}
+	}
+	return ""
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"time"
+
+	"dbx_arrow_dbsql/pkg/arrowfetch"
+	"dbx_arrow_dbsql/pkg/pipeline"
+
+	"golang.org/x/term"
+)
+
+// clearScreen moves the cursor home and clears the terminal, as watch(1) does between
+// runs.
+const clearScreen = "\x1b[H\x1b[2J"
+
+// watchCell is a value's position in a result, its row and column.
+type watchCell struct {
+	row    int64
+	column string
+}
+
+// runWatch runs the query for --watch at every interval until interrupted. On a terminal
+// the screen is redrawn for each run, and the table format highlights the values that
+// differ from the previous run at the same row and column. Otherwise every run is
+// written after the last: --out gets a file per run numbered by {n}, and --sink appends
+// them. A failed first run ends the watch; later failures are logged and the query runs
+// again at the next interval.
+func runWatch(ctx context.Context, client *arrowfetch.Client, statements []string, opts *cliOptions, stats *runStats) error {
+	if len(statements) != 1 {
+		return errors.New("--watch re-runs a single query, not a script")
+	}
+	query := statements[0]
+	redraw := opts.sink == "" && opts.out == "-" && term.IsTerminal(int(os.Stdout.Fd()))
+	title, _, _ := strings.Cut(query, "\n")
+
+	ticker := time.NewTicker(opts.watch)
+	defer ticker.Stop()
+	var previous map[watchCell]string
+	for n := 0; ; n++ {
+		runOpts := *opts
+		current := map[watchCell]string{}
+		if redraw {
+			fmt.Fprintf(os.Stdout, "%sEvery %s: %s    %s\n\n", clearScreen, opts.watch, title, time.Now().Format(time.DateTime))
+			runOpts.highlight = func(row int64, column, value string) bool {
+				current[watchCell{row, column}] = value
+				old, ok := previous[watchCell{row, column}]
+				return previous != nil && (!ok || old != value)
+			}
+		}
+		err := writeResult(ctx, client, &runOpts, n, pipeline.Query(client, query, opts.params.args()...), stats)
+		switch {
+		case err != nil && n == 0:
+			return err
+		case err != nil:
+			slog.Error("the query failed, running it again at the next interval", "run", n, "err", err)
+		default:
+			previous = current
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}